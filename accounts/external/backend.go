@@ -17,9 +17,11 @@
 package external
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts"
@@ -64,6 +66,7 @@ type ExternalSigner struct {
 	client   *rpc.Client
 	endpoint string
 	status   string
+	timeout  time.Duration // Timeout of the requests to the signer, zero meaning no timeout
 	cacheMu  sync.RWMutex
 	cache    []accounts.Account
 }
@@ -86,6 +89,23 @@ func NewExternalSigner(endpoint string) (*ExternalSigner, error) {
 	return extsigner, nil
 }
 
+// SetTimeout sets the time the signer is given to respond to a request, after
+// which the request is abandoned. Zero disables the timeout.
+func (api *ExternalSigner) SetTimeout(timeout time.Duration) {
+	api.timeout = timeout
+}
+
+// call performs a request to the signer, respecting the configured timeout.
+func (api *ExternalSigner) call(result interface{}, method string, args ...interface{}) error {
+	ctx := context.Background()
+	if api.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, api.timeout)
+		defer cancel()
+	}
+	return api.client.CallContext(ctx, result, method, args...)
+}
+
 func (api *ExternalSigner) URL() accounts.URL {
 	return accounts.URL{
 		Scheme: "extapi",
@@ -160,15 +180,18 @@ func (api *ExternalSigner) signHash(account accounts.Account, hash []byte) ([]by
 func (api *ExternalSigner) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
 	var res hexutil.Bytes
 	var signAddress = common.NewMixedcaseAddress(account.Address)
-	if err := api.client.Call(&res, "account_signData",
+	if err := api.call(&res, "account_signData",
 		mimeType,
 		&signAddress, // Need to use the pointer here, because of how MarshalJSON is defined
 		hexutil.Encode(data)); err != nil {
 		return nil, err
 	}
-	// If V is on 27/28-form, convert to 0/1 for Clique
-	if mimeType == accounts.MimetypeClique && (res[64] == 27 || res[64] == 28) {
-		res[64] -= 27 // Transform V from 27/28 to 0/1 for Clique use
+	// If V is on 27/28-form, convert to 0/1 for Clique and Parlia
+	switch mimeType {
+	case accounts.MimetypeClique, accounts.MimetypeParlia, accounts.MimetypeParliaVote:
+		if res[64] == 27 || res[64] == 28 {
+			res[64] -= 27 // Transform V from 27/28 to 0/1 for Clique and Parlia use
+		}
 	}
 	return res, nil
 }
@@ -176,7 +199,7 @@ func (api *ExternalSigner) SignData(account accounts.Account, mimeType string, d
 func (api *ExternalSigner) SignText(account accounts.Account, text []byte) ([]byte, error) {
 	var signature hexutil.Bytes
 	var signAddress = common.NewMixedcaseAddress(account.Address)
-	if err := api.client.Call(&signature, "account_signData",
+	if err := api.call(&signature, "account_signData",
 		accounts.MimetypeTextPlain,
 		&signAddress, // Need to use the pointer here, because of how MarshalJSON is defined
 		hexutil.Encode(text)); err != nil {
@@ -239,7 +262,7 @@ func (api *ExternalSigner) SignTx(account accounts.Account, tx *types.Transactio
 		args.AccessList = &accessList
 	}
 	var res signTransactionResult
-	if err := api.client.Call(&res, "account_signTransaction", args); err != nil {
+	if err := api.call(&res, "account_signTransaction", args); err != nil {
 		return nil, err
 	}
 	return res.Tx, nil
@@ -258,7 +281,7 @@ func (api *ExternalSigner) SignDataWithPassphrase(account accounts.Account, pass
 
 func (api *ExternalSigner) listAccounts() ([]common.Address, error) {
 	var res []common.Address
-	if err := api.client.Call(&res, "account_list"); err != nil {
+	if err := api.call(&res, "account_list"); err != nil {
 		return nil, err
 	}
 	return res, nil
@@ -266,7 +289,7 @@ func (api *ExternalSigner) listAccounts() ([]common.Address, error) {
 
 func (api *ExternalSigner) pingVersion() (string, error) {
 	var v string
-	if err := api.client.Call(&v, "account_version"); err != nil {
+	if err := api.call(&v, "account_version"); err != nil {
 		return "", err
 	}
 	return v, nil
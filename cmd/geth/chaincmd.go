@@ -38,10 +38,12 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/era"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/p2p/enode"
+	"github.com/ethereum/go-ethereum/trie"
 	"gopkg.in/urfave/cli.v1"
 )
 
@@ -53,6 +55,7 @@ var (
 		ArgsUsage: "<genesisPath>",
 		Flags: []cli.Flag{
 			utils.DataDirFlag,
+			utils.StateSchemeFlag,
 		},
 		Category: "BLOCKCHAIN COMMANDS",
 		Description: `
@@ -151,6 +154,71 @@ Optional second and third arguments control the first and
 last block to write. In this mode, the file will be appended
 if already existing. If the file ends with .gz, the output will
 be gzipped.`,
+	}
+	historyCommand = cli.Command{
+		Name:      "history",
+		Usage:     "Export and import chain history as era1 archives",
+		ArgsUsage: "",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Subcommands: []cli.Command{
+			historyExportCommand,
+			historyImportCommand,
+		},
+	}
+	historyExportCommand = cli.Command{
+		Action:    utils.MigrateFlags(exportHistory),
+		Name:      "export",
+		Usage:     "Export chain history into era1 archives",
+		ArgsUsage: "<dir> [<blockNumFirst> <blockNumLast>]",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.MainnetFlag,
+			utils.PulseChainFlag,
+			utils.PulseChainTestnetFlag,
+			utils.RopstenFlag,
+			utils.SepoliaFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+Requires a first argument of the directory to write the archives to.
+Every archive holds the headers, bodies, receipts and total difficulties
+of 8192 blocks along with their accumulator root. Optional second and
+third arguments control the first and last block to write and must span
+complete archives; by default all complete archives up to the head are
+exported. The checksums of the archives are written to checksums.txt and
+their accumulator roots to roots.txt.`,
+	}
+	historyImportCommand = cli.Command{
+		Action:    utils.MigrateFlags(importHistory),
+		Name:      "import",
+		Usage:     "Import chain history from era1 archives",
+		ArgsUsage: "<dir>",
+		Flags: []cli.Flag{
+			utils.DataDirFlag,
+			utils.AncientFlag,
+			utils.CacheFlag,
+			utils.HistoryRootsFlag,
+			utils.MainnetFlag,
+			utils.PulseChainFlag,
+			utils.PulseChainTestnetFlag,
+			utils.RopstenFlag,
+			utils.SepoliaFlag,
+			utils.RinkebyFlag,
+			utils.GoerliFlag,
+		},
+		Category: "BLOCKCHAIN COMMANDS",
+		Description: `
+The import command writes the era1 archives listed in checksums.txt of the
+given directory straight into the ancient store. Every archive is verified
+against its checksum and accumulator root, and must extend the local chain.
+Archives are refused unless their accumulator root is listed in the file
+passed with --history.roots, which has to come from a trusted source rather
+than along with the archives. The node has to be freshly initialized or only
+hold ancient history.`,
 	}
 	importPreimagesCommand = cli.Command{
 		Action:    utils.MigrateFlags(importPreimages),
@@ -233,6 +301,7 @@ func initGenesis(ctx *cli.Context) error {
 		if err != nil {
 			utils.Fatalf("Failed to open database: %v", err)
 		}
+		utils.ParseStateScheme(ctx, chaindb)
 		_, hash, err := core.SetupGenesisBlock(chaindb, genesis)
 		if err != nil {
 			utils.Fatalf("Failed to write genesis block: %v", err)
@@ -466,6 +535,95 @@ func exportChain(ctx *cli.Context) error {
 	return nil
 }
 
+// exportHistory exports complete epochs of the chain history into era1 archives.
+func exportHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 && len(ctx.Args()) != 3 {
+		utils.Fatalf("This command requires one or three arguments.")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, true)
+	defer db.Close()
+
+	head := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadFastBlockHash(db))
+	if head == nil {
+		utils.Fatalf("Export error: no head block found")
+	}
+	var first, last uint64
+	if len(ctx.Args()) == 1 {
+		if *head+1 < era.MaxSize {
+			utils.Fatalf("Export error: chain shorter than a single archive of %d blocks\n", era.MaxSize)
+		}
+		last = (*head+1)/era.MaxSize*era.MaxSize - 1
+	} else {
+		var ferr, lerr error
+		first, ferr = strconv.ParseUint(ctx.Args().Get(1), 10, 64)
+		last, lerr = strconv.ParseUint(ctx.Args().Get(2), 10, 64)
+		if ferr != nil || lerr != nil {
+			utils.Fatalf("Export error in parsing parameters: block number not an integer\n")
+		}
+		if last > *head {
+			utils.Fatalf("Export error: block number %d larger than head block %d\n", last, *head)
+		}
+	}
+	start := time.Now()
+	if err := utils.ExportHistory(db, ctx.Args().First(), historyNetwork(ctx), first, last); err != nil {
+		utils.Fatalf("Export error: %v\n", err)
+	}
+	fmt.Printf("Export done in %v\n", time.Since(start))
+	return nil
+}
+
+// importHistory imports era1 archives straight into the ancient store.
+func importHistory(ctx *cli.Context) error {
+	if len(ctx.Args()) != 1 {
+		utils.Fatalf("This command requires an argument.")
+	}
+	if !ctx.GlobalIsSet(utils.HistoryRootsFlag.Name) {
+		utils.Fatalf("The trusted accumulator roots are required (--%s)", utils.HistoryRootsFlag.Name)
+	}
+	trusted, err := utils.ReadHistoryRoots(ctx.GlobalString(utils.HistoryRootsFlag.Name))
+	if err != nil {
+		utils.Fatalf("Failed to read trusted accumulator roots: %v", err)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	db := utils.MakeChainDatabase(ctx, stack, false)
+	defer db.Close()
+
+	if _, _, err := core.SetupGenesisBlock(db, utils.MakeGenesis(ctx)); err != nil {
+		utils.Fatalf("Failed to setup genesis block: %v", err)
+	}
+	start := time.Now()
+	if err := utils.ImportHistory(db, ctx.Args().First(), trusted); err != nil {
+		utils.Fatalf("Import error: %v", err)
+	}
+	fmt.Printf("Import done in %v\n", time.Since(start))
+	return nil
+}
+
+// historyNetwork returns the network name used in era1 archive file names.
+func historyNetwork(ctx *cli.Context) string {
+	switch {
+	case ctx.GlobalBool(utils.PulseChainFlag.Name):
+		return "pulsechain"
+	case ctx.GlobalBool(utils.PulseChainTestnetFlag.Name):
+		return "pulsechain-testnet"
+	case ctx.GlobalBool(utils.RopstenFlag.Name):
+		return "ropsten"
+	case ctx.GlobalBool(utils.SepoliaFlag.Name):
+		return "sepolia"
+	case ctx.GlobalBool(utils.RinkebyFlag.Name):
+		return "rinkeby"
+	case ctx.GlobalBool(utils.GoerliFlag.Name):
+		return "goerli"
+	default:
+		return "mainnet"
+	}
+}
+
 // importPreimages imports preimage data from the specified file.
 func importPreimages(ctx *cli.Context) error {
 	if len(ctx.Args()) < 1 {
@@ -569,7 +727,7 @@ func dump(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	state, err := state.New(root, state.NewDatabase(db), nil)
+	state, err := state.New(root, state.NewDatabaseWithConfig(db, &trie.Config{Preimages: true, Scheme: rawdb.ReadStateScheme(db)}), nil)
 	if err != nil {
 		return err
 	}
@@ -65,6 +65,7 @@ var (
 		utils.BootnodesFlag,
 		utils.DataDirFlag,
 		utils.AncientFlag,
+		utils.DBEngineFlag,
 		utils.MinFreeDiskSpaceFlag,
 		utils.KeyStoreDirFlag,
 		utils.ExternalSignerFlag,
@@ -72,6 +73,7 @@ var (
 		utils.USBFlag,
 		utils.DirectBroadcastFlag,
 		utils.RangeLimitFlag,
+		utils.ParliaHistoryFlag,
 		utils.SmartCardDaemonPathFlag,
 		utils.OverrideArrowGlacierFlag,
 		utils.OverrideTerminalTotalDifficulty,
@@ -87,6 +89,11 @@ var (
 		utils.TxPoolNoLocalsFlag,
 		utils.TxPoolJournalFlag,
 		utils.TxPoolRejournalFlag,
+		utils.TxPoolSnapshotFlag,
+		utils.TxPoolSnapshotMaxAgeFlag,
+		utils.TxPoolSnapshotMaxTxsFlag,
+		utils.TxPoolDropHistoryFlag,
+		utils.TxPoolDropJournalFlag,
 		utils.TxPoolPriceLimitFlag,
 		utils.TxPoolPriceBumpFlag,
 		utils.TxPoolAccountSlotsFlag,
@@ -97,8 +104,10 @@ var (
 		utils.SyncModeFlag,
 		utils.ExitWhenSyncedFlag,
 		utils.GCModeFlag,
+		utils.StateSchemeFlag,
 		utils.SnapshotFlag,
 		utils.TxLookupLimitFlag,
+		utils.HistoryRetainFlag,
 		utils.LightServeFlag,
 		utils.LightIngressFlag,
 		utils.LightEgressFlag,
@@ -134,6 +143,11 @@ var (
 		utils.MinerRecommitIntervalFlag,
 		utils.MinerDelayLeftoverFlag,
 		utils.MinerNoVerifyFlag,
+		utils.MinerSignerFlag,
+		utils.MinerOrderingFlag,
+		utils.MinerOrderingReserveFlag,
+		utils.MinerOrderingPriorityFlag,
+		utils.MinerOrderingAgeFlag,
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
@@ -147,6 +161,7 @@ var (
 		utils.PulseChainFlag,
 		utils.PulseChainTestnetFlag,
 		utils.DeveloperGasLimitFlag,
+		utils.DeveloperParliaFlag,
 		utils.RopstenFlag,
 		utils.SepoliaFlag,
 		utils.RinkebyFlag,
@@ -220,6 +235,7 @@ func init() {
 		initNetworkCommand,
 		importCommand,
 		exportCommand,
+		historyCommand,
 		importPreimagesCommand,
 		exportPreimagesCommand,
 		removedbCommand,
@@ -246,6 +262,8 @@ func init() {
 		utils.ShowDeprecated,
 		// See snapshot.go
 		snapshotCommand,
+		// See pulsecmd.go
+		pulseCommand,
 	}
 	sort.Sort(cli.CommandsByName(app.Commands))
 
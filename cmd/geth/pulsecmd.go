@@ -0,0 +1,362 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/parlia"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	creditsFormatFlag = cli.StringFlag{
+		Name:  "format",
+		Usage: "Export format of the sacrifice credits (csv or json)",
+		Value: "csv",
+	}
+	creditsOutputFlag = cli.StringFlag{
+		Name:  "output",
+		Usage: "File to export the sacrifice credits into (default = stdout)",
+	}
+)
+
+var (
+	pulseCommand = cli.Command{
+		Name:      "pulse",
+		Usage:     "A set of commands for the PulseChain specific data",
+		ArgsUsage: "",
+		Category:  "MISCELLANEOUS COMMANDS",
+		Subcommands: []cli.Command{
+			{
+				Name:      "credits",
+				Usage:     "Inspect the sacrifice credits awarded at the PrimordialPulse fork",
+				ArgsUsage: "",
+				Category:  "MISCELLANEOUS COMMANDS",
+				Subcommands: []cli.Command{
+					{
+						Name:      "lookup",
+						Usage:     "Print the sacrifice credits of the given addresses",
+						ArgsUsage: "<address> [<address> ...]",
+						Action:    utils.MigrateFlags(lookupCredits),
+						Category:  "MISCELLANEOUS COMMANDS",
+						Description: `
+geth pulse credits lookup <address> [<address> ...]
+prints the total sacrifice credit awarded to every given address at the
+PrimordialPulse fork, along with the number of credit records.`,
+					},
+					{
+						Name:     "totals",
+						Usage:    "Print the totals of the sacrifice credits",
+						Action:   utils.MigrateFlags(creditTotals),
+						Category: "MISCELLANEOUS COMMANDS",
+						Description: `
+geth pulse credits totals
+prints the number of credit records, the number of credited addresses and
+the total amount credited at the PrimordialPulse fork.`,
+					},
+					{
+						Name:     "export",
+						Usage:    "Export the sacrifice credits",
+						Action:   utils.MigrateFlags(exportCredits),
+						Category: "MISCELLANEOUS COMMANDS",
+						Flags: []cli.Flag{
+							creditsFormatFlag,
+							creditsOutputFlag,
+						},
+						Description: `
+geth pulse credits export [--format csv|json] [--output <file>]
+exports every sacrifice credit record in the order the records are applied
+at the PrimordialPulse fork, with the amounts in wei.`,
+					},
+					{
+						Name:     "verify",
+						Usage:    "Verify the sacrifice credits against the historical state",
+						Action:   utils.MigrateFlags(verifyCredits),
+						Category: "MISCELLANEOUS COMMANDS",
+						Flags: []cli.Flag{
+							utils.DataDirFlag,
+							utils.AncientFlag,
+							utils.PulseChainFlag,
+							utils.PulseChainTestnetFlag,
+						},
+						Description: `
+geth pulse credits verify
+checks that the balance of every credited address changed by its sacrifice
+credit at the PrimordialPulse block. The states before and after the fork
+block must be available. The treasury allocation is accounted for, while
+the addresses touched by the block's transactions are skipped.`,
+					},
+				},
+			},
+			{
+				Name:      "protection",
+				Usage:     "Manage the slashing protection database of the local Parlia validators",
+				ArgsUsage: "",
+				Category:  "MISCELLANEOUS COMMANDS",
+				Subcommands: []cli.Command{
+					{
+						Name:      "export",
+						Usage:     "Export the slashing protection database",
+						ArgsUsage: "[<file>]",
+						Action:    utils.MigrateFlags(exportProtection),
+						Category:  "MISCELLANEOUS COMMANDS",
+						Flags:     parliaSnapshotFlags,
+						Description: `
+geth pulse protection export [<file>]
+exports every header signed by the local validators into the given file, or
+to stdout, in the JSON slashing protection interchange format.`,
+					},
+					{
+						Name:      "import",
+						Usage:     "Import a slashing protection interchange file",
+						ArgsUsage: "<file>",
+						Action:    utils.MigrateFlags(importProtection),
+						Category:  "MISCELLANEOUS COMMANDS",
+						Flags:     parliaSnapshotFlags,
+						Description: `
+geth pulse protection import <file>
+merges the headers signed by validators, as exported on another machine, into
+the local slashing protection database. The local validators refuse to sign
+any header conflicting with the imported ones. Import the data before running
+the validator with the migrated key.`,
+					},
+				},
+			},
+		},
+	}
+)
+
+// loadCredits returns the embedded sacrifice credits, failing the command if
+// they can't be decoded.
+func loadCredits() []*parlia.SacrificeCredit {
+	credits, err := parlia.SacrificeCredits()
+	if err != nil {
+		utils.Fatalf("Failed to decode sacrifice credits: %v", err)
+	}
+	return credits
+}
+
+func lookupCredits(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errors.New("missing address argument")
+	}
+	credits := loadCredits()
+	for _, arg := range ctx.Args() {
+		if !common.IsHexAddress(arg) {
+			return fmt.Errorf("invalid address %q", arg)
+		}
+		var (
+			addr    = common.HexToAddress(arg)
+			total   = new(big.Int)
+			records int
+		)
+		for _, credit := range credits {
+			if credit.Address == addr {
+				total.Add(total, credit.Amount)
+				records++
+			}
+		}
+		fmt.Printf("%s: %s wei (%d records)\n", addr.Hex(), total, records)
+	}
+	return nil
+}
+
+func creditTotals(ctx *cli.Context) error {
+	var (
+		credits = loadCredits()
+		total   = new(big.Int)
+	)
+	for _, credit := range credits {
+		total.Add(total, credit.Amount)
+	}
+	fmt.Printf("Records:   %d\n", len(credits))
+	fmt.Printf("Addresses: %d\n", len(parlia.AggregateSacrificeCredits(credits)))
+	fmt.Printf("Total:     %s wei\n", total)
+	return nil
+}
+
+func exportCredits(ctx *cli.Context) error {
+	var out io.Writer = os.Stdout
+	if path := ctx.String(creditsOutputFlag.Name); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	credits := loadCredits()
+
+	switch format := ctx.String(creditsFormatFlag.Name); format {
+	case "csv":
+		w := csv.NewWriter(out)
+		w.Write([]string{"address", "amount"})
+		for _, credit := range credits {
+			w.Write([]string{credit.Address.Hex(), credit.Amount.String()})
+		}
+		w.Flush()
+		return w.Error()
+
+	case "json":
+		type record struct {
+			Address common.Address `json:"address"`
+			Amount  string         `json:"amount"`
+		}
+		records := make([]record, len(credits))
+		for i, credit := range credits {
+			records[i] = record{Address: credit.Address, Amount: credit.Amount.String()}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+
+	default:
+		return fmt.Errorf("unknown export format %q", format)
+	}
+}
+
+func verifyCredits(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chaindb := utils.MakeChainDatabase(ctx, stack, true)
+	defer chaindb.Close()
+
+	config := rawdb.ReadChainConfig(chaindb, rawdb.ReadCanonicalHash(chaindb, 0))
+	if config == nil {
+		utils.Fatalf("Failed to load chain config")
+	}
+	if config.Parlia == nil || config.PrimordialPulseBlock == nil || config.PrimordialPulseBlock.Sign() == 0 {
+		utils.Fatalf("Chain has no PrimordialPulse fork")
+	}
+	number := config.PrimordialPulseBlock.Uint64()
+	block := rawdb.ReadBlock(chaindb, rawdb.ReadCanonicalHash(chaindb, number), number)
+	if block == nil {
+		utils.Fatalf("PrimordialPulse block #%d not available", number)
+	}
+	parent := rawdb.ReadHeader(chaindb, block.ParentHash(), number-1)
+	if parent == nil {
+		utils.Fatalf("PrimordialPulse parent block #%d not available", number-1)
+	}
+	sdb := state.NewDatabase(chaindb)
+	prestate, err := state.New(parent.Root, sdb, nil)
+	if err != nil {
+		utils.Fatalf("State before the PrimordialPulse block not available: %v", err)
+	}
+	poststate, err := state.New(block.Root(), sdb, nil)
+	if err != nil {
+		utils.Fatalf("State after the PrimordialPulse block not available: %v", err)
+	}
+	// Balances touched by the block's transactions can't be verified
+	skip := map[common.Address]struct{}{block.Coinbase(): {}}
+	signer := types.MakeSigner(config, block.Number())
+	for _, tx := range block.Transactions() {
+		if from, err := types.Sender(signer, tx); err == nil {
+			skip[from] = struct{}{}
+		}
+		if tx.To() != nil {
+			skip[*tx.To()] = struct{}{}
+		}
+	}
+	start := time.Now()
+	log.Info("Verifying sacrifice credits", "number", number, "hash", block.Hash())
+
+	mismatches := parlia.VerifySacrificeCredits(config.Parlia, loadCredits(), prestate, poststate, skip)
+	for _, mismatch := range mismatches {
+		log.Error("Sacrifice credit mismatch", "address", mismatch.Address, "want", mismatch.Want, "have", mismatch.Have)
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("%d sacrifice credit mismatches", len(mismatches))
+	}
+	log.Info("Verified sacrifice credits", "skipped", len(skip), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func exportProtection(ctx *cli.Context) error {
+	if ctx.NArg() > 1 {
+		return errors.New("too many arguments")
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	_, engine := makeParliaEngine(ctx, stack, true)
+	interchange, err := engine.ExportSlashingProtection()
+	if err != nil {
+		return err
+	}
+	var out io.Writer = os.Stdout
+	if ctx.NArg() == 1 {
+		f, err := os.Create(ctx.Args().First())
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(interchange); err != nil {
+		return err
+	}
+	var records int
+	for _, data := range interchange.Data {
+		records += len(data.SignedHeaders)
+	}
+	log.Info("Exported slashing protection data", "validators", len(interchange.Data), "records", records)
+	return nil
+}
+
+func importProtection(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("need the interchange file to import")
+	}
+	blob, err := os.ReadFile(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	interchange := new(parlia.ProtectionInterchange)
+	if err := json.Unmarshal(blob, interchange); err != nil {
+		return fmt.Errorf("invalid interchange file: %v", err)
+	}
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	_, engine := makeParliaEngine(ctx, stack, false)
+	imported, conflicts, err := engine.ImportSlashingProtection(interchange)
+	if err != nil {
+		return err
+	}
+	if conflicts > 0 {
+		log.Warn("Conflicting slashing protection records, refusing to sign at their heights", "conflicts", conflicts)
+	}
+	log.Info("Imported slashing protection data", "validators", len(interchange.Data), "imported", imported, "conflicts", conflicts)
+	return nil
+}
@@ -20,11 +20,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"time"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/parlia"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/state/pruner"
@@ -32,6 +35,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/node"
 	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/trie"
 	cli "gopkg.in/urfave/cli.v1"
@@ -45,6 +49,24 @@ var (
 	emptyCode = crypto.Keccak256(nil)
 )
 
+var (
+	parliaFromEpochFlag = cli.Uint64Flag{
+		Name:  "from",
+		Usage: "Epoch to start regenerating the snapshots from",
+	}
+	parliaKeepFlag = cli.Uint64Flag{
+		Name:  "keep",
+		Usage: "Number of the most recent canonical snapshots to keep",
+		Value: 128,
+	}
+	parliaSnapshotFlags = []cli.Flag{
+		utils.DataDirFlag,
+		utils.AncientFlag,
+		utils.PulseChainFlag,
+		utils.PulseChainTestnetFlag,
+	}
+)
+
 var (
 	snapshotCommand = cli.Command{
 		Name:        "snapshot",
@@ -177,6 +199,63 @@ The argument is interpreted as block number or hash. If none is provided, the la
 block is used.
 `,
 			},
+			{
+				Name:     "parlia",
+				Usage:    "A set of commands maintaining the Parlia consensus snapshots",
+				Category: "MISCELLANEOUS COMMANDS",
+				Subcommands: []cli.Command{
+					{
+						Name:     "inspect",
+						Usage:    "List the Parlia snapshots stored in the database",
+						Action:   utils.MigrateFlags(inspectParliaSnapshots),
+						Category: "MISCELLANEOUS COMMANDS",
+						Flags:    parliaSnapshotFlags,
+						Description: `
+geth snapshot parlia inspect
+lists every checkpoint snapshot of the Parlia consensus engine stored in the
+database, along with whether it belongs to the canonical chain.
+`,
+					},
+					{
+						Name:     "verify",
+						Usage:    "Recompute the Parlia snapshots from the header chain and compare them with the stored ones",
+						Action:   utils.MigrateFlags(verifyParliaSnapshots),
+						Category: "MISCELLANEOUS COMMANDS",
+						Flags:    parliaSnapshotFlags,
+						Description: `
+geth snapshot parlia verify
+recomputes every canonical checkpoint snapshot by applying the headers since
+the previous one, and reports any mismatch in the validators, the recent
+validators and the recent fork hashes stored in the database.
+`,
+					},
+					{
+						Name:     "rebuild",
+						Usage:    "Regenerate the Parlia snapshots from the header chain",
+						Action:   utils.MigrateFlags(rebuildParliaSnapshots),
+						Category: "MISCELLANEOUS COMMANDS",
+						Flags:    append([]cli.Flag{parliaFromEpochFlag}, parliaSnapshotFlags...),
+						Description: `
+geth snapshot parlia rebuild --from <epoch>
+regenerates the checkpoint snapshots from the first block of the given epoch
+up to the chain head and overwrites the stored ones. Regeneration starts from
+the latest canonical snapshot stored before that block.
+`,
+					},
+					{
+						Name:     "prune",
+						Usage:    "Delete all but the most recent Parlia snapshots",
+						Action:   utils.MigrateFlags(pruneParliaSnapshots),
+						Category: "MISCELLANEOUS COMMANDS",
+						Flags:    append([]cli.Flag{parliaKeepFlag}, parliaSnapshotFlags...),
+						Description: `
+geth snapshot parlia prune --keep <N>
+deletes every stored snapshot except the N most recent canonical ones. Snapshots
+of non-canonical blocks and undecodable snapshots are always deleted.
+`,
+					},
+				},
+			},
 		},
 	}
 )
@@ -220,7 +299,7 @@ func verifyState(ctx *cli.Context) error {
 		log.Error("Failed to load head block")
 		return errors.New("no head block")
 	}
-	snaptree, err := snapshot.New(chaindb, trie.NewDatabase(chaindb), 256, headBlock.Root(), false, false, false)
+	snaptree, err := snapshot.New(chaindb, utils.MakeTrieDatabase(chaindb), 256, headBlock.Root(), false, false, false)
 	if err != nil {
 		log.Error("Failed to open snapshot tree", "err", err)
 		return err
@@ -277,7 +356,7 @@ func traverseState(ctx *cli.Context) error {
 		root = headBlock.Root()
 		log.Info("Start traversing the state", "root", root, "number", headBlock.NumberU64())
 	}
-	triedb := trie.NewDatabase(chaindb)
+	triedb := utils.MakeTrieDatabase(chaindb)
 	t, err := trie.NewSecure(root, triedb)
 	if err != nil {
 		log.Error("Failed to open trie", "root", root, "err", err)
@@ -299,7 +378,7 @@ func traverseState(ctx *cli.Context) error {
 			return err
 		}
 		if acc.Root != emptyRoot {
-			storageTrie, err := trie.NewSecure(acc.Root, triedb)
+			storageTrie, err := trie.NewSecureWithOwner(common.BytesToHash(accIter.Key), acc.Root, triedb)
 			if err != nil {
 				log.Error("Failed to open storage trie", "root", acc.Root, "err", err)
 				return err
@@ -367,7 +446,7 @@ func traverseRawState(ctx *cli.Context) error {
 		root = headBlock.Root()
 		log.Info("Start traversing the state", "root", root, "number", headBlock.NumberU64())
 	}
-	triedb := trie.NewDatabase(chaindb)
+	triedb := utils.MakeTrieDatabase(chaindb)
 	t, err := trie.NewSecure(root, triedb)
 	if err != nil {
 		log.Error("Failed to open trie", "root", root, "err", err)
@@ -405,7 +484,7 @@ func traverseRawState(ctx *cli.Context) error {
 				return errors.New("invalid account")
 			}
 			if acc.Root != emptyRoot {
-				storageTrie, err := trie.NewSecure(acc.Root, triedb)
+				storageTrie, err := trie.NewSecureWithOwner(common.BytesToHash(accIter.LeafKey()), acc.Root, triedb)
 				if err != nil {
 					log.Error("Failed to open storage trie", "root", acc.Root, "err", err)
 					return errors.New("missing storage trie")
@@ -472,7 +551,7 @@ func dumpState(ctx *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	snaptree, err := snapshot.New(db, trie.NewDatabase(db), 256, root, false, false, false)
+	snaptree, err := snapshot.New(db, utils.MakeTrieDatabase(db), 256, root, false, false, false)
 	if err != nil {
 		return err
 	}
@@ -533,3 +612,165 @@ func dumpState(ctx *cli.Context) error {
 		"elapsed", common.PrettyDuration(time.Since(start)))
 	return nil
 }
+
+// makeParliaEngine opens the chain database and creates the header chain along
+// with a Parlia engine for the offline snapshot maintenance.
+func makeParliaEngine(ctx *cli.Context, stack *node.Node, readonly bool) (*core.HeaderChain, *parlia.Parlia) {
+	chaindb := utils.MakeChainDatabase(ctx, stack, readonly)
+
+	genesis := rawdb.ReadCanonicalHash(chaindb, 0)
+	config := rawdb.ReadChainConfig(chaindb, genesis)
+	if config == nil {
+		utils.Fatalf("Failed to load chain config")
+	}
+	if config.Parlia == nil {
+		utils.Fatalf("Chain is not running the Parlia consensus engine")
+	}
+	engine := parlia.New(config, chaindb, nil, genesis, nil)
+	chain, err := core.NewHeaderChain(chaindb, config, engine, func() bool { return false })
+	if err != nil {
+		utils.Fatalf("Failed to open header chain: %v", err)
+	}
+	return chain, engine
+}
+
+// isCanonicalSnapshot reports whether the snapshot belongs to the canonical chain.
+func isCanonicalSnapshot(chain *core.HeaderChain, snap *parlia.Snapshot) bool {
+	header := chain.GetHeaderByNumber(snap.Number)
+	return header != nil && header.Hash() == snap.Hash
+}
+
+func inspectParliaSnapshots(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, engine := makeParliaEngine(ctx, stack, true)
+
+	snaps, corrupt, err := engine.StoredSnapshots()
+	if err != nil {
+		log.Error("Failed to iterate parlia snapshots", "err", err)
+		return err
+	}
+	var canonical int
+	for _, snap := range snaps {
+		isCanonical := isCanonicalSnapshot(chain, snap)
+		if isCanonical {
+			canonical++
+		}
+		log.Info("Parlia snapshot", "number", snap.Number, "hash", snap.Hash, "validators", len(snap.Validators),
+			"recents", len(snap.Recents), "forkhashes", len(snap.RecentForkHashes), "canonical", isCanonical)
+	}
+	for _, hash := range corrupt {
+		log.Warn("Corrupted parlia snapshot", "hash", hash)
+	}
+	log.Info("Inspected parlia snapshots", "canonical", canonical, "noncanonical", len(snaps)-canonical, "corrupted", len(corrupt))
+	return nil
+}
+
+func verifyParliaSnapshots(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, engine := makeParliaEngine(ctx, stack, true)
+
+	snaps, corrupt, err := engine.StoredSnapshots()
+	if err != nil {
+		log.Error("Failed to iterate parlia snapshots", "err", err)
+		return err
+	}
+	for _, hash := range corrupt {
+		log.Error("Corrupted parlia snapshot", "hash", hash)
+	}
+	var (
+		base     *parlia.Snapshot
+		verified int
+		failed   = len(corrupt)
+		start    = time.Now()
+	)
+	for _, snap := range snaps {
+		if !isCanonicalSnapshot(chain, snap) {
+			log.Debug("Skipping non-canonical parlia snapshot", "number", snap.Number, "hash", snap.Hash)
+			continue
+		}
+		header := chain.GetHeader(snap.Hash, snap.Number)
+		want, err := engine.RegenerateSnapshot(chain, base, header)
+		if err != nil {
+			log.Error("Failed to regenerate parlia snapshot", "number", snap.Number, "hash", snap.Hash, "err", err)
+			failed++
+			continue
+		}
+		if diffs := parlia.DiffSnapshots(snap, want); len(diffs) > 0 {
+			log.Error("Parlia snapshot mismatch", "number", snap.Number, "hash", snap.Hash, "differences", len(diffs))
+			for _, diff := range diffs {
+				log.Error("  " + diff)
+			}
+			// Continue from the correct snapshot to avoid reporting inherited mismatches
+			base, failed = want, failed+1
+			continue
+		}
+		base, verified = snap, verified+1
+	}
+	if failed > 0 {
+		log.Error("Parlia snapshot verification failed", "verified", verified, "failed", failed, "elapsed", common.PrettyDuration(time.Since(start)))
+		return fmt.Errorf("%d invalid parlia snapshots", failed)
+	}
+	log.Info("Verified parlia snapshots", "verified", verified, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func rebuildParliaSnapshots(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, engine := makeParliaEngine(ctx, stack, false)
+
+	if !ctx.IsSet(parliaFromEpochFlag.Name) {
+		return fmt.Errorf("missing --%s", parliaFromEpochFlag.Name)
+	}
+	var (
+		from  = ctx.Uint64(parliaFromEpochFlag.Name) * chain.Config().Parlia.Epoch
+		start = time.Now()
+	)
+	rebuilt, err := engine.RebuildSnapshots(chain, from)
+	if err != nil {
+		log.Error("Failed to rebuild parlia snapshots", "from", from, "rebuilt", rebuilt, "err", err)
+		return err
+	}
+	log.Info("Rebuilt parlia snapshots", "from", from, "rebuilt", rebuilt, "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+func pruneParliaSnapshots(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, engine := makeParliaEngine(ctx, stack, false)
+
+	snaps, corrupt, err := engine.StoredSnapshots()
+	if err != nil {
+		log.Error("Failed to iterate parlia snapshots", "err", err)
+		return err
+	}
+	// Keep the most recent canonical snapshots, delete everything else
+	var (
+		keep    = ctx.Uint64(parliaKeepFlag.Name)
+		stale   = corrupt
+		deleted int
+	)
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if keep > 0 && isCanonicalSnapshot(chain, snaps[i]) {
+			keep--
+			continue
+		}
+		stale = append(stale, snaps[i].Hash)
+	}
+	for _, hash := range stale {
+		if err := engine.DeleteSnapshot(hash); err != nil {
+			log.Error("Failed to delete parlia snapshot", "hash", hash, "err", err)
+			return err
+		}
+		deleted++
+	}
+	log.Info("Pruned parlia snapshots", "deleted", deleted, "kept", len(snaps)+len(corrupt)-deleted)
+	return nil
+}
@@ -36,11 +36,13 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			configFileFlag,
 			utils.DataDirFlag,
 			utils.AncientFlag,
+			utils.DBEngineFlag,
 			utils.MinFreeDiskSpaceFlag,
 			utils.KeyStoreDirFlag,
 			utils.USBFlag,
 			utils.DirectBroadcastFlag,
 			utils.RangeLimitFlag,
+			utils.ParliaHistoryFlag,
 			utils.SmartCardDaemonPathFlag,
 			utils.NetworkIdFlag,
 			utils.MainnetFlag,
@@ -53,7 +55,9 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.SyncModeFlag,
 			utils.ExitWhenSyncedFlag,
 			utils.GCModeFlag,
+			utils.StateSchemeFlag,
 			utils.TxLookupLimitFlag,
+			utils.HistoryRetainFlag,
 			utils.EthStatsURLFlag,
 			utils.IdentityFlag,
 			utils.LightKDFFlag,
@@ -80,6 +84,7 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.DeveloperFlag,
 			utils.DeveloperPeriodFlag,
 			utils.DeveloperGasLimitFlag,
+			utils.DeveloperParliaFlag,
 		},
 	},
 	{
@@ -102,6 +107,11 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.TxPoolNoLocalsFlag,
 			utils.TxPoolJournalFlag,
 			utils.TxPoolRejournalFlag,
+			utils.TxPoolSnapshotFlag,
+			utils.TxPoolSnapshotMaxAgeFlag,
+			utils.TxPoolSnapshotMaxTxsFlag,
+			utils.TxPoolDropHistoryFlag,
+			utils.TxPoolDropJournalFlag,
 			utils.TxPoolPriceLimitFlag,
 			utils.TxPoolPriceBumpFlag,
 			utils.TxPoolAccountSlotsFlag,
@@ -194,6 +204,11 @@ var AppHelpFlagGroups = []flags.FlagGroup{
 			utils.MinerRecommitIntervalFlag,
 			utils.MinerDelayLeftoverFlag,
 			utils.MinerNoVerifyFlag,
+			utils.MinerSignerFlag,
+			utils.MinerOrderingFlag,
+			utils.MinerOrderingReserveFlag,
+			utils.MinerOrderingPriorityFlag,
+			utils.MinerOrderingAgeFlag,
 		},
 	},
 	{
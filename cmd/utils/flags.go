@@ -18,6 +18,7 @@
 package utils
 
 import (
+	"bytes"
 	"crypto/ecdsa"
 	"fmt"
 	"io"
@@ -27,6 +28,7 @@ import (
 	"os"
 	"path/filepath"
 	godebug "runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"text/tabwriter"
@@ -67,6 +69,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/nat"
 	"github.com/ethereum/go-ethereum/p2p/netutil"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
 	pcsclite "github.com/gballet/go-libpcsclite"
 	gopsutil "github.com/shirou/gopsutil/mem"
 	"gopkg.in/urfave/cli.v1"
@@ -122,10 +125,19 @@ var (
 		Name:  "rangelimit",
 		Usage: "Enable 5000 blocks limit for range query",
 	}
+	ParliaHistoryFlag = cli.BoolFlag{
+		Name:  "parlia.history",
+		Usage: "Index the Parlia validator set history and signing statistics",
+	}
 	AncientFlag = DirectoryFlag{
 		Name:  "datadir.ancient",
 		Usage: "Data directory for ancient chain segments (default = inside chaindata)",
 	}
+	DBEngineFlag = cli.StringFlag{
+		Name:  "db.engine",
+		Usage: "Backing database implementation to use ('leveldb' or 'pebble')",
+		Value: "",
+	}
 	MinFreeDiskSpaceFlag = DirectoryFlag{
 		Name:  "datadir.minfreedisk",
 		Usage: "Minimum free disk space in MB, once reached triggers auto shut down (default = --cache.gc converted to MB, 0 = disabled)",
@@ -189,6 +201,10 @@ var (
 		Usage: "Initial block gas limit",
 		Value: 11500000,
 	}
+	DeveloperParliaFlag = cli.IntFlag{
+		Name:  "dev.parlia",
+		Usage: "Number of validators taking turns sealing a Parlia chain in developer mode (0 = clique)",
+	}
 	IdentityFlag = cli.StringFlag{
 		Name:  "identity",
 		Usage: "Custom node name",
@@ -239,6 +255,10 @@ var (
 		Usage: `Blockchain garbage collection mode ("full", "archive")`,
 		Value: "full",
 	}
+	StateSchemeFlag = cli.StringFlag{
+		Name:  "state.scheme",
+		Usage: `Scheme to use for storing ethereum state ("hash", "path") (default = stored scheme or "hash")`,
+	}
 	SnapshotFlag = cli.BoolTFlag{
 		Name:  "snapshot",
 		Usage: `Enables snapshot-database mode (default = enable)`,
@@ -248,6 +268,14 @@ var (
 		Usage: "Number of recent blocks to maintain transactions index for (default = about one year, 0 = entire chain)",
 		Value: ethconfig.Defaults.TxLookupLimit,
 	}
+	HistoryRetainFlag = cli.Uint64Flag{
+		Name:  "history.retain",
+		Usage: "Number of recent blocks to retain ancient bodies and receipts for (default = 0, entire chain)",
+	}
+	HistoryRootsFlag = cli.StringFlag{
+		Name:  "history.roots",
+		Usage: "File listing the trusted accumulator roots of the history archives to import, one per line",
+	}
 	LightKDFFlag = cli.BoolFlag{
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
@@ -369,6 +397,29 @@ var (
 		Usage: "Time interval to regenerate the local transaction journal",
 		Value: core.DefaultTxPoolConfig.Rejournal,
 	}
+	TxPoolSnapshotFlag = cli.StringFlag{
+		Name:  "txpool.snapshot",
+		Usage: "Disk snapshot of remote transactions to survive node restarts, rewritten every rejournal interval (disabled if empty)",
+	}
+	TxPoolSnapshotMaxAgeFlag = cli.DurationFlag{
+		Name:  "txpool.snapshot.maxage",
+		Usage: "Maximum age of the snapshotted remote transactions to restore",
+		Value: core.DefaultTxPoolConfig.SnapshotMaxAge,
+	}
+	TxPoolSnapshotMaxTxsFlag = cli.Uint64Flag{
+		Name:  "txpool.snapshot.maxtxs",
+		Usage: "Maximum number of snapshotted remote transactions to restore",
+		Value: core.DefaultTxPoolConfig.SnapshotMaxTxs,
+	}
+	TxPoolDropHistoryFlag = cli.Uint64Flag{
+		Name:  "txpool.drophistory",
+		Usage: "Number of dropped transactions to remember the fate of (0 = disabled)",
+		Value: core.DefaultTxPoolConfig.DropHistory,
+	}
+	TxPoolDropJournalFlag = cli.StringFlag{
+		Name:  "txpool.dropjournal",
+		Usage: "Disk log of dropped transactions to survive node restarts (memory only if empty)",
+	}
 	TxPoolPriceLimitFlag = cli.Uint64Flag{
 		Name:  "txpool.pricelimit",
 		Usage: "Minimum gas price limit to enforce for acceptance into the pool",
@@ -499,6 +550,29 @@ var (
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	MinerSignerFlag = cli.StringFlag{
+		Name:  "miner.signer",
+		Usage: "External signer (clef url or path to ipc file) sealing the Parlia blocks of the etherbase",
+	}
+	MinerOrderingFlag = cli.StringFlag{
+		Name:  "miner.ordering",
+		Usage: "Transaction ordering strategy of the built blocks (price, reserve, age, roundrobin)",
+		Value: ethconfig.Defaults.Miner.Ordering,
+	}
+	MinerOrderingReserveFlag = cli.Uint64Flag{
+		Name:  "miner.ordering.reserve",
+		Usage: "Percentage of the block gas reserved for locals and priority senders (reserve ordering)",
+		Value: ethconfig.Defaults.Miner.ReserveGas,
+	}
+	MinerOrderingPriorityFlag = cli.StringFlag{
+		Name:  "miner.ordering.priority",
+		Usage: "Comma separated senders entitled to the reserved block gas besides the locals (reserve ordering)",
+	}
+	MinerOrderingAgeFlag = cli.DurationFlag{
+		Name:  "miner.ordering.age",
+		Usage: "Time in the pool after which transactions are preferred (age ordering)",
+		Value: ethconfig.Defaults.Miner.AgeThreshold,
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -1274,6 +1348,15 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	setDataDir(ctx, cfg)
 	setSmartCard(ctx, cfg)
 
+	if ctx.GlobalIsSet(DBEngineFlag.Name) {
+		dbEngine := ctx.GlobalString(DBEngineFlag.Name)
+		if dbEngine != "leveldb" && dbEngine != "pebble" {
+			Fatalf("Invalid choice for db.engine '%s', allowed 'leveldb' or 'pebble'", dbEngine)
+		}
+		log.Info(fmt.Sprintf("Using %s as db engine", dbEngine))
+		cfg.DBEngine = dbEngine
+	}
+
 	if ctx.GlobalIsSet(ExternalSignerFlag.Name) {
 		cfg.ExternalSigner = ctx.GlobalString(ExternalSignerFlag.Name)
 	}
@@ -1395,6 +1478,21 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolRejournalFlag.Name) {
 		cfg.Rejournal = ctx.GlobalDuration(TxPoolRejournalFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolSnapshotFlag.Name) {
+		cfg.Snapshot = ctx.GlobalString(TxPoolSnapshotFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSnapshotMaxAgeFlag.Name) {
+		cfg.SnapshotMaxAge = ctx.GlobalDuration(TxPoolSnapshotMaxAgeFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolSnapshotMaxTxsFlag.Name) {
+		cfg.SnapshotMaxTxs = ctx.GlobalUint64(TxPoolSnapshotMaxTxsFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolDropHistoryFlag.Name) {
+		cfg.DropHistory = ctx.GlobalUint64(TxPoolDropHistoryFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolDropJournalFlag.Name) {
+		cfg.DropJournal = ctx.GlobalString(TxPoolDropJournalFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolPriceLimitFlag.Name) {
 		cfg.PriceLimit = ctx.GlobalUint64(TxPoolPriceLimitFlag.Name)
 	}
@@ -1468,6 +1566,27 @@ func setMiner(ctx *cli.Context, cfg *miner.Config) {
 	if ctx.GlobalIsSet(MinerNoVerifyFlag.Name) {
 		cfg.Noverify = ctx.GlobalBool(MinerNoVerifyFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerSignerFlag.Name) {
+		cfg.Signer = ctx.GlobalString(MinerSignerFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerOrderingFlag.Name) {
+		cfg.Ordering = ctx.GlobalString(MinerOrderingFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerOrderingReserveFlag.Name) {
+		cfg.ReserveGas = ctx.GlobalUint64(MinerOrderingReserveFlag.Name)
+	}
+	if ctx.GlobalIsSet(MinerOrderingPriorityFlag.Name) {
+		for _, account := range strings.Split(ctx.GlobalString(MinerOrderingPriorityFlag.Name), ",") {
+			if trimmed := strings.TrimSpace(account); !common.IsHexAddress(trimmed) {
+				Fatalf("Invalid account in --miner.ordering.priority: %s", trimmed)
+			} else {
+				cfg.PrioritySenders = append(cfg.PrioritySenders, common.HexToAddress(trimmed))
+			}
+		}
+	}
+	if ctx.GlobalIsSet(MinerOrderingAgeFlag.Name) {
+		cfg.AgeThreshold = ctx.GlobalDuration(MinerOrderingAgeFlag.Name)
+	}
 	if ctx.GlobalIsSet(LegacyMinerGasTargetFlag.Name) {
 		log.Warn("The generic --miner.gastarget flag is deprecated and will be removed in the future!")
 	}
@@ -1543,6 +1662,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	CheckExclusive(ctx, MainnetFlag, PulseChainFlag, PulseChainTestnetFlag, DeveloperFlag, RopstenFlag, RinkebyFlag, GoerliFlag, SepoliaFlag)
 	CheckExclusive(ctx, LightServeFlag, SyncModeFlag, "light")
 	CheckExclusive(ctx, DeveloperFlag, ExternalSignerFlag) // Can't use both ephemeral unlocked and external signer
+	CheckExclusive(ctx, DeveloperFlag, MinerSignerFlag)
 	if ctx.GlobalString(GCModeFlag.Name) == "archive" && ctx.GlobalUint64(TxLookupLimitFlag.Name) != 0 {
 		ctx.GlobalSet(TxLookupLimitFlag.Name, "0")
 		log.Warn("Disable transaction unindexing for archive node")
@@ -1602,12 +1722,18 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(GCModeFlag.Name) {
 		cfg.NoPruning = ctx.GlobalString(GCModeFlag.Name) == "archive"
 	}
+	if ctx.GlobalIsSet(StateSchemeFlag.Name) {
+		cfg.StateScheme = ctx.GlobalString(StateSchemeFlag.Name)
+	}
 	if ctx.GlobalIsSet(DirectBroadcastFlag.Name) {
 		cfg.DirectBroadcast = ctx.GlobalBool(DirectBroadcastFlag.Name)
 	}
 	if ctx.GlobalIsSet(RangeLimitFlag.Name) {
 		cfg.RangeLimit = ctx.GlobalBool(RangeLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(ParliaHistoryFlag.Name) {
+		cfg.ParliaHistory = ctx.GlobalBool(ParliaHistoryFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheNoPrefetchFlag.Name) {
 		cfg.NoPrefetch = ctx.GlobalBool(CacheNoPrefetchFlag.Name)
 	}
@@ -1620,6 +1746,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	if ctx.GlobalIsSet(TxLookupLimitFlag.Name) {
 		cfg.TxLookupLimit = ctx.GlobalUint64(TxLookupLimitFlag.Name)
 	}
+	if ctx.GlobalIsSet(HistoryRetainFlag.Name) {
+		cfg.HistoryRetain = ctx.GlobalUint64(HistoryRetainFlag.Name)
+	}
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheTrieFlag.Name) {
 		cfg.TrieCleanCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheTrieFlag.Name) / 100
 	}
@@ -1754,7 +1883,13 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 		log.Info("Using developer account", "address", developer.Address)
 
 		// Create a new developer genesis block or reuse existing one
-		cfg.Genesis = core.DeveloperGenesisBlock(uint64(ctx.GlobalInt(DeveloperPeriodFlag.Name)), ctx.GlobalUint64(DeveloperGasLimitFlag.Name), developer.Address)
+		if n := ctx.GlobalInt(DeveloperParliaFlag.Name); n > 0 {
+			validators := makeDeveloperValidators(ks, developer, passphrase, n)
+			cfg.ParliaDevValidators = validators
+			cfg.Genesis = core.DeveloperParliaGenesisBlock(uint64(ctx.GlobalInt(DeveloperPeriodFlag.Name)), ctx.GlobalUint64(DeveloperGasLimitFlag.Name), developer.Address, validators)
+		} else {
+			cfg.Genesis = core.DeveloperGenesisBlock(uint64(ctx.GlobalInt(DeveloperPeriodFlag.Name)), ctx.GlobalUint64(DeveloperGasLimitFlag.Name), developer.Address)
+		}
 		if ctx.GlobalIsSet(DataDirFlag.Name) {
 			// Check if we have an already initialized chain and fall back to
 			// that if so. Otherwise we need to generate a new genesis spec.
@@ -1774,6 +1909,40 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *ethconfig.Config) {
 	}
 }
 
+// makeDeveloperValidators returns the given number of unlocked validator
+// accounts for a Parlia developer network, starting with the developer account
+// and reusing the other keystore accounts before creating new ones.
+func makeDeveloperValidators(ks *keystore.KeyStore, developer accounts.Account, passphrase string, n int) []common.Address {
+	validators := []common.Address{developer.Address}
+	for _, account := range ks.Accounts() {
+		if len(validators) == n {
+			break
+		}
+		if account.Address == developer.Address {
+			continue
+		}
+		if err := ks.Unlock(account, passphrase); err != nil {
+			Fatalf("Failed to unlock developer validator: %v", err)
+		}
+		validators = append(validators, account.Address)
+	}
+	for len(validators) < n {
+		account, err := ks.NewAccount(passphrase)
+		if err != nil {
+			Fatalf("Failed to create developer validator: %v", err)
+		}
+		if err := ks.Unlock(account, passphrase); err != nil {
+			Fatalf("Failed to unlock developer validator: %v", err)
+		}
+		validators = append(validators, account.Address)
+	}
+	sort.Slice(validators, func(i, j int) bool {
+		return bytes.Compare(validators[i][:], validators[j][:]) < 0
+	})
+	log.Info("Using developer validators", "count", len(validators), "validators", validators)
+	return validators
+}
+
 // SetDNSDiscoveryDefaults configures DNS discovery with the given URL if
 // no URLs are set.
 func SetDNSDiscoveryDefaults(cfg *ethconfig.Config, genesis common.Hash) {
@@ -1962,10 +2131,27 @@ func MakeGenesis(ctx *cli.Context) *core.Genesis {
 	return genesis
 }
 
+// ParseStateScheme checks the state scheme requested on the command line
+// against the one recorded in the database, marking fresh databases.
+func ParseStateScheme(ctx *cli.Context, db ethdb.KeyValueStore) string {
+	scheme, err := rawdb.ParseStateScheme(ctx.GlobalString(StateSchemeFlag.Name), db)
+	if err != nil {
+		Fatalf("%v", err)
+	}
+	return scheme
+}
+
+// MakeTrieDatabase creates a trie database on top of the chain database using
+// the state scheme the database is marked with.
+func MakeTrieDatabase(db ethdb.Database) *trie.Database {
+	return trie.NewDatabaseWithConfig(db, &trie.Config{Preimages: true, Scheme: rawdb.ReadStateScheme(db)})
+}
+
 // MakeChain creates a chain manager from set command line flags.
 func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chainDb ethdb.Database) {
 	var err error
 	chainDb = MakeChainDatabase(ctx, stack, false) // TODO(rjl493456442) support read-only database
+	scheme := ParseStateScheme(ctx, chainDb)
 	config, _, err := core.SetupGenesisBlock(chainDb, MakeGenesis(ctx))
 	if err != nil {
 		Fatalf("%v", err)
@@ -1999,6 +2185,10 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 		TrieTimeLimit:       ethconfig.Defaults.TrieTimeout,
 		SnapshotLimit:       ethconfig.Defaults.SnapshotCache,
 		Preimages:           ctx.GlobalBool(CachePreimagesFlag.Name),
+		StateScheme:         scheme,
+	}
+	if cache.TrieDirtyDisabled && scheme == rawdb.PathScheme {
+		Fatalf("--%s=archive is not supported by the path-based state scheme", GCModeFlag.Name)
 	}
 	if cache.TrieDirtyDisabled && !cache.Preimages {
 		cache.Preimages = true
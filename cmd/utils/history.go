@@ -0,0 +1,348 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/era"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// HistoryChecksumsFile is the name of the file listing the sha256 checksums of
+// the era1 archives in an exported history directory, in sha256sum format.
+const HistoryChecksumsFile = "checksums.txt"
+
+// HistoryRootsFile is the name of the file listing the accumulator roots of the
+// era1 archives in an exported history directory, one per line. The roots are
+// meant to be distributed through a trusted channel, imports never rely on the
+// copy shipped along with the archives.
+const HistoryRootsFile = "roots.txt"
+
+// ExportHistory exports the canonical blocks in the [first, last] range into
+// era1 archives in the given directory, reading them directly from the chain
+// and ancient stores. The range must cover complete epochs of era.MaxSize
+// blocks. The checksums and the accumulator roots of the written archives are
+// listed in the checksums and roots files of the directory.
+func ExportHistory(db ethdb.Database, dir string, network string, first, last uint64) error {
+	if last < first || first%era.MaxSize != 0 || (last+1)%era.MaxSize != 0 {
+		return fmt.Errorf("export range [%d, %d] doesn't cover complete epochs of %d blocks", first, last, era.MaxSize)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var checksums, roots []string
+	for epoch := first / era.MaxSize; epoch <= last/era.MaxSize; epoch++ {
+		start := time.Now()
+		name, sum, root, err := exportEpoch(db, dir, network, epoch)
+		if err != nil {
+			return fmt.Errorf("epoch %d: %v", epoch, err)
+		}
+		checksums = append(checksums, fmt.Sprintf("%x  %s", sum, name))
+		roots = append(roots, root.Hex())
+		log.Info("Exported history", "epoch", epoch, "file", name, "root", root, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, HistoryRootsFile), []byte(strings.Join(roots, "\n")+"\n"), 0644); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, HistoryChecksumsFile), []byte(strings.Join(checksums, "\n")+"\n"), 0644)
+}
+
+// exportEpoch writes a single era1 archive, returning its name, checksum and
+// accumulator root.
+func exportEpoch(db ethdb.Database, dir string, network string, epoch uint64) (string, []byte, common.Hash, error) {
+	f, err := ioutil.TempFile(dir, "*.era1.tmp")
+	if err != nil {
+		return "", nil, common.Hash{}, err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name()) // noop after the rename
+	}()
+	var (
+		hasher  = sha256.New()
+		buf     = bufio.NewWriter(io.MultiWriter(f, hasher))
+		builder = era.NewBuilder(buf)
+	)
+	for n := epoch * era.MaxSize; n < (epoch+1)*era.MaxSize; n++ {
+		hash := rawdb.ReadCanonicalHash(db, n)
+		if hash == (common.Hash{}) {
+			return "", nil, common.Hash{}, fmt.Errorf("missing canonical block %d", n)
+		}
+		var (
+			header   = rawdb.ReadHeaderRLP(db, hash, n)
+			body     = rawdb.ReadBodyRLP(db, hash, n)
+			receipts = rawdb.ReadReceiptsRLP(db, hash, n)
+			td       = rawdb.ReadTd(db, hash, n)
+		)
+		if len(header) == 0 || len(body) == 0 || len(receipts) == 0 || td == nil {
+			return "", nil, common.Hash{}, fmt.Errorf("missing data of block %d", n)
+		}
+		if err := builder.AddRLP(header, body, receipts, n, hash, td); err != nil {
+			return "", nil, common.Hash{}, err
+		}
+	}
+	root, err := builder.Finalize()
+	if err != nil {
+		return "", nil, common.Hash{}, err
+	}
+	if err := buf.Flush(); err != nil {
+		return "", nil, common.Hash{}, err
+	}
+	if err := f.Close(); err != nil {
+		return "", nil, common.Hash{}, err
+	}
+	name := era.Filename(network, epoch, root)
+	if err := os.Rename(f.Name(), filepath.Join(dir, name)); err != nil {
+		return "", nil, common.Hash{}, err
+	}
+	return name, hasher.Sum(nil), root, nil
+}
+
+// ImportHistory imports the era1 archives listed in the checksums file of the
+// given directory straight into the ancient store. Every archive is checked
+// against its checksum, its accumulator root and the already present chain
+// before being written, and is refused unless its accumulator root is one of
+// the trusted ones. The database must not hold any chain data beyond the
+// ancient store except for the genesis block.
+func ImportHistory(db ethdb.Database, dir string, trusted map[common.Hash]bool) error {
+	if len(trusted) == 0 {
+		return errors.New("no trusted accumulator roots")
+	}
+	archives, err := readHistoryChecksums(dir)
+	if err != nil {
+		return err
+	}
+	genesis := rawdb.ReadCanonicalHash(db, 0)
+	if genesis == (common.Hash{}) {
+		return errors.New("database has no genesis block")
+	}
+	frozen, err := db.Ancients()
+	if err != nil {
+		return err
+	}
+	if head := rawdb.ReadHeaderNumber(db, rawdb.ReadHeadHeaderHash(db)); head != nil && *head > 0 && *head >= frozen {
+		return fmt.Errorf("database holds chain data beyond the ancient store (head #%d)", *head)
+	}
+	for _, archive := range archives {
+		start := time.Now()
+		imported, err := importEpoch(db, filepath.Join(dir, archive.name), archive.sum, trusted, frozen)
+		if err != nil {
+			return fmt.Errorf("%s: %v", archive.name, err)
+		}
+		if imported == frozen {
+			log.Info("Skipping imported history", "file", archive.name)
+			continue
+		}
+		frozen = imported
+		log.Info("Imported history", "file", archive.name, "head", frozen-1, "elapsed", common.PrettyDuration(time.Since(start)))
+	}
+	return nil
+}
+
+// importEpoch verifies a single era1 archive and appends the blocks not yet in
+// the ancient store, returning the new number of frozen items.
+func importEpoch(db ethdb.Database, path string, checksum []byte, trusted map[common.Hash]bool, frozen uint64) (uint64, error) {
+	sum, err := historyChecksum(path)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(sum, checksum) {
+		return 0, fmt.Errorf("checksum mismatch: have %x, want %x", sum, checksum)
+	}
+	// The archive is read on demand, its content is still verified against
+	// the trusted accumulator root below.
+	e, err := era.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer e.Close()
+
+	if e.Start()%era.MaxSize != 0 || e.Count() != era.MaxSize {
+		return 0, fmt.Errorf("archive [%d, %d) is not a complete epoch", e.Start(), e.Start()+e.Count())
+	}
+	root, err := e.Verify()
+	if err != nil {
+		return 0, err
+	}
+	if !trusted[root] {
+		return 0, fmt.Errorf("untrusted accumulator root %x", root)
+	}
+	if suffix := fmt.Sprintf("-%05d-%x.era1", e.Start()/era.MaxSize, root[:4]); !strings.HasSuffix(path, suffix) {
+		return 0, fmt.Errorf("file name doesn't match accumulator root %x", root)
+	}
+	end := e.Start() + e.Count()
+	if e.Start() > frozen {
+		return 0, fmt.Errorf("missing history before block %d", e.Start())
+	}
+	// Ensure the archive is consistent with the history already present
+	for n := e.Start(); n < end && n < frozen; n++ {
+		block, err := e.Block(n)
+		if err != nil {
+			return 0, err
+		}
+		if block.Hash != rawdb.ReadCanonicalHash(db, n) {
+			return 0, fmt.Errorf("block %d mismatches the local chain", n)
+		}
+	}
+	if end <= frozen {
+		return frozen, nil
+	}
+	first, err := e.Block(frozen)
+	if err != nil {
+		return 0, err
+	}
+	if frozen == 0 {
+		if first.Hash != rawdb.ReadCanonicalHash(db, 0) {
+			return 0, fmt.Errorf("genesis mismatch: have %x, want %x", first.Hash, rawdb.ReadCanonicalHash(db, 0))
+		}
+	} else {
+		var header types.Header
+		if err := rlp.DecodeBytes(first.Header, &header); err != nil {
+			return 0, err
+		}
+		if header.ParentHash != rawdb.ReadCanonicalHash(db, frozen-1) {
+			return 0, fmt.Errorf("block %d is not a child of the local chain", frozen)
+		}
+	}
+	// Write the blocks into the ancient store, followed by the number mappings
+	// and the head markers into the key-value store.
+	var (
+		batch = db.NewBatch()
+		last  common.Hash
+	)
+	_, err = db.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for n := frozen; n < end; n++ {
+			block, err := e.Block(n)
+			if err != nil {
+				return err
+			}
+			td, err := rlp.EncodeToBytes(block.TotalDifficulty)
+			if err != nil {
+				return err
+			}
+			if err := rawdb.WriteAncientRawBlock(op, n, block.Hash, block.Header, block.Body, block.Receipts, td); err != nil {
+				return err
+			}
+			rawdb.WriteHeaderNumber(batch, block.Hash, n)
+			last = block.Hash
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := db.Sync(); err != nil {
+		return 0, err
+	}
+	rawdb.WriteHeadHeaderHash(batch, last)
+	rawdb.WriteHeadFastBlockHash(batch, last)
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	return end, nil
+}
+
+// ReadHistoryRoots parses a file of trusted accumulator roots, holding a hex
+// encoded root per line.
+func ReadHistoryRoots(path string) (map[common.Hash]bool, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	roots := make(map[common.Hash]bool)
+	for i, line := range strings.Split(string(blob), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		root, err := hex.DecodeString(strings.TrimPrefix(line, "0x"))
+		if err != nil || len(root) != common.HashLength {
+			return nil, fmt.Errorf("%s:%d: invalid accumulator root", path, i+1)
+		}
+		roots[common.BytesToHash(root)] = true
+	}
+	return roots, nil
+}
+
+// historyArchive is an era1 archive listed in the checksums file.
+type historyArchive struct {
+	name string
+	sum  []byte
+}
+
+// readHistoryChecksums parses the checksums file of an exported history
+// directory.
+func readHistoryChecksums(dir string) ([]historyArchive, error) {
+	blob, err := ioutil.ReadFile(filepath.Join(dir, HistoryChecksumsFile))
+	if err != nil {
+		return nil, err
+	}
+	var archives []historyArchive
+	for i, line := range strings.Split(string(blob), "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: malformed line", HistoryChecksumsFile, i+1)
+		}
+		sum, err := hex.DecodeString(fields[0])
+		if err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("%s:%d: invalid checksum", HistoryChecksumsFile, i+1)
+		}
+		if filepath.Base(fields[1]) != fields[1] {
+			return nil, fmt.Errorf("%s:%d: invalid file name", HistoryChecksumsFile, i+1)
+		}
+		archives = append(archives, historyArchive{name: fields[1], sum: sum})
+	}
+	if len(archives) == 0 {
+		return nil, fmt.Errorf("no archives listed in %s", HistoryChecksumsFile)
+	}
+	return archives, nil
+}
+
+// historyChecksum computes the sha256 checksum of a file, streaming it instead
+// of loading the whole archive into memory.
+func historyChecksum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return nil, err
+	}
+	return hasher.Sum(nil), nil
+}
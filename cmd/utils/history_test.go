@@ -0,0 +1,177 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package utils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/internal/era"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that history exported into era1 archives can be imported into a fresh
+// database, and that tampered archives are rejected.
+func TestHistoryExportImport(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping in short mode")
+	}
+	var (
+		key, _ = crypto.GenerateKey()
+		addr   = crypto.PubkeyToAddress(key.PublicKey)
+		gspec  = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}}}
+		signer = types.LatestSigner(gspec.Config)
+		db     = rawdb.NewMemoryDatabase()
+	)
+	genesis := gspec.MustCommit(db)
+	blocks, receipts := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 2*era.MaxSize+10, func(i int, b *core.BlockGen) {
+		if i%1000 == 0 {
+			tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(addr), common.Address{0x01}, big.NewInt(1), params.TxGas, b.BaseFee(), nil), signer, key)
+			b.AddTx(tx)
+		}
+	})
+	td := genesis.Difficulty()
+	for i, block := range blocks {
+		td = new(big.Int).Add(td, block.Difficulty())
+		rawdb.WriteBlock(db, block)
+		rawdb.WriteReceipts(db, block.Hash(), block.NumberU64(), receipts[i])
+		rawdb.WriteTd(db, block.Hash(), block.NumberU64(), td)
+		rawdb.WriteCanonicalHash(db, block.Hash(), block.NumberU64())
+	}
+	rawdb.WriteHeadHeaderHash(db, blocks[len(blocks)-1].Hash())
+	rawdb.WriteHeadFastBlockHash(db, blocks[len(blocks)-1].Hash())
+
+	// Incomplete epochs are rejected, complete ones exported
+	dir := t.TempDir()
+	if err := ExportHistory(db, dir, "test", 1, era.MaxSize-1); err == nil {
+		t.Fatalf("exported partial epoch")
+	}
+	if err := ExportHistory(db, dir, "test", 0, 2*era.MaxSize-1); err != nil {
+		t.Fatalf("failed to export history: %v", err)
+	}
+	archives, err := readHistoryChecksums(dir)
+	if err != nil {
+		t.Fatalf("failed to read checksums: %v", err)
+	}
+	if len(archives) != 2 {
+		t.Fatalf("archive count mismatch: have %d, want 2", len(archives))
+	}
+	trusted, err := ReadHistoryRoots(filepath.Join(dir, HistoryRootsFile))
+	if err != nil {
+		t.Fatalf("failed to read accumulator roots: %v", err)
+	}
+	if len(trusted) != 2 {
+		t.Fatalf("accumulator root count mismatch: have %d, want 2", len(trusted))
+	}
+	// Archives are refused without trusted roots or if their root isn't trusted
+	if err := ImportHistory(newHistoryTestDatabase(t, gspec), dir, nil); err == nil {
+		t.Fatalf("imported history without trusted roots")
+	}
+	roots, err := ioutil.ReadFile(filepath.Join(dir, HistoryRootsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	partial := map[common.Hash]bool{common.HexToHash(strings.Fields(string(roots))[0]): true}
+	untrusted := newHistoryTestDatabase(t, gspec)
+	if err := ImportHistory(untrusted, dir, partial); err == nil {
+		t.Fatalf("imported archive with untrusted root")
+	}
+	if frozen, _ := untrusted.Ancients(); frozen != era.MaxSize {
+		t.Fatalf("ancient count mismatch: have %d, want %d", frozen, era.MaxSize)
+	}
+	// Import the archives into a fresh database and check the chain
+	imported := newHistoryTestDatabase(t, gspec)
+	if err := ImportHistory(imported, dir, trusted); err != nil {
+		t.Fatalf("failed to import history: %v", err)
+	}
+	if frozen, _ := imported.Ancients(); frozen != 2*era.MaxSize {
+		t.Fatalf("ancient count mismatch: have %d, want %d", frozen, 2*era.MaxSize)
+	}
+	for n := uint64(0); n < 2*era.MaxSize; n++ {
+		hash := rawdb.ReadCanonicalHash(db, n)
+		if have := rawdb.ReadCanonicalHash(imported, n); have != hash {
+			t.Fatalf("block %d: hash mismatch: have %x, want %x", n, have, hash)
+		}
+		if number := rawdb.ReadHeaderNumber(imported, hash); number == nil || *number != n {
+			t.Fatalf("block %d: missing number mapping", n)
+		}
+		if !bytes.Equal(rawdb.ReadBodyRLP(imported, hash, n), rawdb.ReadBodyRLP(db, hash, n)) {
+			t.Fatalf("block %d: body mismatch", n)
+		}
+		if !bytes.Equal(rawdb.ReadReceiptsRLP(imported, hash, n), rawdb.ReadReceiptsRLP(db, hash, n)) {
+			t.Fatalf("block %d: receipts mismatch", n)
+		}
+		if rawdb.ReadTd(imported, hash, n).Cmp(rawdb.ReadTd(db, hash, n)) != 0 {
+			t.Fatalf("block %d: td mismatch", n)
+		}
+	}
+	if head := rawdb.ReadHeadHeaderHash(imported); head != blocks[2*era.MaxSize-2].Hash() {
+		t.Fatalf("head header mismatch: have %x, want %x", head, blocks[2*era.MaxSize-2].Hash())
+	}
+	// Reimporting is a noop
+	if err := ImportHistory(imported, dir, trusted); err != nil {
+		t.Fatalf("failed to reimport history: %v", err)
+	}
+	// Tampered archives fail the checksum
+	path := filepath.Join(dir, archives[1].name)
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob[len(blob)/2]++
+	if err := ioutil.WriteFile(path, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ImportHistory(newHistoryTestDatabase(t, gspec), dir, trusted); err == nil {
+		t.Fatalf("imported tampered archive")
+	}
+	// Archives of a different chain are rejected
+	other := newHistoryTestDatabase(t, &core.Genesis{Config: params.TestChainConfig, ExtraData: []byte("other")})
+	if err := ImportHistory(other, dir, trusted); err == nil {
+		t.Fatalf("imported archives of a different chain")
+	}
+}
+
+// newHistoryTestDatabase creates a freezer backed database holding the genesis.
+func newHistoryTestDatabase(t *testing.T, gspec *core.Genesis) ethdb.Database {
+	ancient, err := ioutil.TempDir("", "history-ancient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), ancient, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(ancient)
+	})
+	gspec.MustCommit(db)
+	return db
+}
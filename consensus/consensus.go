@@ -143,6 +143,32 @@ type PoSA interface {
 	IsSystemTransaction(tx *types.Transaction, header *types.Header) (bool, error)
 	IsSystemContract(to *common.Address) bool
 	EnoughDistance(chain ChainReader, header *types.Header) bool
+
+	// IsActiveValidatorAt returns whether the locally authorized validator is
+	// part of the validator set at the given block.
+	IsActiveValidatorAt(chain ChainHeaderReader, header *types.Header) bool
+
+	// VerifyVote checks whether a fast finality vote was cast by a validator of
+	// the target block and references the justified block of the target.
+	VerifyVote(chain ChainHeaderReader, vote *types.VoteEnvelope) error
+
+	// SignVote signs the given vote data with the locally authorized validator.
+	SignVote(data *types.VoteData) (*types.VoteEnvelope, error)
+
+	// GetJustifiedNumberAndHash returns the latest justified block as seen from
+	// the given header.
+	GetJustifiedNumberAndHash(chain ChainHeaderReader, header *types.Header) (uint64, common.Hash, error)
+
+	// GetFinalizedHeader returns the latest finalized header as seen from the
+	// given header.
+	GetFinalizedHeader(chain ChainHeaderReader, header *types.Header) *types.Header
+}
+
+// VotePool is the source of fast finality votes used by PoSA engines to
+// assemble vote attestations while sealing.
+type VotePool interface {
+	// FetchVoteByBlockHash returns all the known votes targeting the given block.
+	FetchVoteByBlockHash(blockHash common.Hash) []*types.VoteEnvelope
 }
 
 // ErrUnauthorizedValidator is returned if a header is signed by a non-authorized entity,
@@ -580,6 +580,24 @@ const slashingABI = `
 		"stateMutability": "nonpayable",
 		"type": "function"
 	},
+	{
+		"inputs": [
+			{
+				"internalType": "bytes",
+				"name": "header1",
+				"type": "bytes"
+			},
+			{
+				"internalType": "bytes",
+				"name": "header2",
+				"type": "bytes"
+			}
+		],
+		"name": "submitDoubleSignEvidence",
+		"outputs": [],
+		"stateMutability": "nonpayable",
+		"type": "function"
+	},
 	{
 		"inputs": [],
 		"name": "clean",
@@ -17,8 +17,12 @@
 package parlia
 
 import (
+	"math/big"
+
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rpc"
 )
@@ -86,3 +90,118 @@ func (api *API) GetValidatorsAtHash(hash common.Hash) ([]common.Address, error)
 	}
 	return snap.validators(), nil
 }
+
+// GetJustifiedNumber retrieves the number of the latest justified block as seen
+// from the specified block.
+func (api *API) GetJustifiedNumber(number *rpc.BlockNumber) (uint64, error) {
+	// Retrieve the requested block number (or current if none requested)
+	var header *types.Header
+	if number == nil || *number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	// Ensure we have an actually valid block and return its justified number
+	if header == nil {
+		return 0, errUnknownBlock
+	}
+	justified, _, err := api.parlia.GetJustifiedNumberAndHash(api.chain, header)
+	return justified, err
+}
+
+// GetFinalizedNumber retrieves the number of the latest finalized block as seen
+// from the specified block.
+func (api *API) GetFinalizedNumber(number *rpc.BlockNumber) (uint64, error) {
+	// Retrieve the requested block number (or current if none requested)
+	var header *types.Header
+	if number == nil || *number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	// Ensure we have an actually valid block and return its finalized number
+	if header == nil {
+		return 0, errUnknownBlock
+	}
+	finalized := api.parlia.GetFinalizedHeader(api.chain, header)
+	if finalized == nil {
+		return 0, errUnknownBlock
+	}
+	return finalized.Number.Uint64(), nil
+}
+
+// GetValidatorHistory retrieves the validator set changes indexed so far, each
+// with the validators joining and leaving the set at the announcing epoch.
+func (api *API) GetValidatorHistory() ([]*ValidatorSetChange, error) {
+	return validatorHistory(api.parlia.db)
+}
+
+// GetSigningStats retrieves the number of blocks each validator sealed in and
+// out of turn within the specified (inclusive) block range.
+func (api *API) GetSigningStats(from rpc.BlockNumber, to *rpc.BlockNumber) ([]*SigningStats, error) {
+	head := api.chain.CurrentHeader().Number.Uint64()
+
+	last := head
+	if to != nil && *to != rpc.LatestBlockNumber {
+		if *to < 0 {
+			return nil, errUnknownBlock
+		}
+		last = uint64(to.Int64())
+	}
+	first := head
+	if from != rpc.LatestBlockNumber {
+		if from < 0 {
+			return nil, errUnknownBlock
+		}
+		first = uint64(from.Int64())
+	}
+	if first > last || last > head {
+		return nil, errOutOfRangeChain
+	}
+	return signingStats(api.parlia.db, api.chain, api.parlia.config.Epoch, first, last)
+}
+
+// GetFeeDistribution retrieves the split of the transaction fees collected in
+// the specified block between the beneficiaries of the fee schedule and the
+// validator.
+func (api *API) GetFeeDistribution(number *rpc.BlockNumber) (*FeeDistribution, error) {
+	var header *types.Header
+	if number == nil || *number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	hash, num := header.Hash(), header.Number.Uint64()
+
+	body := rawdb.ReadBody(api.parlia.db, hash, num)
+	if body == nil {
+		return nil, errUnknownBlock
+	}
+	return api.parlia.feeDistribution(header, body.Transactions, rawdb.ReadRawReceipts(api.parlia.db, hash, num))
+}
+
+// SetSealerOnline starts or stops the sealing of a local validator of a developer
+// network, so that the others seal its blocks out of turn and slash it.
+func (api *API) SetSealerOnline(val common.Address, online bool) error {
+	return api.parlia.SetSealerOnline(val, online)
+}
+
+// PulseAPI is a user facing RPC API to allow querying the PulseChain specific
+// data, like the sacrifice credits awarded at the PrimordialPulse fork.
+type PulseAPI struct{}
+
+// GetSacrificeCredit retrieves the total sacrifice credit awarded to the given
+// address at the PrimordialPulse fork, or zero if it wasn't credited.
+func (api *PulseAPI) GetSacrificeCredit(address common.Address) (*hexutil.Big, error) {
+	credit, err := LookupSacrificeCredit(address)
+	if err != nil {
+		return nil, err
+	}
+	if credit == nil {
+		credit = new(big.Int)
+	}
+	return (*hexutil.Big)(credit), nil
+}
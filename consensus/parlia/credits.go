@@ -0,0 +1,136 @@
+package parlia
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// errInvalidCredits is returned if the sacrifice credits are not a well formed
+// sequence of length prefixed records.
+var errInvalidCredits = errors.New("invalid sacrifice credits")
+
+var (
+	creditsOnce  sync.Once
+	credits      []*SacrificeCredit          // Sacrifice credits embedded in the binary, in file order
+	creditsIndex map[common.Address]*big.Int // Total sacrifice credit of every credited address
+	creditsErr   error                       // Error encountered while parsing the embedded credits
+)
+
+// SacrificeCredit is a balance credited to an address at the PrimordialPulse
+// fork. An address might be credited by multiple records.
+type SacrificeCredit struct {
+	Address common.Address
+	Amount  *big.Int
+}
+
+// CreditMismatch is a credited address whose balance changed by a different
+// amount at the PrimordialPulse block than it was credited.
+type CreditMismatch struct {
+	Address common.Address
+	Want    *big.Int // Expected balance change
+	Have    *big.Int // Actual balance change
+}
+
+// ParseSacrificeCredits decodes the sacrifice credits from their binary form, a
+// sequence of records each prefixed by its byte length, consisting of the
+// credited address followed by the big endian credit amount.
+func ParseSacrificeCredits(raw []byte) ([]*SacrificeCredit, error) {
+	var parsed []*SacrificeCredit
+	for ptr := 0; ptr < len(raw); {
+		size := int(raw[ptr])
+		ptr++
+
+		if size < common.AddressLength || ptr+size > len(raw) {
+			return nil, fmt.Errorf("%w: record %d at offset %d", errInvalidCredits, len(parsed), ptr-1)
+		}
+		record := raw[ptr : ptr+size]
+		ptr += size
+
+		parsed = append(parsed, &SacrificeCredit{
+			Address: common.BytesToAddress(record[:common.AddressLength]),
+			Amount:  new(big.Int).SetBytes(record[common.AddressLength:]),
+		})
+	}
+	return parsed, nil
+}
+
+// loadSacrificeCredits parses and indexes the embedded sacrifice credits the
+// first time they are needed.
+func loadSacrificeCredits() {
+	creditsOnce.Do(func() {
+		if credits, creditsErr = ParseSacrificeCredits(rawCredits); creditsErr == nil {
+			creditsIndex = AggregateSacrificeCredits(credits)
+		}
+	})
+}
+
+// SacrificeCredits returns the sacrifice credits awarded at the PrimordialPulse
+// fork, in the order they are applied.
+func SacrificeCredits() ([]*SacrificeCredit, error) {
+	loadSacrificeCredits()
+	return credits, creditsErr
+}
+
+// LookupSacrificeCredit returns the total sacrifice credit awarded to the given
+// address at the PrimordialPulse fork, or nil if it wasn't credited.
+func LookupSacrificeCredit(addr common.Address) (*big.Int, error) {
+	loadSacrificeCredits()
+	if creditsErr != nil {
+		return nil, creditsErr
+	}
+	if amount := creditsIndex[addr]; amount != nil {
+		return new(big.Int).Set(amount), nil
+	}
+	return nil, nil
+}
+
+// AggregateSacrificeCredits sums up the sacrifice credits by address.
+func AggregateSacrificeCredits(credits []*SacrificeCredit) map[common.Address]*big.Int {
+	totals := make(map[common.Address]*big.Int)
+	for _, credit := range credits {
+		if total := totals[credit.Address]; total != nil {
+			total.Add(total, credit.Amount)
+		} else {
+			totals[credit.Address] = new(big.Int).Set(credit.Amount)
+		}
+	}
+	return totals
+}
+
+// VerifySacrificeCredits checks that the balance of every credited address grew
+// by its total credit between the states before and after the PrimordialPulse
+// block, including the treasury allocation. Addresses in the skip set, e.g. the
+// ones touched by the block's transactions, are not checked. The mismatches are
+// returned ordered by address.
+func VerifySacrificeCredits(config *params.ParliaConfig, credits []*SacrificeCredit, parent, state *state.StateDB, skip map[common.Address]struct{}) []*CreditMismatch {
+	expected := AggregateSacrificeCredits(credits)
+	if config.Treasury != nil {
+		treasury := common.HexToAddress(config.Treasury.Addr)
+		if expected[treasury] == nil {
+			expected[treasury] = new(big.Int)
+		}
+		expected[treasury].Add(expected[treasury], (*big.Int)(config.Treasury.Balance))
+	}
+	var mismatches []*CreditMismatch
+	for addr, want := range expected {
+		if _, ok := skip[addr]; ok {
+			continue
+		}
+		have := new(big.Int).Sub(state.GetBalance(addr), parent.GetBalance(addr))
+		if have.Cmp(want) != 0 {
+			mismatches = append(mismatches, &CreditMismatch{Address: addr, Want: want, Have: have})
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		return bytes.Compare(mismatches[i].Address[:], mismatches[j].Address[:]) < 0
+	})
+	return mismatches
+}
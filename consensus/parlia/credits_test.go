@@ -0,0 +1,117 @@
+package parlia
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// encodeCredits packs sacrifice credits into their length prefixed binary form.
+func encodeCredits(credits []*SacrificeCredit) []byte {
+	var raw []byte
+	for _, credit := range credits {
+		record := append(credit.Address.Bytes(), credit.Amount.Bytes()...)
+		raw = append(append(raw, byte(len(record))), record...)
+	}
+	return raw
+}
+
+func TestParseSacrificeCredits(t *testing.T) {
+	want := []*SacrificeCredit{
+		{Address: common.Address{0x01}, Amount: big.NewInt(1000)},
+		{Address: common.Address{0x02}, Amount: new(big.Int)},
+		{Address: common.Address{0x01}, Amount: big.NewInt(24)},
+	}
+	raw := encodeCredits(want)
+
+	have, err := ParseSacrificeCredits(raw)
+	if err != nil {
+		t.Fatalf("failed to parse credits: %v", err)
+	}
+	if len(have) != len(want) {
+		t.Fatalf("record count mismatch: have %d, want %d", len(have), len(want))
+	}
+	for i := range want {
+		if have[i].Address != want[i].Address || have[i].Amount.Cmp(want[i].Amount) != 0 {
+			t.Errorf("record %d mismatch: have %x/%v, want %x/%v", i, have[i].Address, have[i].Amount, want[i].Address, want[i].Amount)
+		}
+	}
+	if totals := AggregateSacrificeCredits(have); len(totals) != 2 || totals[common.Address{0x01}].Int64() != 1024 {
+		t.Errorf("aggregated credits mismatch: %v", totals)
+	}
+	// Truncated records and records shorter than an address must be rejected
+	for _, bad := range [][]byte{raw[:len(raw)-1], {0x02, 0x01, 0x02}} {
+		if _, err := ParseSacrificeCredits(bad); !errors.Is(err, errInvalidCredits) {
+			t.Errorf("error mismatch: have %v, want %v", err, errInvalidCredits)
+		}
+	}
+}
+
+func TestEmbeddedSacrificeCredits(t *testing.T) {
+	credits, err := SacrificeCredits()
+	if err != nil {
+		t.Fatalf("failed to decode embedded credits: %v", err)
+	}
+	if len(credits) == 0 {
+		t.Fatalf("no embedded credits")
+	}
+	credit, err := LookupSacrificeCredit(credits[0].Address)
+	if err != nil || credit == nil || credit.Sign() == 0 {
+		t.Fatalf("credited address not found: %v, %v", credit, err)
+	}
+	if credit, err := LookupSacrificeCredit(common.Address{}); credit != nil || err != nil {
+		t.Fatalf("uncredited address found: %v, %v", credit, err)
+	}
+}
+
+func TestVerifySacrificeCredits(t *testing.T) {
+	var (
+		treasury = common.Address{0xee}
+		config   = &params.ParliaConfig{Treasury: &params.Treasury{Addr: treasury.Hex(), Balance: math.NewHexOrDecimal256(500)}}
+		credits  = []*SacrificeCredit{
+			{Address: common.Address{0x01}, Amount: big.NewInt(100)},
+			{Address: common.Address{0x02}, Amount: big.NewInt(200)},
+			{Address: common.Address{0x03}, Amount: big.NewInt(300)},
+			{Address: treasury, Amount: big.NewInt(50)},
+		}
+	)
+	parent, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	parent.AddBalance(common.Address{0x01}, big.NewInt(7))
+
+	post := parent.Copy()
+	post.AddBalance(common.Address{0x01}, big.NewInt(100))
+	post.AddBalance(common.Address{0x02}, big.NewInt(199))
+	post.AddBalance(common.Address{0x03}, big.NewInt(1)) // skipped below
+	post.AddBalance(treasury, big.NewInt(550))
+
+	mismatches := VerifySacrificeCredits(config, credits, parent, post, map[common.Address]struct{}{{0x03}: {}})
+	if len(mismatches) != 1 {
+		t.Fatalf("mismatch count mismatch: have %d, want 1", len(mismatches))
+	}
+	if m := mismatches[0]; m.Address != (common.Address{0x02}) || m.Want.Int64() != 200 || m.Have.Int64() != 199 {
+		t.Fatalf("mismatch details wrong: %x, want %v, have %v", m.Address, m.Want, m.Have)
+	}
+}
+
+// Tests that malformed embedded credits abort the fork block instead of
+// silently skipping the allocations.
+func TestPrimordialPulseAllocationsMalformed(t *testing.T) {
+	defer func(raw []byte) { rawCredits = raw }(rawCredits)
+	rawCredits = []byte{0x20, 0x01}
+
+	engine, _, _ := newDoubleSignTester(t)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("malformed credits applied without failure")
+		}
+	}()
+	engine.primordialPulseAllocations(statedb)
+}
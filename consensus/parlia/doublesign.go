@@ -0,0 +1,400 @@
+package parlia
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	inMemorySealers = 4096 // Number of recent (number, signer) pairs to remember for double sign detection
+
+	maxEvidencesPerBlock = 2   // Maximum number of double sign evidences submitted in a single block
+	evidenceExpiry       = 256 // Number of blocks after which a double sign evidence can't be submitted any more
+)
+
+var (
+	// evidencePrefix is the database key prefix of the pending double sign evidences.
+	evidencePrefix = []byte("parlia-evidence-")
+
+	// errInvalidEvidence is returned if a double sign evidence doesn't prove two
+	// different headers sealed by the same validator at the same height.
+	errInvalidEvidence = errors.New("invalid double sign evidence")
+
+	// errStaleEvidence is returned if a double sign evidence is too old to be
+	// submitted in the current block.
+	errStaleEvidence = errors.New("stale double sign evidence")
+
+	detectedEvidenceMeter = metrics.NewRegisteredMeter("parlia/doublesign/detected", nil)
+)
+
+// DoubleSignEvidence is the proof of a validator sealing two different headers
+// at the same height.
+type DoubleSignEvidence struct {
+	Header1 *types.Header
+	Header2 *types.Header
+}
+
+// newDoubleSignEvidence creates an evidence from two conflicting headers. The
+// headers are ordered by hash, so every node derives the same evidence.
+func newDoubleSignEvidence(a, b *types.Header) *DoubleSignEvidence {
+	if bytes.Compare(a.Hash().Bytes(), b.Hash().Bytes()) > 0 {
+		a, b = b, a
+	}
+	return &DoubleSignEvidence{Header1: types.CopyHeader(a), Header2: types.CopyHeader(b)}
+}
+
+// Hash returns the unique identifier of the evidence.
+func (e *DoubleSignEvidence) Hash() common.Hash {
+	h1, h2 := e.Header1.Hash(), e.Header2.Hash()
+	return crypto.Keccak256Hash(h1[:], h2[:])
+}
+
+// sealerKey identifies a validator sealing at a given height.
+type sealerKey struct {
+	number uint64
+	signer common.Address
+}
+
+// doubleSignMonitor tracks the sealers of the recently verified headers and
+// persists an evidence whenever a validator seals two different headers at the
+// same height. Headers are fed from the seal verification, covering both the
+// block fetcher and batch header verification.
+type doubleSignMonitor struct {
+	db       ethdb.Database
+	sealers  *lru.ARCCache          // Recently seen headers, indexed by height and sealer
+	inflight map[common.Hash]uint64 // Evidences submitted in locally produced blocks, mapped to the block height
+	lock     sync.Mutex
+}
+
+func newDoubleSignMonitor(db ethdb.Database) *doubleSignMonitor {
+	sealers, err := lru.NewARC(inMemorySealers)
+	if err != nil {
+		panic(err)
+	}
+	return &doubleSignMonitor{db: db, sealers: sealers, inflight: make(map[common.Hash]uint64)}
+}
+
+// observe records the sealer of a verified header, storing a double sign
+// evidence if a different header sealed by the same validator at the same
+// height was already seen.
+func (m *doubleSignMonitor) observe(header *types.Header, signer common.Address) {
+	key := sealerKey{number: header.Number.Uint64(), signer: signer}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	cached, ok := m.sealers.Get(key)
+	if !ok {
+		m.sealers.Add(key, types.CopyHeader(header))
+		return
+	}
+	prev := cached.(*types.Header)
+	if prev.Hash() == header.Hash() {
+		return
+	}
+	evidence := newDoubleSignEvidence(prev, header)
+	log.Warn("Detected double signing validator", "number", key.number, "validator", signer, "hash1", evidence.Header1.Hash(), "hash2", evidence.Header2.Hash())
+	detectedEvidenceMeter.Mark(1)
+
+	if err := m.store(evidence); err != nil {
+		log.Error("Failed to store double sign evidence", "number", key.number, "validator", signer, "err", err)
+	}
+}
+
+// store persists a pending evidence into the database.
+func (m *doubleSignMonitor) store(evidence *DoubleSignEvidence) error {
+	if m.db == nil {
+		return nil
+	}
+	blob, err := rlp.EncodeToBytes(evidence)
+	if err != nil {
+		return err
+	}
+	hash := evidence.Hash()
+	return m.db.Put(append(evidencePrefix, hash[:]...), blob)
+}
+
+// discard removes an evidence from the pending set, either because it has been
+// submitted or it turned out to be unusable.
+func (m *doubleSignMonitor) discard(evidence *DoubleSignEvidence) {
+	hash := evidence.Hash()
+
+	m.lock.Lock()
+	delete(m.inflight, hash)
+	m.lock.Unlock()
+
+	if m.db == nil {
+		return
+	}
+	if err := m.db.Delete(append(evidencePrefix, hash[:]...)); err != nil {
+		log.Error("Failed to delete double sign evidence", "hash", hash, "err", err)
+	}
+}
+
+// submitted marks an evidence as carried by a locally produced block at the
+// given height, holding it back until that block is settled.
+func (m *doubleSignMonitor) submitted(evidence *DoubleSignEvidence, number uint64) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.inflight[evidence.Hash()] = number
+}
+
+// inflightAt returns the height of the local block carrying the evidence, if
+// any.
+func (m *doubleSignMonitor) inflightAt(evidence *DoubleSignEvidence) (uint64, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	number, ok := m.inflight[evidence.Hash()]
+	return number, ok
+}
+
+// release forgets the local block carrying the evidence, making it eligible for
+// submission again.
+func (m *doubleSignMonitor) release(evidence *DoubleSignEvidence) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	delete(m.inflight, evidence.Hash())
+}
+
+// pending returns the evidences still to be submitted, oldest first. Evidences
+// which expired as of the given block number are dropped.
+func (m *doubleSignMonitor) pending(number uint64) []*DoubleSignEvidence {
+	if m.db == nil {
+		return nil
+	}
+	var (
+		evidences []*DoubleSignEvidence
+		stale     []*DoubleSignEvidence
+	)
+	it := m.db.NewIterator(evidencePrefix, nil)
+	for it.Next() {
+		evidence := new(DoubleSignEvidence)
+		if err := rlp.DecodeBytes(it.Value(), evidence); err != nil {
+			log.Error("Invalid double sign evidence in database", "key", common.Bytes2Hex(it.Key()), "err", err)
+			continue
+		}
+		if evidence.Header1.Number.Uint64()+evidenceExpiry < number {
+			stale = append(stale, evidence)
+			continue
+		}
+		evidences = append(evidences, evidence)
+	}
+	it.Release()
+
+	for _, evidence := range stale {
+		m.discard(evidence)
+	}
+	sort.Slice(evidences, func(i, j int) bool {
+		return evidences[i].Header1.Number.Cmp(evidences[j].Header1.Number) < 0
+	})
+	return evidences
+}
+
+// verifyDoubleSignEvidence checks that an evidence proves a validator sealing
+// two different headers at the same height, and that it can be submitted in the
+// given block. The validator set is resolved along the ancestry of the block to
+// keep the check independent of the local canonical chain.
+func (p *Parlia) verifyDoubleSignEvidence(chain consensus.ChainHeaderReader, header *types.Header, evidence *DoubleSignEvidence) error {
+	h1, h2 := evidence.Header1, evidence.Header2
+	if h1 == nil || h2 == nil || h1.Number == nil || h2.Number == nil {
+		return errInvalidEvidence
+	}
+	if h1.Number.Cmp(h2.Number) != 0 || h1.Hash() == h2.Hash() {
+		return errInvalidEvidence
+	}
+	number := h1.Number.Uint64()
+	if number == 0 || number >= header.Number.Uint64() {
+		return errInvalidEvidence
+	}
+	if number+evidenceExpiry < header.Number.Uint64() {
+		return errStaleEvidence
+	}
+	signer1, err := ecrecover(h1, p.signatures, p.chainConfig.ChainID)
+	if err != nil {
+		return err
+	}
+	signer2, err := ecrecover(h2, p.signatures, p.chainConfig.ChainID)
+	if err != nil {
+		return err
+	}
+	if signer1 != signer2 || signer1 != h1.Coinbase || signer2 != h2.Coinbase {
+		return errInvalidEvidence
+	}
+	// Ensure the signer was a validator at the height of the evidence
+	ancestor := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	for ancestor != nil && ancestor.Number.Uint64() > number-1 {
+		ancestor = chain.GetHeader(ancestor.ParentHash, ancestor.Number.Uint64()-1)
+	}
+	if ancestor == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	snap, err := p.snapshot(chain, ancestor.Number.Uint64(), ancestor.Hash(), nil)
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Validators[signer1]; !ok {
+		return errInvalidEvidence
+	}
+	return nil
+}
+
+// settleDoubleSignEvidence checks whether the local block which carried an
+// evidence submission made it into the ancestry of the given header. Included
+// evidences are dropped, the ones whose block got replaced are released for
+// submission again. It reports whether the evidence is still pending.
+func (p *Parlia) settleDoubleSignEvidence(chain consensus.ChainHeaderReader, header *types.Header, evidence *DoubleSignEvidence) bool {
+	number, ok := p.doubleSign.inflightAt(evidence)
+	if !ok || number >= header.Number.Uint64() {
+		// Not submitted yet, or the block carrying it is being rebuilt
+		return true
+	}
+	ancestor := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	for ancestor != nil && ancestor.Number.Uint64() > number {
+		ancestor = chain.GetHeader(ancestor.ParentHash, ancestor.Number.Uint64()-1)
+	}
+	if ancestor == nil {
+		// Ancestry unavailable, hold the evidence back until it expires
+		return false
+	}
+	if reader, ok := chain.(consensus.ChainReader); ok {
+		if block := reader.GetBlock(ancestor.Hash(), number); block != nil {
+			for _, tx := range block.Transactions() {
+				if included, err := p.decodeDoubleSignEvidence(tx); err == nil && included != nil && included.Hash() == evidence.Hash() {
+					log.Debug("Double sign evidence included", "number", evidence.Header1.Number, "block", number)
+					p.doubleSign.discard(evidence)
+					return false
+				}
+			}
+		}
+	}
+	p.doubleSign.release(evidence)
+	return true
+}
+
+// submitDoubleSignEvidences submits the pending double sign evidences to the
+// slashing contract while mining a block. Evidences which can't be submitted
+// are dropped, the submitted ones are held back until their block is settled.
+func (p *Parlia) submitDoubleSignEvidences(chain consensus.ChainHeaderReader, state *state.StateDB, header *types.Header, cx core.ChainContext,
+	txs *[]*types.Transaction, receipts *[]*types.Receipt, usedGas *uint64) {
+	submitted := 0
+	for _, evidence := range p.doubleSign.pending(header.Number.Uint64()) {
+		if submitted >= maxEvidencesPerBlock {
+			break
+		}
+		if !p.settleDoubleSignEvidence(chain, header, evidence) {
+			continue
+		}
+		if err := p.verifyDoubleSignEvidence(chain, header, evidence); err != nil {
+			log.Debug("Dropping unusable double sign evidence", "number", evidence.Header1.Number, "err", err)
+			p.doubleSign.discard(evidence)
+			continue
+		}
+		log.Info("Submitting double sign evidence", "number", evidence.Header1.Number, "validator", evidence.Header1.Coinbase)
+		if err := p.submitDoubleSignEvidence(evidence, state, header, cx, txs, receipts, nil, usedGas, true); err != nil {
+			// it is possible that the evidence was already submitted by another validator
+			log.Error("Double sign evidence submission failed", "number", evidence.Header1.Number, "validator", evidence.Header1.Coinbase, "err", err)
+			p.doubleSign.discard(evidence)
+			continue
+		}
+		p.doubleSign.submitted(evidence, header.Number.Uint64())
+		submitted++
+	}
+}
+
+// applyDoubleSignEvidences verifies and applies the double sign evidences
+// submitted at the head of the remaining system transactions of a block.
+func (p *Parlia) applyDoubleSignEvidences(chain consensus.ChainHeaderReader, state *state.StateDB, header *types.Header, cx core.ChainContext,
+	txs *[]*types.Transaction, receipts *[]*types.Receipt, systemTxs *[]*types.Transaction, usedGas *uint64) error {
+	for i := 0; i < maxEvidencesPerBlock && len(*systemTxs) > 0; i++ {
+		evidence, err := p.decodeDoubleSignEvidence((*systemTxs)[0])
+		if err != nil {
+			return err
+		}
+		if evidence == nil {
+			break
+		}
+		if err := p.verifyDoubleSignEvidence(chain, header, evidence); err != nil {
+			return err
+		}
+		if err := p.submitDoubleSignEvidence(evidence, state, header, cx, txs, receipts, systemTxs, usedGas, false); err != nil {
+			return err
+		}
+		p.doubleSign.discard(evidence)
+	}
+	return nil
+}
+
+// decodeDoubleSignEvidence extracts the evidence from a system transaction if
+// it is a double sign evidence submission, or returns nil otherwise.
+func (p *Parlia) decodeDoubleSignEvidence(tx *types.Transaction) (*DoubleSignEvidence, error) {
+	if tx.To() == nil || *tx.To() != common.HexToAddress(systemcontracts.SlashingContract) {
+		return nil, nil
+	}
+	method := p.slashABI.Methods["submitDoubleSignEvidence"]
+	if len(tx.Data()) < 4 || !bytes.Equal(tx.Data()[:4], method.ID) {
+		return nil, nil
+	}
+	args, err := method.Inputs.Unpack(tx.Data()[4:])
+	if err != nil || len(args) != 2 {
+		return nil, errInvalidEvidence
+	}
+	blob1, ok1 := args[0].([]byte)
+	blob2, ok2 := args[1].([]byte)
+	if !ok1 || !ok2 {
+		return nil, errInvalidEvidence
+	}
+	evidence := new(DoubleSignEvidence)
+	if err := rlp.DecodeBytes(blob1, &evidence.Header1); err != nil {
+		return nil, errInvalidEvidence
+	}
+	if err := rlp.DecodeBytes(blob2, &evidence.Header2); err != nil {
+		return nil, errInvalidEvidence
+	}
+	return evidence, nil
+}
+
+// submitDoubleSignEvidence submits both RLP encoded headers of an evidence to
+// the slashing contract.
+func (p *Parlia) submitDoubleSignEvidence(evidence *DoubleSignEvidence, state *state.StateDB, header *types.Header, chain core.ChainContext,
+	txs *[]*types.Transaction, receipts *[]*types.Receipt, receivedTxs *[]*types.Transaction, usedGas *uint64, mining bool) error {
+	// method
+	method := "submitDoubleSignEvidence"
+
+	blob1, err := rlp.EncodeToBytes(evidence.Header1)
+	if err != nil {
+		return err
+	}
+	blob2, err := rlp.EncodeToBytes(evidence.Header2)
+	if err != nil {
+		return err
+	}
+	// get packed data
+	data, err := p.slashABI.Pack(method, blob1, blob2)
+	if err != nil {
+		log.Error("Unable to pack tx for double sign evidence", "error", err)
+		return err
+	}
+	// get system message
+	msg := p.getSystemMessage(header.Coinbase, common.HexToAddress(systemcontracts.SlashingContract), data, common.Big0)
+	// apply message
+	return p.applyTransaction(msg, state, header, chain, txs, receipts, receivedTxs, usedGas, mining)
+}
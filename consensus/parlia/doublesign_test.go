@@ -0,0 +1,236 @@
+package parlia
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// testHeaderChain is a minimal consensus.ChainHeaderReader over a fixed set of
+// headers.
+type testHeaderChain struct {
+	config  *params.ChainConfig
+	headers []*types.Header
+	feed    event.Feed
+}
+
+func (c *testHeaderChain) Config() *params.ChainConfig { return c.config }
+func (c *testHeaderChain) CurrentHeader() *types.Header {
+	return c.headers[len(c.headers)-1]
+}
+func (c *testHeaderChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if number < uint64(len(c.headers)) && c.headers[number].Hash() == hash {
+		return c.headers[number]
+	}
+	return nil
+}
+func (c *testHeaderChain) GetHeaderByNumber(number uint64) *types.Header {
+	if number < uint64(len(c.headers)) {
+		return c.headers[number]
+	}
+	return nil
+}
+func (c *testHeaderChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	for _, header := range c.headers {
+		if header.Hash() == hash {
+			return header
+		}
+	}
+	return nil
+}
+func (c *testHeaderChain) GetTd(hash common.Hash, number uint64) *big.Int { return nil }
+func (c *testHeaderChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return c.feed.Subscribe(ch)
+}
+
+// newDoubleSignTester creates a Parlia engine and a two block chain, whose
+// genesis authorizes the returned validator key.
+func newDoubleSignTester(t *testing.T) (*Parlia, *testHeaderChain, *ecdsa.PrivateKey) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	config := &params.ChainConfig{
+		ChainID:              big.NewInt(943),
+		DoubleSignSlashBlock: big.NewInt(0),
+		Parlia:               &params.ParliaConfig{Period: 3, Epoch: 200},
+	}
+	genesis := &types.Header{
+		Number: big.NewInt(0),
+		Extra:  append(append(make([]byte, extraVanity), signer.Bytes()...), make([]byte, extraSeal)...),
+	}
+	chain := &testHeaderChain{config: config, headers: []*types.Header{genesis}}
+	chain.headers = append(chain.headers, &types.Header{ParentHash: genesis.Hash(), Number: big.NewInt(1)})
+
+	return New(config, rawdb.NewMemoryDatabase(), nil, genesis.Hash(), nil), chain, key
+}
+
+// sealTestHeader creates a header at the given height sealed by the given key.
+func sealTestHeader(t *testing.T, engine *Parlia, key *ecdsa.PrivateKey, number int64, vanity byte) *types.Header {
+	header := &types.Header{
+		Number:     big.NewInt(number),
+		Coinbase:   crypto.PubkeyToAddress(key.PublicKey),
+		Difficulty: diffInTurn,
+		Extra:      make([]byte, extraVanity+extraSeal),
+	}
+	header.Extra[0] = vanity
+
+	sig, err := crypto.Sign(SealHash(header, engine.chainConfig.ChainID).Bytes(), key)
+	if err != nil {
+		t.Fatalf("failed to seal header: %v", err)
+	}
+	copy(header.Extra[extraVanity:], sig)
+	return header
+}
+
+func TestDoubleSignMonitor(t *testing.T) {
+	engine, _, key := newDoubleSignTester(t)
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	h1 := sealTestHeader(t, engine, key, 1, 1)
+	h2 := sealTestHeader(t, engine, key, 1, 2)
+
+	// Seeing the same header repeatedly is not an evidence
+	engine.doubleSign.observe(h1, signer)
+	engine.doubleSign.observe(h1, signer)
+	if evidences := engine.doubleSign.pending(2); len(evidences) != 0 {
+		t.Fatalf("evidence created for a single header: %d", len(evidences))
+	}
+	// A different header at the same height is
+	engine.doubleSign.observe(h2, signer)
+	evidences := engine.doubleSign.pending(2)
+	if len(evidences) != 1 {
+		t.Fatalf("pending evidence count mismatch: have %d, want %d", len(evidences), 1)
+	}
+	if evidences[0].Hash() != newDoubleSignEvidence(h2, h1).Hash() {
+		t.Fatalf("evidence hash depends on header order")
+	}
+	// Expired evidences must be dropped from the store
+	if evidences := engine.doubleSign.pending(2 + evidenceExpiry); len(evidences) != 0 {
+		t.Fatalf("expired evidence still pending")
+	}
+	if evidences := engine.doubleSign.pending(2); len(evidences) != 0 {
+		t.Fatalf("expired evidence not deleted")
+	}
+}
+
+func TestVerifyDoubleSignEvidence(t *testing.T) {
+	engine, chain, key := newDoubleSignTester(t)
+	other, _ := crypto.GenerateKey()
+
+	header := &types.Header{ParentHash: chain.headers[1].Hash(), Number: big.NewInt(2)}
+	h1 := sealTestHeader(t, engine, key, 1, 1)
+
+	tests := []struct {
+		evidence *DoubleSignEvidence
+		err      error
+	}{
+		{newDoubleSignEvidence(h1, sealTestHeader(t, engine, key, 1, 2)), nil},
+		{&DoubleSignEvidence{Header1: h1, Header2: h1}, errInvalidEvidence},
+		{newDoubleSignEvidence(h1, sealTestHeader(t, engine, key, 0, 2)), errInvalidEvidence},
+		{newDoubleSignEvidence(h1, sealTestHeader(t, engine, other, 1, 2)), errInvalidEvidence},
+		{newDoubleSignEvidence(sealTestHeader(t, engine, other, 1, 1), sealTestHeader(t, engine, other, 1, 2)), errInvalidEvidence},
+		{newDoubleSignEvidence(sealTestHeader(t, engine, key, 2, 1), sealTestHeader(t, engine, key, 2, 2)), errInvalidEvidence},
+	}
+	for i, tt := range tests {
+		if err := engine.verifyDoubleSignEvidence(chain, header, tt.evidence); !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestDoubleSignEvidenceTransaction(t *testing.T) {
+	engine, _, key := newDoubleSignTester(t)
+	evidence := newDoubleSignEvidence(sealTestHeader(t, engine, key, 1, 1), sealTestHeader(t, engine, key, 1, 2))
+
+	// Pack the evidence the same way the block producer does and decode it back
+	blob1, _ := rlp.EncodeToBytes(evidence.Header1)
+	blob2, _ := rlp.EncodeToBytes(evidence.Header2)
+	data, err := engine.slashABI.Pack("submitDoubleSignEvidence", blob1, blob2)
+	if err != nil {
+		t.Fatalf("failed to pack evidence: %v", err)
+	}
+	contract := common.HexToAddress(systemcontracts.SlashingContract)
+	decoded, err := engine.decodeDoubleSignEvidence(types.NewTransaction(0, contract, common.Big0, 0, common.Big0, data))
+	if err != nil {
+		t.Fatalf("failed to decode evidence: %v", err)
+	}
+	if decoded == nil || decoded.Hash() != evidence.Hash() {
+		t.Fatalf("decoded evidence mismatch")
+	}
+	// Other system transactions must be skipped
+	slash, _ := engine.slashABI.Pack("slash", evidence.Header1.Coinbase)
+	if decoded, err := engine.decodeDoubleSignEvidence(types.NewTransaction(0, contract, common.Big0, 0, common.Big0, slash)); decoded != nil || err != nil {
+		t.Fatalf("slash transaction decoded as evidence: %v, %v", decoded, err)
+	}
+	// Malformed submissions must be rejected
+	if _, err := engine.decodeDoubleSignEvidence(types.NewTransaction(0, contract, common.Big0, 0, common.Big0, data[:len(data)-32])); err != errInvalidEvidence {
+		t.Fatalf("malformed evidence error mismatch: have %v, want %v", err, errInvalidEvidence)
+	}
+}
+
+// testBlockChain extends the header chain with block bodies.
+type testBlockChain struct {
+	*testHeaderChain
+	blocks map[common.Hash]*types.Block
+}
+
+func (c *testBlockChain) GetBlock(hash common.Hash, number uint64) *types.Block {
+	if block := c.blocks[hash]; block != nil && block.NumberU64() == number {
+		return block
+	}
+	return nil
+}
+
+func TestDoubleSignEvidenceSettlement(t *testing.T) {
+	for _, included := range []bool{false, true} {
+		engine, headers, key := newDoubleSignTester(t)
+		signer := crypto.PubkeyToAddress(key.PublicKey)
+		chain := &testBlockChain{testHeaderChain: headers, blocks: make(map[common.Hash]*types.Block)}
+
+		engine.doubleSign.observe(sealTestHeader(t, engine, key, 1, 1), signer)
+		engine.doubleSign.observe(sealTestHeader(t, engine, key, 1, 2), signer)
+		evidence := engine.doubleSign.pending(2)[0]
+
+		// Submit the evidence in a local block at height 2, rebuilding the block
+		// at the same height must keep submitting it
+		engine.doubleSign.submitted(evidence, 2)
+		header2 := &types.Header{ParentHash: headers.headers[1].Hash(), Number: big.NewInt(2)}
+		if !engine.settleDoubleSignEvidence(chain, header2, evidence) {
+			t.Fatalf("included %v: evidence held back while rebuilding its block", included)
+		}
+		// Seal block 2, either carrying the submission or not
+		var txs []*types.Transaction
+		if included {
+			blob1, _ := rlp.EncodeToBytes(evidence.Header1)
+			blob2, _ := rlp.EncodeToBytes(evidence.Header2)
+			data, _ := engine.slashABI.Pack("submitDoubleSignEvidence", blob1, blob2)
+			txs = append(txs, types.NewTransaction(0, common.HexToAddress(systemcontracts.SlashingContract), common.Big0, 0, common.Big0, data))
+		}
+		block := types.NewBlock(header2, txs, nil, nil, trie.NewStackTrie(nil))
+		headers.headers = append(headers.headers, block.Header())
+		chain.blocks[block.Hash()] = block
+
+		header3 := &types.Header{ParentHash: block.Hash(), Number: big.NewInt(3)}
+		if pending := engine.settleDoubleSignEvidence(chain, header3, evidence); pending == included {
+			t.Fatalf("included %v: pending mismatch: have %v", included, pending)
+		}
+		if _, ok := engine.doubleSign.inflightAt(evidence); ok {
+			t.Fatalf("included %v: evidence still in flight", included)
+		}
+		if have := len(engine.doubleSign.pending(3)); included && have != 0 || !included && have != 1 {
+			t.Fatalf("included %v: pending evidence count mismatch: have %d", included, have)
+		}
+	}
+}
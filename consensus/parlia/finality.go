@@ -0,0 +1,323 @@
+package parlia
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	validatorNumberSize = 1 // Fixed number of extra-data bytes reserved for the validator count after the FastFinality fork
+)
+
+var (
+	// errInvalidAttestation is returned if a header contains a vote attestation
+	// which can't be decoded or doesn't reference the validator set properly.
+	errInvalidAttestation = errors.New("invalid vote attestation")
+
+	// errInvalidAttestationTarget is returned if a vote attestation doesn't
+	// target the parent of the header carrying it.
+	errInvalidAttestationTarget = errors.New("vote attestation target is not the parent block")
+
+	// errInvalidAttestationSource is returned if a vote attestation doesn't
+	// reference the latest justified block as its source.
+	errInvalidAttestationSource = errors.New("vote attestation source is not the justified block")
+
+	// errInsufficientAttestation is returned if a vote attestation isn't signed
+	// by a quorum of the validators.
+	errInsufficientAttestation = errors.New("vote attestation lacks a validator quorum")
+
+	// errInvalidVote is returned if a vote is malformed or doesn't reference the
+	// justified block of its target.
+	errInvalidVote = errors.New("invalid vote")
+
+	// errTooManyValidators is returned if the validator set doesn't fit into the
+	// one byte validator count of the extra-data.
+	errTooManyValidators = errors.New("too many validators for extra-data")
+)
+
+// getValidatorBytesFromHeader returns the validator list embedded into the
+// extra-data of a header. Prior to the FastFinality fork everything between the
+// vanity and the seal is the validator list, afterwards the list is prefixed by
+// its length and only present on epoch blocks. Nil is returned if the extra-data
+// is malformed.
+func getValidatorBytesFromHeader(header *types.Header, chainConfig *params.ChainConfig, parliaConfig *params.ParliaConfig) []byte {
+	if len(header.Extra) < extraVanity+extraSeal {
+		return nil
+	}
+	if !chainConfig.IsFastFinality(header.Number) {
+		return header.Extra[extraVanity : len(header.Extra)-extraSeal]
+	}
+	if header.Number.Uint64()%parliaConfig.Epoch != 0 || len(header.Extra) < extraVanity+validatorNumberSize+extraSeal {
+		return nil
+	}
+	start := extraVanity + validatorNumberSize
+	end := start + int(header.Extra[extraVanity])*validatorBytesLength
+	if end > len(header.Extra)-extraSeal {
+		return nil
+	}
+	return header.Extra[start:end]
+}
+
+// getVoteAttestationFromHeader decodes the vote attestation embedded into the
+// extra-data of a header after the FastFinality fork, if there is any.
+func getVoteAttestationFromHeader(header *types.Header, chainConfig *params.ChainConfig, parliaConfig *params.ParliaConfig) (*types.VoteAttestation, error) {
+	if !chainConfig.IsFastFinality(header.Number) || len(header.Extra) <= extraVanity+extraSeal {
+		return nil, nil
+	}
+	start := extraVanity
+	if header.Number.Uint64()%parliaConfig.Epoch == 0 {
+		start += validatorNumberSize + int(header.Extra[extraVanity])*validatorBytesLength
+		if start > len(header.Extra)-extraSeal {
+			return nil, errInvalidSpanValidators
+		}
+	}
+	raw := header.Extra[start : len(header.Extra)-extraSeal]
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	attestation := new(types.VoteAttestation)
+	if err := rlp.DecodeBytes(raw, attestation); err != nil {
+		return nil, errInvalidAttestation
+	}
+	if attestation.Data == nil {
+		return nil, errInvalidAttestation
+	}
+	return attestation, nil
+}
+
+// quorum returns the number of votes needed to justify a block, which is the
+// ceiling of two thirds of the validators.
+func quorum(validators int) int {
+	return (2*validators + 2) / 3
+}
+
+// SetVotePool injects the source of fast finality votes used to assemble vote
+// attestations while sealing.
+func (p *Parlia) SetVotePool(pool consensus.VotePool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.votePool = pool
+}
+
+// justified returns the latest justified block as tracked by the snapshot. If
+// no block was ever justified, the genesis block is considered justified.
+func (p *Parlia) justified(snap *Snapshot) (uint64, common.Hash) {
+	if snap.Attestation == nil {
+		return 0, p.genesisHash
+	}
+	return snap.Attestation.TargetNumber, snap.Attestation.TargetHash
+}
+
+// verifyVoteAttestation checks the vote attestation of a header, if there is
+// any, against the validator set and justified block of its parent's snapshot.
+func (p *Parlia) verifyVoteAttestation(header, parent *types.Header, snap *Snapshot) error {
+	attestation, err := getVoteAttestationFromHeader(header, p.chainConfig, p.config)
+	if err != nil || attestation == nil {
+		return err
+	}
+	if attestation.Data.TargetNumber != parent.Number.Uint64() || attestation.Data.TargetHash != parent.Hash() {
+		return errInvalidAttestationTarget
+	}
+	number, hash := p.justified(snap)
+	if attestation.Data.SourceNumber != number || attestation.Data.SourceHash != hash {
+		return errInvalidAttestationSource
+	}
+	validators := snap.validators()
+	if len(validators) > types.MaxAttestationValidators {
+		return errInvalidAttestation
+	}
+	if uint64(attestation.VoteAddressSet)>>uint(len(validators)) != 0 {
+		return errInvalidAttestation
+	}
+	count := attestation.VoteAddressSet.Count()
+	if count < quorum(len(validators)) {
+		return errInsufficientAttestation
+	}
+	if len(attestation.Signatures) != count {
+		return errInvalidAttestation
+	}
+	idx := 0
+	for i, validator := range validators {
+		if !attestation.VoteAddressSet.Has(i) {
+			continue
+		}
+		voter, err := types.RecoverVoter(attestation.Data, attestation.Signatures[idx])
+		if err != nil {
+			return err
+		}
+		if voter != validator {
+			return errInvalidAttestation
+		}
+		idx++
+	}
+	return nil
+}
+
+// assembleVoteAttestation aggregates the votes targeting the parent of the
+// header into a vote attestation and appends it to the extra-data. The snapshot
+// must be the one of the parent block. Nothing is appended if no quorum of votes
+// is known.
+func (p *Parlia) assembleVoteAttestation(header *types.Header, snap *Snapshot) error {
+	p.lock.RLock()
+	pool := p.votePool
+	p.lock.RUnlock()
+
+	if pool == nil || !p.chainConfig.IsFastFinality(header.Number) {
+		return nil
+	}
+	number := header.Number.Uint64()
+	validators := snap.validators()
+	if len(validators) > types.MaxAttestationValidators {
+		return nil
+	}
+	votes := pool.FetchVoteByBlockHash(header.ParentHash)
+	if len(votes) < quorum(len(validators)) {
+		return nil
+	}
+	source, sourceHash := p.justified(snap)
+	data := &types.VoteData{
+		SourceNumber: source,
+		SourceHash:   sourceHash,
+		TargetNumber: number - 1,
+		TargetHash:   header.ParentHash,
+	}
+	signatures := make(map[common.Address][]byte)
+	for _, vote := range votes {
+		if *vote.Data != *data {
+			continue
+		}
+		voter, err := vote.Voter()
+		if err != nil {
+			continue
+		}
+		if _, ok := snap.Validators[voter]; ok {
+			signatures[voter] = vote.Signature
+		}
+	}
+	if len(signatures) < quorum(len(validators)) {
+		return nil
+	}
+	attestation := &types.VoteAttestation{Data: data}
+	for i, validator := range validators {
+		if sig, ok := signatures[validator]; ok {
+			attestation.VoteAddressSet = attestation.VoteAddressSet.Set(i)
+			attestation.Signatures = append(attestation.Signatures, sig)
+		}
+	}
+	blob, err := rlp.EncodeToBytes(attestation)
+	if err != nil {
+		return err
+	}
+	header.Extra = append(header.Extra, blob...)
+
+	log.Debug("Assembled vote attestation", "number", number, "target", data.TargetHash, "source", data.SourceNumber, "votes", len(signatures))
+	return nil
+}
+
+// IsActiveValidatorAt implements consensus.PoSA, returning whether the locally
+// authorized validator is part of the validator set after the given block.
+func (p *Parlia) IsActiveValidatorAt(chain consensus.ChainHeaderReader, header *types.Header) bool {
+	p.lock.RLock()
+	val := p.val
+	p.lock.RUnlock()
+
+	snap, err := p.snapshot(chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return false
+	}
+	_, ok := snap.Validators[val]
+	return ok
+}
+
+// VerifyVote implements consensus.PoSA, checking that a vote was cast by one of
+// the validators of the target block and references its justified block.
+func (p *Parlia) VerifyVote(chain consensus.ChainHeaderReader, vote *types.VoteEnvelope) error {
+	if vote.Data == nil {
+		return errInvalidVote
+	}
+	target := chain.GetHeader(vote.Data.TargetHash, vote.Data.TargetNumber)
+	if target == nil {
+		return errUnknownBlock
+	}
+	if !p.chainConfig.IsFastFinality(new(big.Int).Add(target.Number, common.Big1)) {
+		return errInvalidVote
+	}
+	snap, err := p.snapshot(chain, target.Number.Uint64(), target.Hash(), nil)
+	if err != nil {
+		return err
+	}
+	number, hash := p.justified(snap)
+	if vote.Data.SourceNumber != number || vote.Data.SourceHash != hash {
+		return errInvalidVote
+	}
+	voter, err := vote.Voter()
+	if err != nil {
+		return err
+	}
+	if _, ok := snap.Validators[voter]; !ok {
+		return &consensus.ErrUnauthorizedValidator{}
+	}
+	return nil
+}
+
+// SignVote implements consensus.PoSA, signing the vote data with the locally
+// authorized validator.
+func (p *Parlia) SignVote(data *types.VoteData) (*types.VoteEnvelope, error) {
+	p.lock.RLock()
+	val, signFn := p.val, p.signFn
+	p.lock.RUnlock()
+
+	if signFn == nil {
+		return nil, &consensus.ErrUnauthorizedValidator{}
+	}
+	payload, err := rlp.EncodeToBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signFn(accounts.Account{Address: val}, accounts.MimetypeParliaVote, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &types.VoteEnvelope{Signature: sig, Data: data}, nil
+}
+
+// GetJustifiedNumberAndHash implements consensus.PoSA, returning the latest
+// justified block as seen from the given header.
+func (p *Parlia) GetJustifiedNumberAndHash(chain consensus.ChainHeaderReader, header *types.Header) (uint64, common.Hash, error) {
+	if header == nil {
+		return 0, common.Hash{}, errUnknownBlock
+	}
+	snap, err := p.snapshot(chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return 0, common.Hash{}, err
+	}
+	number, hash := p.justified(snap)
+	return number, hash, nil
+}
+
+// GetFinalizedHeader implements consensus.PoSA, returning the latest finalized
+// header as seen from the given header. A justified block is finalized once its
+// direct child gets justified too.
+func (p *Parlia) GetFinalizedHeader(chain consensus.ChainHeaderReader, header *types.Header) *types.Header {
+	if header == nil {
+		return nil
+	}
+	snap, err := p.snapshot(chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		log.Debug("Failed to retrieve snapshot for finality", "number", header.Number, "hash", header.Hash(), "err", err)
+		return nil
+	}
+	if snap.Attestation == nil {
+		return chain.GetHeaderByNumber(0)
+	}
+	return chain.GetHeader(snap.Attestation.SourceHash, snap.Attestation.SourceNumber)
+}
@@ -0,0 +1,186 @@
+package parlia
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// testVotePool is a consensus.VotePool serving a fixed set of votes.
+type testVotePool map[common.Hash][]*types.VoteEnvelope
+
+func (p testVotePool) FetchVoteByBlockHash(hash common.Hash) []*types.VoteEnvelope {
+	return p[hash]
+}
+
+// newFinalityTester creates a Parlia engine with fast finality active from
+// genesis, along with a snapshot of the given number of validators.
+func newFinalityTester(validators int) (*Parlia, *Snapshot, map[common.Address]*ecdsa.PrivateKey) {
+	keys := make(map[common.Address]*ecdsa.PrivateKey)
+	addrs := make([]common.Address, 0, validators)
+	for i := 0; i < validators; i++ {
+		key, _ := crypto.GenerateKey()
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		keys[addr] = key
+		addrs = append(addrs, addr)
+	}
+	config := &params.ParliaConfig{Period: 3, Epoch: 200}
+	engine := &Parlia{
+		chainConfig: &params.ChainConfig{FastFinalityBlock: big.NewInt(0), Parlia: config},
+		config:      config,
+		genesisHash: common.Hash{0x01},
+	}
+	return engine, newSnapshot(config, nil, 0, engine.genesisHash, addrs, nil), keys
+}
+
+func signVote(t *testing.T, key *ecdsa.PrivateKey, data *types.VoteData) *types.VoteEnvelope {
+	sig, err := crypto.Sign(data.Hash().Bytes(), key)
+	if err != nil {
+		t.Fatalf("failed to sign vote: %v", err)
+	}
+	return &types.VoteEnvelope{Signature: sig, Data: data}
+}
+
+func TestValidatorBytesFromHeader(t *testing.T) {
+	config := &params.ParliaConfig{Period: 3, Epoch: 200}
+	chainConfig := &params.ChainConfig{FastFinalityBlock: big.NewInt(400), Parlia: config}
+
+	validators := make([]byte, 2*validatorBytesLength)
+	for i := range validators {
+		validators[i] = byte(i)
+	}
+	legacy := append(append(make([]byte, extraVanity), validators...), make([]byte, extraSeal)...)
+	counted := append(append(append(make([]byte, extraVanity), 2), validators...), make([]byte, extraSeal)...)
+	attested := append(append(append(append(make([]byte, extraVanity), 2), validators...), 0xc0), make([]byte, extraSeal)...)
+
+	tests := []struct {
+		number uint64
+		extra  []byte
+		want   []byte
+	}{
+		{200, legacy, validators},                         // Pre-fork, no count prefix
+		{400, counted, validators},                        // Post-fork epoch with count prefix
+		{400, attested, validators},                       // Post-fork epoch followed by an attestation
+		{401, counted, nil},                               // Post-fork non-epoch block carries no validators
+		{400, counted[:extraVanity+2+extraSeal], nil},     // Count exceeding the extra-data
+		{400, make([]byte, extraVanity+extraSeal-1), nil}, // Truncated extra-data
+	}
+	for i, tt := range tests {
+		header := &types.Header{Number: new(big.Int).SetUint64(tt.number), Extra: tt.extra}
+		if have := getValidatorBytesFromHeader(header, chainConfig, config); string(have) != string(tt.want) {
+			t.Errorf("test %d: validator bytes mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
+
+func TestVoteAttestation(t *testing.T) {
+	engine, snap, keys := newFinalityTester(4)
+
+	parent := &types.Header{Number: big.NewInt(10), Extra: make([]byte, extraVanity+extraSeal)}
+	data := &types.VoteData{
+		SourceNumber: 0,
+		SourceHash:   engine.genesisHash,
+		TargetNumber: 10,
+		TargetHash:   parent.Hash(),
+	}
+	// Collect votes from all but one validator, which is still a quorum of 3
+	pool := make(testVotePool)
+	for i, addr := range snap.validators() {
+		if i == 0 {
+			continue
+		}
+		pool[data.TargetHash] = append(pool[data.TargetHash], signVote(t, keys[addr], data))
+	}
+	engine.SetVotePool(pool)
+
+	header := &types.Header{Number: big.NewInt(11), ParentHash: parent.Hash(), Extra: make([]byte, extraVanity)}
+	if err := engine.assembleVoteAttestation(header, snap); err != nil {
+		t.Fatalf("failed to assemble attestation: %v", err)
+	}
+	header.Extra = append(header.Extra, make([]byte, extraSeal)...)
+
+	attestation, err := getVoteAttestationFromHeader(header, engine.chainConfig, engine.config)
+	if err != nil || attestation == nil {
+		t.Fatalf("failed to retrieve attestation: %v", err)
+	}
+	if have := attestation.VoteAddressSet.Count(); have != 3 {
+		t.Fatalf("attestation voter count mismatch: have %d, want %d", have, 3)
+	}
+	if err := engine.verifyVoteAttestation(header, parent, snap); err != nil {
+		t.Fatalf("failed to verify assembled attestation: %v", err)
+	}
+	// Justify the parent and ensure the snapshot tracks it
+	snap.updateAttestation(header, engine.chainConfig)
+	if number, hash := engine.justified(snap); number != 10 || hash != parent.Hash() {
+		t.Fatalf("justified block mismatch: have #%d [%x], want #%d [%x]", number, hash, 10, parent.Hash())
+	}
+	// Any other parent must be rejected
+	other := &types.Header{Number: big.NewInt(10), Extra: make([]byte, extraVanity+extraSeal+1)}
+	if err := engine.verifyVoteAttestation(header, other, snap); !errors.Is(err, errInvalidAttestationTarget) {
+		t.Fatalf("unexpected error for foreign target: have %v, want %v", err, errInvalidAttestationTarget)
+	}
+}
+
+func TestVoteAttestationQuorum(t *testing.T) {
+	engine, snap, keys := newFinalityTester(4)
+
+	parent := &types.Header{Number: big.NewInt(10), Extra: make([]byte, extraVanity+extraSeal)}
+	data := &types.VoteData{
+		SourceNumber: 0,
+		SourceHash:   engine.genesisHash,
+		TargetNumber: 10,
+		TargetHash:   parent.Hash(),
+	}
+	validators := snap.validators()
+
+	// Nothing must be assembled without a quorum of votes
+	engine.SetVotePool(testVotePool{data.TargetHash: {
+		signVote(t, keys[validators[0]], data),
+		signVote(t, keys[validators[1]], data),
+	}})
+	header := &types.Header{Number: big.NewInt(11), ParentHash: parent.Hash(), Extra: make([]byte, extraVanity)}
+	if err := engine.assembleVoteAttestation(header, snap); err != nil {
+		t.Fatalf("failed to assemble attestation: %v", err)
+	}
+	if len(header.Extra) != extraVanity {
+		t.Fatalf("attestation assembled without quorum")
+	}
+	// Forged attestations with too few or mismatching signatures must be rejected
+	tests := []struct {
+		set  types.ValidatorBitSet
+		sigs [][]byte
+		err  error
+	}{
+		{
+			set:  types.ValidatorBitSet(0).Set(0).Set(1),
+			sigs: [][]byte{signVote(t, keys[validators[0]], data).Signature, signVote(t, keys[validators[1]], data).Signature},
+			err:  errInsufficientAttestation,
+		},
+		{
+			set:  types.ValidatorBitSet(0).Set(0).Set(1).Set(2),
+			sigs: [][]byte{signVote(t, keys[validators[0]], data).Signature, signVote(t, keys[validators[1]], data).Signature, signVote(t, keys[validators[3]], data).Signature},
+			err:  errInvalidAttestation,
+		},
+		{
+			set:  types.ValidatorBitSet(0).Set(0).Set(1).Set(4),
+			sigs: [][]byte{signVote(t, keys[validators[0]], data).Signature, signVote(t, keys[validators[1]], data).Signature, signVote(t, keys[validators[2]], data).Signature},
+			err:  errInvalidAttestation,
+		},
+	}
+	for i, tt := range tests {
+		header := &types.Header{Number: big.NewInt(11), ParentHash: parent.Hash()}
+		blob, _ := rlp.EncodeToBytes(&types.VoteAttestation{VoteAddressSet: tt.set, Signatures: tt.sigs, Data: data})
+		header.Extra = append(append(make([]byte, extraVanity), blob...), make([]byte, extraSeal)...)
+
+		if err := engine.verifyVoteAttestation(header, parent, snap); !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
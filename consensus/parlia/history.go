@@ -0,0 +1,314 @@
+package parlia
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	historyConfirmations = 64    // Number of blocks an epoch needs to be buried under before getting indexed
+	historyHeadChanSize  = 10    // Size of the channel listening to chain head events
+	maxSigningStatsScan  = 16384 // Maximum number of unindexed headers scanned to serve a signing stats query
+)
+
+// errSigningStatsRange is returned if a signing stats query would need to scan
+// too many headers not covered by the history index.
+var errSigningStatsRange = errors.New("signing stats range not indexed and too large to scan")
+
+// ValidatorSetChange is a change of the validator set announced at an epoch
+// block. The new set becomes active len(previous validators)/2 blocks later.
+type ValidatorSetChange struct {
+	Number     uint64           `json:"number"`     // Number of the epoch block announcing the validator set
+	Hash       common.Hash      `json:"hash"`       // Hash of the epoch block announcing the validator set
+	Epoch      uint64           `json:"epoch"`      // Index of the epoch
+	Validators []common.Address `json:"validators"` // Full validator set announced at the epoch block
+	Added      []common.Address `json:"added"`      // Validators joining the set
+	Removed    []common.Address `json:"removed"`    // Validators leaving the set
+}
+
+// SigningStats is the number of blocks a validator sealed in and out of turn.
+type SigningStats struct {
+	Validator common.Address `json:"validator"`
+	InTurn    uint64         `json:"inTurn"`
+	OutOfTurn uint64         `json:"outOfTurn"`
+}
+
+// historyChain provides the chain access needed by the history indexer.
+type historyChain interface {
+	consensus.ChainHeaderReader
+
+	// SubscribeChainHeadEvent subscribes to new chain head notifications.
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+}
+
+// HistoryIndexer walks the epoch blocks of the canonical chain and persists the
+// validator set transitions and the per-validator signing statistics of every
+// epoch. Only epochs buried deep enough to be considered final are indexed.
+type HistoryIndexer struct {
+	db          ethdb.Database
+	chain       historyChain
+	chainConfig *params.ChainConfig
+	config      *params.ParliaConfig
+
+	validators []common.Address // Validator set announced at the last indexed epoch
+
+	headCh  chan core.ChainHeadEvent
+	headSub event.Subscription
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewHistoryIndexer creates a validator history indexer for the given chain
+// and starts indexing in the background.
+func NewHistoryIndexer(db ethdb.Database, chain historyChain) *HistoryIndexer {
+	h := &HistoryIndexer{
+		db:          db,
+		chain:       chain,
+		chainConfig: chain.Config(),
+		config:      chain.Config().Parlia,
+		headCh:      make(chan core.ChainHeadEvent, historyHeadChanSize),
+		quit:        make(chan struct{}),
+	}
+	if changes := rawdb.ReadParliaValidatorChanges(db); len(changes) > 0 {
+		last := new(ValidatorSetChange)
+		if err := rlp.DecodeBytes(changes[len(changes)-1], last); err != nil {
+			log.Error("Invalid validator set change in database", "err", err)
+		} else {
+			h.validators = last.Validators
+		}
+	}
+	h.headSub = chain.SubscribeChainHeadEvent(h.headCh)
+
+	h.wg.Add(1)
+	go h.loop()
+	return h
+}
+
+// Stop terminates the background indexing.
+func (h *HistoryIndexer) Stop() {
+	h.headSub.Unsubscribe()
+	close(h.quit)
+	h.wg.Wait()
+}
+
+func (h *HistoryIndexer) loop() {
+	defer h.wg.Done()
+
+	h.index(h.chain.CurrentHeader().Number.Uint64())
+	for {
+		select {
+		case ev := <-h.headCh:
+			if ev.Block != nil {
+				h.index(ev.Block.NumberU64())
+			}
+		case <-h.headSub.Err():
+			return
+		case <-h.quit:
+			return
+		}
+	}
+}
+
+// next returns the number of the next epoch block to index.
+func (h *HistoryIndexer) next() uint64 {
+	if last := rawdb.ReadParliaHistoryHead(h.db); last != nil {
+		return *last + h.config.Epoch
+	}
+	// Blocks prior to the PrimordialPulse fork weren't sealed by validators
+	if fork := h.chainConfig.PrimordialPulseBlock; fork != nil {
+		return (fork.Uint64() + h.config.Epoch - 1) / h.config.Epoch * h.config.Epoch
+	}
+	return 0
+}
+
+// index indexes all the epochs final as of the given chain head.
+func (h *HistoryIndexer) index(head uint64) {
+	for number := h.next(); number+h.config.Epoch-1+historyConfirmations <= head; number += h.config.Epoch {
+		select {
+		case <-h.quit:
+			return
+		default:
+		}
+		if err := h.indexEpoch(number); err != nil {
+			log.Warn("Failed to index validator history", "number", number, "err", err)
+			return
+		}
+	}
+}
+
+// indexEpoch persists the validator set change announced at the given epoch
+// block and the signing statistics of the epoch's blocks.
+func (h *HistoryIndexer) indexEpoch(number uint64) error {
+	header := h.chain.GetHeaderByNumber(number)
+	if header == nil {
+		return errUnknownBlock
+	}
+	var validators []common.Address
+	if validatorBytes := getValidatorBytesFromHeader(header, h.chainConfig, h.config); validatorBytes != nil {
+		parsed, err := ParseValidators(validatorBytes)
+		if err != nil {
+			return err
+		}
+		validators = parsed
+		sort.Sort(validatorsAscending(validators))
+	}
+	// Count the blocks sealed by each validator during the epoch
+	stats := make(map[common.Address]*SigningStats)
+	for n := number; n < number+h.config.Epoch; n++ {
+		if n == 0 {
+			continue // Genesis is not sealed
+		}
+		sealed := h.chain.GetHeaderByNumber(n)
+		if sealed == nil {
+			return errUnknownBlock
+		}
+		accumulateSigningStats(stats, sealed)
+	}
+	batch := h.db.NewBatch()
+	if validators != nil {
+		added, removed := diffValidators(h.validators, validators)
+		if len(added) > 0 || len(removed) > 0 {
+			blob, err := rlp.EncodeToBytes(&ValidatorSetChange{
+				Number:     number,
+				Hash:       header.Hash(),
+				Epoch:      number / h.config.Epoch,
+				Validators: validators,
+				Added:      added,
+				Removed:    removed,
+			})
+			if err != nil {
+				return err
+			}
+			rawdb.WriteParliaValidatorChange(batch, number, blob)
+		}
+	}
+	blob, err := rlp.EncodeToBytes(sortSigningStats(stats))
+	if err != nil {
+		return err
+	}
+	rawdb.WriteParliaSigningStats(batch, number, blob)
+	rawdb.WriteParliaHistoryHead(batch, number)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	if validators != nil {
+		h.validators = validators
+	}
+	log.Debug("Indexed validator history", "number", number, "validators", len(validators), "signers", len(stats))
+	return nil
+}
+
+// accumulateSigningStats counts a sealed header towards the stats of its sealer.
+func accumulateSigningStats(stats map[common.Address]*SigningStats, header *types.Header) {
+	s := stats[header.Coinbase]
+	if s == nil {
+		s = &SigningStats{Validator: header.Coinbase}
+		stats[header.Coinbase] = s
+	}
+	if header.Difficulty != nil && header.Difficulty.Cmp(diffInTurn) == 0 {
+		s.InTurn++
+	} else {
+		s.OutOfTurn++
+	}
+}
+
+// sortSigningStats flattens the signing stats into a list ordered by validator.
+func sortSigningStats(stats map[common.Address]*SigningStats) []*SigningStats {
+	list := make([]*SigningStats, 0, len(stats))
+	for _, s := range stats {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].Validator[:], list[j].Validator[:]) < 0
+	})
+	return list
+}
+
+// diffValidators returns the validators added and removed between two sets.
+func diffValidators(prev, next []common.Address) (added, removed []common.Address) {
+	known := make(map[common.Address]struct{}, len(prev))
+	for _, val := range prev {
+		known[val] = struct{}{}
+	}
+	for _, val := range next {
+		if _, ok := known[val]; ok {
+			delete(known, val)
+			continue
+		}
+		added = append(added, val)
+	}
+	for _, val := range prev {
+		if _, ok := known[val]; ok {
+			removed = append(removed, val)
+		}
+	}
+	return added, removed
+}
+
+// validatorHistory retrieves all the indexed validator set changes.
+func validatorHistory(db ethdb.Database) ([]*ValidatorSetChange, error) {
+	blobs := rawdb.ReadParliaValidatorChanges(db)
+	changes := make([]*ValidatorSetChange, 0, len(blobs))
+	for _, blob := range blobs {
+		change := new(ValidatorSetChange)
+		if err := rlp.DecodeBytes(blob, change); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// signingStats aggregates the signing statistics of the given block range,
+// served from the history index for fully indexed epochs and from the headers
+// themselves otherwise.
+func signingStats(db ethdb.Database, chain consensus.ChainHeaderReader, epoch uint64, from, to uint64) ([]*SigningStats, error) {
+	var (
+		stats   = make(map[common.Address]*SigningStats)
+		scanned int
+	)
+	for number := from; number <= to; {
+		if number%epoch == 0 && number+epoch-1 <= to {
+			if blob := rawdb.ReadParliaSigningStats(db, number); blob != nil {
+				var indexed []*SigningStats
+				if err := rlp.DecodeBytes(blob, &indexed); err != nil {
+					return nil, err
+				}
+				for _, s := range indexed {
+					if stats[s.Validator] == nil {
+						stats[s.Validator] = &SigningStats{Validator: s.Validator}
+					}
+					stats[s.Validator].InTurn += s.InTurn
+					stats[s.Validator].OutOfTurn += s.OutOfTurn
+				}
+				number += epoch
+				continue
+			}
+		}
+		if scanned++; scanned > maxSigningStatsScan {
+			return nil, errSigningStatsRange
+		}
+		if number > 0 {
+			header := chain.GetHeaderByNumber(number)
+			if header == nil {
+				return nil, errUnknownBlock
+			}
+			accumulateSigningStats(stats, header)
+		}
+		number++
+	}
+	return sortSigningStats(stats), nil
+}
@@ -0,0 +1,107 @@
+package parlia
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// newHistoryTestChain creates a chain of the given length with an epoch of 4
+// blocks, where every epoch block announces the validators produced by the
+// callback. Blocks are sealed round-robin by the announced validators, the
+// first one in turn.
+func newHistoryTestChain(length int, validators func(epoch uint64) []common.Address) *testHeaderChain {
+	config := &params.ChainConfig{ChainID: big.NewInt(1), Parlia: &params.ParliaConfig{Period: 3, Epoch: 4}}
+	chain := &testHeaderChain{config: config}
+
+	var (
+		parent common.Hash
+		active []common.Address
+	)
+	for i := 0; i < length; i++ {
+		header := &types.Header{ParentHash: parent, Number: big.NewInt(int64(i)), Difficulty: diffNoTurn, Extra: make([]byte, extraVanity)}
+		if uint64(i)%config.Parlia.Epoch == 0 {
+			active = validators(uint64(i) / config.Parlia.Epoch)
+			for _, val := range active {
+				header.Extra = append(header.Extra, val.Bytes()...)
+			}
+		}
+		header.Extra = append(header.Extra, make([]byte, extraSeal)...)
+		header.Coinbase = active[i%len(active)]
+		if i%len(active) == 0 {
+			header.Difficulty = diffInTurn
+		}
+		chain.headers = append(chain.headers, header)
+		parent = header.Hash()
+	}
+	return chain
+}
+
+func TestHistoryIndexer(t *testing.T) {
+	var (
+		a = common.Address{0x0a}
+		b = common.Address{0x0b}
+		c = common.Address{0x0c}
+	)
+	chain := newHistoryTestChain(12, func(epoch uint64) []common.Address {
+		if epoch == 0 {
+			return []common.Address{a, b}
+		}
+		return []common.Address{c, a}
+	})
+	indexer := &HistoryIndexer{
+		db:          rawdb.NewMemoryDatabase(),
+		chain:       chain,
+		chainConfig: chain.config,
+		config:      chain.config.Parlia,
+	}
+	for number := uint64(0); number < 12; number += 4 {
+		if err := indexer.indexEpoch(number); err != nil {
+			t.Fatalf("failed to index epoch %d: %v", number, err)
+		}
+	}
+	// Only the genesis set and the first change must be recorded
+	history, err := validatorHistory(indexer.db)
+	if err != nil {
+		t.Fatalf("failed to retrieve history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("history length mismatch: have %d, want %d", len(history), 2)
+	}
+	if !reflect.DeepEqual(history[0].Added, []common.Address{a, b}) || len(history[0].Removed) != 0 {
+		t.Errorf("genesis change mismatch: added %v, removed %v", history[0].Added, history[0].Removed)
+	}
+	if history[1].Number != 4 || history[1].Epoch != 1 {
+		t.Errorf("change position mismatch: have #%d (epoch %d), want #4 (epoch 1)", history[1].Number, history[1].Epoch)
+	}
+	if !reflect.DeepEqual(history[1].Added, []common.Address{c}) || !reflect.DeepEqual(history[1].Removed, []common.Address{b}) {
+		t.Errorf("epoch change mismatch: added %v, removed %v", history[1].Added, history[1].Removed)
+	}
+	if !reflect.DeepEqual(history[1].Validators, []common.Address{a, c}) {
+		t.Errorf("epoch validators mismatch: have %v, want %v", history[1].Validators, []common.Address{a, c})
+	}
+	// Partially indexed and unindexed ranges must yield the same stats
+	for _, db := range []ethdb.Database{indexer.db, rawdb.NewMemoryDatabase()} {
+		stats, err := signingStats(db, chain, 4, 2, 11)
+		if err != nil {
+			t.Fatalf("failed to retrieve signing stats: %v", err)
+		}
+		want := []*SigningStats{
+			{Validator: a, InTurn: 1, OutOfTurn: 4},
+			{Validator: b, InTurn: 0, OutOfTurn: 1},
+			{Validator: c, InTurn: 4, OutOfTurn: 0},
+		}
+		if !reflect.DeepEqual(stats, want) {
+			t.Errorf("signing stats mismatch")
+			for i, s := range stats {
+				t.Logf("stat %d: %+v", i, s)
+			}
+		}
+	}
+}
@@ -85,6 +85,10 @@ var (
 	// that is not part of the local blockchain.
 	errUnknownBlock = errors.New("unknown block")
 
+	// errNoFeeSchedule is returned if the fee distribution of a block is requested
+	// but no fee schedule is in effect at it.
+	errNoFeeSchedule = errors.New("no fee schedule in effect")
+
 	// errMissingVanity is returned if a block's extra-data section is shorter than
 	// 32 bytes, which is required to store the signer vanity.
 	errMissingVanity = errors.New("extra-data 32 byte vanity prefix missing")
@@ -198,6 +202,11 @@ type Parlia struct {
 	validatorSetABI abi.ABI
 	slashABI        abi.ABI
 	stakingABI      abi.ABI
+	votePool        consensus.VotePool // Source of fast finality votes to assemble attestations from
+	doubleSign      *doubleSignMonitor // Detector and store of double sign evidences
+	protection      *sealProtection    // Record of the headers signed locally, refusing conflicting ones
+
+	sealers map[common.Address]*devSealer // Local validators taking turns sealing on developer networks, protected by lock
 
 	// The fields below are for testing only
 	fakeDiff bool // Skip difficulty verifications
@@ -250,6 +259,8 @@ func New(chainConfig *params.ChainConfig, db ethdb.Database, ethAPI *ethapi.Publ
 		validatorSetABI: vABI,
 		slashABI:        slABI,
 		stakingABI:      stABI,
+		doubleSign:      newDoubleSignMonitor(db),
+		protection:      newSealProtection(db),
 		signer:          types.NewLondonSigner(chainConfig.ChainID),
 		makeEthash:      makeEthash,
 	}
@@ -375,12 +386,18 @@ func (p *Parlia) verifyHeader(chain consensus.ChainHeaderReader, header *types.H
 	isEpoch := number%p.config.Epoch == 0
 
 	// Ensure that the extra-data contains a signer list on checkpoint, but none otherwise
-	signersBytes := len(header.Extra) - extraVanity - extraSeal
-	if !isEpoch && signersBytes != 0 {
-		return errExtraValidators
-	}
+	if !p.chainConfig.IsFastFinality(header.Number) {
+		signersBytes := len(header.Extra) - extraVanity - extraSeal
+		if !isEpoch && signersBytes != 0 {
+			return errExtraValidators
+		}
 
-	if isEpoch && signersBytes%validatorBytesLength != 0 {
+		if isEpoch && signersBytes%validatorBytesLength != 0 {
+			return errInvalidSpanValidators
+		}
+	} else if isEpoch && getValidatorBytesFromHeader(header, p.chainConfig, p.config) == nil {
+		// After the FastFinality fork the signer list is length prefixed and may be
+		// followed by a vote attestation, which is verified with the cascading fields
 		return errInvalidSpanValidators
 	}
 
@@ -438,6 +455,11 @@ func (p *Parlia) verifyCascadingFields(chain consensus.ChainHeaderReader, header
 		return err
 	}
 
+	// Verify the fast finality vote attestation, if any
+	if err := p.verifyVoteAttestation(header, parent, snap); err != nil {
+		return err
+	}
+
 	// Verify that the gas limit is <= 2^63-1
 	capacity := uint64(0x7fffffffffffffff)
 	if header.GasLimit > capacity {
@@ -501,29 +523,15 @@ func (p *Parlia) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 		if number == 0 {
 			checkpoint := chain.GetHeaderByNumber(number)
 			if checkpoint != nil {
-				// get checkpoint data
-				hash := checkpoint.Hash()
-
-				if p.chainConfig.PrimordialPulseAhead(common.Big0) {
-					// If we're at the genesis, but there is a PrimordialPulse fork in our future,
-					// this implies that we're behind the forked chain. Suppose an empty set of validators
-					// and wait for chain synchronization.
-					snap = newSnapshot(p.config, p.signatures, number, hash, []common.Address{{}}, p.ethAPI)
-				} else {
-					// Initialize the validators from the genesis block extra-data.
-					validatorBytes := checkpoint.Extra[extraVanity : len(checkpoint.Extra)-extraSeal]
-					validators, err := ParseValidators(validatorBytes)
-					if err != nil {
-						return nil, err
-					}
-
-					snap = newSnapshot(p.config, p.signatures, number, hash, validators, p.ethAPI)
+				s, err := p.genesisSnapshot(checkpoint)
+				if err != nil {
+					return nil, err
 				}
-
+				snap = s
 				if err := snap.store(p.db); err != nil {
 					return nil, err
 				}
-				log.Info("Stored checkpoint snapshot to disk", "number", number, "hash", hash)
+				log.Info("Stored checkpoint snapshot to disk", "number", number, "hash", snap.Hash)
 				break
 			}
 		}
@@ -533,12 +541,11 @@ func (p *Parlia) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 		// In such a case we initialize the validator snapshot from ParliaConfig instead of genesis block headers.
 		// Offset by one since this is function is looking for the snapshot based on previous block.
 		if p.chainConfig.IsPrimordialPulseBlock(number + 1) {
-			validators, err := p.initPulsors()
+			s, err := p.primordialSnapshot(number, hash)
 			if err != nil {
 				return nil, err
 			}
-
-			snap = newSnapshot(p.config, p.signatures, number, hash, validators, p.ethAPI)
+			snap = s
 
 			// Store the snapshot to cache instead of disk since the block may or may not fall on the checkpointInterval.
 			// The snap will load from cache, or worst case be reconstructed from config again.
@@ -594,6 +601,39 @@ func (p *Parlia) snapshot(chain consensus.ChainHeaderReader, number uint64, hash
 	return snap, err
 }
 
+// genesisSnapshot creates the initial snapshot at the genesis block.
+func (p *Parlia) genesisSnapshot(genesis *types.Header) (*Snapshot, error) {
+	hash := genesis.Hash()
+	if p.chainConfig.PrimordialPulseAhead(common.Big0) {
+		// If we're at the genesis, but there is a PrimordialPulse fork in our future,
+		// this implies that we're behind the forked chain. Suppose an empty set of validators
+		// and wait for chain synchronization.
+		return newSnapshot(p.config, p.signatures, 0, hash, []common.Address{{}}, p.ethAPI), nil
+	}
+	// Initialize the validators from the genesis block extra-data.
+	validatorBytes := getValidatorBytesFromHeader(genesis, p.chainConfig, p.config)
+	if validatorBytes == nil {
+		return nil, errInvalidSpanValidators
+	}
+	validators, err := ParseValidators(validatorBytes)
+	if err != nil {
+		return nil, err
+	}
+	return newSnapshot(p.config, p.signatures, 0, hash, validators, p.ethAPI), nil
+}
+
+// primordialSnapshot creates the initial snapshot of a chain forked from an
+// existing network at the PrimordialPulseBlock, taking the validators from the
+// ParliaConfig instead of the genesis header. The given block is the parent of
+// the PrimordialPulseBlock.
+func (p *Parlia) primordialSnapshot(number uint64, hash common.Hash) (*Snapshot, error) {
+	validators, err := p.initPulsors()
+	if err != nil {
+		return nil, err
+	}
+	return newSnapshot(p.config, p.signatures, number, hash, validators, p.ethAPI), nil
+}
+
 // VerifyUncles implements consensus.Engine, always returning an error for any
 // uncles as this consensus mechanism doesn't permit uncles.
 func (p *Parlia) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
@@ -641,6 +681,7 @@ func (p *Parlia) verifySeal(chain consensus.ChainHeaderReader, header *types.Hea
 	if _, ok := snap.Validators[signer]; !ok {
 		return &consensus.ErrUnauthorizedValidator{}
 	}
+	p.doubleSign.observe(header, signer)
 
 	for seen, recent := range snap.Recents {
 		if recent == signer {
@@ -668,19 +709,26 @@ func (p *Parlia) verifySeal(chain consensus.ChainHeaderReader, header *types.Hea
 // Prepare implements consensus.Engine, preparing all the consensus fields of the
 // header for running the transactions on top.
 func (p *Parlia) Prepare(chain consensus.ChainHeaderReader, header *types.Header) error {
+	// Hand the block over to the local validator which would seal it first
+	if p.hasSealers() {
+		sealer, err := p.nextSealer(chain, header)
+		if err != nil {
+			return err
+		}
+		return sealer.Prepare(chain, header)
+	}
 	// Bail out early if the Authorize() method for block mining has not been called
 	if p.signTxFn == nil {
 		return &consensus.ErrUnauthorizedValidator{}
 	}
 
-	header.Coinbase = p.val
-	header.Nonce = types.BlockNonce{}
-
 	number := header.Number.Uint64()
 	snap, err := p.snapshot(chain, number-1, header.ParentHash, nil)
 	if err != nil {
 		return err
 	}
+	header.Coinbase = p.val
+	header.Nonce = types.BlockNonce{}
 
 	// Set the correct difficulty
 	header.Difficulty = calcDifficulty(snap, p.val)
@@ -699,9 +747,21 @@ func (p *Parlia) Prepare(chain consensus.ChainHeaderReader, header *types.Header
 			return err
 		}
 
+		if p.chainConfig.IsFastFinality(header.Number) {
+			count := len(newValidatorBytes) / validatorBytesLength
+			if count > math.MaxUint8 {
+				return errTooManyValidators
+			}
+			header.Extra = append(header.Extra, byte(count))
+		}
 		header.Extra = append(header.Extra, newValidatorBytes...)
 	}
 
+	// Aggregate the votes on the parent block collected so far into the header
+	if err := p.assembleVoteAttestation(header, snap); err != nil {
+		log.Warn("Failed to assemble vote attestation", "number", number, "err", err)
+	}
+
 	// add extra seal space
 	header.Extra = append(header.Extra, make([]byte, extraSeal)...)
 
@@ -746,8 +806,7 @@ func (p *Parlia) Finalize(chain consensus.ChainHeaderReader, header *types.Heade
 			return err
 		}
 
-		extraSuffix := len(header.Extra) - extraSeal
-		if !bytes.Equal(header.Extra[extraVanity:extraSuffix], validatorsBytes) {
+		if !bytes.Equal(getValidatorBytesFromHeader(header, p.chainConfig, p.config), validatorsBytes) {
 			return errMismatchingEpochValidators
 		}
 	}
@@ -776,6 +835,13 @@ func (p *Parlia) Finalize(chain consensus.ChainHeaderReader, header *types.Heade
 		}
 	}
 
+	// apply the double sign evidences submitted by the block producer
+	if p.chainConfig.IsDoubleSignSlash(header.Number) {
+		if err := p.applyDoubleSignEvidences(chain, state, header, cx, txs, receipts, systemTxs, usedGas); err != nil {
+			return err
+		}
+	}
+
 	if header.Difficulty.Cmp(diffInTurn) != 0 {
 		spoiledVal := snap.supposeValidator()
 		signedRecently := false
@@ -811,6 +877,9 @@ func (p *Parlia) Finalize(chain consensus.ChainHeaderReader, header *types.Heade
 // nor block rewards given, and returns the final block.
 func (p *Parlia) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB,
 	txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, []*types.Receipt, error) {
+	if sealer := p.sealer(header.Coinbase); sealer != nil {
+		return sealer.FinalizeAndAssemble(chain, header, state, txs, uncles, receipts)
+	}
 	// No block rewards in PoA, so the state remains as is and uncles are dropped
 	cx := chainContext{Chain: chain, parlia: p}
 	if txs == nil {
@@ -845,6 +914,11 @@ func (p *Parlia) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *
 		}
 	}
 
+	// submit the double sign evidences collected by the monitor
+	if p.chainConfig.IsDoubleSignSlash(header.Number) {
+		p.submitDoubleSignEvidences(chain, state, header, cx, &txs, &receipts, &usedGas)
+	}
+
 	if header.Difficulty.Cmp(diffInTurn) != 0 {
 		snap, err := p.snapshot(chain, number-1, header.ParentHash, nil)
 		if err != nil {
@@ -898,6 +972,9 @@ func (p *Parlia) Authorize(val common.Address, signFn SignerFn, signTxFn SignerT
 }
 
 func (p *Parlia) Delay(chain consensus.ChainReader, header *types.Header) *time.Duration {
+	if sealer := p.sealer(header.Coinbase); sealer != nil {
+		return sealer.Delay(chain, header)
+	}
 	number := header.Number.Uint64()
 	snap, err := p.snapshot(chain, number-1, header.ParentHash, nil)
 	if err != nil {
@@ -911,7 +988,9 @@ func (p *Parlia) Delay(chain consensus.ChainReader, header *types.Header) *time.
 // the local signing credentials.
 func (p *Parlia) Seal(chain consensus.ChainHeaderReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
 	header := block.Header()
-
+	if sealer := p.sealer(header.Coinbase); sealer != nil {
+		return sealer.Seal(chain, block, results, stop)
+	}
 	// Sealing the genesis block is not supported
 	number := header.Number.Uint64()
 	if number == 0 {
@@ -937,13 +1016,8 @@ func (p *Parlia) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 	}
 
 	// If we're amongst the recent signers, wait for the next block
-	for seen, recent := range snap.Recents {
-		if recent == val {
-			// Signer is among recents, only wait if the current block doesn't shift it out
-			if limit := uint64(len(snap.Validators)/2 + 1); number < limit || seen > number-limit {
-				return errors.New("signed recently, must wait for others")
-			}
-		}
+	if signedRecently(snap, val, number) {
+		return errors.New("signed recently, must wait for others")
 	}
 
 	// Sweet, the protocol permits us to sign the block, wait for our time
@@ -951,14 +1025,9 @@ func (p *Parlia) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 
 	log.Info("Sealing block with", "number", number, "delay", delay, "headerDifficulty", header.Difficulty, "val", val.Hex())
 
-	// Sign all the things!
-	sig, err := signFn(accounts.Account{Address: val}, accounts.MimetypeParlia, ParliaRLP(header, p.chainConfig.ChainID))
-	if err != nil {
-		return err
-	}
-	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
-
-	// Wait until sealing is terminated or delay timeout.
+	// Wait until sealing is terminated or delay timeout. The header is only signed
+	// afterwards, as the sealing task might get replaced by a fuller one in the
+	// meantime and only a single header per height may be signed.
 	log.Trace("Waiting for slot to sign and propagate", "delay", common.PrettyDuration(delay))
 	go func() {
 		select {
@@ -966,11 +1035,23 @@ func (p *Parlia) Seal(chain consensus.ChainHeaderReader, block *types.Block, res
 			return
 		case <-time.After(delay):
 		}
+		sealHash := SealHash(header, p.chainConfig.ChainID)
+		if err := p.protection.protect(val, number, sealHash); err != nil {
+			log.Error("Refusing to seal block", "number", number, "sealhash", sealHash, "err", err)
+			return
+		}
+		// Sign all the things!
+		sig, err := signFn(accounts.Account{Address: val}, accounts.MimetypeParlia, ParliaRLP(header, p.chainConfig.ChainID))
+		if err != nil {
+			log.Error("Failed to seal block", "number", number, "sealhash", sealHash, "err", err)
+			return
+		}
+		copy(header.Extra[len(header.Extra)-extraSeal:], sig)
 
 		select {
 		case results <- block.WithSeal(header):
 		default:
-			log.Warn("Sealing result is not read by miner", "sealhash", SealHash(header, p.chainConfig.ChainID))
+			log.Warn("Sealing result is not read by miner", "sealhash", sealHash)
 		}
 	}()
 
@@ -1016,12 +1097,21 @@ func (p *Parlia) SealHash(header *types.Header) common.Hash {
 
 // APIs implements consensus.Engine, returning the user facing RPC API to query snapshot.
 func (p *Parlia) APIs(chain consensus.ChainHeaderReader) []rpc.API {
-	return []rpc.API{{
+	apis := []rpc.API{{
 		Namespace: "parlia",
 		Version:   "1.0",
 		Service:   &API{chain: chain, parlia: p},
 		Public:    false,
 	}}
+	if p.chainConfig.PrimordialPulseBlock != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "pulse",
+			Version:   "1.0",
+			Service:   &PulseAPI{},
+			Public:    true,
+		})
+	}
+	return apis
 }
 
 // Close implements consensus.Engine. It's a noop for parlia as there are no background threads.
@@ -1086,6 +1176,9 @@ func (p *Parlia) distributeIncoming(val common.Address, state *state.StateDB, he
 	}
 	state.SetBalance(consensus.SystemAddress, big.NewInt(0))
 
+	if schedule := p.config.FeeSchedule(header.Number); schedule != nil {
+		return p.distributeFees(schedule, balance, val, state, header, chain, txs, receipts, receivedTxs, usedGas, mining)
+	}
 	burn := big.NewInt(0)
 	if p.config.BurnRate > 0 {
 		burn = burn.Div(balance, big.NewInt(int64(p.config.BurnRate)))
@@ -1099,6 +1192,124 @@ func (p *Parlia) distributeIncoming(val common.Address, state *state.StateDB, he
 	return p.distributeToValidator(reward, val, state, header, chain, txs, receipts, receivedTxs, usedGas, mining)
 }
 
+// distributeFees splits the accrued fees according to the given fee schedule.
+// The shares are paid in the configured order, either as plain transfers or as
+// system transactions calling the beneficiary contract, and the remainder is
+// deposited to the validator. A share whose method call would revert is paid
+// as a plain transfer instead, so a misbehaving beneficiary can't halt the
+// chain.
+func (p *Parlia) distributeFees(schedule *params.FeeSchedule, fees *big.Int, val common.Address, state *state.StateDB, header *types.Header, chain core.ChainContext,
+	txs *[]*types.Transaction, receipts *[]*types.Receipt, receivedTxs *[]*types.Transaction, usedGas *uint64, mining bool) error {
+	var (
+		amounts, reward = splitFees(schedule, fees)
+		context         = []interface{}{"number", header.Number, "fees", fees}
+	)
+	for i, share := range schedule.Shares {
+		amount := amounts[i]
+		if amount.Sign() == 0 {
+			continue
+		}
+		context = append(context, share.Name, amount)
+
+		addr := common.HexToAddress(share.Addr)
+		if share.Method == "" || !isToSystemContract(addr) {
+			state.AddBalance(addr, amount)
+			continue
+		}
+		state.AddBalance(header.Coinbase, amount)
+		msg := p.getSystemMessage(header.Coinbase, addr, crypto.Keccak256([]byte(share.Method + "()"))[:4], amount)
+		if err := dryRunMessage(msg, state, header, p.chainConfig, chain); err != nil {
+			log.Warn("Fee share call reverted, transferring instead", "number", header.Number, "share", share.Name, "addr", addr, "err", err)
+			state.SubBalance(header.Coinbase, amount)
+			state.AddBalance(addr, amount)
+			continue
+		}
+		if err := p.applyTransaction(msg, state, header, chain, txs, receipts, receivedTxs, usedGas, mining); err != nil {
+			return err
+		}
+	}
+	context = append(context, "validator", reward)
+	log.Debug("Distributed transaction fees", context...)
+
+	if reward.Sign() == 0 {
+		return nil
+	}
+	state.AddBalance(header.Coinbase, reward)
+	return p.distributeToValidator(reward, val, state, header, chain, txs, receipts, receivedTxs, usedGas, mining)
+}
+
+// splitFees computes the amounts paid to the beneficiaries of the fee schedule,
+// in the order of its shares, and the remainder deposited to the validator.
+func splitFees(schedule *params.FeeSchedule, fees *big.Int) ([]*big.Int, *big.Int) {
+	var (
+		amounts = make([]*big.Int, len(schedule.Shares))
+		reward  = new(big.Int).Set(fees)
+	)
+	for i, share := range schedule.Shares {
+		amounts[i] = new(big.Int).Mul(fees, new(big.Int).SetUint64(share.Bps))
+		amounts[i].Div(amounts[i], big.NewInt(params.FeeShareDenominator))
+		reward.Sub(reward, amounts[i])
+	}
+	return amounts, reward
+}
+
+// FeeDistribution is the split of the transaction fees collected in a block
+// according to the fee schedule in effect.
+type FeeDistribution struct {
+	Number    uint64            `json:"number"`    // Number of the block collecting the fees
+	Hash      common.Hash       `json:"hash"`      // Hash of the block collecting the fees
+	Fees      *hexutil.Big      `json:"fees"`      // Priority fees paid by the transactions of the block
+	Shares    []*FeeSharePayout `json:"shares"`    // Amounts paid to the beneficiaries, in order
+	Validator *hexutil.Big      `json:"validator"` // Remainder deposited to the validator
+}
+
+// FeeSharePayout is the amount of the fees of a block paid to a beneficiary.
+type FeeSharePayout struct {
+	Name   string         `json:"name"`
+	Addr   common.Address `json:"addr"`
+	Amount *hexutil.Big   `json:"amount"`
+}
+
+// feeDistribution recomputes the fee split of a block from its transactions
+// and their receipts, the same way it was done when finalizing the block. The
+// shares paid by plain transfers leave no other trace on chain.
+//
+// Only the priority fees of the transactions are accounted, value sent to the
+// system address directly is distributed as well, but isn't included here.
+func (p *Parlia) feeDistribution(header *types.Header, txs types.Transactions, receipts types.Receipts) (*FeeDistribution, error) {
+	schedule := p.config.FeeSchedule(header.Number)
+	if schedule == nil {
+		return nil, errNoFeeSchedule
+	}
+	if len(txs) != len(receipts) {
+		return nil, fmt.Errorf("receipt count mismatch: have %d, want %d", len(receipts), len(txs))
+	}
+	fees := new(big.Int)
+	for i, tx := range txs {
+		if system, err := p.IsSystemTransaction(tx, header); err != nil || system {
+			continue
+		}
+		tip := tx.EffectiveGasTipValue(header.BaseFee)
+		fees.Add(fees, tip.Mul(tip, new(big.Int).SetUint64(receipts[i].GasUsed)))
+	}
+	amounts, reward := splitFees(schedule, fees)
+
+	dist := &FeeDistribution{
+		Number:    header.Number.Uint64(),
+		Hash:      header.Hash(),
+		Fees:      (*hexutil.Big)(fees),
+		Validator: (*hexutil.Big)(reward),
+	}
+	for i, share := range schedule.Shares {
+		dist.Shares = append(dist.Shares, &FeeSharePayout{
+			Name:   share.Name,
+			Addr:   common.HexToAddress(share.Addr),
+			Amount: (*hexutil.Big)(amounts[i]),
+		})
+	}
+	return dist, nil
+}
+
 // rotateValidators triggers the staked validator rotation
 func (p *Parlia) rotateValidators(state *state.StateDB, header *types.Header, chain core.ChainContext,
 	txs *[]*types.Transaction, receipts *[]*types.Receipt, receivedTxs *[]*types.Transaction, usedGas *uint64, mining bool) error {
@@ -1306,6 +1517,11 @@ func encodeSigHeader(w io.Writer, header *types.Header, chainId *big.Int) {
 	}
 }
 
+// InTurn reports whether the header is sealed, or prepared, by the in-turn validator.
+func InTurn(header *types.Header) bool {
+	return header.Difficulty != nil && header.Difficulty.Cmp(diffInTurn) == 0
+}
+
 func backOffTime(snap *Snapshot, val common.Address) uint64 {
 	if snap.inturn(val) {
 		return 0
@@ -1384,3 +1600,15 @@ func applyMessage(
 	}
 	return msg.Gas() - returnGas, err
 }
+
+// dryRunMessage executes a system message without leaving any trace in the
+// state, reporting whether it would fail.
+func dryRunMessage(msg callmsg, state *state.StateDB, header *types.Header, chainConfig *params.ChainConfig, chainContext core.ChainContext) error {
+	snapshot := state.Snapshot()
+	defer state.RevertToSnapshot(snapshot)
+
+	context := core.NewEVMBlockContext(header, chainContext, nil)
+	vmenv := vm.NewEVM(context, vm.TxContext{Origin: msg.From(), GasPrice: big.NewInt(0)}, state, chainConfig, vm.Config{})
+	_, _, err := vmenv.Call(vm.AccountRef(msg.From()), *msg.To(), msg.Data(), msg.Gas(), msg.Value())
+	return err
+}
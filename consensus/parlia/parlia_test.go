@@ -2,10 +2,19 @@ package parlia
 
 import (
 	"fmt"
+	"math/big"
 	"math/rand"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 func TestImpactOfValidatorOutOfService(t *testing.T) {
@@ -144,3 +153,93 @@ func randomAddress() common.Address {
 	rand.Read(addrBytes)
 	return common.BytesToAddress(addrBytes)
 }
+
+// testChainContext is a core.ChainContext without any ancestry.
+type testChainContext struct {
+	engine consensus.Engine
+}
+
+func (c *testChainContext) Engine() consensus.Engine                                { return c.engine }
+func (c *testChainContext) GetHeader(hash common.Hash, number uint64) *types.Header { return nil }
+
+// Tests that fee shares paid to a reverting system contract fall back to plain
+// transfers and that no deposit is made when nothing is left to the validator.
+func TestDistributeFeesFallback(t *testing.T) {
+	engine, _, _ := newDoubleSignTester(t)
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+	contract := common.HexToAddress(systemcontracts.SlashingContract)
+	statedb.SetCode(contract, []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.REVERT)})
+
+	var (
+		header   = &types.Header{Number: big.NewInt(1), Coinbase: common.Address{0xc0}, Difficulty: diffInTurn, GasLimit: 30_000_000}
+		schedule = &params.FeeSchedule{Shares: []params.FeeShare{
+			{Name: "community", Addr: contract.Hex(), Method: "receiveFees", Bps: 6000},
+			{Name: "burn", Addr: systemcontracts.FeeBurnContract, Bps: 4000},
+		}}
+		fees     = big.NewInt(1000)
+		txs      []*types.Transaction
+		receipts []*types.Receipt
+		usedGas  uint64
+	)
+	if err := engine.distributeFees(schedule, fees, header.Coinbase, statedb, header, &testChainContext{engine}, &txs, &receipts, nil, &usedGas, false); err != nil {
+		t.Fatalf("failed to distribute fees: %v", err)
+	}
+	if len(txs) != 0 {
+		t.Fatalf("system transactions created: %d", len(txs))
+	}
+	if balance := statedb.GetBalance(contract); balance.Cmp(big.NewInt(600)) != 0 {
+		t.Fatalf("contract share mismatch: have %v, want %v", balance, 600)
+	}
+	if balance := statedb.GetBalance(common.HexToAddress(systemcontracts.FeeBurnContract)); balance.Cmp(big.NewInt(400)) != 0 {
+		t.Fatalf("burn share mismatch: have %v, want %v", balance, 400)
+	}
+	if balance := statedb.GetBalance(header.Coinbase); balance.Sign() != 0 {
+		t.Fatalf("coinbase kept fees: %v", balance)
+	}
+}
+
+// Tests that the fee split of a block is recomputed from the priority fees of
+// its transactions, ignoring the system transactions.
+func TestFeeDistribution(t *testing.T) {
+	engine, _, _ := newDoubleSignTester(t)
+
+	var (
+		user, _     = crypto.GenerateKey()
+		coinbase, _ = crypto.GenerateKey()
+		header      = &types.Header{Number: big.NewInt(1), Coinbase: crypto.PubkeyToAddress(coinbase.PublicKey), BaseFee: big.NewInt(5)}
+		validators  = common.HexToAddress(systemcontracts.ValidatorContract)
+	)
+	if _, err := engine.feeDistribution(header, nil, nil); err != errNoFeeSchedule {
+		t.Fatalf("error mismatch without fee schedule: have %v, want %v", err, errNoFeeSchedule)
+	}
+	engine.config.FeeSchedules = []params.FeeSchedule{{Block: big.NewInt(0), Shares: []params.FeeShare{
+		{Name: "community", Addr: systemcontracts.SlashingContract, Method: "receiveFees", Bps: 6000},
+		{Name: "burn", Addr: systemcontracts.FeeBurnContract, Bps: 2500},
+	}}}
+	txs := types.Transactions{
+		types.MustSignNewTx(user, engine.signer, &types.DynamicFeeTx{ChainID: engine.chainConfig.ChainID, Gas: 21000, GasTipCap: big.NewInt(2), GasFeeCap: big.NewInt(10), To: &common.Address{}}),
+		types.MustSignNewTx(user, engine.signer, &types.LegacyTx{Nonce: 1, Gas: 30000, GasPrice: big.NewInt(8), To: &common.Address{}}),
+		types.MustSignNewTx(coinbase, engine.signer, &types.LegacyTx{Gas: 100000, GasPrice: common.Big0, To: &validators, Value: big.NewInt(1)}),
+	}
+	receipts := types.Receipts{{GasUsed: 21000}, {GasUsed: 30000}, {GasUsed: 50000}}
+
+	if _, err := engine.feeDistribution(header, txs, receipts[:2]); err == nil {
+		t.Fatalf("fee distribution computed with missing receipts")
+	}
+	dist, err := engine.feeDistribution(header, txs, receipts)
+	if err != nil {
+		t.Fatalf("failed to compute fee distribution: %v", err)
+	}
+	if fees := dist.Fees.ToInt(); fees.Cmp(big.NewInt(132000)) != 0 {
+		t.Fatalf("fees mismatch: have %v, want %v", fees, 132000)
+	}
+	for i, want := range []int64{79200, 33000} {
+		if amount := dist.Shares[i].Amount.ToInt(); amount.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("share %d mismatch: have %v, want %v", i, amount, want)
+		}
+	}
+	if reward := dist.Validator.ToInt(); reward.Cmp(big.NewInt(19800)) != 0 {
+		t.Fatalf("validator reward mismatch: have %v, want %v", reward, 19800)
+	}
+}
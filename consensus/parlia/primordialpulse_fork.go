@@ -3,6 +3,7 @@ package parlia
 import (
 	_ "embed"
 	"errors"
+	"fmt"
 	"math/big"
 	"sort"
 
@@ -69,16 +70,14 @@ func (p *Parlia) primordialPulseAllocations(state *state.StateDB) {
 	}
 
 	log.Info("Awarding PrimordialPulse sacrifice credits (this will take some time) 💸")
-	for ptr := 0; ptr < len(rawCredits); {
-		byteCount := int(rawCredits[ptr])
-		ptr++
-
-		record := rawCredits[ptr : ptr+byteCount]
-		ptr += byteCount
-
-		addr := common.BytesToAddress(record[:20])
-		credit := new(big.Int).SetBytes(record[20:])
-		state.AddBalance(addr, credit)
+	credits, err := ParseSacrificeCredits(rawCredits)
+	if err != nil {
+		// The credits are embedded in the binary, skipping them would silently
+		// fork the chain at the PrimordialPulse block
+		panic(fmt.Sprintf("invalid PrimordialPulse sacrifice credits: %v", err))
+	}
+	for _, credit := range credits {
+		state.AddBalance(credit.Address, credit.Amount)
 	}
 	log.Info("Finished awarding PrimordialPulse sacrifice credits 🤑")
 }
@@ -0,0 +1,229 @@
+package parlia
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ProtectionInterchangeVersion is the version of the slashing protection
+// interchange format produced and accepted by this implementation.
+const ProtectionInterchangeVersion = "1"
+
+var (
+	// signedPrefix is the database key prefix of the headers signed by the local
+	// validators, followed by the validator address and the block number.
+	signedPrefix = []byte("parlia-signed-")
+
+	// errConflictingSeal is returned if a validator is requested to sign a header
+	// at a height it already signed a different header at.
+	errConflictingSeal = errors.New("conflicting header already signed at this height")
+
+	// errInterchangeMismatch is returned if slashing protection data of another
+	// chain or of an unknown format is imported.
+	errInterchangeMismatch = errors.New("incompatible slashing protection interchange")
+)
+
+// ProtectionInterchange is the JSON interchange format of the slashing protection
+// data, modelled after EIP-3076. An example document:
+//
+//	{
+//	  "metadata": {
+//	    "interchange_format_version": "1",
+//	    "chain_id": 943,
+//	    "genesis_hash": "0x..."
+//	  },
+//	  "data": [{
+//	    "validator": "0x...",
+//	    "signed_headers": [{"number": 1234, "seal_hash": "0x..."}]
+//	  }]
+//	}
+//
+// A zero seal hash marks a height with conflicting records, at which the
+// validator refuses to sign any header.
+type ProtectionInterchange struct {
+	Metadata ProtectionMetadata   `json:"metadata"`
+	Data     []*ProtectionRecords `json:"data"`
+}
+
+// ProtectionMetadata identifies the chain the slashing protection data belongs to.
+type ProtectionMetadata struct {
+	Version     string      `json:"interchange_format_version"`
+	ChainID     uint64      `json:"chain_id"`
+	GenesisHash common.Hash `json:"genesis_hash"`
+}
+
+// ProtectionRecords are the headers signed by a single validator.
+type ProtectionRecords struct {
+	Validator     common.Address  `json:"validator"`
+	SignedHeaders []*SignedHeader `json:"signed_headers"`
+}
+
+// SignedHeader is the seal hash of a header signed at a given height.
+type SignedHeader struct {
+	Number   uint64      `json:"number"`
+	SealHash common.Hash `json:"seal_hash"`
+}
+
+// sealProtection is the slashing protection database, a persistent record of
+// every header signed by the local validators, refusing to sign two different
+// headers at the same height, even across restarts.
+type sealProtection struct {
+	db   ethdb.Database
+	lock sync.Mutex // Serializes the check-and-record operations
+}
+
+func newSealProtection(db ethdb.Database) *sealProtection {
+	return &sealProtection{db: db}
+}
+
+// signedKey = signedPrefix + validator + num (uint64 big endian)
+func signedKey(val common.Address, number uint64) []byte {
+	key := make([]byte, len(signedPrefix)+common.AddressLength+8)
+	copy(key, signedPrefix)
+	copy(key[len(signedPrefix):], val.Bytes())
+	binary.BigEndian.PutUint64(key[len(signedPrefix)+common.AddressLength:], number)
+	return key
+}
+
+// protect records the header with the given seal hash as signed by the validator,
+// failing if a different header was already signed at the same height.
+func (s *sealProtection) protect(val common.Address, number uint64, hash common.Hash) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	key := signedKey(val, number)
+	if blob, err := s.db.Get(key); err == nil && len(blob) > 0 {
+		if prev := common.BytesToHash(blob); prev != hash {
+			return fmt.Errorf("%w: #%d signed as %x, requested %x", errConflictingSeal, number, prev, hash)
+		}
+		return nil
+	}
+	return s.db.Put(key, hash.Bytes())
+}
+
+// export retrieves every recorded header signed by the local validators.
+func (s *sealProtection) export() ([]*ProtectionRecords, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	it := s.db.NewIterator(signedPrefix, nil)
+	defer it.Release()
+
+	var (
+		records []*ProtectionRecords
+		last    *ProtectionRecords
+	)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(signedPrefix)+common.AddressLength+8 {
+			continue
+		}
+		val := common.BytesToAddress(key[len(signedPrefix) : len(signedPrefix)+common.AddressLength])
+		if last == nil || last.Validator != val {
+			last = &ProtectionRecords{Validator: val}
+			records = append(records, last)
+		}
+		last.SignedHeaders = append(last.SignedHeaders, &SignedHeader{
+			Number:   binary.BigEndian.Uint64(key[len(signedPrefix)+common.AddressLength:]),
+			SealHash: common.BytesToHash(it.Value()),
+		})
+	}
+	return records, it.Error()
+}
+
+// merge imports the signed headers of a validator, returning the number of new
+// records and of heights with conflicting records. Conflicting heights are
+// marked by a zero seal hash, refusing to sign any header at them.
+func (s *sealProtection) merge(records *ProtectionRecords) (int, int, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var (
+		batch     = s.db.NewBatch()
+		pending   = make(map[uint64]common.Hash)
+		imported  int
+		conflicts int
+	)
+	for _, signed := range records.SignedHeaders {
+		key := signedKey(records.Validator, signed.Number)
+
+		local, ok := pending[signed.Number]
+		if !ok {
+			if blob, err := s.db.Get(key); err == nil && len(blob) > 0 {
+				local, ok = common.BytesToHash(blob), true
+			}
+		}
+		switch {
+		case !ok:
+			batch.Put(key, signed.SealHash.Bytes())
+			pending[signed.Number] = signed.SealHash
+			imported++
+
+		case local != signed.SealHash && local != (common.Hash{}):
+			log.Warn("Conflicting slashing protection record", "validator", records.Validator, "number", signed.Number,
+				"local", local, "imported", signed.SealHash)
+			batch.Put(key, common.Hash{}.Bytes())
+			pending[signed.Number] = common.Hash{}
+			conflicts++
+		}
+	}
+	return imported, conflicts, batch.Write()
+}
+
+// ExportSlashingProtection retrieves the headers signed by the local validators
+// in the slashing protection interchange format.
+func (p *Parlia) ExportSlashingProtection() (*ProtectionInterchange, error) {
+	records, err := p.protection.export()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		sort.Slice(record.SignedHeaders, func(i, j int) bool {
+			return record.SignedHeaders[i].Number < record.SignedHeaders[j].Number
+		})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return bytes.Compare(records[i].Validator[:], records[j].Validator[:]) < 0
+	})
+	return &ProtectionInterchange{
+		Metadata: ProtectionMetadata{
+			Version:     ProtectionInterchangeVersion,
+			ChainID:     p.chainConfig.ChainID.Uint64(),
+			GenesisHash: p.genesisHash,
+		},
+		Data: records,
+	}, nil
+}
+
+// ImportSlashingProtection merges slashing protection data, typically exported
+// on another machine, into the local records. It returns the number of imported
+// records and the number of heights with records conflicting with the local ones.
+func (p *Parlia) ImportSlashingProtection(interchange *ProtectionInterchange) (int, int, error) {
+	meta := interchange.Metadata
+	if meta.Version != ProtectionInterchangeVersion {
+		return 0, 0, fmt.Errorf("%w: unsupported version %q", errInterchangeMismatch, meta.Version)
+	}
+	if meta.ChainID != p.chainConfig.ChainID.Uint64() {
+		return 0, 0, fmt.Errorf("%w: chain id %d, local %v", errInterchangeMismatch, meta.ChainID, p.chainConfig.ChainID)
+	}
+	if meta.GenesisHash != p.genesisHash {
+		return 0, 0, fmt.Errorf("%w: genesis %x, local %x", errInterchangeMismatch, meta.GenesisHash, p.genesisHash)
+	}
+	var imported, conflicts int
+	for _, records := range interchange.Data {
+		n, c, err := p.protection.merge(records)
+		if err != nil {
+			return imported, conflicts, err
+		}
+		imported, conflicts = imported+n, conflicts+c
+	}
+	return imported, conflicts, nil
+}
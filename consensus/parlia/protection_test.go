@@ -0,0 +1,95 @@
+package parlia
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestSealProtection(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		config = &params.ChainConfig{ChainID: big.NewInt(943), Parlia: &params.ParliaConfig{Period: 3, Epoch: 200}}
+		val    = common.Address{0x01}
+	)
+	engine := New(config, db, nil, common.Hash{0xff}, nil)
+	if err := engine.protection.protect(val, 10, common.Hash{0x0a}); err != nil {
+		t.Fatalf("failed to record header: %v", err)
+	}
+	if err := engine.protection.protect(val, 10, common.Hash{0x0a}); err != nil {
+		t.Fatalf("same header refused: %v", err)
+	}
+	if err := engine.protection.protect(common.Address{0x02}, 10, common.Hash{0x0b}); err != nil {
+		t.Fatalf("other validator refused: %v", err)
+	}
+	// Conflicting headers must be refused, even after a restart
+	engine = New(config, db, nil, common.Hash{0xff}, nil)
+	if err := engine.protection.protect(val, 10, common.Hash{0x0b}); !errors.Is(err, errConflictingSeal) {
+		t.Fatalf("error mismatch: have %v, want %v", err, errConflictingSeal)
+	}
+	// Snapshot iteration must not trip over the records
+	if snaps, corrupt, err := engine.StoredSnapshots(); len(snaps) != 0 || len(corrupt) != 0 || err != nil {
+		t.Fatalf("records mistaken for snapshots: %d, %d, %v", len(snaps), len(corrupt), err)
+	}
+}
+
+func TestSlashingProtectionInterchange(t *testing.T) {
+	var (
+		config = &params.ChainConfig{ChainID: big.NewInt(943), Parlia: &params.ParliaConfig{Period: 3, Epoch: 200}}
+		val    = common.Address{0x01}
+	)
+	source := New(config, rawdb.NewMemoryDatabase(), nil, common.Hash{0xff}, nil)
+	for number, hash := range map[uint64]common.Hash{3: {0x03}, 1: {0x01}, 2: {0x02}} {
+		source.protection.protect(val, number, hash)
+	}
+	source.protection.protect(common.Address{0x02}, 1, common.Hash{0x11})
+
+	exported, err := source.ExportSlashingProtection()
+	if err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+	blob, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatalf("failed to encode interchange: %v", err)
+	}
+	interchange := new(ProtectionInterchange)
+	if err := json.Unmarshal(blob, interchange); err != nil {
+		t.Fatalf("failed to decode interchange: %v", err)
+	}
+	if len(interchange.Data) != 2 || len(interchange.Data[0].SignedHeaders) != 3 || interchange.Data[0].SignedHeaders[2].Number != 3 {
+		t.Fatalf("exported data mismatch: %s", blob)
+	}
+	// Import into a database which signed a conflicting header at height 2
+	target := New(config, rawdb.NewMemoryDatabase(), nil, common.Hash{0xff}, nil)
+	target.protection.protect(val, 2, common.Hash{0xee})
+
+	imported, conflicts, err := target.ImportSlashingProtection(interchange)
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	if imported != 3 || conflicts != 1 {
+		t.Fatalf("import stats mismatch: imported %d, conflicts %d", imported, conflicts)
+	}
+	if err := target.protection.protect(val, 3, common.Hash{0x03}); err != nil {
+		t.Errorf("imported header refused: %v", err)
+	}
+	if err := target.protection.protect(val, 3, common.Hash{0x04}); !errors.Is(err, errConflictingSeal) {
+		t.Errorf("header conflicting with import accepted: %v", err)
+	}
+	for _, hash := range []common.Hash{{0x02}, {0xee}} {
+		if err := target.protection.protect(val, 2, hash); !errors.Is(err, errConflictingSeal) {
+			t.Errorf("header at conflicting height accepted: %v", err)
+		}
+	}
+	// Data of other chains must be rejected
+	other := *interchange
+	other.Metadata.GenesisHash = common.Hash{0x01}
+	if _, _, err := target.ImportSlashingProtection(&other); !errors.Is(err, errInterchangeMismatch) {
+		t.Errorf("error mismatch: have %v, want %v", err, errInterchangeMismatch)
+	}
+}
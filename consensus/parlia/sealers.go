@@ -0,0 +1,151 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package parlia
+
+import (
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+var (
+	// errUnknownSealer is returned if a validator which isn't sealing locally is
+	// attempted to be taken offline or brought back.
+	errUnknownSealer = errors.New("unknown local sealer")
+
+	// errNoSealer is returned if none of the local validators is permitted to
+	// seal the next block, because they are offline or signed recently.
+	errNoSealer = errors.New("no local sealer available")
+)
+
+// devSealer is a local validator of a developer network. Each one seals with
+// its own engine instance, the same way it would as a separate node.
+type devSealer struct {
+	engine *Parlia // Engine authorized with the key of the validator
+	online bool    // Whether the validator is sealing blocks
+}
+
+// AuthorizeSealers sets up an independent sealer for each of the given local
+// validators, which take turns the same way separate nodes would: every block
+// is sealed by the online validator permitted to seal it first. If the in-turn
+// validator is offline, another one seals after its back off time and slashes
+// it. This is meant for developer networks running all validators in one process.
+func (p *Parlia) AuthorizeSealers(vals []common.Address, signFn SignerFn, signTxFn SignerTxFn) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.sealers = make(map[common.Address]*devSealer, len(vals))
+	for _, val := range vals {
+		engine := New(p.chainConfig, p.db, p.ethAPI, p.genesisHash, p.makeEthash)
+		engine.Authorize(val, signFn, signTxFn)
+
+		// Share the state tied to the chain rather than the sealer
+		engine.votePool = p.votePool
+		engine.doubleSign = p.doubleSign
+		engine.protection = p.protection
+
+		p.sealers[val] = &devSealer{engine: engine, online: true}
+	}
+}
+
+// SetSealerOnline starts or stops the sealing of a local validator set up by
+// AuthorizeSealers. While offline, the blocks of the validator are sealed out
+// of turn by the others.
+func (p *Parlia) SetSealerOnline(val common.Address, online bool) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	sealer, ok := p.sealers[val]
+	if !ok {
+		return errUnknownSealer
+	}
+	if sealer.online != online {
+		log.Info("Changed local sealer status", "validator", val, "online", online)
+	}
+	sealer.online = online
+	return nil
+}
+
+// hasSealers reports whether blocks are sealed by the local validators set up
+// by AuthorizeSealers.
+func (p *Parlia) hasSealers() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return len(p.sealers) > 0
+}
+
+// sealer returns the engine of the online local validator with the given address,
+// or nil if there's none.
+func (p *Parlia) sealer(val common.Address) *Parlia {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if sealer, ok := p.sealers[val]; ok && sealer.online {
+		return sealer.engine
+	}
+	return nil
+}
+
+// nextSealer returns the engine of the online local validator which is permitted
+// to seal the given block first, i.e. the in-turn one or otherwise the one with
+// the shortest back off time.
+func (p *Parlia) nextSealer(chain consensus.ChainHeaderReader, header *types.Header) (*Parlia, error) {
+	number := header.Number.Uint64()
+	snap, err := p.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	var (
+		next    *Parlia
+		backoff uint64
+	)
+	for val, sealer := range p.sealers {
+		if !sealer.online {
+			continue
+		}
+		if _, authorized := snap.Validators[val]; !authorized || signedRecently(snap, val, number) {
+			continue
+		}
+		if delay := backOffTime(snap, val); next == nil || delay < backoff {
+			next, backoff = sealer.engine, delay
+		}
+	}
+	if next == nil {
+		return nil, errNoSealer
+	}
+	return next, nil
+}
+
+// signedRecently reports whether the given validator is amongst the recent
+// signers of the snapshot and thus not permitted to seal the given block.
+func signedRecently(snap *Snapshot, val common.Address, number uint64) bool {
+	for seen, recent := range snap.Recents {
+		if recent == val {
+			if limit := uint64(len(snap.Validators)/2 + 1); number < limit || seen > number-limit {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package parlia
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/systemcontracts"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// sealerBackend is a Backend over a local chain, implementing the methods the
+// system contract calls rely on. Calling any other method panics.
+type sealerBackend struct {
+	ethapi.Backend
+	chain *core.BlockChain
+}
+
+func (b *sealerBackend) ChainConfig() *params.ChainConfig { return b.chain.Config() }
+func (b *sealerBackend) RPCGasCap() uint64                { return 50_000_000 }
+func (b *sealerBackend) RPCEVMTimeout() time.Duration     { return 5 * time.Second }
+
+func (b *sealerBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	hash, ok := blockNrOrHash.Hash()
+	if !ok {
+		return nil, nil, errors.New("block hash required")
+	}
+	header := b.chain.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, nil, errors.New("header not found")
+	}
+	statedb, err := b.chain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+func (b *sealerBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmConfig *vm.Config) (*vm.EVM, func() error, error) {
+	context := core.NewEVMBlockContext(header, b.chain, nil)
+	return vm.NewEVM(context, core.NewEVMTxContext(msg), state, b.chain.Config(), *vmConfig), func() error { return nil }, nil
+}
+
+// Tests that the local sealers of a developer network take turns, that taking
+// the in-turn one offline gets it slashed by the others and that the staked
+// validators are rotated at the end of the era.
+func TestLocalSealers(t *testing.T) {
+	// Create the validators and a developer network with short epochs
+	keys := make(map[common.Address]*ecdsa.PrivateKey)
+	vals := make([]common.Address, 0, 3)
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		addr := crypto.PubkeyToAddress(key.PublicKey)
+		keys[addr] = key
+		vals = append(vals, addr)
+	}
+	sort.Slice(vals, func(i, j int) bool { return bytes.Compare(vals[i][:], vals[j][:]) < 0 })
+
+	faucetKey, _ := crypto.GenerateKey()
+	faucet := crypto.PubkeyToAddress(faucetKey.PublicKey)
+
+	genesis := core.DeveloperParliaGenesisBlock(0, 11500000, faucet, vals)
+	genesis.Config.Parlia.Epoch = 4
+	genesis.Config.Parlia.Era = 2
+
+	db := rawdb.NewMemoryDatabase()
+	block := genesis.MustCommit(db)
+
+	backend := new(sealerBackend)
+	engine := New(genesis.Config, db, ethapi.NewPublicBlockChainAPI(backend), block.Hash(), nil)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+	backend.chain = chain
+
+	signFn := func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), keys[account.Address])
+	}
+	signTxFn := func(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+		return types.SignTx(tx, types.LatestSignerForChainID(chainID), keys[account.Address])
+	}
+	engine.AuthorizeSealers(vals, signFn, signTxFn)
+
+	if err := engine.SetSealerOnline(faucet, false); err != errUnknownSealer {
+		t.Fatalf("unknown sealer error mismatch: have %v, want %v", err, errUnknownSealer)
+	}
+	// mine seals the next block with whichever local sealer gets to it first,
+	// including a transfer as empty blocks are not sealed on 0-period chains
+	signer := types.LatestSigner(genesis.Config)
+	mine := func() *types.Block {
+		t.Helper()
+
+		parent := chain.CurrentBlock()
+		header := &types.Header{
+			ParentHash: parent.Hash(),
+			Number:     new(big.Int).Add(parent.Number(), common.Big1),
+			GasLimit:   parent.GasLimit(),
+			BaseFee:    misc.CalcBaseFee(genesis.Config, parent.Header()),
+		}
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("block %d: failed to prepare: %v", header.Number, err)
+		}
+		statedb, err := chain.StateAt(parent.Root())
+		if err != nil {
+			t.Fatalf("block %d: failed to retrieve state: %v", header.Number, err)
+		}
+		if err := systemcontracts.UpgradeBuildInSystemContract(genesis.Config, header.Number, statedb); err != nil {
+			t.Fatalf("block %d: failed to upgrade system contracts: %v", header.Number, err)
+		}
+		tx, _ := types.SignTx(types.NewTransaction(statedb.GetNonce(faucet), common.Address{0xaa}, common.Big1, params.TxGas, new(big.Int).Mul(header.BaseFee, common.Big2), nil), signer, faucetKey)
+		statedb.Prepare(tx.Hash(), 0)
+		receipt, err := core.ApplyTransaction(genesis.Config, chain, &header.Coinbase, new(core.GasPool).AddGas(header.GasLimit), statedb, header, tx, &header.GasUsed, vm.Config{})
+		if err != nil {
+			t.Fatalf("block %d: failed to apply transfer: %v", header.Number, err)
+		}
+		block, _, err := engine.FinalizeAndAssemble(chain, header, statedb, []*types.Transaction{tx}, nil, []*types.Receipt{receipt})
+		if err != nil {
+			t.Fatalf("block %d: failed to assemble: %v", header.Number, err)
+		}
+		results := make(chan *types.Block, 1)
+		if err := engine.Seal(chain, block, results, nil); err != nil {
+			t.Fatalf("block %d: failed to seal: %v", header.Number, err)
+		}
+		select {
+		case block = <-results:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("block %d: sealing timed out", header.Number)
+		}
+		if _, err := chain.InsertChain(types.Blocks{block}); err != nil {
+			t.Fatalf("block %d: failed to import: %v", header.Number, err)
+		}
+		return block
+	}
+	// called checks whether the given block executed a system call of the method
+	// on the contract successfully
+	called := func(block *types.Block, contract string, contractABI abi.ABI, method string) bool {
+		receipts := chain.GetReceiptsByHash(block.Hash())
+		for i, tx := range block.Transactions() {
+			if to := tx.To(); to == nil || *to != common.HexToAddress(contract) {
+				continue
+			}
+			if bytes.HasPrefix(tx.Data(), contractABI.Methods[method].ID) {
+				return receipts[i].Status == types.ReceiptStatusSuccessful
+			}
+		}
+		return false
+	}
+	// Seal a few blocks in turn, then take the next in-turn validator offline
+	for i := 0; i < 2; i++ {
+		if block := mine(); !InTurn(block.Header()) {
+			t.Fatalf("block %d: sealed out of turn", block.Number())
+		}
+	}
+	snap, err := engine.snapshot(chain, 2, chain.CurrentBlock().Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	offline := snap.supposeValidator()
+	if err := engine.SetSealerOnline(offline, false); err != nil {
+		t.Fatalf("failed to take sealer offline: %v", err)
+	}
+	block = mine()
+	if InTurn(block.Header()) || block.Coinbase() == offline {
+		t.Fatalf("block %d: sealed by the offline validator", block.Number())
+	}
+	if !called(block, systemcontracts.SlashingContract, engine.slashABI, "slash") {
+		t.Errorf("block %d: offline validator not slashed", block.Number())
+	}
+	// Bring the validator back and seal until the end of the era
+	if err := engine.SetSealerOnline(offline, true); err != nil {
+		t.Fatalf("failed to bring sealer online: %v", err)
+	}
+	era := genesis.Config.Parlia.Epoch * genesis.Config.Parlia.Era
+	for block.NumberU64() < era-1 {
+		block = mine()
+	}
+	if !called(block, systemcontracts.StakingContract, engine.stakingABI, "rotateValidators") {
+		t.Errorf("block %d: validators not rotated", block.Number())
+	}
+	if block = mine(); len(getValidatorBytesFromHeader(block.Header(), genesis.Config, genesis.Config.Parlia)) != len(vals)*validatorBytesLength {
+		t.Errorf("block %d: rotated validators not announced", block.Number())
+	}
+}
@@ -34,17 +34,26 @@ import (
 	lru "github.com/hashicorp/golang-lru"
 )
 
+// snapshotPrefix is the database key prefix of the checkpoint snapshots.
+var snapshotPrefix = []byte("parlia-")
+
+// snapshotKey = snapshotPrefix + hash
+func snapshotKey(hash common.Hash) []byte {
+	return append(append([]byte{}, snapshotPrefix...), hash.Bytes()...)
+}
+
 // Snapshot is the state of the validatorSet at a given point.
 type Snapshot struct {
 	config   *params.ParliaConfig // Consensus engine parameters to fine tune behavior
 	ethAPI   *ethapi.PublicBlockChainAPI
 	sigCache *lru.ARCCache // Cache of recent block signatures to speed up ecrecover
 
-	Number           uint64                      `json:"number"`             // Block number where the snapshot was created
-	Hash             common.Hash                 `json:"hash"`               // Block hash where the snapshot was created
-	Validators       map[common.Address]struct{} `json:"validators"`         // Set of authorized validators at this moment
-	Recents          map[uint64]common.Address   `json:"recents"`            // Set of recent validators for spam protections
-	RecentForkHashes map[uint64]string           `json:"recent_fork_hashes"` // Set of recent forkHash
+	Number           uint64                      `json:"number"`                // Block number where the snapshot was created
+	Hash             common.Hash                 `json:"hash"`                  // Block hash where the snapshot was created
+	Validators       map[common.Address]struct{} `json:"validators"`            // Set of authorized validators at this moment
+	Recents          map[uint64]common.Address   `json:"recents"`               // Set of recent validators for spam protections
+	RecentForkHashes map[uint64]string           `json:"recent_fork_hashes"`    // Set of recent forkHash
+	Attestation      *types.VoteData             `json:"attestation,omitempty"` // Latest justified (target) and finalized (source) blocks
 }
 
 // newSnapshot creates a new snapshot with the specified startup parameters. This
@@ -83,7 +92,7 @@ func (s validatorsAscending) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 
 // loadSnapshot loads an existing snapshot from the database.
 func loadSnapshot(config *params.ParliaConfig, sigCache *lru.ARCCache, db ethdb.Database, hash common.Hash, ethAPI *ethapi.PublicBlockChainAPI) (*Snapshot, error) {
-	blob, err := db.Get(append([]byte("parlia-"), hash[:]...))
+	blob, err := db.Get(snapshotKey(hash))
 	if err != nil {
 		return nil, err
 	}
@@ -104,7 +113,7 @@ func (s *Snapshot) store(db ethdb.Database) error {
 	if err != nil {
 		return err
 	}
-	return db.Put(append([]byte("parlia-"), s.Hash[:]...), blob)
+	return db.Put(snapshotKey(s.Hash), blob)
 }
 
 // copy creates a deep copy of the snapshot
@@ -129,6 +138,10 @@ func (s *Snapshot) copy() *Snapshot {
 	for block, id := range s.RecentForkHashes {
 		cpy.RecentForkHashes[block] = id
 	}
+	if s.Attestation != nil {
+		attestation := *s.Attestation
+		cpy.Attestation = &attestation
+	}
 	return cpy
 }
 
@@ -196,8 +209,7 @@ func (s *Snapshot) apply(headers []*types.Header, chain consensus.ChainHeaderRea
 			if checkpointHeader == nil {
 				return nil, consensus.ErrUnknownAncestor
 			}
-			if len(checkpointHeader.Extra) >= extraVanity+extraSeal {
-				validatorBytes := checkpointHeader.Extra[extraVanity : len(checkpointHeader.Extra)-extraSeal]
+			if validatorBytes := getValidatorBytesFromHeader(checkpointHeader, chain.Config(), s.config); validatorBytes != nil {
 				// get validators from headers and use that for new validator set
 				newValArr, err := ParseValidators(validatorBytes)
 				if err != nil {
@@ -229,12 +241,39 @@ func (s *Snapshot) apply(headers []*types.Header, chain consensus.ChainHeaderRea
 			}
 		}
 		snap.RecentForkHashes[number] = hex.EncodeToString(header.Extra[extraVanity-nextForkHashSize : extraVanity])
+
+		// track the justified and finalized blocks of the fast finality votes
+		if err := snap.updateAttestation(header, chain.Config()); err != nil {
+			return nil, err
+		}
 	}
 	snap.Number += uint64(len(headers))
 	snap.Hash = headers[len(headers)-1].Hash()
 	return snap, nil
 }
 
+// updateAttestation advances the justified block to the target of the header's
+// vote attestation. If the target directly follows the source, the source also
+// becomes finalized.
+func (s *Snapshot) updateAttestation(header *types.Header, chainConfig *params.ChainConfig) error {
+	attestation, err := getVoteAttestationFromHeader(header, chainConfig, s.config)
+	if err != nil || attestation == nil {
+		return err
+	}
+	// Only attestations of the direct parent advance the justified block
+	if attestation.Data.TargetHash != header.ParentHash || attestation.Data.TargetNumber+1 != header.Number.Uint64() {
+		return nil
+	}
+	if s.Attestation != nil && attestation.Data.SourceNumber+1 != attestation.Data.TargetNumber {
+		s.Attestation.TargetNumber = attestation.Data.TargetNumber
+		s.Attestation.TargetHash = attestation.Data.TargetHash
+	} else {
+		data := *attestation.Data
+		s.Attestation = &data
+	}
+	return nil
+}
+
 // validators retrieves the list of validators in ascending order.
 func (s *Snapshot) validators() []common.Address {
 	validators := make([]common.Address, 0, len(s.Validators))
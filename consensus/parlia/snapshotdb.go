@@ -0,0 +1,229 @@
+package parlia
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// errSnapshotAhead is returned if a snapshot is regenerated on top of a base
+// snapshot newer than the requested block.
+var errSnapshotAhead = errors.New("base snapshot ahead of target block")
+
+// StoredSnapshots retrieves all the checkpoint snapshots persisted in the
+// database, ordered by block number. The hashes of the snapshots which can't
+// be decoded are returned separately.
+func (p *Parlia) StoredSnapshots() ([]*Snapshot, []common.Hash, error) {
+	it := p.db.NewIterator(snapshotPrefix, nil)
+	defer it.Release()
+
+	var (
+		snaps   []*Snapshot
+		corrupt []common.Hash
+	)
+	for it.Next() {
+		// Skip any other data sharing the prefix, e.g. double sign evidences
+		if len(it.Key()) != len(snapshotPrefix)+common.HashLength {
+			continue
+		}
+		snap := new(Snapshot)
+		if err := json.Unmarshal(it.Value(), snap); err != nil {
+			corrupt = append(corrupt, common.BytesToHash(it.Key()[len(snapshotPrefix):]))
+			continue
+		}
+		snap.config = p.config
+		snap.sigCache = p.signatures
+		snap.ethAPI = p.ethAPI
+		snaps = append(snaps, snap)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		if snaps[i].Number != snaps[j].Number {
+			return snaps[i].Number < snaps[j].Number
+		}
+		return bytes.Compare(snaps[i].Hash[:], snaps[j].Hash[:]) < 0
+	})
+	return snaps, corrupt, it.Error()
+}
+
+// StoreSnapshot persists the snapshot into the database, overwriting any
+// previously stored one at the same block.
+func (p *Parlia) StoreSnapshot(snap *Snapshot) error {
+	return snap.store(p.db)
+}
+
+// DeleteSnapshot removes the snapshot at the given block from the database.
+func (p *Parlia) DeleteSnapshot(hash common.Hash) error {
+	return p.db.Delete(snapshotKey(hash))
+}
+
+// RegenerateSnapshot recomputes the snapshot at the given header from the header
+// chain, bypassing any cached or stored snapshot. Headers are applied on top of
+// the base snapshot if one is given, or on top of the genesis or PrimordialPulse
+// snapshot otherwise.
+func (p *Parlia) RegenerateSnapshot(chain consensus.ChainHeaderReader, base *Snapshot, header *types.Header) (*Snapshot, error) {
+	var (
+		headers []*types.Header
+		snap    *Snapshot
+		number  = header.Number.Uint64()
+		hash    = header.Hash()
+	)
+	if base != nil && base.Number > number {
+		return nil, errSnapshotAhead
+	}
+	for snap == nil {
+		switch {
+		case base != nil && number == base.Number:
+			if hash != base.Hash {
+				return nil, errBlockHashInconsistent
+			}
+			snap = base
+
+		case number == 0:
+			genesis := chain.GetHeader(hash, number)
+			if genesis == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			s, err := p.genesisSnapshot(genesis)
+			if err != nil {
+				return nil, err
+			}
+			snap = s
+
+		case p.chainConfig.IsPrimordialPulseBlock(number + 1):
+			s, err := p.primordialSnapshot(number, hash)
+			if err != nil {
+				return nil, err
+			}
+			snap = s
+
+		default:
+			header := chain.GetHeader(hash, number)
+			if header == nil {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			headers = append(headers, header) // headers appended in descending order
+			number, hash = number-1, header.ParentHash
+		}
+	}
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	return snap.apply(headers, chain, nil, p.chainConfig.ChainID)
+}
+
+// DiffSnapshots returns a human readable description of every difference of a
+// snapshot from the expected one.
+func DiffSnapshots(have, want *Snapshot) []string {
+	var diffs []string
+	if have.Number != want.Number || have.Hash != want.Hash {
+		diffs = append(diffs, fmt.Sprintf("block: have #%d [%x], want #%d [%x]", have.Number, have.Hash, want.Number, want.Hash))
+	}
+	for val := range have.Validators {
+		if _, ok := want.Validators[val]; !ok {
+			diffs = append(diffs, fmt.Sprintf("validators: unexpected %s", val))
+		}
+	}
+	for val := range want.Validators {
+		if _, ok := have.Validators[val]; !ok {
+			diffs = append(diffs, fmt.Sprintf("validators: missing %s", val))
+		}
+	}
+	diffs = append(diffs, diffRecents("recents", addressStrings(have.Recents), addressStrings(want.Recents))...)
+	diffs = append(diffs, diffRecents("recent_fork_hashes", have.RecentForkHashes, want.RecentForkHashes)...)
+	switch {
+	case have.Attestation == nil && want.Attestation == nil:
+	case have.Attestation == nil || want.Attestation == nil || *have.Attestation != *want.Attestation:
+		diffs = append(diffs, fmt.Sprintf("attestation: have %+v, want %+v", have.Attestation, want.Attestation))
+	}
+	return diffs
+}
+
+// diffRecents describes the differences between two block number keyed maps.
+func diffRecents(name string, have, want map[uint64]string) []string {
+	numbers := make([]uint64, 0, len(have)+len(want))
+	for number := range have {
+		numbers = append(numbers, number)
+	}
+	for number := range want {
+		if _, ok := have[number]; !ok {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+	var diffs []string
+	for _, number := range numbers {
+		h, hok := have[number]
+		w, wok := want[number]
+		switch {
+		case !wok:
+			diffs = append(diffs, fmt.Sprintf("%s[%d]: unexpected %s", name, number, h))
+		case !hok:
+			diffs = append(diffs, fmt.Sprintf("%s[%d]: missing %s", name, number, w))
+		case h != w:
+			diffs = append(diffs, fmt.Sprintf("%s[%d]: have %s, want %s", name, number, h, w))
+		}
+	}
+	return diffs
+}
+
+// addressStrings converts the recent validators into their string form.
+func addressStrings(recents map[uint64]common.Address) map[uint64]string {
+	strs := make(map[uint64]string, len(recents))
+	for number, addr := range recents {
+		strs[number] = addr.Hex()
+	}
+	return strs
+}
+
+// RebuildSnapshots regenerates and stores the checkpoint snapshots of the
+// canonical chain from the given block up to the chain head, on top of the
+// latest stored canonical snapshot preceding it. The stored snapshots at and
+// after the given block are not trusted and get overwritten.
+func (p *Parlia) RebuildSnapshots(chain consensus.ChainHeaderReader, from uint64) (int, error) {
+	snaps, _, err := p.StoredSnapshots()
+	if err != nil {
+		return 0, err
+	}
+	var base *Snapshot
+	for _, snap := range snaps {
+		if snap.Number >= from {
+			break
+		}
+		if header := chain.GetHeaderByNumber(snap.Number); header != nil && header.Hash() == snap.Hash {
+			base = snap
+		}
+	}
+	var (
+		head    = chain.CurrentHeader().Number.Uint64()
+		rebuilt int
+	)
+	for number := (from + checkpointInterval - 1) / checkpointInterval * checkpointInterval; number <= head; number += checkpointInterval {
+		// Blocks prior to the PrimordialPulse fork weren't sealed by validators
+		if p.chainConfig.PrimordialPulseAhead(new(big.Int).SetUint64(number)) {
+			continue
+		}
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			return rebuilt, consensus.ErrUnknownAncestor
+		}
+		snap, err := p.RegenerateSnapshot(chain, base, header)
+		if err != nil {
+			return rebuilt, err
+		}
+		if err := snap.store(p.db); err != nil {
+			return rebuilt, err
+		}
+		log.Info("Rebuilt checkpoint snapshot", "number", snap.Number, "hash", snap.Hash)
+		base, rebuilt = snap, rebuilt+1
+	}
+	return rebuilt, nil
+}
@@ -0,0 +1,140 @@
+package parlia
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// newSealedTestChain creates a chain of the given length sealed alternately by
+// two validators, along with a Parlia engine over an empty database.
+func newSealedTestChain(t *testing.T, length int) (*Parlia, *testHeaderChain) {
+	keys := make([]*ecdsa.PrivateKey, 2)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+	}
+	config := &params.ChainConfig{ChainID: big.NewInt(943), Parlia: &params.ParliaConfig{Period: 3, Epoch: 4}}
+	chain := &testHeaderChain{config: config}
+
+	var parent common.Hash
+	for i := 0; i < length; i++ {
+		header := &types.Header{ParentHash: parent, Number: big.NewInt(int64(i)), Difficulty: diffInTurn, Extra: make([]byte, extraVanity)}
+		header.Extra[extraVanity-1] = byte(i) // Vary the fork hashes
+		if uint64(i)%config.Parlia.Epoch == 0 {
+			for _, key := range keys {
+				header.Extra = append(header.Extra, crypto.PubkeyToAddress(key.PublicKey).Bytes()...)
+			}
+		}
+		header.Extra = append(header.Extra, make([]byte, extraSeal)...)
+		if i > 0 {
+			key := keys[i%len(keys)]
+			header.Coinbase = crypto.PubkeyToAddress(key.PublicKey)
+			sig, err := crypto.Sign(SealHash(header, config.ChainID).Bytes(), key)
+			if err != nil {
+				t.Fatalf("failed to seal header: %v", err)
+			}
+			copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+		}
+		chain.headers = append(chain.headers, header)
+		parent = header.Hash()
+	}
+	return New(config, rawdb.NewMemoryDatabase(), nil, chain.headers[0].Hash(), nil), chain
+}
+
+func TestRegenerateSnapshot(t *testing.T) {
+	engine, chain := newSealedTestChain(t, checkpointInterval+8)
+	head := chain.headers[checkpointInterval]
+
+	// Regenerated snapshots must match the ones produced during verification
+	have, err := engine.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	want, err := engine.RegenerateSnapshot(chain, nil, head)
+	if err != nil {
+		t.Fatalf("failed to regenerate snapshot: %v", err)
+	}
+	if diffs := DiffSnapshots(have, want); len(diffs) != 0 {
+		t.Fatalf("regenerated snapshot mismatch: %v", diffs)
+	}
+	// Regenerating on top of a base snapshot must yield the same result
+	base, err := engine.RegenerateSnapshot(chain, nil, chain.headers[10])
+	if err != nil {
+		t.Fatalf("failed to regenerate base snapshot: %v", err)
+	}
+	if snap, err := engine.RegenerateSnapshot(chain, base, head); err != nil {
+		t.Fatalf("failed to regenerate snapshot from base: %v", err)
+	} else if diffs := DiffSnapshots(snap, want); len(diffs) != 0 {
+		t.Fatalf("snapshot regenerated from base mismatch: %v", diffs)
+	}
+	if _, err := engine.RegenerateSnapshot(chain, want, chain.headers[10]); !errors.Is(err, errSnapshotAhead) {
+		t.Fatalf("error mismatch: have %v, want %v", err, errSnapshotAhead)
+	}
+}
+
+func TestRebuildSnapshots(t *testing.T) {
+	engine, chain := newSealedTestChain(t, checkpointInterval+8)
+	head := chain.headers[checkpointInterval]
+
+	// Generate the genesis and first checkpoint snapshots, and add some noise
+	if _, err := engine.snapshot(chain, head.Number.Uint64(), head.Hash(), nil); err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	engine.db.Put(append(evidencePrefix, head.Hash().Bytes()...), []byte{0x01})
+	engine.db.Put(snapshotKey(common.Hash{0x01}), []byte{0x01})
+
+	snaps, corrupt, err := engine.StoredSnapshots()
+	if err != nil {
+		t.Fatalf("failed to iterate snapshots: %v", err)
+	}
+	if len(snaps) != 2 || snaps[0].Number != 0 || snaps[1].Number != checkpointInterval {
+		t.Fatalf("stored snapshots mismatch: %d snapshots", len(snaps))
+	}
+	if len(corrupt) != 1 || corrupt[0] != (common.Hash{0x01}) {
+		t.Fatalf("corrupted snapshots mismatch: %v", corrupt)
+	}
+	// Corrupt the checkpoint snapshot and ensure the differences are reported
+	stored := snaps[1]
+	for number := range stored.Recents {
+		stored.Recents[number] = common.Address{0xff}
+		break
+	}
+	delete(stored.RecentForkHashes, checkpointInterval)
+	if err := engine.StoreSnapshot(stored); err != nil {
+		t.Fatalf("failed to store snapshot: %v", err)
+	}
+	want, err := engine.RegenerateSnapshot(chain, snaps[0], head)
+	if err != nil {
+		t.Fatalf("failed to regenerate snapshot: %v", err)
+	}
+	diffs := DiffSnapshots(stored, want)
+	if len(diffs) != 2 || !strings.HasPrefix(diffs[0], "recents[") || !strings.HasPrefix(diffs[1], "recent_fork_hashes[") {
+		t.Fatalf("snapshot differences mismatch: %v", diffs)
+	}
+	// Rebuild the snapshots and ensure the stored one gets fixed
+	if rebuilt, err := engine.RebuildSnapshots(chain, 1); err != nil || rebuilt != 1 {
+		t.Fatalf("failed to rebuild snapshots: rebuilt %d, err %v", rebuilt, err)
+	}
+	fixed, err := loadSnapshot(engine.config, engine.signatures, engine.db, head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to load rebuilt snapshot: %v", err)
+	}
+	if diffs := DiffSnapshots(fixed, want); len(diffs) != 0 {
+		t.Fatalf("rebuilt snapshot mismatch: %v", diffs)
+	}
+	// Deleted snapshots must be gone
+	if err := engine.DeleteSnapshot(head.Hash()); err != nil {
+		t.Fatalf("failed to delete snapshot: %v", err)
+	}
+	if snaps, _, _ := engine.StoredSnapshots(); len(snaps) != 1 {
+		t.Fatalf("snapshot count mismatch after deletion: have %d, want 1", len(snaps))
+	}
+}
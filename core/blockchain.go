@@ -129,6 +129,8 @@ type CacheConfig struct {
 	TrieTimeLimit       time.Duration // Time limit after which to flush the current in-memory trie to disk
 	SnapshotLimit       int           // Memory allowance (MB) to use for caching snapshot entries in memory
 	Preimages           bool          // Whether to store preimage of trie key to the disk
+	HistoryRetain       uint64        // Number of recent blocks whose bodies and receipts are retained (0 = all)
+	StateScheme         string        // Scheme used to store the state trie nodes, the hash-based one if empty
 
 	SnapshotWait bool // Wait for snapshot construction on startup. TODO(karalabe): This is a dirty hack for testing, nuke it
 }
@@ -234,6 +236,7 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 			Cache:     cacheConfig.TrieCleanLimit,
 			Journal:   cacheConfig.TrieCleanJournal,
 			Preimages: cacheConfig.Preimages,
+			Scheme:    cacheConfig.StateScheme,
 		}),
 		quit:          make(chan struct{}),
 		chainmu:       syncx.NewClosableMutex(),
@@ -390,6 +393,12 @@ func NewBlockChain(db ethdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		go bc.maintainTxIndex(txIndexBlock)
 	}
 
+	// Start the history expiry if old bodies and receipts are not retained.
+	if bc.cacheConfig.HistoryRetain > 0 {
+		bc.wg.Add(1)
+		go bc.maintainHistory(txLookupLimit != nil)
+	}
+
 	// If periodic cache journal is required, spin it up.
 	if bc.cacheConfig.TrieCleanRejournal > 0 {
 		if bc.cacheConfig.TrieCleanRejournal < time.Minute {
@@ -530,6 +539,9 @@ func (bc *BlockChain) setHeadBeyondRoot(head uint64, root common.Hash, repair bo
 					if root != (common.Hash{}) && !beyondRoot && newHeadBlock.Root() == root {
 						beyondRoot, rootNumber = true, newHeadBlock.NumberU64()
 					}
+					if !bc.HasState(newHeadBlock.Root()) {
+						bc.recoverState(newHeadBlock.Root())
+					}
 					if _, err := state.New(newHeadBlock.Root(), bc.stateCache, bc.snaps); err != nil {
 						log.Trace("Block state missing, rewinding further", "number", newHeadBlock.NumberU64(), "hash", newHeadBlock.Hash())
 						if pivot == nil || newHeadBlock.NumberU64() > *pivot {
@@ -633,6 +645,21 @@ func (bc *BlockChain) setHeadBeyondRoot(head uint64, root common.Hash, repair bo
 	return rootNumber, bc.loadLastState()
 }
 
+// recoverState rolls the persisted state back to the given root if the trie
+// database runs with the path-based scheme and enough reverse diffs are kept,
+// returning whether the state is available afterwards.
+func (bc *BlockChain) recoverState(root common.Hash) bool {
+	triedb := bc.stateCache.TrieDB()
+	if !triedb.Recoverable(root) {
+		return false
+	}
+	if err := triedb.Recover(root); err != nil {
+		log.Error("Failed to recover state", "root", root, "err", err)
+		return false
+	}
+	return true
+}
+
 // SnapSyncCommitHead sets the current head block to the one defined by the hash
 // irrelevant what the chain contents were prior.
 func (bc *BlockChain) SnapSyncCommitHead(hash common.Hash) error {
@@ -799,9 +826,15 @@ func (bc *BlockChain) Stop() {
 	//  - HEAD:     So we don't need to reprocess any blocks in the general case
 	//  - HEAD-1:   So we don't do large reorgs if our HEAD becomes an uncle
 	//  - HEAD-127: So we have a hard limit on the number of blocks reexecuted
-	if !bc.cacheConfig.TrieDirtyDisabled {
-		triedb := bc.stateCache.TrieDB()
-
+	if triedb := bc.stateCache.TrieDB(); triedb.Scheme() == rawdb.PathScheme {
+		// The path-based scheme only persists a single state, flush the head
+		// one and rely on the reverse diffs for rolling it back.
+		recent := bc.CurrentBlock()
+		log.Info("Writing cached state to disk", "block", recent.Number(), "hash", recent.Hash(), "root", recent.Root())
+		if err := triedb.Commit(recent.Root(), true, nil); err != nil {
+			log.Error("Failed to commit recent state trie", "err", err)
+		}
+	} else if !bc.cacheConfig.TrieDirtyDisabled {
 		for _, offset := range []uint64{0, 1, TriesInMemory - 1} {
 			if number := bc.CurrentBlock().NumberU64(); number > offset {
 				recent := bc.GetBlockByNumber(number - offset)
@@ -1205,6 +1238,11 @@ func (bc *BlockChain) writeBlockWithState(block *types.Block, receipts []*types.
 	}
 	triedb := bc.stateCache.TrieDB()
 
+	// The path-based scheme keeps a bounded number of diff layers in memory
+	// and flattens the older ones into the disk, no garbage collection needed.
+	if triedb.Scheme() == rawdb.PathScheme {
+		return triedb.CapLayers(root, TriesInMemory)
+	}
 	// If we're running an archive node, always flush
 	if bc.cacheConfig.TrieDirtyDisabled {
 		return triedb.Commit(root, false, nil)
@@ -1803,7 +1841,7 @@ func (bc *BlockChain) insertSideChain(block *types.Block, it *insertIterator) (i
 		numbers []uint64
 	)
 	parent := it.previous()
-	for parent != nil && !bc.HasState(parent.Root) {
+	for parent != nil && !bc.HasState(parent.Root) && !bc.recoverState(parent.Root) {
 		hashes = append(hashes, parent.Hash())
 		numbers = append(numbers, parent.Number.Uint64())
 
@@ -1858,7 +1896,7 @@ func (bc *BlockChain) recoverAncestors(block *types.Block) error {
 		numbers []uint64
 		parent  = block
 	)
-	for parent != nil && !bc.HasState(parent.Root()) {
+	for parent != nil && !bc.HasState(parent.Root()) && !bc.recoverState(parent.Root()) {
 		hashes = append(hashes, parent.Hash())
 		numbers = append(numbers, parent.NumberU64())
 		parent = bc.GetBlock(parent.ParentHash(), parent.NumberU64()-1)
@@ -2268,6 +2306,86 @@ func (bc *BlockChain) maintainTxIndex(ancients uint64) {
 	}
 }
 
+// maintainHistory is responsible for the deletion of the ancient block bodies
+// and receipts falling out of the retention window.
+//
+// User can use flag `history.retain` to specify the number of recent blocks
+// whose bodies and receipts are kept. Only the chain segments which already
+// moved into the freezer are pruned, in whole data files.
+//
+// If indexer is set, the transaction indexer is running and the history is
+// only pruned up to its index tail, otherwise stale indices are deleted here.
+func (bc *BlockChain) maintainHistory(indexer bool) {
+	defer bc.wg.Done()
+
+	var (
+		done   chan struct{}                  // Non-nil if background pruning routine is active.
+		headCh = make(chan ChainHeadEvent, 1) // Buffered to avoid locking up the event feed
+	)
+	sub := bc.SubscribeChainHeadEvent(headCh)
+	if sub == nil {
+		return
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case head := <-headCh:
+			if done == nil {
+				done = make(chan struct{})
+				go func(head uint64) {
+					defer func() { done <- struct{}{} }()
+					bc.pruneHistory(head, indexer)
+				}(head.Block.NumberU64())
+			}
+		case <-done:
+			done = nil
+		case <-bc.quit:
+			if done != nil {
+				log.Info("Waiting background history pruner to exit")
+				<-done
+			}
+			return
+		}
+	}
+}
+
+// pruneHistory deletes the frozen history below the retention window. Bodies
+// are never deleted ahead of the transaction index tail, since unindexing needs
+// them and lookups into the pruned range would be left dangling.
+func (bc *BlockChain) pruneHistory(head uint64, indexer bool) {
+	if head < bc.cacheConfig.HistoryRetain {
+		return
+	}
+	limit := head - bc.cacheConfig.HistoryRetain + 1
+	if frozen, err := bc.db.Ancients(); err != nil {
+		return // No chain freezer, nothing to prune
+	} else if limit > frozen {
+		limit = frozen
+	}
+	tail := rawdb.ReadTxIndexTail(bc.db)
+	if !indexer {
+		// Nobody moves the index tail, unindex the expiring blocks first
+		var from uint64
+		if tail != nil {
+			from = *tail
+		}
+		if from < limit {
+			rawdb.UnindexTransactions(bc.db, from, limit, bc.quit)
+		}
+		tail = rawdb.ReadTxIndexTail(bc.db)
+	}
+	if tail == nil {
+		return // Indexer not initialised yet, everything is indexed
+	}
+	if limit > *tail {
+		limit = *tail
+	}
+	if err := bc.db.TruncateTail(limit); err != nil {
+		log.Error("Failed to prune ancient history", "limit", limit, "err", err)
+	}
+}
+
 // reportBlock logs a bad block error.
 func (bc *BlockChain) reportBlock(block *types.Block, receipts types.Receipts, err error) {
 	rawdb.WriteBadBlock(bc.db, block)
@@ -1739,6 +1739,76 @@ func TestLargeReorgTrieGC(t *testing.T) {
 	}
 }
 
+// Tests that large reorgs and rewinds beyond the in-memory diff layers work
+// with the path-based state scheme by rolling back the persisted state.
+func TestLargeReorgPathScheme(t *testing.T) {
+	// Generate the original common chain segment and the two competing forks
+	engine := ethash.NewFaker()
+
+	db := rawdb.NewMemoryDatabase()
+	genesis := (&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(db)
+
+	shared, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 64, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{1}) })
+	original, _ := GenerateChain(params.TestChainConfig, shared[len(shared)-1], engine, db, 2*TriesInMemory, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{2}) })
+	competitor, _ := GenerateChain(params.TestChainConfig, shared[len(shared)-1], engine, db, 2*TriesInMemory+1, func(i int, b *BlockGen) { b.SetCoinbase(common.Address{3}) })
+
+	// Import the shared chain and the original canonical one
+	diskdb := rawdb.NewMemoryDatabase()
+	rawdb.WriteStateScheme(diskdb, rawdb.PathScheme)
+	(&Genesis{BaseFee: big.NewInt(params.InitialBaseFee)}).MustCommit(diskdb)
+
+	cacheConfig := *defaultCacheConfig
+	cacheConfig.StateScheme = rawdb.PathScheme
+	chain, err := NewBlockChain(diskdb, &cacheConfig, params.TestChainConfig, engine, vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if scheme := chain.stateCache.TrieDB().Scheme(); scheme != rawdb.PathScheme {
+		t.Fatalf("state scheme mismatch: have %s, want %s", scheme, rawdb.PathScheme)
+	}
+	if _, err := chain.InsertChain(shared); err != nil {
+		t.Fatalf("failed to insert shared chain: %v", err)
+	}
+	if _, err := chain.InsertChain(original); err != nil {
+		t.Fatalf("failed to insert original chain: %v", err)
+	}
+	// Ensure only the recent states are available
+	if chain.HasState(shared[len(shared)-1].Root()) {
+		t.Fatalf("common-but-old ancestor state still available")
+	}
+	for i, block := range original[len(original)-TriesInMemory:] {
+		if !chain.HasState(block.Root()) {
+			t.Fatalf("original %d: recent state missing", i)
+		}
+	}
+	// Import the competitor chain, triggering the reorg and ensure the state of
+	// the forking point is recovered and all the blocks are reprocessed.
+	if _, err := chain.InsertChain(competitor); err != nil {
+		t.Fatalf("failed to insert competitor chain: %v", err)
+	}
+	if head := chain.CurrentBlock(); head.Hash() != competitor[len(competitor)-1].Hash() {
+		t.Fatalf("head mismatch: have %d, want %d", head.NumberU64(), competitor[len(competitor)-1].NumberU64())
+	}
+	for i, block := range competitor[len(competitor)-TriesInMemory:] {
+		if !chain.HasState(block.Root()) {
+			t.Fatalf("competitor %d: recent state missing", i)
+		}
+	}
+	// Rewind the chain beyond the in-memory layers and ensure the state is rolled back
+	target := competitor[TriesInMemory/2]
+	if err := chain.SetHead(target.NumberU64()); err != nil {
+		t.Fatalf("failed to rewind chain: %v", err)
+	}
+	if head := chain.CurrentBlock(); head.Hash() != target.Hash() {
+		t.Fatalf("rewound head mismatch: have %d, want %d", head.NumberU64(), target.NumberU64())
+	}
+	if !chain.HasState(target.Root()) {
+		t.Fatalf("rewound state missing")
+	}
+}
+
 func TestBlockchainRecovery(t *testing.T) {
 	// Configure and generate a sample block chain
 	var (
@@ -2637,6 +2707,102 @@ func TestTransactionIndices(t *testing.T) {
 	}
 }
 
+// historyPruneRecorder is a database recording the limits of the history
+// pruning requests.
+type historyPruneRecorder struct {
+	ethdb.Database
+	limits []uint64
+}
+
+func (db *historyPruneRecorder) TruncateTail(items uint64) error {
+	db.limits = append(db.limits, items)
+	return db.Database.TruncateTail(items)
+}
+
+// Tests that enabling the history retention on a chain with all transactions
+// indexed unindexes the expired blocks before pruning them, and that pruning
+// never overtakes the tail of a running transaction indexer.
+func TestHistoryPruningIndexedChain(t *testing.T) {
+	var (
+		gendb   = rawdb.NewMemoryDatabase()
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		funds   = big.NewInt(100000000000000000)
+		gspec   = &Genesis{Config: params.TestChainConfig, Alloc: GenesisAlloc{address: {Balance: funds}}}
+		genesis = gspec.MustCommit(gendb)
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	height := uint64(128)
+	blocks, receipts := GenerateChain(gspec.Config, genesis, ethash.NewFaker(), gendb, int(height), func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x00}, big.NewInt(1000), params.TxGas, block.header.BaseFee, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	frdir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp freezer dir: %v", err)
+	}
+	defer os.RemoveAll(frdir)
+	ancientDb, err := rawdb.NewDatabaseWithFreezer(rawdb.NewMemoryDatabase(), frdir, "", false)
+	if err != nil {
+		t.Fatalf("failed to create temp freezer db: %v", err)
+	}
+	defer ancientDb.Close()
+	gspec.MustCommit(ancientDb)
+	db := &historyPruneRecorder{Database: ancientDb}
+
+	// Import all blocks into the freezer, indexing every transaction
+	chain, err := NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	headers := make([]*types.Header, len(blocks))
+	for i, block := range blocks {
+		headers[i] = block.Header()
+	}
+	if n, err := chain.InsertHeaderChain(headers, 0); err != nil {
+		t.Fatalf("failed to insert header %d: %v", n, err)
+	}
+	if n, err := chain.InsertReceiptChain(blocks, receipts, height); err != nil {
+		t.Fatalf("block %d: failed to insert into chain: %v", n, err)
+	}
+	chain.Stop()
+
+	// Enable the history retention without a transaction indexer
+	cacheConfig := *defaultCacheConfig
+	cacheConfig.HistoryRetain = 32
+
+	chain, err = NewBlockChain(db, &cacheConfig, params.TestChainConfig, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create tester chain: %v", err)
+	}
+	defer chain.Stop()
+
+	want := height - cacheConfig.HistoryRetain + 1
+	chain.pruneHistory(height, false)
+	if len(db.limits) != 1 || db.limits[0] != want {
+		t.Fatalf("prune limit mismatch: have %v, want [%d]", db.limits, want)
+	}
+	if tail := rawdb.ReadTxIndexTail(db); tail == nil || *tail != want {
+		t.Fatalf("tx index tail mismatch: have %v, want %d", tail, want)
+	}
+	for _, block := range blocks {
+		for _, tx := range block.Transactions() {
+			if indexed := rawdb.ReadTxLookupEntry(db, tx.Hash()) != nil; indexed != (block.NumberU64() >= want) {
+				t.Fatalf("block %d: transaction indexed %v, want %v", block.NumberU64(), indexed, !indexed)
+			}
+		}
+	}
+	// A running indexer which didn't move its tail yet must hold back pruning
+	db.limits = nil
+	chain.pruneHistory(height+cacheConfig.HistoryRetain, true)
+	if len(db.limits) != 1 || db.limits[0] != want {
+		t.Fatalf("prune limit mismatch: have %v, want [%d]", db.limits, want)
+	}
+}
+
 func TestSkipStaleTxIndicesInSnapSync(t *testing.T) {
 	// Configure and generate a sample block chain
 	var (
@@ -0,0 +1,372 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+const (
+	// bundlePoolSlots is the maximum number of bundles kept in the pool.
+	bundlePoolSlots = 1024
+
+	// maxBundleTxs is the maximum number of transactions in a single bundle.
+	maxBundleTxs = 64
+
+	// maxBundlesPerSender is the maximum number of bundles in the pool carrying
+	// transactions of the same sender.
+	maxBundlesPerSender = 16
+)
+
+// MaxBundleDistance is the distance ahead of the chain head up to which bundles
+// are accepted and simulated.
+const MaxBundleDistance = 64
+
+var (
+	// ErrBundleEmpty is returned if a bundle without transactions is submitted.
+	ErrBundleEmpty = errors.New("empty bundle")
+
+	// ErrBundleTooLarge is returned if a bundle contains too many transactions.
+	ErrBundleTooLarge = errors.New("bundle too large")
+
+	// ErrBundleOutdated is returned if a bundle targets an already imported block.
+	ErrBundleOutdated = errors.New("bundle targets past block")
+
+	// ErrBundleTooFar is returned if a bundle targets a block too far ahead of
+	// the chain head.
+	ErrBundleTooFar = errors.New("bundle targets block too far ahead")
+
+	// ErrBundleKnown is returned if a bundle is already contained in the pool.
+	ErrBundleKnown = errors.New("already known bundle")
+
+	// ErrBundlePoolFull is returned if the bundle pool has no room left.
+	ErrBundlePoolFull = errors.New("bundle pool is full")
+
+	// ErrBundleSenderLimit is returned if a sender of a bundle already has too
+	// many bundles in the pool.
+	ErrBundleSenderLimit = errors.New("too many bundles from sender")
+
+	// ErrBundleReverted is returned if a transaction of a bundle fails or reverts,
+	// invalidating the entire bundle.
+	ErrBundleReverted = errors.New("bundle transaction reverted")
+)
+
+var (
+	bundleGauge         = metrics.NewRegisteredGauge("bundlepool/bundles", nil)
+	invalidBundleMeter  = metrics.NewRegisteredMeter("bundlepool/invalid", nil)
+	outdatedBundleMeter = metrics.NewRegisteredMeter("bundlepool/outdated", nil)
+)
+
+// Bundle is an ordered group of transactions to be included atomically in a
+// given block: either all of them are executed successfully in order, or none
+// of them is included.
+type Bundle struct {
+	Txs          types.Transactions
+	BlockNumber  uint64 // Number of the block the bundle targets
+	MinTimestamp uint64 // Earliest block timestamp the bundle is valid at (0 = no limit)
+	MaxTimestamp uint64 // Latest block timestamp the bundle is valid at (0 = no limit)
+
+	hash atomic.Value
+}
+
+// Hash returns the hash of the bundle, the keccak256 hash of the concatenated
+// hashes of its transactions.
+func (b *Bundle) Hash() common.Hash {
+	if hash := b.hash.Load(); hash != nil {
+		return hash.(common.Hash)
+	}
+	blob := make([]byte, 0, len(b.Txs)*common.HashLength)
+	for _, tx := range b.Txs {
+		blob = append(blob, tx.Hash().Bytes()...)
+	}
+	hash := crypto.Keccak256Hash(blob)
+	b.hash.Store(hash)
+	return hash
+}
+
+// Valid reports whether the bundle may be included in a block with the given
+// number and timestamp.
+func (b *Bundle) Valid(number uint64, timestamp uint64) bool {
+	if b.BlockNumber != number {
+		return false
+	}
+	if b.MinTimestamp != 0 && timestamp < b.MinTimestamp {
+		return false
+	}
+	if b.MaxTimestamp != 0 && timestamp > b.MaxTimestamp {
+		return false
+	}
+	return true
+}
+
+// BundleResult is the outcome of applying a bundle on top of a state.
+type BundleResult struct {
+	Receipts types.Receipts
+	GasUsed  uint64
+	Payment  *big.Int // Amount received by the block producer, fees included
+}
+
+// GasPrice returns the effective gas price the bundle pays to the block producer.
+func (r *BundleResult) GasPrice() *big.Int {
+	if r.GasUsed == 0 {
+		return new(big.Int)
+	}
+	return new(big.Int).Div(r.Payment, new(big.Int).SetUint64(r.GasUsed))
+}
+
+// ProducerBalance returns the funds held by the producer of the given block:
+// the coinbase balance, increased by the fees collected at the system address
+// under Parlia, which are distributed to the validator when finalizing.
+func ProducerBalance(config *params.ChainConfig, statedb *state.StateDB, header *types.Header) *big.Int {
+	balance := new(big.Int).Set(statedb.GetBalance(header.Coinbase))
+	if config.Parlia != nil && !config.PrimordialPulseAhead(header.Number) && header.Coinbase != consensus.SystemAddress {
+		balance.Add(balance, statedb.GetBalance(consensus.SystemAddress))
+	}
+	return balance
+}
+
+// ApplyBundle applies the transactions of a bundle in order on the given state,
+// the first one at the given index within the block. If any of them is invalid
+// or reverts, ErrBundleReverted is returned and the state is left partially
+// modified, to be reverted by the caller.
+func ApplyBundle(config *params.ChainConfig, bc ChainContext, gp *GasPool, statedb *state.StateDB, header *types.Header, bundle *Bundle, txIndex int, usedGas *uint64, cfg vm.Config) (*BundleResult, error) {
+	var (
+		result = &BundleResult{Receipts: make(types.Receipts, 0, len(bundle.Txs))}
+		before = ProducerBalance(config, statedb, header)
+		gas    = *usedGas
+	)
+	for i, tx := range bundle.Txs {
+		statedb.Prepare(tx.Hash(), txIndex+i)
+		receipt, err := ApplyTransaction(config, bc, &header.Coinbase, gp, statedb, header, tx, usedGas, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%w: tx %x: %v", ErrBundleReverted, tx.Hash(), err)
+		}
+		if receipt.Status == types.ReceiptStatusFailed {
+			return nil, fmt.Errorf("%w: tx %x", ErrBundleReverted, tx.Hash())
+		}
+		result.Receipts = append(result.Receipts, receipt)
+	}
+	result.GasUsed = *usedGas - gas
+	result.Payment = new(big.Int).Sub(ProducerBalance(config, statedb, header), before)
+	return result, nil
+}
+
+// BundlePool collects the transaction bundles submitted for inclusion in the
+// upcoming blocks. Bundles are kept until the block they target is imported.
+type BundlePool struct {
+	config *params.ChainConfig
+	chain  blockChain
+	signer types.Signer
+
+	bundles map[common.Hash]*Bundle          // All bundles in the pool, indexed by hash
+	senders map[common.Hash][]common.Address // Distinct transaction senders of each bundle
+	counts  map[common.Address]int           // Number of bundles in the pool per sender
+	mu      sync.RWMutex
+
+	chainHeadCh  chan ChainHeadEvent
+	chainHeadSub event.Subscription
+	wg           sync.WaitGroup
+}
+
+// NewBundlePool creates a bundle pool tracking the given chain and starts its
+// maintenance loop.
+func NewBundlePool(config *params.ChainConfig, chain blockChain) *BundlePool {
+	pool := &BundlePool{
+		config:      config,
+		chain:       chain,
+		signer:      types.LatestSigner(config),
+		bundles:     make(map[common.Hash]*Bundle),
+		senders:     make(map[common.Hash][]common.Address),
+		counts:      make(map[common.Address]int),
+		chainHeadCh: make(chan ChainHeadEvent, chainHeadChanSize),
+	}
+	pool.chainHeadSub = chain.SubscribeChainHeadEvent(pool.chainHeadCh)
+
+	pool.wg.Add(1)
+	go pool.loop()
+	return pool
+}
+
+// Stop terminates the maintenance loop of the bundle pool.
+func (pool *BundlePool) Stop() {
+	pool.chainHeadSub.Unsubscribe()
+	pool.wg.Wait()
+	log.Info("Bundle pool stopped")
+}
+
+// loop discards the bundles targeting already imported blocks.
+func (pool *BundlePool) loop() {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case ev := <-pool.chainHeadCh:
+			pool.prune(ev.Block.NumberU64())
+
+		case <-pool.chainHeadSub.Err():
+			return
+		}
+	}
+}
+
+// prune removes every bundle targeting a block at or below the given number.
+func (pool *BundlePool) prune(head uint64) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for hash, bundle := range pool.bundles {
+		if bundle.BlockNumber <= head {
+			pool.remove(hash)
+			outdatedBundleMeter.Mark(1)
+		}
+	}
+	bundleGauge.Update(int64(len(pool.bundles)))
+}
+
+// remove deletes a bundle from the pool. The caller must hold the write lock.
+func (pool *BundlePool) remove(hash common.Hash) {
+	for _, sender := range pool.senders[hash] {
+		if pool.counts[sender]--; pool.counts[sender] <= 0 {
+			delete(pool.counts, sender)
+		}
+	}
+	delete(pool.senders, hash)
+	delete(pool.bundles, hash)
+}
+
+// Add validates a bundle and inserts it into the pool.
+func (pool *BundlePool) Add(bundle *Bundle) error {
+	senders, err := pool.validateBundle(bundle)
+	if err != nil {
+		invalidBundleMeter.Mark(1)
+		return err
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	hash := bundle.Hash()
+	if _, ok := pool.bundles[hash]; ok {
+		return ErrBundleKnown
+	}
+	if len(pool.bundles) >= bundlePoolSlots {
+		return ErrBundlePoolFull
+	}
+	for _, sender := range senders {
+		if pool.counts[sender] >= maxBundlesPerSender {
+			return fmt.Errorf("%w: %x", ErrBundleSenderLimit, sender)
+		}
+	}
+	for _, sender := range senders {
+		pool.counts[sender]++
+	}
+	pool.bundles[hash] = bundle
+	pool.senders[hash] = senders
+	bundleGauge.Update(int64(len(pool.bundles)))
+
+	log.Trace("Added bundle to pool", "hash", hash, "txs", len(bundle.Txs), "number", bundle.BlockNumber)
+	return nil
+}
+
+// validateBundle checks whether a bundle is acceptable for the pool, without
+// executing any of its transactions, and returns its distinct senders. Every
+// sender must be able to pay for the gas and value of all its transactions in
+// the bundle at the head state and none of its nonces may be already used,
+// keeping unfunded junk out.
+func (pool *BundlePool) validateBundle(bundle *Bundle) ([]common.Address, error) {
+	if len(bundle.Txs) == 0 {
+		return nil, ErrBundleEmpty
+	}
+	if len(bundle.Txs) > maxBundleTxs {
+		return nil, fmt.Errorf("%w: %d txs, max %d", ErrBundleTooLarge, len(bundle.Txs), maxBundleTxs)
+	}
+	head := pool.chain.CurrentBlock()
+	if bundle.BlockNumber <= head.NumberU64() {
+		return nil, fmt.Errorf("%w: target %d, head %d", ErrBundleOutdated, bundle.BlockNumber, head.NumberU64())
+	}
+	if bundle.BlockNumber > head.NumberU64()+MaxBundleDistance {
+		return nil, fmt.Errorf("%w: target %d, head %d", ErrBundleTooFar, bundle.BlockNumber, head.NumberU64())
+	}
+	if bundle.MaxTimestamp != 0 && bundle.MinTimestamp > bundle.MaxTimestamp {
+		return nil, fmt.Errorf("invalid bundle timestamp range [%d, %d]", bundle.MinTimestamp, bundle.MaxTimestamp)
+	}
+	statedb, err := pool.chain.StateAt(head.Root())
+	if err != nil {
+		return nil, err
+	}
+	var (
+		senders []common.Address
+		costs   = make(map[common.Address]*big.Int)
+	)
+	for _, tx := range bundle.Txs {
+		from, err := types.Sender(pool.signer, tx)
+		if err != nil {
+			return nil, fmt.Errorf("%w: tx %x", ErrInvalidSender, tx.Hash())
+		}
+		if nonce := statedb.GetNonce(from); tx.Nonce() < nonce {
+			return nil, fmt.Errorf("%w: tx %x, nonce %d, state %d", ErrNonceTooLow, tx.Hash(), tx.Nonce(), nonce)
+		}
+		cost := costs[from]
+		if cost == nil {
+			cost = new(big.Int)
+			costs[from] = cost
+			senders = append(senders, from)
+		}
+		cost.Add(cost, tx.Cost())
+		if balance := statedb.GetBalance(from); balance.Cmp(cost) < 0 {
+			return nil, fmt.Errorf("%w: address %x, have %v, want %v", ErrInsufficientFunds, from, balance, cost)
+		}
+	}
+	return senders, nil
+}
+
+// Pending retrieves the bundles which may be included in a block with the given
+// number and timestamp.
+func (pool *BundlePool) Pending(number uint64, timestamp uint64) []*Bundle {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	var bundles []*Bundle
+	for _, bundle := range pool.bundles {
+		if bundle.Valid(number, timestamp) {
+			bundles = append(bundles, bundle)
+		}
+	}
+	return bundles
+}
+
+// Count returns the number of bundles in the pool.
+func (pool *BundlePool) Count() int {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return len(pool.bundles)
+}
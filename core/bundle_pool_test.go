@@ -0,0 +1,115 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestBundlePool(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{10000000, statedb, new(event.Feed)}
+
+	pool := NewBundlePool(params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	key, _ := crypto.GenerateKey()
+	poor, _ := crypto.GenerateKey()
+	gasOnly, _ := crypto.GenerateKey()
+	statedb.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(params.Ether))
+	statedb.SetNonce(crypto.PubkeyToAddress(key.PublicKey), 1)
+	statedb.AddBalance(crypto.PubkeyToAddress(poor.PublicKey), big.NewInt(21100))
+	statedb.AddBalance(crypto.PubkeyToAddress(gasOnly.PublicKey), big.NewInt(21000))
+
+	signed := func(number uint64, key *ecdsa.PrivateKey, nonces ...uint64) *Bundle {
+		txs := make(types.Transactions, len(nonces))
+		for i, nonce := range nonces {
+			txs[i] = transaction(nonce, 21000, key)
+		}
+		return &Bundle{Txs: txs, BlockNumber: number}
+	}
+	bundle := func(number uint64, nonces ...uint64) *Bundle {
+		return signed(number, key, nonces...)
+	}
+	invalid := bundle(1, 0)
+	invalid.Txs[0], _ = invalid.Txs[0].WithSignature(types.HomesteadSigner{}, make([]byte, 65))
+
+	tests := []struct {
+		bundle *Bundle
+		err    error
+	}{
+		{&Bundle{BlockNumber: 1}, ErrBundleEmpty},
+		{bundle(0, 0), ErrBundleOutdated},
+		{bundle(MaxBundleDistance+1, 1), ErrBundleTooFar},
+		{bundle(1, make([]uint64, maxBundleTxs+1)...), ErrBundleTooLarge},
+		{invalid, ErrInvalidSender},
+		{bundle(1, 0), ErrNonceTooLow},
+		{signed(1, poor, 0), nil},
+		{signed(2, poor, 0, 1), ErrInsufficientFunds},
+		{signed(1, gasOnly, 0), ErrInsufficientFunds},
+		{bundle(1, 1, 2), nil},
+		{bundle(1, 1, 2), ErrBundleKnown},
+		{bundle(1, 2), nil},
+		{&Bundle{Txs: bundle(1, 3).Txs, BlockNumber: 2, MinTimestamp: 100, MaxTimestamp: 200}, nil},
+	}
+	for i, tt := range tests {
+		if err := pool.Add(tt.bundle); !errors.Is(err, tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	if n := len(pool.Pending(1, 0)); n != 3 {
+		t.Errorf("pending bundles mismatch for block 1: have %d, want 3", n)
+	}
+	for timestamp, want := range map[uint64]int{99: 0, 100: 1, 200: 1, 201: 0} {
+		if n := len(pool.Pending(2, timestamp)); n != want {
+			t.Errorf("pending bundles mismatch at time %d: have %d, want %d", timestamp, n, want)
+		}
+	}
+	// Bundles targeting imported blocks must be discarded
+	head := types.NewBlock(&types.Header{Number: big.NewInt(1)}, nil, nil, nil, nil)
+	blockchain.chainHeadFeed.Send(ChainHeadEvent{Block: head})
+
+	for start := time.Now(); pool.Count() != 1; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatalf("outdated bundles not discarded: have %d, want 1", pool.Count())
+		}
+	}
+	// Senders may only occupy a limited number of slots, released on discard
+	for i := 1; i < maxBundlesPerSender; i++ {
+		if err := pool.Add(bundle(2, uint64(100+i))); err != nil {
+			t.Fatalf("bundle %d: failed to add: %v", i, err)
+		}
+	}
+	if err := pool.Add(bundle(2, 100+maxBundlesPerSender)); !errors.Is(err, ErrBundleSenderLimit) {
+		t.Fatalf("sender limit error mismatch: have %v, want %v", err, ErrBundleSenderLimit)
+	}
+	if err := pool.Add(signed(2, poor, 0)); err != nil {
+		t.Fatalf("failed to add bundle of another sender: %v", err)
+	}
+}
@@ -24,6 +24,10 @@ import (
 // NewTxsEvent is posted when a batch of transactions enter the transaction pool.
 type NewTxsEvent struct{ Txs []*types.Transaction }
 
+// DroppedTxsEvent is posted when transactions leave the transaction pool without
+// being included in a block.
+type DroppedTxsEvent struct{ Drops []*TxDrop }
+
 // NewMinedBlockEvent is posted when a block has been imported.
 type NewMinedBlockEvent struct{ Block *types.Block }
 
@@ -41,3 +45,6 @@ type ChainSideEvent struct {
 }
 
 type ChainHeadEvent struct{ Block *types.Block }
+
+// NewVoteEvent is posted when a vote enters the vote pool.
+type NewVoteEvent struct{ Vote *types.VoteEnvelope }
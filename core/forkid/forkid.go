@@ -255,6 +255,19 @@ func gatherForks(config *params.ChainConfig) []uint64 {
 			forks = append(forks, rule.Uint64())
 		}
 	}
+	// Gather the system contract upgrades and fee schedules of the consensus engine
+	if config.Parlia != nil {
+		for _, upgrade := range config.Parlia.Upgrades {
+			if upgrade.Block != nil {
+				forks = append(forks, upgrade.Block.Uint64())
+			}
+		}
+		for _, schedule := range config.Parlia.FeeSchedules {
+			if schedule.Block != nil {
+				forks = append(forks, schedule.Block.Uint64())
+			}
+		}
+	}
 	// Sort the fork block numbers to permit chronological XOR
 	for i := 0; i < len(forks); i++ {
 		for j := i + 1; j < len(forks); j++ {
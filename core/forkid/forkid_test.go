@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"math"
 	"math/big"
+	"reflect"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -178,6 +179,25 @@ func TestCreation(t *testing.T) {
 	}
 }
 
+// TestParliaUpgrades tests that system contract upgrades scheduled in the Parlia
+// config are accounted for as forks.
+func TestParliaUpgrades(t *testing.T) {
+	base := &params.ChainConfig{ChainID: big.NewInt(1), HomesteadBlock: big.NewInt(10), Parlia: &params.ParliaConfig{}}
+	upgraded := *base
+	upgraded.Parlia = &params.ParliaConfig{Upgrades: []params.ContractUpgrade{{Name: "A", Block: big.NewInt(20)}, {Name: "B", Block: big.NewInt(10)}}}
+
+	if have, want := gatherForks(&upgraded), []uint64{10, 20}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("fork list mismatch: have %v, want %v", have, want)
+	}
+	genesis := common.Hash{0x01}
+	if have := NewID(&upgraded, genesis, 15); have.Hash != NewID(base, genesis, 15).Hash || have.Next != 20 {
+		t.Errorf("fork ID mismatch before the upgrade: have %x", have)
+	}
+	if NewID(base, genesis, 25).Hash == NewID(&upgraded, genesis, 25).Hash {
+		t.Errorf("fork ID identical after the upgrade")
+	}
+}
+
 // TestValidation tests that a local peer correctly validates and accepts a remote
 // fork ID.
 func TestValidation(t *testing.T) {
@@ -180,9 +180,11 @@ func SetupGenesisBlockWithOverride(db ethdb.Database, genesis *Genesis, override
 		return genesis.Config, block.Hash(), nil
 	}
 	// We have the genesis block in database(perhaps in ancient database)
-	// but the corresponding state is missing.
+	// but the corresponding state is missing. The path-based scheme only
+	// persists the latest state, so the genesis state is expected to be gone
+	// once the chain progressed.
 	header := rawdb.ReadHeader(db, stored, 0)
-	if _, err := state.New(header.Root, state.NewDatabaseWithConfig(db, nil), nil); err != nil {
+	if _, err := state.New(header.Root, state.NewDatabaseWithConfig(db, nil), nil); err != nil && rawdb.ReadStateScheme(db) != rawdb.PathScheme {
 		if genesis == nil {
 			genesis = DefaultGenesisBlock()
 		}
@@ -282,7 +284,9 @@ func (g *Genesis) ToBlock(db ethdb.Database) *types.Block {
 	if db == nil {
 		db = rawdb.NewMemoryDatabase()
 	}
-	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	// Write the genesis state with the scheme the database is marked with
+	sdb := state.NewDatabaseWithConfig(db, &trie.Config{Preimages: true, Scheme: rawdb.ReadStateScheme(db)})
+	statedb, err := state.New(common.Hash{}, sdb, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -491,6 +495,117 @@ func DeveloperGenesisBlock(period uint64, gasLimit uint64, faucet common.Address
 	}
 }
 
+// DeveloperParliaGenesisBlock returns the 'geth --dev --dev.parlia' genesis
+// block, sealed in turns by the given validators. The system contracts of the
+// PrimordialPulse fork are deployed at genesis and the validator set contract
+// and staking contracts are switched over to the developer validators right
+// after their initialization.
+func DeveloperParliaGenesisBlock(period uint64, gasLimit uint64, faucet common.Address, validators []common.Address) *Genesis {
+	config := *params.AllCliqueProtocolChanges
+	config.Clique = nil
+	config.PrimordialPulseBlock = big.NewInt(0)
+	config.SystemZeroBlock = big.NewInt(0)
+	config.DoubleSignSlashBlock = big.NewInt(0)
+	config.Parlia = &params.ParliaConfig{
+		Period:   period,
+		Epoch:    20,
+		Era:      4,
+		BurnRate: 4,
+		Upgrades: []params.ContractUpgrade{{
+			Name:    "DeveloperValidators",
+			Block:   big.NewInt(2),
+			Addr:    systemcontracts.ValidatorContract,
+			Storage: developerValidatorStorage(validators),
+		}, {
+			Name:    "DeveloperStakers",
+			Block:   big.NewInt(2),
+			Addr:    systemcontracts.StakingContract,
+			Storage: developerStakingStorage(validators),
+		}},
+	}
+	genesis := DeveloperGenesisBlock(period, gasLimit, faucet)
+	genesis.Config = &config
+
+	extra := make([]byte, 32)
+	for _, validator := range validators {
+		extra = append(extra, validator.Bytes()...)
+	}
+	genesis.ExtraData = append(extra, make([]byte, crypto.SignatureLength)...)
+
+	for _, contract := range *params.PulseChainTestnetConfig.Parlia.SystemContracts {
+		genesis.Alloc[common.HexToAddress(contract.Addr)] = GenesisAccount{Balance: new(big.Int), Code: common.FromHex(contract.Code)}
+	}
+	return genesis
+}
+
+// developerValidatorStorage returns the storage slots of the validator set
+// contract replacing the validators set up by its initializer with the given
+// ones. The contract keeps an initialized flag in slot 0, the validator array
+// in slot 1 (two slots per element: the address and jailed flag, then the
+// incoming fees) and the 1-based array index of every validator in the mapping
+// at slot 2.
+func developerValidatorStorage(validators []common.Address) map[common.Hash]common.Hash {
+	return developerArrayStorage(validators, 1, 2, 2, func(validator common.Address) []common.Hash {
+		return []common.Hash{common.BytesToHash(validator.Bytes()), {}}
+	})
+}
+
+// developerStakingStorage returns the storage slots of the staking contract
+// replacing the stakers registered by its initializer with the given
+// validators, so era rotations keep electing them. The contract keeps the
+// staker array in slot 2 (four slots per element: the registration flag and
+// validator address, then the fee address, commission and active flag, then
+// the stakes) and the 1-based array index of every staker in the mapping at
+// slot 3.
+func developerStakingStorage(validators []common.Address) map[common.Hash]common.Hash {
+	return developerArrayStorage(validators, 2, 3, 4, func(validator common.Address) []common.Hash {
+		var (
+			registered = new(big.Int).Lsh(new(big.Int).SetBytes(validator.Bytes()), 8)
+			active     = new(big.Int).Lsh(big.NewInt(0x0132), 160)
+		)
+		registered.SetBit(registered, 0, 1)
+		return []common.Hash{
+			common.BigToHash(registered),
+			common.BigToHash(active.Or(active, new(big.Int).SetBytes(validator.Bytes()))),
+			{}, {},
+		}
+	})
+}
+
+// developerArrayStorage returns the storage slots of a system contract keeping
+// the validators in an array of fixed size elements at the given slot, indexed
+// by a mapping from address to the 1-based array position. The entries set up
+// for the testnet validators by the contract initializer are cleared.
+func developerArrayStorage(validators []common.Address, arraySlot, indexSlot int64, size int, element func(common.Address) []common.Hash) map[common.Hash]common.Hash {
+	var (
+		storage = make(map[common.Hash]common.Hash)
+		array   = new(big.Int).SetBytes(crypto.Keccak256(common.BigToHash(big.NewInt(arraySlot)).Bytes()))
+		index   = func(addr common.Address) common.Hash {
+			return crypto.Keccak256Hash(common.BytesToHash(addr.Bytes()).Bytes(), common.BigToHash(big.NewInt(indexSlot)).Bytes())
+		}
+		field = func(i int, field int) common.Hash {
+			slot := new(big.Int).Add(array, big.NewInt(int64(size*i+field)))
+			return common.BigToHash(math.U256(slot))
+		}
+	)
+	// Drop the validators installed by the initializer
+	for i, addr := range *params.PulseChainTestnetConfig.Parlia.InitValidators {
+		storage[index(common.HexToAddress(addr))] = common.Hash{}
+		for j := 0; j < size; j++ {
+			storage[field(i, j)] = common.Hash{}
+		}
+	}
+	// Install the developer validators
+	storage[common.BigToHash(big.NewInt(arraySlot))] = common.BigToHash(big.NewInt(int64(len(validators))))
+	for i, validator := range validators {
+		storage[index(validator)] = common.BigToHash(big.NewInt(int64(i + 1)))
+		for j, value := range element(validator) {
+			storage[field(i, j)] = value
+		}
+	}
+	return storage
+}
+
 func decodePrealloc(data string) GenesisAlloc {
 	var p []struct{ Addr, Balance *big.Int }
 	if err := rlp.NewStream(strings.NewReader(data), 0).Decode(&p); err != nil {
@@ -216,3 +216,37 @@ func TestGenesis_Commit(t *testing.T) {
 		t.Errorf("inequal difficulty; stored: %v, genesisBlock: %v", stored, genesisBlock.Difficulty())
 	}
 }
+
+func TestDeveloperParliaGenesis(t *testing.T) {
+	validators := []common.Address{common.HexToAddress("0xdb5f55b6111f0adc916921cf5624b2768f6524f8"), {0x02}}
+	genesis := DeveloperParliaGenesisBlock(1, 11500000, common.Address{0x01}, validators)
+	if err := genesis.Config.CheckConfigForkOrder(); err != nil {
+		t.Fatalf("invalid config: %v", err)
+	}
+	block, err := genesis.Commit(rawdb.NewMemoryDatabase())
+	if err != nil {
+		t.Fatalf("failed to commit genesis: %v", err)
+	}
+	if have, want := len(block.Extra()), 32+len(validators)*common.AddressLength+65; have != want {
+		t.Fatalf("extra data length mismatch: have %d, want %d", have, want)
+	}
+	// The staking contract entries must match the ones its initializer creates
+	var (
+		staking = developerStakingStorage(validators)
+		array   = common.HexToHash("0x405787fa12a823e0f2b7631cc41b3ba8828b3321ca811111fa75cd3aa3bb5ace")
+		index   = common.HexToHash("0x3636bca477a10839ded91eda15bf3974c8fac76571dcf4d921ddeddf0acb000d")
+	)
+	if have, want := staking[common.BigToHash(big.NewInt(2))], common.BigToHash(big.NewInt(2)); have != want {
+		t.Errorf("staker count mismatch: have %x, want %x", have, want)
+	}
+	if have, want := staking[index], common.BigToHash(big.NewInt(1)); have != want {
+		t.Errorf("staker index mismatch: have %x, want %x", have, want)
+	}
+	if have, want := staking[array], common.HexToHash("0xdb5f55b6111f0adc916921cf5624b2768f6524f801"); have != want {
+		t.Errorf("staker registration mismatch: have %x, want %x", have, want)
+	}
+	next := common.BigToHash(new(big.Int).Add(array.Big(), common.Big1))
+	if have, want := staking[next], common.HexToHash("0x0132db5f55b6111f0adc916921cf5624b2768f6524f8"); have != want {
+		t.Errorf("staker activation mismatch: have %x, want %x", have, want)
+	}
+}
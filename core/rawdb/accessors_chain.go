@@ -419,6 +419,18 @@ func isCanon(reader ethdb.AncientReader, number uint64, hash common.Hash) bool {
 	return bytes.Equal(h, hash[:])
 }
 
+// ReadHistoryTail retrieves the number of the first block whose body and
+// receipts are still stored, the ones below were expired from the freezer.
+func ReadHistoryTail(db ethdb.AncientReader) uint64 {
+	var tail uint64
+	for _, kind := range []string{freezerBodiesTable, freezerReceiptTable} {
+		if number, err := db.AncientTail(kind); err == nil && number > tail {
+			tail = number
+		}
+	}
+	return tail
+}
+
 // ReadBodyRLP retrieves the block body (transactions and uncles) in RLP encoding.
 func ReadBodyRLP(db ethdb.Reader, hash common.Hash, number uint64) rlp.RawValue {
 	// First try to look up the data in ancient database. Extra hash
@@ -821,6 +833,27 @@ func writeAncientBlock(op ethdb.AncientWriteOp, block *types.Block, header *type
 	return nil
 }
 
+// WriteAncientRawBlock appends the RLP encoded content of a single block to the
+// ancient store. The receipts are expected in storage format.
+func WriteAncientRawBlock(op ethdb.AncientWriteOp, number uint64, hash common.Hash, header, body, receipts, td rlp.RawValue) error {
+	if err := op.AppendRaw(freezerHashTable, number, hash.Bytes()); err != nil {
+		return fmt.Errorf("can't add block %d hash: %v", number, err)
+	}
+	if err := op.AppendRaw(freezerHeaderTable, number, header); err != nil {
+		return fmt.Errorf("can't append block header %d: %v", number, err)
+	}
+	if err := op.AppendRaw(freezerBodiesTable, number, body); err != nil {
+		return fmt.Errorf("can't append block body %d: %v", number, err)
+	}
+	if err := op.AppendRaw(freezerReceiptTable, number, receipts); err != nil {
+		return fmt.Errorf("can't append block %d receipts: %v", number, err)
+	}
+	if err := op.AppendRaw(freezerDifficultyTable, number, td); err != nil {
+		return fmt.Errorf("can't append block %d total difficulty: %v", number, err)
+	}
+	return nil
+}
+
 // DeleteBlock removes all block data associated with a hash.
 func DeleteBlock(db ethdb.KeyValueWriter, hash common.Hash, number uint64) {
 	DeleteReceipts(db, hash, number)
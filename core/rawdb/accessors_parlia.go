@@ -0,0 +1,129 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// ReadParliaHistoryHead retrieves the number of the last epoch block indexed by
+// the Parlia validator history indexer.
+func ReadParliaHistoryHead(db ethdb.KeyValueReader) *uint64 {
+	data, _ := db.Get(parliaHistoryHeadKey)
+	if len(data) != 8 {
+		return nil
+	}
+	number := binary.BigEndian.Uint64(data)
+	return &number
+}
+
+// WriteParliaHistoryHead stores the number of the last epoch block indexed by
+// the Parlia validator history indexer.
+func WriteParliaHistoryHead(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Put(parliaHistoryHeadKey, encodeBlockNumber(number)); err != nil {
+		log.Crit("Failed to store parlia history head", "err", err)
+	}
+}
+
+// DeleteParliaHistoryHead deletes the Parlia validator history indexing progress.
+func DeleteParliaHistoryHead(db ethdb.KeyValueWriter) {
+	if err := db.Delete(parliaHistoryHeadKey); err != nil {
+		log.Crit("Failed to remove parlia history head", "err", err)
+	}
+}
+
+// ReadParliaVoteHistory retrieves the RLP encoded highest source and target the
+// local validator voted on.
+func ReadParliaVoteHistory(db ethdb.KeyValueReader) []byte {
+	data, _ := db.Get(parliaVoteHistoryKey)
+	return data
+}
+
+// WriteParliaVoteHistory stores the RLP encoded highest source and target the
+// local validator voted on.
+func WriteParliaVoteHistory(db ethdb.KeyValueWriter, history []byte) {
+	if err := db.Put(parliaVoteHistoryKey, history); err != nil {
+		log.Crit("Failed to store parlia vote history", "err", err)
+	}
+}
+
+// ReadParliaValidatorChange retrieves the RLP encoded validator set change
+// announced at the given epoch block.
+func ReadParliaValidatorChange(db ethdb.KeyValueReader, number uint64) []byte {
+	data, _ := db.Get(parliaValidatorChangeKey(number))
+	return data
+}
+
+// ReadParliaValidatorChanges retrieves all the RLP encoded validator set changes
+// in ascending epoch order.
+func ReadParliaValidatorChanges(db ethdb.Iteratee) [][]byte {
+	var changes [][]byte
+
+	it := db.NewIterator(parliaValidatorChangePrefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		if len(it.Key()) != len(parliaValidatorChangePrefix)+8 {
+			continue
+		}
+		changes = append(changes, common.CopyBytes(it.Value()))
+	}
+	return changes
+}
+
+// WriteParliaValidatorChange stores the RLP encoded validator set change
+// announced at the given epoch block.
+func WriteParliaValidatorChange(db ethdb.KeyValueWriter, number uint64, change []byte) {
+	if err := db.Put(parliaValidatorChangeKey(number), change); err != nil {
+		log.Crit("Failed to store parlia validator change", "err", err)
+	}
+}
+
+// DeleteParliaValidatorChange deletes the validator set change of the given
+// epoch block.
+func DeleteParliaValidatorChange(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Delete(parliaValidatorChangeKey(number)); err != nil {
+		log.Crit("Failed to delete parlia validator change", "err", err)
+	}
+}
+
+// ReadParliaSigningStats retrieves the RLP encoded validator signing statistics
+// of the epoch starting at the given block.
+func ReadParliaSigningStats(db ethdb.KeyValueReader, number uint64) []byte {
+	data, _ := db.Get(parliaSigningStatsKey(number))
+	return data
+}
+
+// WriteParliaSigningStats stores the RLP encoded validator signing statistics
+// of the epoch starting at the given block.
+func WriteParliaSigningStats(db ethdb.KeyValueWriter, number uint64, stats []byte) {
+	if err := db.Put(parliaSigningStatsKey(number), stats); err != nil {
+		log.Crit("Failed to store parlia signing stats", "err", err)
+	}
+}
+
+// DeleteParliaSigningStats deletes the validator signing statistics of the
+// epoch starting at the given block.
+func DeleteParliaSigningStats(db ethdb.KeyValueWriter, number uint64) {
+	if err := db.Delete(parliaSigningStatsKey(number)); err != nil {
+		log.Crit("Failed to delete parlia signing stats", "err", err)
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	// HashScheme is the legacy hash-based state scheme with which trie nodes
+	// are stored in the disk with node hash as the database key. The advantage
+	// of this scheme is that different versions of trie nodes can be stored in
+	// disk, which is very beneficial for constructing archive nodes. The drawback
+	// is it will store different trie nodes on the same path to different
+	// locations on the disk with no data locality, and it's unfriendly for
+	// designing state pruning.
+	HashScheme = "hash"
+
+	// PathScheme is the path-based state scheme with which trie nodes are
+	// stored in the disk with node path as the database key. Only the latest
+	// version of each trie node is persisted, older versions are kept as
+	// in-memory diff layers and reverse diffs, which makes the state pruning
+	// implicit.
+	PathScheme = "path"
+)
+
+// ReadStateScheme retrieves the state scheme recorded in the database, or an
+// empty string if the database has never been marked.
+func ReadStateScheme(db ethdb.KeyValueReader) string {
+	data, _ := db.Get(stateSchemeKey)
+	return string(data)
+}
+
+// WriteStateScheme stores the state scheme used by the database.
+func WriteStateScheme(db ethdb.KeyValueWriter, scheme string) {
+	if err := db.Put(stateSchemeKey, []byte(scheme)); err != nil {
+		log.Crit("Failed to store state scheme", "err", err)
+	}
+}
+
+// ParseStateScheme checks the state scheme requested by the user against the
+// one recorded in the database and returns the scheme to use. A database that
+// holds no chain yet is marked with the provided scheme, a legacy database
+// without any marker is regarded as hash-based.
+func ParseStateScheme(provided string, db ethdb.KeyValueStore) (string, error) {
+	if provided != "" && provided != HashScheme && provided != PathScheme {
+		return "", fmt.Errorf("unknown state scheme %q", provided)
+	}
+	stored := ReadStateScheme(db)
+	if stored == "" && ReadHeadHeaderHash(db) != (common.Hash{}) {
+		stored = HashScheme
+	}
+	if stored == "" {
+		if provided == "" {
+			provided = HashScheme
+		}
+		WriteStateScheme(db, provided)
+		return provided, nil
+	}
+	if provided != "" && provided != stored {
+		return "", fmt.Errorf("incompatible state scheme, stored: %s, provided: %s", stored, provided)
+	}
+	return stored, nil
+}
+
+// ReadAccountTrieNode retrieves the account trie node and the associated node
+// hash with the specified node path.
+func ReadAccountTrieNode(db ethdb.KeyValueReader, path []byte) ([]byte, common.Hash) {
+	data, err := db.Get(accountTrieNodeKey(path))
+	if err != nil || len(data) == 0 {
+		return nil, common.Hash{}
+	}
+	return data, crypto.Keccak256Hash(data)
+}
+
+// HasAccountTrieNode checks the account trie node presence with the specified
+// node path and the associated node hash.
+func HasAccountTrieNode(db ethdb.KeyValueReader, path []byte, hash common.Hash) bool {
+	data, nHash := ReadAccountTrieNode(db, path)
+	return len(data) != 0 && nHash == hash
+}
+
+// WriteAccountTrieNode writes the provided account trie node into database.
+func WriteAccountTrieNode(db ethdb.KeyValueWriter, path []byte, node []byte) {
+	if err := db.Put(accountTrieNodeKey(path), node); err != nil {
+		log.Crit("Failed to store account trie node", "err", err)
+	}
+}
+
+// DeleteAccountTrieNode deletes the specified account trie node from the database.
+func DeleteAccountTrieNode(db ethdb.KeyValueWriter, path []byte) {
+	if err := db.Delete(accountTrieNodeKey(path)); err != nil {
+		log.Crit("Failed to delete account trie node", "err", err)
+	}
+}
+
+// ReadStorageTrieNode retrieves the storage trie node and the associated node
+// hash with the specified node path.
+func ReadStorageTrieNode(db ethdb.KeyValueReader, accountHash common.Hash, path []byte) ([]byte, common.Hash) {
+	data, err := db.Get(storageTrieNodeKey(accountHash, path))
+	if err != nil || len(data) == 0 {
+		return nil, common.Hash{}
+	}
+	return data, crypto.Keccak256Hash(data)
+}
+
+// HasStorageTrieNode checks the storage trie node presence with the provided
+// node path and the associated node hash.
+func HasStorageTrieNode(db ethdb.KeyValueReader, accountHash common.Hash, path []byte, hash common.Hash) bool {
+	data, nHash := ReadStorageTrieNode(db, accountHash, path)
+	return len(data) != 0 && nHash == hash
+}
+
+// WriteStorageTrieNode writes the provided storage trie node into database.
+func WriteStorageTrieNode(db ethdb.KeyValueWriter, accountHash common.Hash, path []byte, node []byte) {
+	if err := db.Put(storageTrieNodeKey(accountHash, path), node); err != nil {
+		log.Crit("Failed to store storage trie node", "err", err)
+	}
+}
+
+// DeleteStorageTrieNode deletes the specified storage trie node from the database.
+func DeleteStorageTrieNode(db ethdb.KeyValueWriter, accountHash common.Hash, path []byte) {
+	if err := db.Delete(storageTrieNodeKey(accountHash, path)); err != nil {
+		log.Crit("Failed to delete storage trie node", "err", err)
+	}
+}
+
+// ReadTrieNodeByPath retrieves the trie node of the given owner and path. The
+// zero owner denotes the account trie.
+func ReadTrieNodeByPath(db ethdb.KeyValueReader, owner common.Hash, path []byte) ([]byte, common.Hash) {
+	if owner == (common.Hash{}) {
+		return ReadAccountTrieNode(db, path)
+	}
+	return ReadStorageTrieNode(db, owner, path)
+}
+
+// WriteTrieNodeByPath writes the trie node of the given owner and path. An
+// empty node deletes the database entry instead.
+func WriteTrieNodeByPath(db ethdb.KeyValueWriter, owner common.Hash, path []byte, node []byte) {
+	switch {
+	case owner == (common.Hash{}) && len(node) == 0:
+		DeleteAccountTrieNode(db, path)
+	case owner == (common.Hash{}):
+		WriteAccountTrieNode(db, path, node)
+	case len(node) == 0:
+		DeleteStorageTrieNode(db, owner, path)
+	default:
+		WriteStorageTrieNode(db, owner, path, node)
+	}
+}
+
+// ReadReverseDiff retrieves the encoded reverse diff with the given id.
+func ReadReverseDiff(db ethdb.KeyValueReader, id uint64) []byte {
+	data, _ := db.Get(reverseDiffKey(id))
+	return data
+}
+
+// WriteReverseDiff stores the encoded reverse diff with the given id.
+func WriteReverseDiff(db ethdb.KeyValueWriter, id uint64, blob []byte) {
+	if err := db.Put(reverseDiffKey(id), blob); err != nil {
+		log.Crit("Failed to store reverse diff", "err", err)
+	}
+}
+
+// DeleteReverseDiff removes the reverse diff with the given id.
+func DeleteReverseDiff(db ethdb.KeyValueWriter, id uint64) {
+	if err := db.Delete(reverseDiffKey(id)); err != nil {
+		log.Crit("Failed to delete reverse diff", "err", err)
+	}
+}
+
+// ReadReverseDiffHead retrieves the id of the latest stored reverse diff, or
+// zero if there is none.
+func ReadReverseDiffHead(db ethdb.KeyValueReader) uint64 {
+	data, _ := db.Get(reverseDiffHeadKey)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// WriteReverseDiffHead stores the id of the latest stored reverse diff.
+func WriteReverseDiffHead(db ethdb.KeyValueWriter, id uint64) {
+	if err := db.Put(reverseDiffHeadKey, encodeBlockNumber(id)); err != nil {
+		log.Crit("Failed to store reverse diff head", "err", err)
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Tests that the state scheme is recorded on fresh databases and checked
+// against the stored one afterwards.
+func TestParseStateScheme(t *testing.T) {
+	tests := []struct {
+		stored   string
+		legacy   bool
+		provided string
+		want     string
+		fail     bool
+	}{
+		{provided: "", want: HashScheme},
+		{provided: HashScheme, want: HashScheme},
+		{provided: PathScheme, want: PathScheme},
+		{provided: "bogus", fail: true},
+		{legacy: true, provided: "", want: HashScheme},
+		{legacy: true, provided: PathScheme, fail: true},
+		{stored: PathScheme, provided: "", want: PathScheme},
+		{stored: PathScheme, provided: PathScheme, want: PathScheme},
+		{stored: PathScheme, provided: HashScheme, fail: true},
+		{stored: HashScheme, provided: PathScheme, fail: true},
+	}
+	for i, tt := range tests {
+		db := NewMemoryDatabase()
+		if tt.stored != "" {
+			WriteStateScheme(db, tt.stored)
+		}
+		if tt.legacy {
+			WriteHeadHeaderHash(db, common.Hash{0x01})
+		}
+		scheme, err := ParseStateScheme(tt.provided, db)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: expected failure, got scheme %q", i, scheme)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if scheme != tt.want {
+			t.Errorf("test %d: scheme mismatch: have %q, want %q", i, scheme, tt.want)
+		}
+		if stored := ReadStateScheme(db); !tt.legacy && stored != tt.want {
+			t.Errorf("test %d: stored scheme mismatch: have %q, want %q", i, stored, tt.want)
+		}
+	}
+}
+
+// Tests that trie nodes stored by path can be read back and are recognised by
+// the key predicates.
+func TestTrieNodeByPath(t *testing.T) {
+	var (
+		db    = NewMemoryDatabase()
+		owner = common.Hash{0xaa}
+		path  = []byte{0x1, 0x2, 0xf}
+		node  = []byte{0xc0, 0x01}
+	)
+	WriteTrieNodeByPath(db, common.Hash{}, path, node)
+	WriteTrieNodeByPath(db, owner, path, node)
+
+	for _, o := range []common.Hash{{}, owner} {
+		blob, hash := ReadTrieNodeByPath(db, o, path)
+		if !bytes.Equal(blob, node) || hash != crypto.Keccak256Hash(node) {
+			t.Fatalf("owner %x: node mismatch: have %x (%x)", o, blob, hash)
+		}
+	}
+	if ok, p := IsAccountTrieNode(accountTrieNodeKey(path)); !ok || !bytes.Equal(p, path) {
+		t.Fatalf("account node key not recognised")
+	}
+	if ok, o, p := IsStorageTrieNode(storageTrieNodeKey(owner, path)); !ok || o != owner || !bytes.Equal(p, path) {
+		t.Fatalf("storage node key not recognised")
+	}
+	if ok, _ := IsAccountTrieNode(append(TrieNodeAccountPrefix, 0x10)); ok {
+		t.Fatalf("invalid account node key recognised")
+	}
+	if ok, _, _ := IsStorageTrieNode(append(TrieNodeStoragePrefix, 0x01)); ok {
+		t.Fatalf("short storage node key recognised")
+	}
+	// Empty blobs delete the nodes
+	WriteTrieNodeByPath(db, common.Hash{}, path, nil)
+	WriteTrieNodeByPath(db, owner, path, nil)
+	if HasAccountTrieNode(db, path, crypto.Keccak256Hash(node)) {
+		t.Fatalf("account node not deleted")
+	}
+	if HasStorageTrieNode(db, owner, path, crypto.Keccak256Hash(node)) {
+		t.Fatalf("storage node not deleted")
+	}
+}
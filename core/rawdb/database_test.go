@@ -15,3 +15,59 @@
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
 package rawdb
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// Tests that an existing database is reopened with the engine that created it,
+// and that a conflicting explicit engine choice is rejected.
+func TestOpenDetectsEngine(t *testing.T) {
+	for _, engine := range []string{dbLeveldb, dbPebble} {
+		if engine == dbPebble && !PebbleEnabled {
+			continue
+		}
+		dir, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		if have := PreexistingDatabase(dir); have != "" {
+			t.Fatalf("empty dir detected as %q", have)
+		}
+		db, err := Open(OpenOptions{Type: engine, Directory: dir})
+		if err != nil {
+			t.Fatalf("%s: failed to create database: %v", engine, err)
+		}
+		if err := db.Put([]byte("key"), []byte("value")); err != nil {
+			t.Fatalf("%s: failed to write: %v", engine, err)
+		}
+		db.Close()
+
+		if have := PreexistingDatabase(dir); have != engine {
+			t.Fatalf("engine mismatch: have %q, want %q", have, engine)
+		}
+		// Reopen without an explicit choice, the data must be there
+		db, err = Open(OpenOptions{Directory: dir})
+		if err != nil {
+			t.Fatalf("%s: failed to reopen database: %v", engine, err)
+		}
+		if val, err := db.Get([]byte("key")); err != nil || string(val) != "value" {
+			t.Fatalf("%s: value mismatch: have %q, %v", engine, val, err)
+		}
+		db.Close()
+
+		// Reopening with the other engine must fail
+		other := dbPebble
+		if engine == dbPebble {
+			other = dbLeveldb
+		}
+		if db, err := Open(OpenOptions{Type: other, Directory: dir}); err == nil {
+			db.Close()
+			t.Fatalf("%s: opened with conflicting engine %s", engine, other)
+		}
+	}
+}
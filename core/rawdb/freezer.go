@@ -294,6 +294,36 @@ func (f *freezer) TruncateAncients(items uint64) error {
 	return nil
 }
 
+// TruncateTail discards the block bodies and receipts below the provided
+// threshold number. Deletion is performed on whole data files, so some items
+// below the threshold may be retained.
+func (f *freezer) TruncateTail(items uint64) error {
+	if f.readonly {
+		return errReadOnly
+	}
+	f.writeLock.Lock()
+	defer f.writeLock.Unlock()
+
+	for name, table := range f.tables {
+		if !freezerPrunableTables[name] {
+			continue
+		}
+		if err := table.truncateTail(items); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AncientTail returns the number of the first item still stored in the given
+// ancient table.
+func (f *freezer) AncientTail(kind string) (uint64, error) {
+	if table := f.tables[kind]; table != nil {
+		return table.tail(), nil
+	}
+	return 0, errUnknownTable
+}
+
 // Sync flushes all data tables to disk.
 func (f *freezer) Sync() error {
 	var errs []error
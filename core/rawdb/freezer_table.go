@@ -22,6 +22,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"path/filepath"
 	"sync"
@@ -44,6 +45,10 @@ var (
 
 	// errNotSupported is returned if the database doesn't support the required operation.
 	errNotSupported = errors.New("this operation is not supported")
+
+	// errTruncateBelowTail is returned if the head of a table is requested to be
+	// truncated below the items already deleted from its tail.
+	errTruncateBelowTail = errors.New("truncation below the pruned tail")
 )
 
 // indexEntry contains the number/id of the file that the data resides in, aswell as the
@@ -359,18 +364,28 @@ func (t *freezerTable) truncate(items uint64) error {
 	if existing > items+1 {
 		log = t.logger.Warn // Only loud warn if we delete multiple items
 	}
+	if items < uint64(t.itemOffset) {
+		return errTruncateBelowTail
+	}
 	log("Truncating freezer table", "items", existing, "limit", items)
-	if err := truncateFreezerFile(t.index, int64(items+1)*indexEntrySize); err != nil {
+	position := items - uint64(t.itemOffset)
+	if err := truncateFreezerFile(t.index, int64(position+1)*indexEntrySize); err != nil {
 		return err
 	}
 	// Calculate the new expected size of the data file and truncate it
 	buffer := make([]byte, indexEntrySize)
-	if _, err := t.index.ReadAt(buffer, int64(items*indexEntrySize)); err != nil {
+	if _, err := t.index.ReadAt(buffer, int64(position*indexEntrySize)); err != nil {
 		return err
 	}
 	var expected indexEntry
 	expected.unmarshalBinary(buffer)
 
+	// The first index entry carries the tail file and offset instead of a
+	// data position, the table is empty from the start of the tail file.
+	if position == 0 {
+		expected = indexEntry{filenum: t.tailId}
+	}
+
 	// We might need to truncate back to older files
 	if expected.filenum != t.headId {
 		// If already open for reading, force-reopen for writing
@@ -403,6 +418,119 @@ func (t *freezerTable) truncate(items uint64) error {
 	return nil
 }
 
+// truncateTail discards the data files at the beginning of the table which
+// only hold items below the provided threshold number. Deletion happens with
+// file granularity, so items sharing a data file with the first retained item
+// are kept. The number of discarded items is recorded in the first index entry.
+func (t *freezerTable) truncateTail(items uint64) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// Never delete the head file, nor anything that is already gone
+	if items > atomic.LoadUint64(&t.items) {
+		items = atomic.LoadUint64(&t.items)
+	}
+	if items <= uint64(t.itemOffset) {
+		return nil
+	}
+	// Locate the data file holding the first retained item. Items never span
+	// files, the end offset of an item is always within the file it lives in.
+	var (
+		buffer = make([]byte, indexEntrySize)
+		entry  indexEntry
+	)
+	position := items - uint64(t.itemOffset)
+	if items == atomic.LoadUint64(&t.items) {
+		// Everything is to be dropped, only the head file can be kept
+		entry.filenum = t.headId
+	} else {
+		if _, err := t.index.ReadAt(buffer, int64((position+1)*indexEntrySize)); err != nil {
+			return err
+		}
+		entry.unmarshalBinary(buffer)
+	}
+	newTailId := entry.filenum
+	if newTailId == t.tailId {
+		return nil
+	}
+	// Find the first item stored in the new tail file, the index entry before
+	// it is the last one pointing into an earlier file.
+	for position > 0 {
+		if _, err := t.index.ReadAt(buffer, int64(position*indexEntrySize)); err != nil {
+			return err
+		}
+		entry.unmarshalBinary(buffer)
+		if entry.filenum != newTailId {
+			break
+		}
+		position--
+	}
+	newOffset := uint64(t.itemOffset) + position
+	if newOffset > math.MaxUint32 {
+		return fmt.Errorf("tail offset %d overflows the index", newOffset)
+	}
+	// We need to truncate, save the old size for metrics tracking
+	oldSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.logger.Info("Truncating freezer table tail", "tail", t.itemOffset, "limit", newOffset, "files", newTailId-t.tailId)
+
+	// Write the retained index entries into a new file, with the first entry
+	// replaced by the new tail file and item offset, then swap it in place.
+	stat, err := t.index.Stat()
+	if err != nil {
+		return err
+	}
+	retained := make([]byte, stat.Size()-int64((position+1)*indexEntrySize))
+	if _, err := t.index.ReadAt(retained, int64((position+1)*indexEntrySize)); err != nil {
+		return err
+	}
+	first := indexEntry{filenum: newTailId, offset: uint32(newOffset)}
+	tmpName := t.index.Name() + ".tmp"
+	tmp, err := openFreezerFileTruncated(tmpName)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(first.append(nil), retained...)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	tmp.Close()
+
+	indexName := t.index.Name()
+	t.index.Close()
+	if err := os.Rename(tmpName, indexName); err != nil {
+		t.index, _ = openFreezerFileForAppend(indexName)
+		return err
+	}
+	if t.index, err = openFreezerFileForAppend(indexName); err != nil {
+		return err
+	}
+	// The index doesn't reference the leading data files any more, drop them
+	for fnum := t.tailId; fnum < newTailId; fnum++ {
+		if f, exist := t.files[fnum]; exist {
+			delete(t.files, fnum)
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}
+	t.tailId = newTailId
+	atomic.StoreUint32(&t.itemOffset, uint32(newOffset))
+
+	// Retrieve the new size and update the total size counter
+	newSize, err := t.sizeNolock()
+	if err != nil {
+		return err
+	}
+	t.sizeGauge.Dec(int64(oldSize - newSize))
+	return nil
+}
+
 // Close closes all opened files.
 func (t *freezerTable) Close() error {
 	t.lock.Lock()
@@ -651,7 +779,12 @@ func (t *freezerTable) retrieveItems(start, count, maxBytes uint64) ([]byte, []i
 // has returns an indicator whether the specified number data
 // exists in the freezer table.
 func (t *freezerTable) has(number uint64) bool {
-	return atomic.LoadUint64(&t.items) > number
+	return atomic.LoadUint64(&t.items) > number && uint64(atomic.LoadUint32(&t.itemOffset)) <= number
+}
+
+// tail returns the number of the first item still stored in the table.
+func (t *freezerTable) tail() uint64 {
+	return uint64(atomic.LoadUint32(&t.itemOffset))
 }
 
 // size returns the total data size in the freezer table.
@@ -398,6 +398,105 @@ func TestFreezerTruncate(t *testing.T) {
 	}
 }
 
+// TestFreezerTruncateTail tests deleting the leading data files of a table,
+// and that the tail offset survives a reopen and subsequent head operations.
+func TestFreezerTruncateTail(t *testing.T) {
+	t.Parallel()
+	rm, wm, sg := metrics.NewMeter(), metrics.NewMeter(), metrics.NewGauge()
+	fname := fmt.Sprintf("truncationtail-%d", rand.Uint64())
+
+	// Fill table, 3 items of 15 bytes fit in each 50 byte data file
+	f, err := newTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeChunks(t, f, 30, 15)
+
+	// Truncating within the first file is a noop
+	if err := f.truncateTail(2); err != nil {
+		t.Fatal(err)
+	}
+	if f.tail() != 0 {
+		t.Fatalf("expected tail %d, got %d", 0, f.tail())
+	}
+	// Item 7 lives in the third file together with items 6 and 8
+	if err := f.truncateTail(7); err != nil {
+		t.Fatal(err)
+	}
+	if f.tail() != 6 || f.tailId != 2 {
+		t.Fatalf("expected tail %d in file %d, got %d in file %d", 6, 2, f.tail(), f.tailId)
+	}
+	for _, num := range []uint32{0, 1} {
+		if _, err := os.Stat(filepath.Join(os.TempDir(), fmt.Sprintf("%s.%04d.rdat", fname, num))); !os.IsNotExist(err) {
+			t.Fatalf("data file %d not deleted: %v", num, err)
+		}
+	}
+	checkRetrieveError(t, f, map[uint64]error{
+		0: errOutOfBounds,
+		5: errOutOfBounds,
+	})
+	checkRetrieve(t, f, map[uint64][]byte{
+		6:  getChunk(15, 6),
+		7:  getChunk(15, 7),
+		29: getChunk(15, 29),
+	})
+	if f.has(5) || !f.has(6) {
+		t.Fatal("wrong item availability around the tail")
+	}
+	f.Close()
+
+	// Reopen, the tail must be retained
+	f, err = newTable(os.TempDir(), fname, rm, wm, sg, 50, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if f.items != 30 || f.tail() != 6 {
+		t.Fatalf("expected %d items from tail %d, got %d from %d", 30, 6, f.items, f.tail())
+	}
+	items, err := f.RetrieveItems(6, 4, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, item := range items {
+		if !bytes.Equal(item, getChunk(15, 6+i)) {
+			t.Fatalf("item %d has wrong value %x", 6+i, item)
+		}
+	}
+	// Truncate the head and continue appending
+	if err := f.truncate(5); err != errTruncateBelowTail {
+		t.Fatalf("expected truncation below tail to fail, got %v", err)
+	}
+	if err := f.truncate(10); err != nil {
+		t.Fatal(err)
+	}
+	batch := f.newBatch()
+	for i := 10; i < 15; i++ {
+		if err := batch.AppendRaw(uint64(i), getChunk(15, 100+i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := batch.commit(); err != nil {
+		t.Fatal(err)
+	}
+	checkRetrieve(t, f, map[uint64][]byte{
+		6:  getChunk(15, 6),
+		9:  getChunk(15, 9),
+		10: getChunk(15, 110),
+		14: getChunk(15, 114),
+	})
+	// Truncating everything keeps the head file only
+	if err := f.truncateTail(f.items); err != nil {
+		t.Fatal(err)
+	}
+	if f.tailId != f.headId {
+		t.Fatalf("expected tail file %d, got %d", f.headId, f.tailId)
+	}
+	checkRetrieve(t, f, map[uint64][]byte{
+		14: getChunk(15, 114),
+	})
+}
+
 // TestFreezerRepairFirstFile tests a head file with the very first item only half-written.
 // That will rewind the index, and _should_ truncate the head file
 func TestFreezerRepairFirstFile(t *testing.T) {
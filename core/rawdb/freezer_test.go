@@ -299,3 +299,52 @@ func checkAncientCount(t *testing.T, f *freezer, kind string, n uint64) {
 		t.Errorf("Ancient(%q, %d) returned unexpected error %q", kind, index, err)
 	}
 }
+
+// This checks that TruncateTail only expires the prunable tables, and that the
+// tail is exposed through AncientTail and the history tail accessor.
+func TestFreezerTruncateHistory(t *testing.T) {
+	t.Parallel()
+
+	tables := map[string]bool{freezerHeaderTable: true, freezerBodiesTable: true, freezerReceiptTable: true}
+	f, dir := newFreezerForTesting(t, tables)
+	defer os.RemoveAll(dir)
+	defer f.Close()
+
+	// 256 byte items, 8 of them fit in a single data file
+	_, err := f.ModifyAncients(func(op ethdb.AncientWriteOp) error {
+		for i := 0; i < 100; i++ {
+			for kind := range tables {
+				if err := op.AppendRaw(kind, uint64(i), getChunk(256, i)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal("ModifyAncients failed:", err)
+	}
+	if err := f.TruncateTail(50); err != nil {
+		t.Fatal("TruncateTail failed:", err)
+	}
+	// Items are deleted file by file, item 48 starts the file holding item 50
+	for kind := range tables {
+		want := uint64(48)
+		if kind == freezerHeaderTable {
+			want = 0
+		}
+		if tail, _ := f.AncientTail(kind); tail != want {
+			t.Fatalf("AncientTail(%q) returned %d, want %d", kind, tail, want)
+		}
+		if ok, _ := f.HasAncient(kind, want); !ok {
+			t.Errorf("HasAncient(%q, %d) returned false unexpectedly", kind, want)
+		}
+		checkAncientCount(t, f, kind, 100)
+	}
+	if _, err := f.Ancient(freezerBodiesTable, 47); err != errOutOfBounds {
+		t.Fatalf("Ancient(%q, 47) returned unexpected error %v", freezerBodiesTable, err)
+	}
+	if tail := ReadHistoryTail(f); tail != 48 {
+		t.Fatalf("ReadHistoryTail returned %d, want %d", tail, 48)
+	}
+}
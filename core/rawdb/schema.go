@@ -75,6 +75,18 @@ var (
 	// uncleanShutdownKey tracks the list of local crashes
 	uncleanShutdownKey = []byte("unclean-shutdown") // config prefix for the db
 
+	// parliaHistoryHeadKey tracks the last epoch indexed by the Parlia validator history indexer.
+	parliaHistoryHeadKey = []byte("ParliaHistoryHead")
+
+	// parliaVoteHistoryKey tracks the highest source and target the local validator voted on.
+	parliaVoteHistoryKey = []byte("ParliaVoteHistory")
+
+	// stateSchemeKey tracks the node storage scheme (hash or path) of the state database.
+	stateSchemeKey = []byte("StateScheme")
+
+	// reverseDiffHeadKey tracks the id of the latest stored reverse diff.
+	reverseDiffHeadKey = []byte("ReverseDiffHead")
+
 	// transitionStatusKey tracks the eth2 transition status.
 	transitionStatusKey = []byte("eth2-transition")
 
@@ -93,6 +105,13 @@ var (
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
 
+	TrieNodeAccountPrefix = []byte("A") // TrieNodeAccountPrefix + hexPath -> trie node
+	TrieNodeStoragePrefix = []byte("O") // TrieNodeStoragePrefix + accountHash + hexPath -> trie node
+	reverseDiffPrefix     = []byte("R") // reverseDiffPrefix + id (uint64 big endian) -> reverse diff
+
+	parliaValidatorChangePrefix = []byte("pv") // parliaValidatorChangePrefix + num (uint64 big endian) -> validator set change at epoch
+	parliaSigningStatsPrefix    = []byte("ps") // parliaSigningStatsPrefix + num (uint64 big endian) -> validator signing stats of epoch
+
 	PreimagePrefix = []byte("secure-key-")      // PreimagePrefix + hash -> preimage
 	configPrefix   = []byte("ethereum-config-") // config prefix for the db
 
@@ -130,6 +149,14 @@ var FreezerNoSnappy = map[string]bool{
 	freezerDifficultyTable: true,
 }
 
+// freezerPrunableTables is the set of freezer tables whose leading items may be
+// deleted to expire old history. Headers, hashes and difficulties are retained
+// so the chain can still be verified and served to light peers.
+var freezerPrunableTables = map[string]bool{
+	freezerBodiesTable:  true,
+	freezerReceiptTable: true,
+}
+
 // LegacyTxLookupEntry is the legacy TxLookupEntry definition with some unnecessary
 // fields.
 type LegacyTxLookupEntry struct {
@@ -229,7 +256,87 @@ func IsCodeKey(key []byte) (bool, []byte) {
 	return false, nil
 }
 
+// accountTrieNodeKey = TrieNodeAccountPrefix + nodePath.
+func accountTrieNodeKey(path []byte) []byte {
+	return append(TrieNodeAccountPrefix, path...)
+}
+
+// storageTrieNodeKey = TrieNodeStoragePrefix + accountHash + nodePath.
+func storageTrieNodeKey(accountHash common.Hash, path []byte) []byte {
+	return append(append(TrieNodeStoragePrefix, accountHash.Bytes()...), path...)
+}
+
+// IsAccountTrieNode reports whether a provided database entry is an account
+// trie node in path-based state scheme, if so return the node path as well.
+func IsAccountTrieNode(key []byte) (bool, []byte) {
+	if !bytes.HasPrefix(key, TrieNodeAccountPrefix) {
+		return false, nil
+	}
+	// The remaining key should only consist a hex node path
+	// whose length is in the range 0 to 64 (excluding 64).
+	path := key[len(TrieNodeAccountPrefix):]
+	if len(path) >= 2*common.HashLength || !isHexPath(path) {
+		return false, nil
+	}
+	return true, path
+}
+
+// IsStorageTrieNode reports whether a provided database entry is a storage
+// trie node in path-based state scheme, if so return the account hash and
+// node path as well.
+func IsStorageTrieNode(key []byte) (bool, common.Hash, []byte) {
+	if !bytes.HasPrefix(key, TrieNodeStoragePrefix) || len(key) < len(TrieNodeStoragePrefix)+common.HashLength {
+		return false, common.Hash{}, nil
+	}
+	// The remaining key consists of 32 bytes account hash followed by a hex
+	// node path whose length is in the range 0 to 64 (excluding 64).
+	path := key[len(TrieNodeStoragePrefix)+common.HashLength:]
+	if len(path) >= 2*common.HashLength || !isHexPath(path) {
+		return false, common.Hash{}, nil
+	}
+	return true, common.BytesToHash(key[len(TrieNodeStoragePrefix) : len(TrieNodeStoragePrefix)+common.HashLength]), path
+}
+
+// isHexPath reports whether every byte of the given path is a valid nibble.
+func isHexPath(path []byte) bool {
+	for _, b := range path {
+		if b >= 16 {
+			return false
+		}
+	}
+	return true
+}
+
+// reverseDiffKey = reverseDiffPrefix + id (uint64 big endian)
+func reverseDiffKey(id uint64) []byte {
+	return append(reverseDiffPrefix, encodeBlockNumber(id)...)
+}
+
+// parliaValidatorChangeKey = parliaValidatorChangePrefix + num (uint64 big endian)
+func parliaValidatorChangeKey(number uint64) []byte {
+	return append(parliaValidatorChangePrefix, encodeBlockNumber(number)...)
+}
+
+// parliaSigningStatsKey = parliaSigningStatsPrefix + num (uint64 big endian)
+func parliaSigningStatsKey(number uint64) []byte {
+	return append(parliaSigningStatsPrefix, encodeBlockNumber(number)...)
+}
+
 // configKey = configPrefix + hash
 func configKey(hash common.Hash) []byte {
 	return append(configPrefix, hash.Bytes()...)
 }
+
+// isAccountTrieNodeKey reports whether the key is an account trie node in
+// path-based state scheme.
+func isAccountTrieNodeKey(key []byte) bool {
+	ok, _ := IsAccountTrieNode(key)
+	return ok
+}
+
+// isStorageTrieNodeKey reports whether the key is a storage trie node in
+// path-based state scheme.
+func isStorageTrieNodeKey(key []byte) bool {
+	ok, _, _ := IsStorageTrieNode(key)
+	return ok
+}
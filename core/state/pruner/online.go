@@ -0,0 +1,703 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/snapshot"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+const (
+	// onlinePruneDepth is the distance from the chain head of the state picked
+	// as the online pruning target. It must be well within the number of tries
+	// held in memory by the blockchain, as the target is flushed from there.
+	onlinePruneDepth = 64
+)
+
+const (
+	PrunePhaseIdle       = "idle"       // No pruning was started since the node is up
+	PrunePhaseMarking    = "marking"    // The state to retain is being added to the bloom
+	PrunePhaseDeleting   = "deleting"   // Stale state entries are being deleted
+	PrunePhaseCompacting = "compacting" // The database is being compacted after deletion
+	PrunePhaseDone       = "done"       // The last pruning finished successfully
+	PrunePhaseAborted    = "aborted"    // The last pruning was interrupted by a shutdown
+	PrunePhaseFailed     = "failed"     // The last pruning failed
+)
+
+var (
+	// errPruneRunning is returned if a pruning is requested while another one
+	// is still in progress.
+	errPruneRunning = errors.New("state pruning already in progress")
+
+	// errPruneUnfinished is returned if a pruning is requested while a state
+	// bloom of an interrupted one is still present in the data directory.
+	errPruneUnfinished = errors.New("unfinished state pruning, restart the node to resume it")
+
+	// errPruneAborted is returned if a pruning is interrupted by a shutdown.
+	errPruneAborted = errors.New("state pruning aborted")
+
+	// errSnapshotDisabled is returned if a pruning is requested on a node which
+	// doesn't maintain the state snapshot.
+	errSnapshotDisabled = errors.New("snapshot disabled")
+)
+
+// OnlineChain defines the small set of methods the online pruner needs from
+// the live blockchain.
+type OnlineChain interface {
+	// CurrentBlock retrieves the current head block of the canonical chain.
+	CurrentBlock() *types.Block
+
+	// GetHeaderByNumber retrieves a block header from the canonical chain.
+	GetHeaderByNumber(number uint64) *types.Header
+
+	// Snapshots returns the snapshot tree of the chain, or nil if disabled.
+	Snapshots() *snapshot.Tree
+
+	// StateCache returns the caching database underpinning the chain state.
+	StateCache() state.Database
+}
+
+// PruneStatus is the progress report of the online state pruning.
+type PruneStatus struct {
+	Running  bool        `json:"running"`         // Whether a pruning is in progress
+	Phase    string      `json:"phase"`           // Current phase of the pruning
+	Root     common.Hash `json:"root"`            // State root retained by the pruning
+	Number   uint64      `json:"number"`          // Block number of the retained state
+	Nodes    uint64      `json:"nodes"`           // Number of deleted state entries
+	Size     uint64      `json:"size"`            // Total size of the deleted state entries
+	Progress float64     `json:"progress"`        // Percentage of the database iterated
+	Started  uint64      `json:"started"`         // Unix timestamp the pruning started at
+	Error    string      `json:"error,omitempty"` // Failure of the last pruning, if any
+}
+
+// OnlinePruner is the live counterpart of Pruner, deleting the stale state of a
+// running node with the same bloom filter approach. The workflow is:
+//
+// - start recording all state persisted by the chain into the bloom
+// - pin a recent snapshot layer and flush its state from memory to disk
+// - add the state of the blocks above the target into the bloom
+// - iterate the pinned layer, reconstruct the relevant state into the bloom
+// - commit the bloom to disk, marking the pruning resumable by RecoverPruning
+// - iterate the database, delete the entries not in the bloom in throttled batches
+//
+// Every component writing state (the blockchain, but also the state syncer and
+// any other user of the chain database) must persist it through the database
+// returned by the Database method, otherwise state written during pruning could
+// be deleted.
+type OnlinePruner struct {
+	db      ethdb.Database
+	datadir string
+
+	active uint32      // Flag whether persisted state needs to be recorded (atomic)
+	bloom  *stateBloom // State bloom of the running pruning, nil if none
+	lock   sync.Mutex  // Lock protecting the bloom and the deletions
+
+	status     PruneStatus
+	statusLock sync.RWMutex
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+
+	// Test hooks
+	generateHook func() // Method to call before the pinned target state is iterated
+}
+
+// NewOnlinePruner creates the online pruner operating on the given database.
+func NewOnlinePruner(db ethdb.Database, datadir string) *OnlinePruner {
+	return &OnlinePruner{
+		db:      db,
+		datadir: datadir,
+		status:  PruneStatus{Phase: PrunePhaseIdle},
+		quit:    make(chan struct{}),
+	}
+}
+
+// Database returns a view of the underlying database which records all trie
+// nodes and contract codes written through it while a pruning is in progress,
+// protecting them from deletion.
+func (p *OnlinePruner) Database() ethdb.Database {
+	return &guardedDatabase{Database: p.db, pruner: p}
+}
+
+// Status returns the progress of the current or last pruning.
+func (p *OnlinePruner) Status() PruneStatus {
+	p.statusLock.RLock()
+	defer p.statusLock.RUnlock()
+
+	return p.status
+}
+
+// Start launches the online pruning of the given live chain in the background,
+// using a state bloom of the given size in megabytes. The state HEAD-64 is
+// used as the target.
+func (p *OnlinePruner) Start(chain OnlineChain, bloomSize uint64) error {
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+
+	if p.status.Running {
+		return errPruneRunning
+	}
+	if rawdb.ReadStateScheme(p.db) == rawdb.PathScheme {
+		return errPathScheme
+	}
+	// If the state bloom of an interrupted pruning is still around, it has to
+	// be resumed offline by RecoverPruning.
+	path, _, err := findBloomFilter(p.datadir)
+	if err != nil {
+		return err
+	}
+	if path != "" {
+		return errPruneUnfinished
+	}
+	snaptree := chain.Snapshots()
+	if snaptree == nil {
+		return errSnapshotDisabled
+	}
+	head := chain.CurrentBlock()
+	if head.NumberU64() <= onlinePruneDepth {
+		return fmt.Errorf("chain not long enough yet: need %d more blocks", onlinePruneDepth+1-head.NumberU64())
+	}
+	target := chain.GetHeaderByNumber(head.NumberU64() - onlinePruneDepth)
+	if target == nil {
+		return fmt.Errorf("missing header #%d", head.NumberU64()-onlinePruneDepth)
+	}
+	// Sanitize the bloom filter size if it's too small.
+	if bloomSize < 256 {
+		log.Warn("Sanitizing bloomfilter size", "provided(MB)", bloomSize, "updated(MB)", 256)
+		bloomSize = 256
+	}
+	bloom, err := newStateBloomWithSize(bloomSize)
+	if err != nil {
+		return err
+	}
+	// Start recording the persisted state before picking the target, all nodes
+	// flushed from here on are protected from deletion.
+	p.lock.Lock()
+	p.bloom = bloom
+	atomic.StoreUint32(&p.active, 1)
+	p.lock.Unlock()
+
+	if err := snaptree.Pin(target.Root); err != nil {
+		p.release()
+		return err
+	}
+	// Flush the target state out of the in-memory trie database, so it's fully
+	// present on disk in case the pruning is interrupted and resumed offline.
+	if err := chain.StateCache().TrieDB().Commit(target.Root, false, nil); err != nil {
+		snaptree.Unpin(target.Root)
+		p.release()
+		return err
+	}
+	if blob := rawdb.ReadTrieNode(p.db, target.Root); len(blob) == 0 {
+		snaptree.Unpin(target.Root)
+		p.release()
+		return fmt.Errorf("associated state[%x] is not present", target.Root)
+	}
+	log.Info("Started online state pruning", "number", target.Number, "root", target.Root)
+
+	p.status = PruneStatus{
+		Running: true,
+		Phase:   PrunePhaseMarking,
+		Root:    target.Root,
+		Number:  target.Number.Uint64(),
+		Started: uint64(time.Now().Unix()),
+	}
+	p.wg.Add(1)
+	go p.run(chain, target)
+	return nil
+}
+
+// Stop interrupts any running pruning and waits for it to exit. An interrupted
+// deletion is resumed by RecoverPruning on the next startup.
+func (p *OnlinePruner) Stop() {
+	close(p.quit)
+	p.wg.Wait()
+}
+
+// run executes a pruning started by Start and records its outcome.
+func (p *OnlinePruner) run(chain OnlineChain, target *types.Header) {
+	defer p.wg.Done()
+
+	err := p.prune(chain, target)
+
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+
+	p.status.Running = false
+	switch {
+	case err == nil:
+		p.status.Phase = PrunePhaseDone
+	case err == errPruneAborted || err == snapshot.ErrGenerationAborted:
+		p.status.Phase = PrunePhaseAborted
+		log.Warn("Online state pruning aborted")
+	default:
+		p.status.Phase = PrunePhaseFailed
+		p.status.Error = err.Error()
+		log.Error("Online state pruning failed", "err", err)
+	}
+}
+
+// prune runs all the phases of an online pruning against the given target.
+func (p *OnlinePruner) prune(chain OnlineChain, target *types.Header) error {
+	var (
+		start    = time.Now()
+		root     = target.Root
+		snaptree = chain.Snapshots()
+		writer   = &lockedBloom{pruner: p}
+	)
+	err := func() error {
+		defer snaptree.Unpin(root)
+
+		// Protect the state of all blocks above the target. The nodes of them
+		// might have been flushed before the recording started, but the diffs
+		// are small and still mostly held in memory.
+		parent := root
+		for number := target.Number.Uint64() + 1; ; number++ {
+			header := chain.GetHeaderByNumber(number)
+			if header == nil {
+				break
+			}
+			if err := markStateDiff(chain.StateCache().TrieDB(), parent, header.Root, writer); err != nil {
+				return err
+			}
+			parent = header.Root
+
+			select {
+			case <-p.quit:
+				return errPruneAborted
+			default:
+			}
+		}
+		// Traverse the target state, re-construct the whole state trie and
+		// commit to the given bloom filter.
+		if p.generateHook != nil {
+			p.generateHook()
+		}
+		if err := snapshot.GenerateTrieWithAbort(snaptree, root, p.db, writer, p.quit); err != nil {
+			return err
+		}
+		// Traverse the genesis, put all genesis state entries into the
+		// bloom filter too.
+		return extractGenesis(p.db, writer)
+	}()
+	if err != nil {
+		p.release()
+		return err
+	}
+	// Persist the bloom, from now on the pruning has to be completed. The lock
+	// is held for the duration of the write, stalling the state flushes of the
+	// chain for a short while.
+	filterName := bloomFilterName(p.datadir, root)
+
+	log.Info("Writing state bloom to disk", "name", filterName)
+	p.lock.Lock()
+	err = p.bloom.Commit(filterName, filterName+stateBloomFileTempSuffix)
+	p.lock.Unlock()
+	if err != nil {
+		p.release()
+		return err
+	}
+	log.Info("State bloom filter committed", "name", filterName)
+
+	p.setPhase(PrunePhaseDeleting)
+	count, err := p.deleteStale()
+	if err != nil {
+		// Leave the recording on, the chain keeps persisting state until
+		// shutdown and RecoverPruning takes over from the persisted bloom.
+		return err
+	}
+	// Delete the state bloom, it marks the entire pruning procedure is
+	// finished. Stop recording the persisted state afterwards.
+	os.RemoveAll(filterName)
+	p.release()
+
+	// Start compactions, will remove the deleted data from the disk immediately.
+	// Note for small pruning, the compaction is skipped.
+	if count >= rangeCompactionThreshold {
+		p.setPhase(PrunePhaseCompacting)
+
+		cstart := time.Now()
+		for b := 0x00; b <= 0xf0; b += 0x10 {
+			var (
+				start = []byte{byte(b)}
+				end   = []byte{byte(b + 0x10)}
+			)
+			if b == 0xf0 {
+				end = nil
+			}
+			select {
+			case <-p.quit:
+				return errPruneAborted
+			default:
+			}
+			log.Info("Compacting database", "range", fmt.Sprintf("%#x-%#x", start, end), "elapsed", common.PrettyDuration(time.Since(cstart)))
+			if err := p.db.Compact(start, end); err != nil {
+				log.Error("Database compaction failed", "error", err)
+				return err
+			}
+		}
+		log.Info("Database compaction finished", "elapsed", common.PrettyDuration(time.Since(cstart)))
+	}
+	status := p.Status()
+	log.Info("State pruning successful", "nodes", status.Nodes, "pruned", common.StorageSize(status.Size), "elapsed", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// staleEntry is a state entry which might be deleted by the online pruner.
+type staleEntry struct {
+	key  []byte
+	size int
+}
+
+// deleteStale iterates the database and deletes all trie nodes and contract
+// codes not present in the state bloom. After each batch the pruner sleeps for
+// as long as the batch took, leaving at least half of the database throughput
+// to block processing.
+func (p *OnlinePruner) deleteStale() (uint64, error) {
+	var (
+		count   uint64
+		size    uint64
+		entries []staleEntry
+		pending int
+		pstart  = time.Now()
+		bstart  = time.Now()
+		logged  = time.Now()
+		iter    = p.db.NewIterator(nil, nil)
+	)
+	defer func() { iter.Release() }()
+
+	flush := func() error {
+		n, s, err := p.deleteEntries(entries)
+		if err != nil {
+			return err
+		}
+		count += n
+		size += s
+
+		last := entries[len(entries)-1].key
+		p.statusLock.Lock()
+		p.status.Nodes, p.status.Size = count, size
+		p.status.Progress = 100 * float64(binary.BigEndian.Uint64(last[:8])) / math.MaxUint64
+		p.statusLock.Unlock()
+
+		if time.Since(logged) > 8*time.Second {
+			log.Info("Pruning state data", "nodes", count, "size", common.StorageSize(size),
+				"elapsed", common.PrettyDuration(time.Since(pstart)))
+			logged = time.Now()
+		}
+		entries, pending = entries[:0], 0
+		return nil
+	}
+	for iter.Next() {
+		// All state entries are candidates for deletion here
+		// - trie node
+		// - legacy contract code
+		// - new-scheme contract code
+		key := iter.Key()
+		if isCode, _ := rawdb.IsCodeKey(key); len(key) != common.HashLength && !isCode {
+			continue
+		}
+		entries = append(entries, staleEntry{key: common.CopyBytes(key), size: len(key) + len(iter.Value())})
+		if pending += len(key); pending < ethdb.IdealBatchSize {
+			continue
+		}
+		last := entries[len(entries)-1].key
+		if err := flush(); err != nil {
+			return count, err
+		}
+		// Recreate the iterator after every batch commit in order
+		// to allow the underlying compactor to delete the entries.
+		iter.Release()
+		iter = p.db.NewIterator(nil, last)
+
+		// Yield to block processing before moving to the next batch
+		select {
+		case <-time.After(time.Since(bstart)):
+		case <-p.quit:
+			return count, errPruneAborted
+		}
+		bstart = time.Now()
+	}
+	if err := iter.Error(); err != nil {
+		return count, err
+	}
+	if len(entries) > 0 {
+		if err := flush(); err != nil {
+			return count, err
+		}
+	}
+	log.Info("Pruned state data", "nodes", count, "size", common.StorageSize(size), "elapsed", common.PrettyDuration(time.Since(pstart)))
+	return count, nil
+}
+
+// deleteEntries deletes all the given entries absent from the state bloom. The
+// lock is held across the check and the write, so state persisted by the chain
+// in the meantime is either recorded before or rewritten after the deletion.
+func (p *OnlinePruner) deleteEntries(entries []staleEntry) (uint64, uint64, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var (
+		count uint64
+		size  uint64
+		batch = p.db.NewBatch()
+	)
+	for _, entry := range entries {
+		checkKey := entry.key
+		if isCode, codeKey := rawdb.IsCodeKey(entry.key); isCode {
+			checkKey = codeKey
+		}
+		if ok, _ := p.bloom.Contain(checkKey); ok {
+			continue
+		}
+		batch.Delete(entry.key)
+		count++
+		size += uint64(entry.size)
+	}
+	return count, size, batch.Write()
+}
+
+// setPhase updates the phase of the running pruning.
+func (p *OnlinePruner) setPhase(phase string) {
+	p.statusLock.Lock()
+	defer p.statusLock.Unlock()
+
+	p.status.Phase = phase
+}
+
+// release stops recording the persisted state and drops the state bloom.
+func (p *OnlinePruner) release() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	atomic.StoreUint32(&p.active, 0)
+	p.bloom = nil
+}
+
+// recoverOnlinePruning resumes an online pruning interrupted by a crash or a
+// shutdown. Since the chain kept progressing after the bloom was persisted,
+// the newest complete state above the target is added to the bloom before the
+// deletion is resumed.
+func recoverOnlinePruning(db ethdb.Database, headBlock *types.Block, root common.Hash, stateBloom *stateBloom, bloomPath string) error {
+	if blob := rawdb.ReadTrieNode(db, root); len(blob) == 0 {
+		log.Error("Pruning target state is not existent")
+		return errors.New("non-existent target state")
+	}
+	triedb := trie.NewDatabase(db)
+	for number := headBlock.NumberU64(); ; number-- {
+		header := rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, number), number)
+		if header == nil {
+			return fmt.Errorf("missing header #%d", number)
+		}
+		if header.Root == root {
+			break
+		}
+		if blob := rawdb.ReadTrieNode(db, header.Root); len(blob) != 0 {
+			err := markStateDiff(triedb, root, header.Root, stateBloom)
+			if err == nil {
+				log.Info("Retaining state written during pruning", "number", number, "root", header.Root)
+				break
+			}
+			log.Warn("Skipping incomplete state", "number", number, "root", header.Root, "err", err)
+		}
+		if number == 0 {
+			break
+		}
+	}
+	return prune(nil, root, db, stateBloom, bloomPath, nil, time.Now())
+}
+
+// markStateDiff commits all the trie nodes and contract codes of the state at
+// root which are absent from the state at parent into the given writer.
+func markStateDiff(triedb *trie.Database, parent, root common.Hash, writer ethdb.KeyValueWriter) error {
+	if parent == root {
+		return nil
+	}
+	oldTrie, err := trie.New(parent, triedb)
+	if err != nil {
+		return err
+	}
+	newTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	// Account lookups are done on a separate trie, as resolving nodes on the
+	// iterated one would mutate it underneath the iterator.
+	lookup, err := trie.New(parent, triedb)
+	if err != nil {
+		return err
+	}
+	it, _ := trie.NewDifferenceIterator(oldTrie.NodeIterator(nil), newTrie.NodeIterator(nil))
+	for it.Next(true) {
+		// Embedded nodes don't have hash.
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			writer.Put(hash.Bytes(), nil)
+		}
+		// If it's a leaf node, yes we are touching an account,
+		// dig into the changed part of the storage trie further.
+		if !it.Leaf() {
+			continue
+		}
+		var acc types.StateAccount
+		if err := rlp.DecodeBytes(it.LeafBlob(), &acc); err != nil {
+			return err
+		}
+		prev := types.StateAccount{Root: emptyRoot, CodeHash: emptyCode}
+		blob, err := lookup.TryGet(it.LeafKey())
+		if err != nil {
+			return err
+		}
+		if len(blob) > 0 {
+			if err := rlp.DecodeBytes(blob, &prev); err != nil {
+				return err
+			}
+		}
+		if acc.Root != prev.Root {
+			if err := markStorageDiff(triedb, prev.Root, acc.Root, writer); err != nil {
+				return err
+			}
+		}
+		if !bytes.Equal(acc.CodeHash, emptyCode) && !bytes.Equal(acc.CodeHash, prev.CodeHash) {
+			writer.Put(acc.CodeHash, nil)
+		}
+	}
+	return it.Error()
+}
+
+// markStorageDiff commits all the trie nodes of the storage trie at root which
+// are absent from the storage trie at parent into the given writer.
+func markStorageDiff(triedb *trie.Database, parent, root common.Hash, writer ethdb.KeyValueWriter) error {
+	oldTrie, err := trie.New(parent, triedb)
+	if err != nil {
+		return err
+	}
+	newTrie, err := trie.New(root, triedb)
+	if err != nil {
+		return err
+	}
+	it, _ := trie.NewDifferenceIterator(oldTrie.NodeIterator(nil), newTrie.NodeIterator(nil))
+	for it.Next(true) {
+		if hash := it.Hash(); hash != (common.Hash{}) {
+			writer.Put(hash.Bytes(), nil)
+		}
+	}
+	return it.Error()
+}
+
+// lockedBloom is a key-value writer committing the state entries into the bloom
+// of the running pruning, synchronized with the state flushes of the chain.
+type lockedBloom struct {
+	pruner *OnlinePruner
+}
+
+// Put implements the KeyValueWriter interface. But here only the key is needed.
+func (w *lockedBloom) Put(key []byte, value []byte) error {
+	w.pruner.lock.Lock()
+	defer w.pruner.lock.Unlock()
+
+	return w.pruner.bloom.Put(key, value)
+}
+
+// Delete removes the key from the key-value data store.
+func (w *lockedBloom) Delete(key []byte) error { panic("not supported") }
+
+// bloomRecorder is a key-value writer committing all the state entries written
+// through it into the bloom, ignoring every other entry.
+type bloomRecorder struct {
+	bloom *stateBloom
+}
+
+// Put implements the KeyValueWriter interface. But here only the key is needed.
+func (r bloomRecorder) Put(key []byte, value []byte) error {
+	if len(key) == common.HashLength {
+		return r.bloom.Put(key, value)
+	}
+	if isCode, _ := rawdb.IsCodeKey(key); isCode {
+		return r.bloom.Put(key, value)
+	}
+	return nil
+}
+
+// Delete implements the KeyValueWriter interface. Deletions are not recorded.
+func (r bloomRecorder) Delete(key []byte) error { return nil }
+
+// guardedDatabase is a database wrapper recording all state entries written
+// through it into the bloom of the running pruning, if any.
+type guardedDatabase struct {
+	ethdb.Database
+	pruner *OnlinePruner
+}
+
+// Put inserts the given value into the key-value data store.
+func (db *guardedDatabase) Put(key []byte, value []byte) error {
+	if atomic.LoadUint32(&db.pruner.active) == 0 {
+		return db.Database.Put(key, value)
+	}
+	db.pruner.lock.Lock()
+	defer db.pruner.lock.Unlock()
+
+	if db.pruner.bloom != nil {
+		bloomRecorder{bloom: db.pruner.bloom}.Put(key, value)
+	}
+	return db.Database.Put(key, value)
+}
+
+// NewBatch creates a write-only database that buffers changes to its host db
+// until a final write is called.
+func (db *guardedDatabase) NewBatch() ethdb.Batch {
+	return &guardedBatch{Batch: db.Database.NewBatch(), pruner: db.pruner}
+}
+
+// guardedBatch is a batch wrapper recording all state entries written through
+// it into the bloom of the running pruning, if any.
+type guardedBatch struct {
+	ethdb.Batch
+	pruner *OnlinePruner
+}
+
+// Write flushes any accumulated data to disk.
+func (b *guardedBatch) Write() error {
+	if atomic.LoadUint32(&b.pruner.active) == 0 {
+		return b.Batch.Write()
+	}
+	b.pruner.lock.Lock()
+	defer b.pruner.lock.Unlock()
+
+	if b.pruner.bloom != nil {
+		if err := b.Batch.Replay(bloomRecorder{bloom: b.pruner.bloom}); err != nil {
+			return err
+		}
+	}
+	return b.Batch.Write()
+}
@@ -0,0 +1,402 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pruner
+
+import (
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// newActivePruner creates an online pruner with a running state bloom, as if
+// a pruning was in progress.
+func newActivePruner(t *testing.T, db ethdb.Database) *OnlinePruner {
+	p := NewOnlinePruner(db, t.TempDir())
+	bloom, err := newStateBloomWithSize(1)
+	if err != nil {
+		t.Fatalf("failed to create state bloom: %v", err)
+	}
+	p.bloom = bloom
+	atomic.StoreUint32(&p.active, 1)
+	return p
+}
+
+// checkState iterates the entire account trie of the given root, failing if
+// any node is missing.
+func checkState(t *testing.T, db ethdb.Database, root common.Hash) {
+	t.Helper()
+
+	tr, err := trie.New(root, trie.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("state %x: missing root: %v", root, err)
+	}
+	it := tr.NodeIterator(nil)
+	for it.Next(true) {
+	}
+	if err := it.Error(); err != nil {
+		t.Fatalf("state %x: incomplete: %v", root, err)
+	}
+}
+
+// hasCode reports whether the contract code with the given hash is stored.
+func hasCode(db ethdb.KeyValueReader, hash common.Hash) bool {
+	return len(rawdb.ReadCodeWithPrefix(db, hash)) != 0
+}
+
+// Tests that the guarded database records the trie nodes and contract codes
+// written through it while a pruning is running, and only those.
+func TestGuardedDatabase(t *testing.T) {
+	var (
+		p  = NewOnlinePruner(rawdb.NewMemoryDatabase(), t.TempDir())
+		db = p.Database()
+
+		idle = crypto.Keccak256Hash([]byte("idle"))
+		node = crypto.Keccak256Hash([]byte("node"))
+		code = crypto.Keccak256Hash([]byte("code"))
+		held = crypto.Keccak256Hash([]byte("batched"))
+	)
+	// Nothing is recorded without a running pruning
+	db.Put(idle.Bytes(), []byte{0x01})
+
+	bloom, _ := newStateBloomWithSize(1)
+	p.bloom = bloom
+	atomic.StoreUint32(&p.active, 1)
+
+	db.Put(node.Bytes(), []byte{0x02})
+	rawdb.WriteCode(db, code, []byte{0x03})
+	rawdb.WriteHeaderNumber(db, common.Hash{0xff}, 1)
+
+	batch := db.NewBatch()
+	batch.Put(held.Bytes(), []byte{0x04})
+	if ok, _ := bloom.Contain(held.Bytes()); ok {
+		t.Fatalf("batched node recorded before the write")
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+	for _, hash := range []common.Hash{node, code, held} {
+		if ok, _ := bloom.Contain(hash.Bytes()); !ok {
+			t.Errorf("state entry %x not recorded", hash)
+		}
+		if has, _ := p.db.Has(hash.Bytes()); !has && hash != code {
+			t.Errorf("state entry %x not written", hash)
+		}
+	}
+	if ok, _ := bloom.Contain(idle.Bytes()); ok {
+		t.Errorf("node written while idle recorded")
+	}
+	if !hasCode(p.db, code) {
+		t.Errorf("contract code not written")
+	}
+	// Stopping the recording must not lose any writes
+	p.release()
+	db.Put(idle.Bytes(), []byte{0x05})
+	if blob, _ := p.db.Get(idle.Bytes()); len(blob) != 1 || blob[0] != 0x05 {
+		t.Errorf("write after release lost: %x", blob)
+	}
+}
+
+// Tests that the deletion removes all the trie nodes and contract codes absent
+// from the bloom, leaving everything else in place.
+func TestDeleteStale(t *testing.T) {
+	var (
+		db = rawdb.NewMemoryDatabase()
+		p  = newActivePruner(t, db)
+
+		keepNode = crypto.Keccak256Hash([]byte("keep-node"))
+		dropNode = crypto.Keccak256Hash([]byte("drop-node"))
+		keepCode = crypto.Keccak256Hash([]byte("keep-code"))
+		dropCode = crypto.Keccak256Hash([]byte("drop-code"))
+		other    = common.Hash{0xff}
+	)
+	db.Put(keepNode.Bytes(), []byte{0x01})
+	db.Put(dropNode.Bytes(), []byte{0x02})
+	rawdb.WriteCode(db, keepCode, []byte{0x03})
+	rawdb.WriteCode(db, dropCode, []byte{0x04})
+	rawdb.WriteHeaderNumber(db, other, 1)
+
+	p.bloom.Put(keepNode.Bytes(), nil)
+	p.bloom.Put(keepCode.Bytes(), nil)
+
+	count, err := p.deleteStale()
+	if err != nil {
+		t.Fatalf("failed to delete stale state: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("deleted entry count mismatch: have %d, want 2", count)
+	}
+	if status := p.Status(); status.Nodes != 2 || status.Size == 0 {
+		t.Errorf("status mismatch: nodes %d, size %d", status.Nodes, status.Size)
+	}
+	if has, _ := db.Has(keepNode.Bytes()); !has {
+		t.Errorf("retained node deleted")
+	}
+	if has, _ := db.Has(dropNode.Bytes()); has {
+		t.Errorf("stale node not deleted")
+	}
+	if !hasCode(db, keepCode) {
+		t.Errorf("retained code deleted")
+	}
+	if hasCode(db, dropCode) {
+		t.Errorf("stale code not deleted")
+	}
+	if rawdb.ReadHeaderNumber(db, other) == nil {
+		t.Errorf("non-state entry deleted")
+	}
+}
+
+// Tests that resuming an interrupted online pruning retains both the target
+// state from the persisted bloom and the newest state written after it.
+func TestRecoverOnlinePruning(t *testing.T) {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		sdb   = state.NewDatabase(db)
+		roots []common.Hash
+	)
+	// Create three consecutive states, the middle one being the pruning target
+	statedb, _ := state.New(common.Hash{}, sdb, nil)
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 16; j++ {
+			statedb.SetBalance(common.BigToAddress(big.NewInt(int64(j))), big.NewInt(int64(i*16+j+1)))
+		}
+		contract := common.BigToAddress(big.NewInt(int64(1000 + i)))
+		statedb.SetCode(contract, []byte{byte(vm.PUSH1), byte(i), byte(vm.STOP)})
+		statedb.SetState(contract, common.Hash{0x01}, common.Hash{byte(i + 1)})
+
+		root, err := statedb.Commit(true)
+		if err != nil {
+			t.Fatalf("failed to commit state %d: %v", i, err)
+		}
+		if err := sdb.TrieDB().Commit(root, false, nil); err != nil {
+			t.Fatalf("failed to flush state %d: %v", i, err)
+		}
+		roots = append(roots, root)
+
+		header := &types.Header{Number: big.NewInt(int64(i)), Root: root}
+		rawdb.WriteHeader(db, header)
+		rawdb.WriteCanonicalHash(db, header.Hash(), uint64(i))
+	}
+	// Only the target state made it into the persisted bloom
+	bloom, _ := newStateBloomWithSize(1)
+	if err := markStateDiff(trie.NewDatabase(db), emptyRoot, roots[1], bloom); err != nil {
+		t.Fatalf("failed to mark target state: %v", err)
+	}
+	bloomPath := bloomFilterName(t.TempDir(), roots[1])
+	if err := bloom.Commit(bloomPath, bloomPath+stateBloomFileTempSuffix); err != nil {
+		t.Fatalf("failed to commit bloom: %v", err)
+	}
+	head := types.NewBlockWithHeader(rawdb.ReadHeader(db, rawdb.ReadCanonicalHash(db, 2), 2))
+	if err := recoverOnlinePruning(db, head, roots[1], bloom, bloomPath); err != nil {
+		t.Fatalf("failed to recover pruning: %v", err)
+	}
+	checkState(t, db, roots[1])
+	checkState(t, db, roots[2])
+	if blob := rawdb.ReadTrieNode(db, roots[0]); len(blob) != 0 {
+		t.Errorf("stale state not pruned")
+	}
+	for i := 1; i < 3; i++ {
+		if !hasCode(db, crypto.Keccak256Hash([]byte{byte(vm.PUSH1), byte(i), byte(vm.STOP)})) {
+			t.Errorf("state %d: contract code pruned", i)
+		}
+	}
+	if _, err := os.Stat(bloomPath); !os.IsNotExist(err) {
+		t.Errorf("state bloom not deleted: %v", err)
+	}
+}
+
+// Tests a full online pruning of a live chain, which keeps importing blocks
+// while the stale state is deleted.
+func TestOnlinePruner(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{address: {Balance: big.NewInt(params.Ether)}}}
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	gendb := rawdb.NewMemoryDatabase()
+	blocks, _ := core.GenerateChain(gspec.Config, gspec.MustCommit(gendb), ethash.NewFaker(), gendb, 128, func(i int, b *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), common.BigToAddress(big.NewInt(int64(i+1000))), big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, key)
+		b.AddTx(tx)
+	})
+	var (
+		db      = rawdb.NewMemoryDatabase()
+		datadir = t.TempDir()
+		p       = NewOnlinePruner(db, datadir)
+	)
+	defer p.Stop()
+	gspec.MustCommit(p.Database())
+
+	// Run an archive node, so every state is persisted and the old ones are stale
+	cacheConfig := &core.CacheConfig{
+		TrieCleanLimit:    256,
+		TrieDirtyLimit:    256,
+		TrieTimeLimit:     5 * time.Minute,
+		SnapshotLimit:     256,
+		SnapshotWait:      true,
+		TrieDirtyDisabled: true,
+	}
+	chain, err := core.NewBlockChain(p.Database(), cacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if err := p.Start(chain, 256); err == nil {
+		t.Fatalf("pruning started on a short chain")
+	}
+	if n, err := chain.InsertChain(blocks[:96]); err != nil {
+		t.Fatalf("block %d: failed to insert: %v", n, err)
+	}
+	stale := chain.GetHeaderByNumber(16).Root
+	checkState(t, db, stale)
+
+	if err := p.Start(chain, 256); err != nil {
+		t.Fatalf("failed to start pruning: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks[96:]); err != nil {
+		t.Fatalf("block %d: failed to insert during pruning: %v", n, err)
+	}
+	for start := time.Now(); p.Status().Running; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > time.Minute {
+			t.Fatalf("pruning timed out: %+v", p.Status())
+		}
+	}
+	status := p.Status()
+	if status.Phase != PrunePhaseDone {
+		t.Fatalf("pruning phase mismatch: have %s, want %s (%s)", status.Phase, PrunePhaseDone, status.Error)
+	}
+	if status.Number != 96-onlinePruneDepth || status.Nodes == 0 {
+		t.Errorf("pruning status mismatch: %+v", status)
+	}
+	// The target and all the states above it must be intact, the old ones gone
+	for number := status.Number; number <= chain.CurrentBlock().NumberU64(); number++ {
+		checkState(t, db, chain.GetHeaderByNumber(number).Root)
+	}
+	if blob := rawdb.ReadTrieNode(db, stale); len(blob) != 0 {
+		t.Errorf("stale state not pruned")
+	}
+	if matches, _ := filepath.Glob(filepath.Join(datadir, stateBloomFilePrefix+"*")); len(matches) != 0 {
+		t.Errorf("state bloom left behind: %v", matches)
+	}
+	if atomic.LoadUint32(&p.active) != 0 {
+		t.Errorf("state recording not stopped")
+	}
+}
+
+// Tests that an online pruning spanning the import of many blocks keeps its
+// target pinned and protects all the state persisted in the meantime.
+func TestOnlinePrunerLongImport(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{address: {Balance: big.NewInt(params.Ether)}}}
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	gendb := rawdb.NewMemoryDatabase()
+	blocks, _ := core.GenerateChain(gspec.Config, gspec.MustCommit(gendb), ethash.NewFaker(), gendb, 96+320, func(i int, b *core.BlockGen) {
+		tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(address), common.BigToAddress(big.NewInt(int64(i+1000))), big.NewInt(1000), params.TxGas, b.BaseFee(), nil), signer, key)
+		b.AddTx(tx)
+	})
+	var (
+		db = rawdb.NewMemoryDatabase()
+		p  = NewOnlinePruner(db, t.TempDir())
+	)
+	defer p.Stop()
+	gspec.MustCommit(p.Database())
+
+	cacheConfig := &core.CacheConfig{
+		TrieCleanLimit:    256,
+		TrieDirtyLimit:    256,
+		TrieTimeLimit:     5 * time.Minute,
+		SnapshotLimit:     256,
+		SnapshotWait:      true,
+		TrieDirtyDisabled: true,
+	}
+	chain, err := core.NewBlockChain(p.Database(), cacheConfig, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks[:96]); err != nil {
+		t.Fatalf("block %d: failed to insert: %v", n, err)
+	}
+	target := chain.GetHeaderByNumber(96 - onlinePruneDepth)
+
+	// Import the rest of the chain while the pruning holds its pin, pushing the
+	// snapshot well beyond the layers kept in memory
+	var (
+		imported = make(chan error, 1)
+		pinned   = make(chan bool, 1)
+	)
+	p.generateHook = func() {
+		n, err := chain.InsertChain(blocks[96:])
+		if err != nil {
+			err = fmt.Errorf("block %d: %v", n, err)
+		}
+		imported <- err
+
+		// The pinned layer must still be readable and hold the pin
+		snap := chain.Snapshots().Snapshot(target.Root)
+		if snap == nil {
+			pinned <- false
+			return
+		}
+		_, err = snap.AccountRLP(crypto.Keccak256Hash(address.Bytes()))
+		pinned <- err == nil && chain.Snapshots().Pin(chain.CurrentBlock().Root()) != nil
+	}
+	if err := p.Start(chain, 256); err != nil {
+		t.Fatalf("failed to start pruning: %v", err)
+	}
+	for start := time.Now(); p.Status().Running; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > time.Minute {
+			t.Fatalf("pruning timed out: %+v", p.Status())
+		}
+	}
+	if err := <-imported; err != nil {
+		t.Fatalf("failed to insert during pruning: %v", err)
+	}
+	if !<-pinned {
+		t.Errorf("pruning target not pinned after the import")
+	}
+	status := p.Status()
+	if status.Phase != PrunePhaseDone {
+		t.Fatalf("pruning phase mismatch: have %s, want %s (%s)", status.Phase, PrunePhaseDone, status.Error)
+	}
+	if head := chain.CurrentBlock().NumberU64(); head != uint64(len(blocks)) {
+		t.Fatalf("chain head mismatch: have %d, want %d", head, len(blocks))
+	}
+	for number := status.Number; number <= chain.CurrentBlock().NumberU64(); number++ {
+		checkState(t, db, chain.GetHeaderByNumber(number).Root)
+	}
+}
@@ -61,6 +61,10 @@ var (
 
 	// emptyCode is the known hash of the empty EVM bytecode.
 	emptyCode = crypto.Keccak256(nil)
+
+	// errPathScheme is returned if a pruning is requested on a database using
+	// the path-based state scheme, which only keeps a single persisted state.
+	errPathScheme = errors.New("state pruning is not needed by path-based state scheme")
 )
 
 // Pruner is an offline tool to prune the stale state with the
@@ -85,6 +89,9 @@ type Pruner struct {
 
 // NewPruner creates the pruner instance.
 func NewPruner(db ethdb.Database, datadir, trieCachePath string, bloomSize uint64) (*Pruner, error) {
+	if rawdb.ReadStateScheme(db) == rawdb.PathScheme {
+		return nil, errPathScheme
+	}
 	headBlock := rawdb.ReadHeadBlock(db)
 	if headBlock == nil {
 		return nil, errors.New("Failed to load head block")
@@ -188,18 +195,23 @@ func prune(snaptree *snapshot.Tree, root common.Hash, maindb ethdb.Database, sta
 	// Pruning is done, now drop the "useless" layers from the snapshot.
 	// Firstly, flushing the target layer into the disk. After that all
 	// diff layers below the target will all be merged into the disk.
-	if root != snaptree.DiskRoot() {
-		if err := snaptree.Cap(root, 0); err != nil {
+	//
+	// The snapshot is left untouched when resuming an online pruning, it
+	// is still paired with the chain head rather than the pruning target.
+	if snaptree != nil {
+		if root != snaptree.DiskRoot() {
+			if err := snaptree.Cap(root, 0); err != nil {
+				return err
+			}
+		}
+		// Secondly, flushing the snapshot journal into the disk. All diff
+		// layers upon are dropped silently. Eventually the entire snapshot
+		// tree is converted into a single disk layer with the pruning target
+		// as the root.
+		if _, err := snaptree.Journal(root); err != nil {
 			return err
 		}
 	}
-	// Secondly, flushing the snapshot journal into the disk. All diff
-	// layers upon are dropped silently. Eventually the entire snapshot
-	// tree is converted into a single disk layer with the pruning target
-	// as the root.
-	if _, err := snaptree.Journal(root); err != nil {
-		return err
-	}
 	// Delete the state bloom, it marks the entire pruning procedure is
 	// finished. If any crashes or manual exit happens before this,
 	// `RecoverPruning` will pick it up in the next restarts to redo all
@@ -363,18 +375,6 @@ func RecoverPruning(datadir string, db ethdb.Database, trieCachePath string) err
 	if headBlock == nil {
 		return errors.New("Failed to load head block")
 	}
-	// Initialize the snapshot tree in recovery mode to handle this special case:
-	// - Users run the `prune-state` command multiple times
-	// - Neither these `prune-state` running is finished(e.g. interrupted manually)
-	// - The state bloom filter is already generated, a part of state is deleted,
-	//   so that resuming the pruning here is mandatory
-	// - The state HEAD is rewound already because of multiple incomplete `prune-state`
-	// In this case, even the state HEAD is not exactly matched with snapshot, it
-	// still feasible to recover the pruning correctly.
-	snaptree, err := snapshot.New(db, trie.NewDatabase(db), 256, headBlock.Root(), false, false, true)
-	if err != nil {
-		return err // The relevant snapshot(s) might not exist
-	}
 	stateBloom, err := NewStateBloomFromDisk(stateBloomPath)
 	if err != nil {
 		return err
@@ -387,30 +387,41 @@ func RecoverPruning(datadir string, db ethdb.Database, trieCachePath string) err
 	// state is picked for usage.
 	deleteCleanTrieCache(trieCachePath)
 
-	// All the state roots of the middle layers should be forcibly pruned,
-	// otherwise the dangling state will be left.
-	var (
-		found       bool
-		layers      = snaptree.Snapshots(headBlock.Root(), 128, true)
-		middleRoots = make(map[common.Hash]struct{})
-	)
-	for _, layer := range layers {
-		if layer.Root() == stateBloomRoot {
-			found = true
-			break
+	// Initialize the snapshot tree in recovery mode to handle this special case:
+	// - Users run the `prune-state` command multiple times
+	// - Neither these `prune-state` running is finished(e.g. interrupted manually)
+	// - The state bloom filter is already generated, a part of state is deleted,
+	//   so that resuming the pruning here is mandatory
+	// - The state HEAD is rewound already because of multiple incomplete `prune-state`
+	// In this case, even the state HEAD is not exactly matched with snapshot, it
+	// still feasible to recover the pruning correctly.
+	snaptree, err := snapshot.New(db, trie.NewDatabase(db), 256, headBlock.Root(), false, false, true)
+	if err != nil {
+		log.Warn("Failed to load snapshot for pruning recovery", "err", err)
+	} else {
+		// All the state roots of the middle layers should be forcibly pruned,
+		// otherwise the dangling state will be left.
+		var (
+			layers      = snaptree.Snapshots(headBlock.Root(), 128, true)
+			middleRoots = make(map[common.Hash]struct{})
+		)
+		for _, layer := range layers {
+			if layer.Root() == stateBloomRoot {
+				return prune(snaptree, stateBloomRoot, db, stateBloom, stateBloomPath, middleRoots, time.Now())
+			}
+			middleRoots[layer.Root()] = struct{}{}
 		}
-		middleRoots[layer.Root()] = struct{}{}
-	}
-	if !found {
-		log.Error("Pruning target state is not existent")
-		return errors.New("non-existent target state")
 	}
-	return prune(snaptree, stateBloomRoot, db, stateBloom, stateBloomPath, middleRoots, time.Now())
+	// The pruning target is not among the snapshot layers, which is the case
+	// for an interrupted online pruning: the chain kept progressing while the
+	// stale state was being deleted. The state written since then is not in the
+	// persisted bloom, so protect the newest complete state in the database too.
+	return recoverOnlinePruning(db, headBlock, stateBloomRoot, stateBloom, stateBloomPath)
 }
 
 // extractGenesis loads the genesis state and commits all the state entries
 // into the given bloomfilter.
-func extractGenesis(db ethdb.Database, stateBloom *stateBloom) error {
+func extractGenesis(db ethdb.Database, stateBloom ethdb.KeyValueWriter) error {
 	genesisHash := rawdb.ReadCanonicalHash(db, 0)
 	if genesisHash == (common.Hash{}) {
 		return errors.New("missing genesis hash")
@@ -64,11 +64,18 @@ func GenerateStorageTrieRoot(account common.Hash, it StorageIterator) (common.Ha
 // accounts as well as the corresponding storages and regenerate the whole state
 // (account trie + all storage tries).
 func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethdb.KeyValueWriter) error {
+	return GenerateTrieWithAbort(snaptree, root, src, dst, nil)
+}
+
+// GenerateTrieWithAbort is the same as GenerateTrie, but the regeneration is
+// interrupted with ErrGenerationAborted as soon as the abort channel is closed.
+func GenerateTrieWithAbort(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethdb.KeyValueWriter, abort <-chan struct{}) error {
 	// Traverse all state by snapshot, re-generate the whole state trie
 	acctIt, err := snaptree.AccountIterator(root, common.Hash{})
 	if err != nil {
 		return err // The required snapshot might not exist.
 	}
+	acctIt = &abortAccountIterator{AccountIterator: acctIt, abort: abort}
 	defer acctIt.Release()
 
 	got, err := generateTrieRoot(dst, acctIt, common.Hash{}, stackTrieGenerate, func(dst ethdb.KeyValueWriter, accountHash, codeHash common.Hash, stat *generateStats) (common.Hash, error) {
@@ -85,6 +92,7 @@ func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethd
 		if err != nil {
 			return common.Hash{}, err
 		}
+		storageIt = &abortStorageIterator{StorageIterator: storageIt, abort: abort}
 		defer storageIt.Release()
 
 		hash, err := generateTrieRoot(dst, storageIt, accountHash, stackTrieGenerate, nil, stat, false)
@@ -103,6 +111,64 @@ func GenerateTrie(snaptree *Tree, root common.Hash, src ethdb.Database, dst ethd
 	return nil
 }
 
+// abortAccountIterator is an account iterator which stops yielding entries once
+// the abort channel is closed.
+type abortAccountIterator struct {
+	AccountIterator
+	abort <-chan struct{}
+	err   error
+}
+
+// Next steps the iterator forward one element, returning false if exhausted or
+// aborted.
+func (it *abortAccountIterator) Next() bool {
+	select {
+	case <-it.abort:
+		it.err = ErrGenerationAborted
+		return false
+	default:
+		return it.AccountIterator.Next()
+	}
+}
+
+// Error returns any failure that occurred during iteration, which might have
+// caused a premature iteration exit.
+func (it *abortAccountIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.AccountIterator.Error()
+}
+
+// abortStorageIterator is a storage iterator which stops yielding entries once
+// the abort channel is closed.
+type abortStorageIterator struct {
+	StorageIterator
+	abort <-chan struct{}
+	err   error
+}
+
+// Next steps the iterator forward one element, returning false if exhausted or
+// aborted.
+func (it *abortStorageIterator) Next() bool {
+	select {
+	case <-it.abort:
+		it.err = ErrGenerationAborted
+		return false
+	default:
+		return it.StorageIterator.Next()
+	}
+}
+
+// Error returns any failure that occurred during iteration, which might have
+// caused a premature iteration exit.
+func (it *abortStorageIterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.StorageIterator.Error()
+}
+
 // generateStats is a collection of statistics gathered by the trie generator
 // for logging purposes.
 type generateStats struct {
@@ -349,6 +415,9 @@ func generateTrieRoot(db ethdb.KeyValueWriter, it Iterator, account common.Hash,
 			logged, processed = time.Now(), 0
 		}
 	}
+	if err := it.Error(); err != nil {
+		return stop(err)
+	}
 	// Commit the last part statistic.
 	if processed > 0 && stats != nil {
 		if account == (common.Hash{}) {
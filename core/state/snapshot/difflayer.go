@@ -49,6 +49,12 @@ var (
 	// smaller number to be on the safe side.
 	aggregatorItemLimit = aggregatorMemoryLimit / 42
 
+	// pinnedMemoryLimit is the minimum size the diff layer aggregating the writes
+	// above a pinned layer may grow to. Nothing can be flushed into the disk
+	// layer while the pin is held, so it is dropped once the aggregator outgrows
+	// this or the snapshot cache allowance, whichever is larger.
+	pinnedMemoryLimit = uint64(256 * 1024 * 1024)
+
 	// bloomTargetError is the target false positive rate when the aggregator
 	// layer is at its fullest. The actual value will probably move around up
 	// and down from this number, it's mostly a ballpark figure.
@@ -431,15 +437,21 @@ func (dl *diffLayer) Update(blockRoot common.Hash, destructs map[common.Hash]str
 // a single diff at the bottom. Since usually the lowermost diff is the largest,
 // the flattening builds up from there in reverse.
 func (dl *diffLayer) flatten() snapshot {
+	return dl.flattenAbove(nil)
+}
+
+// flattenAbove is the same as flatten, but it stops at the given layer, leaving
+// it and everything beneath it untouched.
+func (dl *diffLayer) flattenAbove(stop snapshot) snapshot {
 	// If the parent is not diff, we're the first in line, return unmodified
 	parent, ok := dl.parent.(*diffLayer)
-	if !ok {
+	if !ok || dl.parent == stop {
 		return dl
 	}
 	// Parent is a diff, flatten it first (note, apart from weird corned cases,
 	// flatten will realistically only ever merge 1 layer, so there's no need to
 	// be smarter about grouping flattens together).
-	parent = parent.flatten().(*diffLayer)
+	parent = parent.flattenAbove(stop).(*diffLayer)
 
 	parent.lock.Lock()
 	defer parent.lock.Unlock()
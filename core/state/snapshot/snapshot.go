@@ -94,6 +94,14 @@ var (
 	// errSnapshotCycle is returned if a snapshot is attempted to be inserted
 	// that forms a cycle in the snapshot tree.
 	errSnapshotCycle = errors.New("snapshot cycle")
+
+	// ErrGenerationAborted is returned if a trie regeneration from the snapshot
+	// is interrupted by the caller.
+	ErrGenerationAborted = errors.New("trie generation aborted")
+
+	// errSnapshotPinned is returned if a layer is attempted to be pinned while
+	// another one is already held.
+	errSnapshotPinned = errors.New("snapshot already pinned")
 )
 
 // Snapshot represents the functionality supported by a snapshot storage layer.
@@ -162,6 +170,7 @@ type Tree struct {
 	triedb *trie.Database           // In-memory cache to access the trie through
 	cache  int                      // Megabytes permitted to use for read caches
 	layers map[common.Hash]snapshot // Collection of all known layers
+	pinned common.Hash              // Layer protected from flattening by a long running reader
 	lock   sync.RWMutex
 
 	// Test hooks
@@ -387,20 +396,27 @@ func (t *Tree) Cap(root common.Hash, layers int) error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
-	// Flattening the bottom-most diff layer requires special casing since there's
-	// no child to rewire to the grandparent. In that case we can fake a temporary
-	// child for the capping and then remove it.
-	if layers == 0 {
-		// If full commit was requested, flatten the diffs and merge onto disk
-		diff.lock.RLock()
-		base := diffToDisk(diff.flatten().(*diffLayer))
-		diff.lock.RUnlock()
-
-		// Replace the entire snapshot tree with the flat base
-		t.layers = map[common.Hash]snapshot{base.root: base}
-		return nil
+	// If a layer beneath the requested one is pinned, only the layers above it
+	// are flattened, as long as they fit into the memory allowance.
+	var persisted *diskLayer
+	if t.pinnedBelow(diff) && t.capAbovePin(diff, layers) {
+		log.Debug("Snapshot capped above pinned layer", "root", root, "pinned", t.pinned)
+	} else {
+		// Flattening the bottom-most diff layer requires special casing since there's
+		// no child to rewire to the grandparent. In that case we can fake a temporary
+		// child for the capping and then remove it.
+		if layers == 0 {
+			// If full commit was requested, flatten the diffs and merge onto disk
+			diff.lock.RLock()
+			base := diffToDisk(diff.flatten().(*diffLayer))
+			diff.lock.RUnlock()
+
+			// Replace the entire snapshot tree with the flat base
+			t.layers = map[common.Hash]snapshot{base.root: base}
+			return nil
+		}
+		persisted = t.cap(diff, layers)
 	}
-	persisted := t.cap(diff, layers)
 
 	// Remove any layer that is stale or links into a stale layer
 	children := make(map[common.Hash][]common.Hash)
@@ -440,6 +456,113 @@ func (t *Tree) Cap(root common.Hash, layers int) error {
 	return nil
 }
 
+// Pin marks the layer belonging to the given root as being in use by a long
+// running reader (e.g. the online state pruner). Until Unpin is called, Cap
+// will neither flatten the pinned layer nor anything beneath it, so the layer
+// can be iterated while new layers keep being added on top.
+//
+// Note, only a single layer can be pinned at a time. The layers above the pin
+// are merged in memory instead of being flushed to disk, if they outgrow the
+// allowance returned by pinAllowance the pin is dropped and the pinned layer
+// goes stale.
+func (t *Tree) Pin(root common.Hash) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.pinned != (common.Hash{}) {
+		return errSnapshotPinned
+	}
+	snap, ok := t.layers[root]
+	if !ok {
+		return fmt.Errorf("snapshot [%#x] missing", root)
+	}
+	if snap.Stale() {
+		return ErrSnapshotStale
+	}
+	t.pinned = root
+	return nil
+}
+
+// Unpin releases the pin held on the layer belonging to the given root. The
+// deferred flattening happens on the next Cap.
+func (t *Tree) Unpin(root common.Hash) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.pinned == root {
+		t.pinned = common.Hash{}
+	}
+}
+
+// pinnedBelow reports whether the pinned layer is the given diff layer or one
+// of its ancestors.
+func (t *Tree) pinnedBelow(diff *diffLayer) bool {
+	if t.pinned == (common.Hash{}) {
+		return false
+	}
+	for layer := snapshot(diff); layer != nil; layer = layer.Parent() {
+		if layer.Root() == t.pinned {
+			return true
+		}
+	}
+	return false
+}
+
+// pinAllowance returns the maximum memory the layers above the pinned one may
+// use. It scales with the configured snapshot cache, so nodes expecting long
+// running readers can raise it, but never goes below pinnedMemoryLimit.
+func (t *Tree) pinAllowance() uint64 {
+	if allowance := uint64(t.cache) * 1024 * 1024; allowance > pinnedMemoryLimit {
+		return allowance
+	}
+	return pinnedMemoryLimit
+}
+
+// capAbovePin is the counterpart of cap while a layer beneath the given diff is
+// pinned. All diffs beyond the permitted number are flattened into a single
+// layer on top of the pinned one, which is left untouched together with all
+// its ancestors. If the flattened layer exceeds the memory allowance, the pin
+// is dropped and false is returned, the caller needs to cap the tree normally.
+func (t *Tree) capAbovePin(diff *diffLayer, layers int) bool {
+	// Dive until we run out of layers or reach the pinned layer
+	var child *diffLayer
+	for i := 0; i < layers; i++ {
+		if diff.root == t.pinned || diff.parent.Root() == t.pinned {
+			return true // Nothing to flatten above the pin
+		}
+		child, diff = diff, diff.parent.(*diffLayer)
+	}
+	if diff.root == t.pinned {
+		return true
+	}
+	// Drop the pin if the flattened layer would outgrow the memory allowance
+	var memory uint64
+	for layer := snapshot(diff); layer.Root() != t.pinned; layer = layer.Parent() {
+		memory += layer.(*diffLayer).memory
+	}
+	if allowance := t.pinAllowance(); memory > allowance {
+		log.Warn("Dropping snapshot pin, memory allowance exceeded", "pinned", t.pinned, "memory", common.StorageSize(memory), "allowance", common.StorageSize(allowance))
+		t.pinned = common.Hash{}
+		return false
+	}
+	// Hold the write lock of the child until the flattened layer is linked in,
+	// the same way cap does. Without a child, the flattened layer replaces the
+	// requested one.
+	if child != nil {
+		child.lock.Lock()
+		defer child.lock.Unlock()
+	} else {
+		diff.lock.RLock()
+		defer diff.lock.RUnlock()
+	}
+	flattened := diff.flattenAbove(t.layers[t.pinned]).(*diffLayer)
+	t.layers[flattened.root] = flattened
+	if child != nil {
+		child.parent = flattened
+	}
+	return true
+}
+
 // cap traverses downwards the diff tree until the number of allowed layers are
 // crossed. All diffs beyond the permitted number are flattened downwards. If the
 // layer limit is reached, memory cap is also enforced (but not before).
@@ -237,6 +237,157 @@ func TestDiffLayerExternalInvalidationPartialFlatten(t *testing.T) {
 	}
 }
 
+// Tests that pinning a layer only allows flattening the layers above it, keeping
+// the pinned layer and everything beneath it accessible.
+func TestPinnedLayerSurvivesCap(t *testing.T) {
+	// Create an empty base layer and a snapshot tree out of it
+	base := &diskLayer{
+		diskdb: rawdb.NewMemoryDatabase(),
+		root:   common.HexToHash("0x01"),
+		cache:  fastcache.New(1024 * 500),
+	}
+	snaps := &Tree{
+		layers: map[common.Hash]snapshot{
+			base.root: base,
+		},
+	}
+	// Commit five diffs on top and pin the second one
+	for i := 2; i <= 6; i++ {
+		accounts := map[common.Hash][]byte{
+			common.BigToHash(big.NewInt(int64(i))): randomAccount(),
+		}
+		if err := snaps.Update(common.BigToHash(big.NewInt(int64(i))), common.BigToHash(big.NewInt(int64(i-1))), nil, accounts, nil); err != nil {
+			t.Fatalf("failed to create a diff layer: %v", err)
+		}
+	}
+	if err := snaps.Pin(common.HexToHash("0x07")); err == nil {
+		t.Fatalf("pinned unknown layer")
+	}
+	if err := snaps.Pin(common.HexToHash("0x03")); err != nil {
+		t.Fatalf("failed to pin layer: %v", err)
+	}
+	if err := snaps.Pin(common.HexToHash("0x04")); err != errSnapshotPinned {
+		t.Fatalf("second pin error mismatch: have %v, want %v", err, errSnapshotPinned)
+	}
+	var (
+		bottom = snaps.Snapshot(common.HexToHash("0x02")).(*diffLayer)
+		ref    = snaps.Snapshot(common.HexToHash("0x03")).(*diffLayer)
+	)
+	// Capping should flatten the layers above the pin only
+	if err := snaps.Cap(common.HexToHash("0x06"), 1); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	if n := len(snaps.layers); n != 5 {
+		t.Errorf("pinned layer count mismatch: have %d, want %d", n, 5)
+	}
+	if snaps.Snapshot(common.HexToHash("0x04")) != nil {
+		t.Errorf("layer above the pin not flattened")
+	}
+	if err := snaps.Cap(common.HexToHash("0x06"), 0); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	if n := len(snaps.layers); n != 4 {
+		t.Errorf("pinned layer count mismatch: have %d, want %d", n, 4)
+	}
+	if ref.Stale() || bottom.Stale() {
+		t.Errorf("pinned layer or its parent went stale")
+	}
+	head := snaps.Snapshot(common.HexToHash("0x06")).(*diffLayer)
+	if head.Parent() != ref {
+		t.Errorf("flattened layer not linked to the pinned one")
+	}
+	for i := 2; i <= 6; i++ {
+		if acc, err := head.AccountRLP(common.BigToHash(big.NewInt(int64(i)))); err != nil || len(acc) == 0 {
+			t.Errorf("account %d missing from flattened layer: %v", i, err)
+		}
+	}
+	// Releasing the pin should allow the deferred flattening
+	snaps.Unpin(common.HexToHash("0x03"))
+	if err := snaps.Cap(common.HexToHash("0x06"), 0); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	if n := len(snaps.layers); n != 1 {
+		t.Errorf("unpinned layer count mismatch: have %d, want %d", n, 1)
+	}
+	if !bottom.Stale() {
+		t.Errorf("unpinned layers not flattened")
+	}
+}
+
+// Tests that the pin is dropped if the layers above it outgrow the memory
+// allowance, so they can be flushed to disk.
+func TestPinnedLayerMemoryLimit(t *testing.T) {
+	defer func(limit uint64) { pinnedMemoryLimit = limit }(pinnedMemoryLimit)
+	pinnedMemoryLimit = 0
+
+	base := &diskLayer{
+		diskdb: rawdb.NewMemoryDatabase(),
+		root:   common.HexToHash("0x01"),
+		cache:  fastcache.New(1024 * 500),
+	}
+	snaps := &Tree{
+		layers: map[common.Hash]snapshot{
+			base.root: base,
+		},
+	}
+	accounts := map[common.Hash][]byte{
+		common.HexToHash("0xa1"): randomAccount(),
+	}
+	for i := 2; i <= 4; i++ {
+		if err := snaps.Update(common.BigToHash(big.NewInt(int64(i))), common.BigToHash(big.NewInt(int64(i-1))), nil, accounts, nil); err != nil {
+			t.Fatalf("failed to create a diff layer: %v", err)
+		}
+	}
+	if err := snaps.Pin(common.HexToHash("0x02")); err != nil {
+		t.Fatalf("failed to pin layer: %v", err)
+	}
+	ref := snaps.Snapshot(common.HexToHash("0x02")).(*diffLayer)
+
+	if err := snaps.Cap(common.HexToHash("0x04"), 0); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	if n := len(snaps.layers); n != 1 {
+		t.Errorf("layer count mismatch: have %d, want %d", n, 1)
+	}
+	if !ref.Stale() {
+		t.Errorf("pinned layer not flattened")
+	}
+	if err := snaps.Pin(common.HexToHash("0x04")); err != nil {
+		t.Errorf("pin not released: %v", err)
+	}
+	// A snapshot cache allowance should keep the pin alive beyond the default
+	base = &diskLayer{
+		diskdb: rawdb.NewMemoryDatabase(),
+		root:   common.HexToHash("0x01"),
+		cache:  fastcache.New(1024 * 500),
+	}
+	snaps = &Tree{
+		cache: 1,
+		layers: map[common.Hash]snapshot{
+			base.root: base,
+		},
+	}
+	for i := 2; i <= 4; i++ {
+		if err := snaps.Update(common.BigToHash(big.NewInt(int64(i))), common.BigToHash(big.NewInt(int64(i-1))), nil, accounts, nil); err != nil {
+			t.Fatalf("failed to create a diff layer: %v", err)
+		}
+	}
+	if err := snaps.Pin(common.HexToHash("0x02")); err != nil {
+		t.Fatalf("failed to pin layer: %v", err)
+	}
+	ref = snaps.Snapshot(common.HexToHash("0x02")).(*diffLayer)
+
+	if err := snaps.Cap(common.HexToHash("0x04"), 0); err != nil {
+		t.Fatalf("failed to cap snapshot tree: %v", err)
+	}
+	if ref.Stale() {
+		t.Errorf("pinned layer flattened within the cache allowance")
+	}
+	if err := snaps.Pin(common.HexToHash("0x04")); err != errSnapshotPinned {
+		t.Errorf("pin dropped within the cache allowance: %v", err)
+	}
+}
+
 // TestPostCapBasicDataAccess tests some functionality regarding capping/flattening.
 func TestPostCapBasicDataAccess(t *testing.T) {
 	// setAccount is a helper to construct a random account entry and assign it to
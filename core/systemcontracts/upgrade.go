@@ -39,10 +39,9 @@ var (
 	GenesisHash common.Hash
 )
 
-func init() {
-	// reserved for future use to instantiate Upgrade vars
-}
-
+// UpgradeBuildInSystemContract applies the system contract upgrades activating
+// at the given block: the PrimordialPulse deployment and any upgrades scheduled
+// in the Parlia config.
 func UpgradeBuildInSystemContract(config *params.ChainConfig, blockNumber *big.Int, statedb *state.StateDB) error {
 	if config == nil || blockNumber == nil || statedb == nil {
 		return nil
@@ -63,23 +62,61 @@ func UpgradeBuildInSystemContract(config *params.ChainConfig, blockNumber *big.I
 		if err != nil {
 			return err
 		}
-		applySystemContractUpgrade(&Upgrade{
+		if err := applySystemContractUpgrade(&Upgrade{
 			UpgradeName: "PrimordialPulse",
 			Configs:     configs,
-		}, blockNumber, statedb, logger)
+		}, blockNumber, statedb, logger); err != nil {
+			return err
+		}
 
 		// reset system contract balances to 0, in case of carry-over funds from ETH state
 		for _, cfg := range configs {
 			logger.Info(fmt.Sprintf("Resetting contract %s balance to 0", cfg.ContractAddr.String()))
 			statedb.SetBalance(cfg.ContractAddr, big.NewInt(0))
 		}
-	} else {
+	}
+
+	upgraded := config.IsPrimordialPulseBlock(blockNumber.Uint64())
+	if config.Parlia != nil {
+		for _, upgrade := range config.Parlia.Upgrades {
+			if upgrade.Block == nil || upgrade.Block.Cmp(blockNumber) != 0 {
+				continue
+			}
+			if err := applySystemContractUpgrade(scheduledUpgrade(upgrade), blockNumber, statedb, logger); err != nil {
+				return err
+			}
+			upgraded = true
+		}
+	}
+	if !upgraded {
 		logger.Debug("No system contract updates to apply", "height", blockNumber.String())
 	}
 
 	return nil
 }
 
+// scheduledUpgrade converts a system contract upgrade scheduled in the chain
+// config into an upgrade applicable to the state.
+func scheduledUpgrade(upgrade params.ContractUpgrade) *Upgrade {
+	cfg := &UpgradeConfig{
+		ContractAddr: common.HexToAddress(upgrade.Addr),
+		Code:         upgrade.Code,
+	}
+	if len(upgrade.Storage) > 0 {
+		storage := upgrade.Storage
+		cfg.AfterUpgrade = func(blockNumber *big.Int, contractAddr common.Address, statedb *state.StateDB) error {
+			for key, value := range storage {
+				statedb.SetState(contractAddr, key, value)
+			}
+			return nil
+		}
+	}
+	return &Upgrade{
+		UpgradeName: upgrade.Name,
+		Configs:     []*UpgradeConfig{cfg},
+	}
+}
+
 func primordialPulseUpgrade(config *params.ChainConfig) ([]*UpgradeConfig, error) {
 	if config.Parlia.SystemContracts == nil {
 		return nil, errors.New("Missing systemContracts in parlia config for PrimordialPulse fork")
@@ -96,10 +133,12 @@ func primordialPulseUpgrade(config *params.ChainConfig) ([]*UpgradeConfig, error
 	return upgrades, nil
 }
 
-func applySystemContractUpgrade(upgrade *Upgrade, blockNumber *big.Int, statedb *state.StateDB, logger log.Logger) {
+// applySystemContractUpgrade replaces the code of the upgraded contracts and
+// runs the upgrade hooks, failing on a malformed upgrade instead of panicking.
+func applySystemContractUpgrade(upgrade *Upgrade, blockNumber *big.Int, statedb *state.StateDB, logger log.Logger) error {
 	if upgrade == nil {
 		logger.Info("Empty upgrade config", "height", blockNumber.String())
-		return
+		return nil
 	}
 
 	logger.Info(fmt.Sprintf("Applying upgrade %s at height %d", upgrade.UpgradeName, blockNumber.Int64()))
@@ -109,21 +148,24 @@ func applySystemContractUpgrade(upgrade *Upgrade, blockNumber *big.Int, statedb
 		if cfg.BeforeUpgrade != nil {
 			err := cfg.BeforeUpgrade(blockNumber, cfg.ContractAddr, statedb)
 			if err != nil {
-				panic(fmt.Errorf("contract address: %s, execute beforeUpgrade error: %s", cfg.ContractAddr.String(), err.Error()))
+				return fmt.Errorf("upgrade %s, contract address: %s, execute beforeUpgrade error: %v", upgrade.UpgradeName, cfg.ContractAddr.String(), err)
 			}
 		}
 
-		newContractCode, err := hex.DecodeString(strings.TrimPrefix(cfg.Code, "0x"))
-		if err != nil {
-			panic(fmt.Errorf("failed to decode new contract code: %s", err.Error()))
+		if cfg.Code != "" {
+			newContractCode, err := hex.DecodeString(strings.TrimPrefix(cfg.Code, "0x"))
+			if err != nil {
+				return fmt.Errorf("upgrade %s, failed to decode new contract code: %v", upgrade.UpgradeName, err)
+			}
+			statedb.SetCode(cfg.ContractAddr, newContractCode)
 		}
-		statedb.SetCode(cfg.ContractAddr, newContractCode)
 
 		if cfg.AfterUpgrade != nil {
 			err := cfg.AfterUpgrade(blockNumber, cfg.ContractAddr, statedb)
 			if err != nil {
-				panic(fmt.Errorf("contract address: %s, execute afterUpgrade error: %s", cfg.ContractAddr.String(), err.Error()))
+				return fmt.Errorf("upgrade %s, contract address: %s, execute afterUpgrade error: %v", upgrade.UpgradeName, cfg.ContractAddr.String(), err)
 			}
 		}
 	}
+	return nil
 }
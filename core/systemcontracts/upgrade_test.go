@@ -0,0 +1,62 @@
+package systemcontracts
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestScheduledUpgrades(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+	addr := common.HexToAddress(SlashingContract)
+	config := &params.ChainConfig{
+		Parlia: &params.ParliaConfig{
+			Upgrades: []params.ContractUpgrade{
+				{Name: "Code", Block: big.NewInt(10), Addr: SlashingContract, Code: "0x6001"},
+				{Name: "Storage", Block: big.NewInt(20), Addr: SlashingContract, Storage: map[common.Hash]common.Hash{{0x01}: {0x02}}},
+			},
+		},
+	}
+	if err := UpgradeBuildInSystemContract(config, big.NewInt(9), statedb); err != nil {
+		t.Fatalf("failed to apply upgrades: %v", err)
+	}
+	if code := statedb.GetCode(addr); len(code) != 0 {
+		t.Fatalf("contract upgraded ahead of schedule: %x", code)
+	}
+	if err := UpgradeBuildInSystemContract(config, big.NewInt(10), statedb); err != nil {
+		t.Fatalf("failed to apply upgrades: %v", err)
+	}
+	if code := statedb.GetCode(addr); !bytes.Equal(code, []byte{0x60, 0x01}) {
+		t.Fatalf("contract code mismatch: have %x, want %x", code, []byte{0x60, 0x01})
+	}
+	// Storage only upgrades must leave the code intact
+	if err := UpgradeBuildInSystemContract(config, big.NewInt(20), statedb); err != nil {
+		t.Fatalf("failed to apply upgrades: %v", err)
+	}
+	if value := statedb.GetState(addr, common.Hash{0x01}); value != (common.Hash{0x02}) {
+		t.Fatalf("storage slot mismatch: have %x, want %x", value, common.Hash{0x02})
+	}
+	if code := statedb.GetCode(addr); !bytes.Equal(code, []byte{0x60, 0x01}) {
+		t.Fatalf("contract code overwritten by storage upgrade: %x", code)
+	}
+}
+
+// Tests that a malformed upgrade fails the block instead of crashing the node.
+func TestMalformedUpgrade(t *testing.T) {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+
+	config := &params.ChainConfig{
+		Parlia: &params.ParliaConfig{
+			Upgrades: []params.ContractUpgrade{{Name: "Broken", Block: big.NewInt(10), Addr: SlashingContract, Code: "0x60zz"}},
+		},
+	}
+	if err := UpgradeBuildInSystemContract(config, big.NewInt(10), statedb); err == nil {
+		t.Fatalf("malformed upgrade applied")
+	}
+}
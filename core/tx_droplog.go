@@ -0,0 +1,234 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// Reasons for a transaction to leave the pool without being included. Transactions
+// made stale by a block are not recorded, as they are mostly the included ones.
+const (
+	DropReplaced    = "replaced"           // Replaced by a transaction with the same nonce and a higher price
+	DropUnderpriced = "underpriced"        // Discarded to make room for better priced transactions
+	DropEvicted     = "evicted"            // Evicted to enforce the account or global slot limits
+	DropExpired     = "expired"            // Not executed in time
+	DropUnpayable   = "insufficient funds" // Sender unable to pay for the transaction anymore
+)
+
+// TxDrop records why a transaction left the pool.
+type TxDrop struct {
+	Hash        common.Hash // Hash of the dropped transaction
+	Reason      string      // Reason the transaction was dropped for
+	Replacement common.Hash // Hash of the replacing transaction, if any
+	Time        uint64      // Unix time the transaction was dropped at
+}
+
+// txDropLog is a bounded ring of the latest transactions dropped from the pool,
+// optionally backed by a file on disk to survive node restarts.
+//
+// The ring is guarded by the pool lock, while the file is only written by persist
+// under its own lock, so disk writes never stall the pool.
+type txDropLog struct {
+	limit int                     // Maximum number of drops retained
+	ring  []*TxDrop               // Retained drops, oldest overwritten first
+	next  int                     // Position of the next drop in the ring
+	index map[common.Hash]*TxDrop // Retained drops by transaction hash
+	queue []*TxDrop               // Drops recorded since the last flush
+
+	path    string        // Filesystem path to store the drops at (empty = memory only)
+	file    *os.File      // File to append new drops to
+	writer  *bufio.Writer // Buffered output stream of the file
+	recent  []*TxDrop     // Latest persisted drops, to regenerate the file from
+	written int           // Number of drops in the file since the last rotation
+	lock    sync.Mutex    // Protects the file fields above
+}
+
+// newTxDropLog creates a drop log retaining the given number of drops.
+func newTxDropLog(limit int, path string) *txDropLog {
+	return &txDropLog{
+		limit: limit,
+		ring:  make([]*TxDrop, limit),
+		index: make(map[common.Hash]*TxDrop),
+		path:  path,
+	}
+}
+
+// load restores the drops persisted on disk and reopens the file for appending.
+func (dl *txDropLog) load() error {
+	if dl.path == "" {
+		return nil
+	}
+	if input, err := os.Open(dl.path); err == nil {
+		stream := rlp.NewStream(bufio.NewReader(input), 0)
+		for {
+			drop := new(TxDrop)
+			if err = stream.Decode(drop); err != nil {
+				if err != io.EOF {
+					log.Warn("Failed to load dropped transaction log", "err", err)
+				}
+				break
+			}
+			dl.insert(drop)
+			dl.remember(drop)
+		}
+		input.Close()
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return dl.rotate()
+}
+
+// insert adds a drop to the ring, overwriting the oldest one when full.
+func (dl *txDropLog) insert(drop *TxDrop) {
+	if old := dl.ring[dl.next]; old != nil && dl.index[old.Hash] == old {
+		delete(dl.index, old.Hash)
+	}
+	dl.ring[dl.next] = drop
+	dl.next = (dl.next + 1) % dl.limit
+	dl.index[drop.Hash] = drop
+}
+
+// add records a transaction being dropped for the given reason.
+func (dl *txDropLog) add(tx *types.Transaction, reason string, replacement *types.Transaction) {
+	drop := &TxDrop{
+		Hash:   tx.Hash(),
+		Reason: reason,
+		Time:   uint64(time.Now().Unix()),
+	}
+	if replacement != nil {
+		drop.Replacement = replacement.Hash()
+	}
+	dl.insert(drop)
+	dl.queue = append(dl.queue, drop)
+}
+
+// remember tracks a persisted drop for regenerating the file, keeping only the
+// retained amount. The file lock must be held.
+func (dl *txDropLog) remember(drop *TxDrop) {
+	dl.recent = append(dl.recent, drop)
+	if len(dl.recent) > dl.limit {
+		dl.recent = dl.recent[len(dl.recent)-dl.limit:]
+	}
+}
+
+// persist appends flushed drops to the file on disk. It must be called without
+// holding the pool lock.
+func (dl *txDropLog) persist(drops []*TxDrop) {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	if dl.writer == nil {
+		return
+	}
+	for _, drop := range drops {
+		if err := rlp.Encode(dl.writer, drop); err != nil {
+			log.Warn("Failed to persist dropped transaction", "err", err)
+		}
+		dl.remember(drop)
+
+		// Regenerate the file once it holds twice the retained drops
+		if dl.written++; dl.written >= 2*dl.limit {
+			if err := dl.rotate(); err != nil {
+				log.Warn("Failed to rotate dropped transaction log", "err", err)
+				return
+			}
+		}
+	}
+	if err := dl.writer.Flush(); err != nil {
+		log.Warn("Failed to persist dropped transactions", "err", err)
+	}
+}
+
+// get retrieves the drop record of a transaction, if retained.
+func (dl *txDropLog) get(hash common.Hash) *TxDrop {
+	return dl.index[hash]
+}
+
+// flush returns the drops recorded since the last flush.
+func (dl *txDropLog) flush() []*TxDrop {
+	drops := dl.queue
+	dl.queue = nil
+	return drops
+}
+
+// rotate regenerates the file on disk based on the latest persisted drops. The
+// file lock must be held.
+func (dl *txDropLog) rotate() error {
+	if err := dl.closeFile(); err != nil {
+		return err
+	}
+	replacement, err := os.OpenFile(dl.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	buffer := bufio.NewWriter(replacement)
+	dl.written = 0
+	for _, drop := range dl.recent {
+		if err = rlp.Encode(buffer, drop); err != nil {
+			replacement.Close()
+			return err
+		}
+		dl.written++
+	}
+	if err = buffer.Flush(); err != nil {
+		replacement.Close()
+		return err
+	}
+	replacement.Close()
+
+	if err = os.Rename(dl.path+".new", dl.path); err != nil {
+		return err
+	}
+	sink, err := os.OpenFile(dl.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	dl.file, dl.writer = sink, bufio.NewWriter(sink)
+	return nil
+}
+
+// closeFile flushes and closes the file backing the drop log. The file lock
+// must be held.
+func (dl *txDropLog) closeFile() error {
+	if dl.file == nil {
+		return nil
+	}
+	err := dl.writer.Flush()
+	if cerr := dl.file.Close(); err == nil {
+		err = cerr
+	}
+	dl.file, dl.writer = nil, nil
+	return err
+}
+
+// close closes the file backing the drop log.
+func (dl *txDropLog) close() error {
+	dl.lock.Lock()
+	defer dl.lock.Unlock()
+
+	return dl.closeFile()
+}
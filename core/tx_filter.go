@@ -0,0 +1,220 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// senderRateWindow is the time window the per sender rate limit applies to.
+const senderRateWindow = time.Minute
+
+// TxPolicy is the configurable admission policy of the transaction pool, made
+// of the built-in filters.
+type TxPolicy struct {
+	Deny       []common.Address `json:"deny,omitempty"`      // Accounts whose transactions, sent or received, are rejected
+	Allow      []common.Address `json:"allow,omitempty"`     // If set, only transactions sent by these accounts are accepted
+	Selectors  []SelectorRule   `json:"selectors,omitempty"` // Contract method calls rejected
+	SenderRate uint64           `json:"senderRate"`          // Maximum remote transactions accepted per sender per minute (0 = unlimited)
+}
+
+// SelectorRule rejects the calls of a contract method, identified either by its
+// 4-byte selector in hex or by its signature, e.g. "transfer(address,uint256)".
+type SelectorRule struct {
+	Contract *common.Address `json:"contract,omitempty" toml:",omitempty"` // Contract the rule applies to (nil = any)
+	Selector string          `json:"selector"`
+}
+
+// Filters validates the policy and creates its admission filters.
+func (p *TxPolicy) Filters() ([]TxFilter, error) {
+	if p == nil {
+		return nil, nil
+	}
+	var filters []TxFilter
+	if len(p.Deny) > 0 || len(p.Allow) > 0 {
+		filters = append(filters, newAddressFilter(p.Deny, p.Allow))
+	}
+	if len(p.Selectors) > 0 {
+		filter, err := newSelectorFilter(p.Selectors)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	if p.SenderRate > 0 {
+		filters = append(filters, newRateFilter(p.SenderRate, senderRateWindow))
+	}
+	return filters, nil
+}
+
+// addressFilter rejects the transactions of deny listed accounts and, if an
+// allow list is set, the ones sent by accounts not on it.
+type addressFilter struct {
+	deny  map[common.Address]struct{}
+	allow map[common.Address]struct{}
+}
+
+func newAddressFilter(deny, allow []common.Address) *addressFilter {
+	filter := &addressFilter{
+		deny:  make(map[common.Address]struct{}),
+		allow: make(map[common.Address]struct{}),
+	}
+	for _, addr := range deny {
+		filter.deny[addr] = struct{}{}
+	}
+	for _, addr := range allow {
+		filter.allow[addr] = struct{}{}
+	}
+	return filter
+}
+
+func (f *addressFilter) FilterTx(tx *types.Transaction, from common.Address, local bool) error {
+	if _, ok := f.deny[from]; ok {
+		return fmt.Errorf("sender %v denied", from)
+	}
+	if to := tx.To(); to != nil {
+		if _, ok := f.deny[*to]; ok {
+			return fmt.Errorf("recipient %v denied", *to)
+		}
+	}
+	if len(f.allow) > 0 {
+		if _, ok := f.allow[from]; !ok {
+			return fmt.Errorf("sender %v not allowed", from)
+		}
+	}
+	return nil
+}
+
+// selectorFilter rejects the calls of contract methods.
+type selectorFilter struct {
+	rules []selectorMatch
+}
+
+// selectorMatch is a parsed selector rule.
+type selectorMatch struct {
+	contract *common.Address
+	selector []byte
+	name     string
+}
+
+// parseSelector converts a 4-byte selector in hex or a method signature into the
+// selector bytes. Signatures are parsed like the ones of the 4byte database of
+// the signer, so argument types are validated and canonicalized before deriving
+// the selector.
+func parseSelector(selector string) ([]byte, error) {
+	selector = strings.TrimSpace(selector)
+	if strings.HasPrefix(selector, "0x") {
+		id, err := hexutil.Decode(selector)
+		if err != nil || len(id) != 4 {
+			return nil, fmt.Errorf("invalid 4-byte selector %q", selector)
+		}
+		return id, nil
+	}
+	spec, err := abi.ParseSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid method signature %q: %v", selector, err)
+	}
+	parsed, err := abi.JSON(bytes.NewReader(spec))
+	if err != nil {
+		return nil, fmt.Errorf("invalid method signature %q: %v", selector, err)
+	}
+	for _, method := range parsed.Methods {
+		return method.ID, nil
+	}
+	return nil, fmt.Errorf("invalid method signature %q", selector)
+}
+
+func newSelectorFilter(rules []SelectorRule) (*selectorFilter, error) {
+	filter := new(selectorFilter)
+	for _, rule := range rules {
+		id, err := parseSelector(rule.Selector)
+		if err != nil {
+			return nil, err
+		}
+		filter.rules = append(filter.rules, selectorMatch{contract: rule.Contract, selector: id, name: rule.Selector})
+	}
+	return filter, nil
+}
+
+func (f *selectorFilter) FilterTx(tx *types.Transaction, from common.Address, local bool) error {
+	to, data := tx.To(), tx.Data()
+	if to == nil || len(data) < 4 {
+		return nil
+	}
+	for _, rule := range f.rules {
+		if rule.contract != nil && *rule.contract != *to {
+			continue
+		}
+		if bytes.Equal(rule.selector, data[:4]) {
+			return fmt.Errorf("method %s of %v denied", rule.name, *to)
+		}
+	}
+	return nil
+}
+
+// rateFilter caps the number of remote transactions accepted from a sender in
+// a fixed time window. Local transactions are exempt. The quota is only charged
+// for transactions which actually entered the pool.
+type rateFilter struct {
+	limit  uint64
+	window time.Duration
+
+	start  time.Time                 // Start of the current window
+	counts map[common.Address]uint64 // Transactions accepted per sender in the current window
+}
+
+func newRateFilter(limit uint64, window time.Duration) *rateFilter {
+	return &rateFilter{
+		limit:  limit,
+		window: window,
+		counts: make(map[common.Address]uint64),
+	}
+}
+
+// rotate starts a new window if the current one is over.
+func (f *rateFilter) rotate() {
+	if now := time.Now(); now.Sub(f.start) >= f.window {
+		f.start, f.counts = now, make(map[common.Address]uint64)
+	}
+}
+
+func (f *rateFilter) FilterTx(tx *types.Transaction, from common.Address, local bool) error {
+	if local {
+		return nil
+	}
+	f.rotate()
+	if f.counts[from] >= f.limit {
+		return fmt.Errorf("sender %v exceeded %d transactions per %v", from, f.limit, f.window)
+	}
+	return nil
+}
+
+func (f *rateFilter) TxAdmitted(tx *types.Transaction, from common.Address, local bool) {
+	if local {
+		return
+	}
+	f.rotate()
+	f.counts[from]++
+}
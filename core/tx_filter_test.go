@@ -0,0 +1,185 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func callTransaction(nonce uint64, to common.Address, data []byte, key *ecdsa.PrivateKey) *types.Transaction {
+	tx, _ := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(0), 100000, big.NewInt(1), data), types.HomesteadSigner{}, key)
+	return tx
+}
+
+// Tests that the selector rules accept hex selectors and method signatures.
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     string
+		fail     bool
+	}{
+		{selector: "0xa9059cbb", want: "0xa9059cbb"},
+		{selector: "transfer(address,uint256)", want: "0xa9059cbb"},
+		{selector: "0xa9059c", fail: true},
+		{selector: "transfer", fail: true},
+		{selector: "transfer(address, uint256)", fail: true},
+		{selector: "transfer(adress,uint256)", fail: true},
+		{selector: "totalSupply()", want: "0x18160ddd"},
+	}
+	for _, tt := range tests {
+		id, err := parseSelector(tt.selector)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("%q: expected error", tt.selector)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.selector, err)
+			continue
+		}
+		if have := common.Bytes2Hex(id); "0x"+have != tt.want {
+			t.Errorf("%q: selector mismatch: have 0x%s, want %s", tt.selector, have, tt.want)
+		}
+	}
+}
+
+// Tests that the admission policy of the pool is enforced and can be replaced
+// at runtime.
+func TestTransactionPolicy(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	var (
+		from     = crypto.PubkeyToAddress(key.PublicKey)
+		other, _ = crypto.GenerateKey()
+		token    = common.Address{0xcc}
+		denied   = common.Address{0xbb}
+		transfer = common.FromHex("0xa9059cbb0000")
+	)
+	testAddBalance(pool, from, big.NewInt(1000000000))
+	testAddBalance(pool, crypto.PubkeyToAddress(other.PublicKey), big.NewInt(1000000000))
+
+	if err := pool.SetPolicy(&TxPolicy{Selectors: []SelectorRule{{Selector: "bogus"}}}); err == nil {
+		t.Fatalf("invalid policy accepted")
+	}
+	err := pool.SetPolicy(&TxPolicy{
+		Deny:       []common.Address{denied},
+		Selectors:  []SelectorRule{{Contract: &token, Selector: "transfer(address,uint256)"}},
+		SenderRate: 2,
+	})
+	if err != nil {
+		t.Fatalf("failed to set policy: %v", err)
+	}
+	// Deny listed recipients and contract scoped selectors must be rejected
+	if err := pool.AddRemote(callTransaction(0, denied, nil, key)); !errors.Is(err, ErrTxFiltered) {
+		t.Fatalf("denied recipient: have %v, want %v", err, ErrTxFiltered)
+	}
+	if err := pool.AddRemote(callTransaction(0, token, transfer, key)); !errors.Is(err, ErrTxFiltered) {
+		t.Fatalf("denied selector: have %v, want %v", err, ErrTxFiltered)
+	}
+	// Rejected transactions don't count against the rate, other contracts are fine
+	if err := pool.AddRemote(callTransaction(0, common.Address{0xdd}, transfer, key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.AddRemote(callTransaction(1, common.Address{}, nil, key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.AddRemote(callTransaction(2, common.Address{}, nil, key)); !errors.Is(err, ErrTxFiltered) {
+		t.Fatalf("rate limited sender: have %v, want %v", err, ErrTxFiltered)
+	}
+	// Local transactions are exempt from the rate limit
+	if err := pool.AddLocal(callTransaction(2, common.Address{}, nil, key)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	// Custom filters are evaluated next to the policy
+	pool.AddFilter(filterFunc(func(tx *types.Transaction, from common.Address, local bool) error {
+		if tx.Nonce() == 0 {
+			return errors.New("nonce zero")
+		}
+		return nil
+	}))
+	if err := pool.AddRemote(callTransaction(0, common.Address{}, nil, other)); !errors.Is(err, ErrTxFiltered) {
+		t.Fatalf("custom filter: have %v, want %v", err, ErrTxFiltered)
+	}
+	// Replacing the policy with an allow list locks out everyone else
+	if err := pool.SetPolicy(&TxPolicy{Allow: []common.Address{from}}); err != nil {
+		t.Fatalf("failed to set policy: %v", err)
+	}
+	if err := pool.AddRemote(callTransaction(1, common.Address{}, nil, other)); !errors.Is(err, ErrTxFiltered) {
+		t.Fatalf("sender not allowed: have %v, want %v", err, ErrTxFiltered)
+	}
+	if err := pool.addRemoteSync(callTransaction(3, denied, nil, key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if pending, _ := pool.Stats(); pending != 4 {
+		t.Fatalf("pending transactions mismatch: have %d, want %d", pending, 4)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that the sender rate quota is only charged for transactions entering the
+// pool and that transactions reinjected after a reorg bypass the policy.
+func TestTransactionRateQuota(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	if err := pool.SetPolicy(&TxPolicy{SenderRate: 2}); err != nil {
+		t.Fatalf("failed to set policy: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(0, 100000, big.NewInt(2), key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	// A rejected replacement must not consume the quota
+	if err := pool.AddRemote(pricedTransaction(0, 100001, big.NewInt(2), key)); !errors.Is(err, ErrReplaceUnderpriced) {
+		t.Fatalf("underpriced replacement: have %v, want %v", err, ErrReplaceUnderpriced)
+	}
+	if err := pool.AddRemote(pricedTransaction(1, 100000, big.NewInt(2), key)); err != nil {
+		t.Fatalf("failed to add transaction: %v", err)
+	}
+	if err := pool.AddRemote(pricedTransaction(2, 100000, big.NewInt(2), key)); !errors.Is(err, ErrTxFiltered) {
+		t.Fatalf("rate limited sender: have %v, want %v", err, ErrTxFiltered)
+	}
+	// Reinjected transactions were admitted before, they must not be filtered
+	pool.mu.Lock()
+	_, err := pool.add(pricedTransaction(2, 100000, big.NewInt(2), key), false, true)
+	pool.mu.Unlock()
+	if err != nil {
+		t.Fatalf("failed to reinject transaction: %v", err)
+	}
+}
+
+// filterFunc adapts a function into a transaction filter.
+type filterFunc func(tx *types.Transaction, from common.Address, local bool) error
+
+func (f filterFunc) FilterTx(tx *types.Transaction, from common.Address, local bool) error {
+	return f(tx, from, local)
+}
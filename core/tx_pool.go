@@ -18,6 +18,7 @@ package core
 
 import (
 	"errors"
+	"fmt"
 	"math"
 	"math/big"
 	"sort"
@@ -85,6 +86,10 @@ var (
 	// than some meaningful limit a user might use. This is not a consensus error
 	// making the transaction invalid, rather a DOS protection.
 	ErrOversizedData = errors.New("oversized data")
+
+	// ErrTxFiltered is returned if a transaction is rejected by one of the admission
+	// filters of the pool.
+	ErrTxFiltered = errors.New("transaction rejected by txpool policy")
 )
 
 var (
@@ -115,6 +120,8 @@ var (
 	// throttleTxMeter counts how many transactions are rejected due to too-many-changes between
 	// txpool reorgs.
 	throttleTxMeter = metrics.NewRegisteredMeter("txpool/throttle", nil)
+	// filteredTxMeter counts how many transactions are rejected by the admission policy
+	filteredTxMeter = metrics.NewRegisteredMeter("txpool/filtered", nil)
 	// reorgDurationTimer measures how long time a txpool reorg takes.
 	reorgDurationTimer = metrics.NewRegisteredTimer("txpool/reorgtime", nil)
 	// dropBetweenReorgHistogram counts how many drops we experience between two reorg runs. It is expected
@@ -126,6 +133,9 @@ var (
 	localGauge   = metrics.NewRegisteredGauge("txpool/local", nil)
 	slotsGauge   = metrics.NewRegisteredGauge("txpool/slots", nil)
 
+	privateExpiredMeter  = metrics.NewRegisteredMeter("txpool/private/expired", nil)
+	privateFallbackMeter = metrics.NewRegisteredMeter("txpool/private/fallback", nil)
+
 	reheapTimer = metrics.NewRegisteredTimer("txpool/reheap", nil)
 )
 
@@ -165,6 +175,33 @@ type TxPoolConfig struct {
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
+
+	Snapshot       string        // Snapshot of remote transactions to survive node restarts (empty = disabled)
+	SnapshotMaxAge time.Duration // Maximum age of the snapshotted transactions to restore
+	SnapshotMaxTxs uint64        // Maximum number of snapshotted transactions to restore
+
+	DropHistory uint64 // Number of dropped transactions to remember the fate of (0 = disabled)
+	DropJournal string // Disk log of dropped transactions to survive node restarts (empty = memory only)
+
+	Policy *TxPolicy `toml:",omitempty"` // Admission policy rules to enforce on incoming transactions
+}
+
+// TxFilter is an admission rule of the transaction pool, evaluated for every
+// transaction after its basic validation. Filters are invoked with the pool lock
+// held, so they must not call back into the pool.
+type TxFilter interface {
+	// FilterTx returns an error if the transaction sent by the given account must
+	// be rejected. The local flag is set for transactions of local accounts.
+	FilterTx(tx *types.Transaction, from common.Address, local bool) error
+}
+
+// TxAdmitter is an optional extension of TxFilter for filters keeping track of
+// the admitted transactions, e.g. to enforce quotas. It's only notified of the
+// transactions which actually entered the pool.
+type TxAdmitter interface {
+	// TxAdmitted is called once a transaction which passed the filters has been
+	// inserted into the pool.
+	TxAdmitted(tx *types.Transaction, from common.Address, local bool)
 }
 
 // DefaultTxPoolConfig contains the default configurations for the transaction
@@ -182,6 +219,11 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	GlobalQueue:  1024,
 
 	Lifetime: 3 * time.Hour,
+
+	SnapshotMaxAge: 3 * time.Hour,
+	SnapshotMaxTxs: 4096 + 1024,
+
+	DropHistory: 16384,
 }
 
 // sanitize checks the provided user configurations and changes anything that's
@@ -236,6 +278,8 @@ type TxPool struct {
 	chain       blockChain
 	gasPrice    *big.Int
 	txFeed      event.Feed
+	privTxFeed  event.Feed
+	dropFeed    event.Feed
 	scope       event.SubscriptionScope
 	signer      types.Signer
 	mu          sync.RWMutex
@@ -248,14 +292,20 @@ type TxPool struct {
 	pendingNonces *txNoncer      // Pending state tracking virtual nonces
 	currentMaxGas uint64         // Current gas limit for transaction caps
 
-	locals  *accountSet // Set of local transaction to exempt from eviction rules
-	journal *txJournal  // Journal of local transaction to back up to disk
+	locals   *accountSet // Set of local transaction to exempt from eviction rules
+	journal  *txJournal  // Journal of local transaction to back up to disk
+	snapshot *txSnapshot // Snapshot of remote transactions to back up to disk
+	drops    *txDropLog  // Recently dropped transactions with the reasons
+
+	policy  []TxFilter // Admission filters built from the configured policy
+	filters []TxFilter // Admission filters plugged in by other subsystems
 
 	pending map[common.Address]*txList   // All currently processable transactions
 	queue   map[common.Address]*txList   // Queued but non-processable transactions
 	beats   map[common.Address]time.Time // Last heartbeat from each known account
 	all     *txLookup                    // All transactions to allow lookups
 	priced  *txPricedList                // All transactions sorted by price
+	private map[common.Hash]*privateTx   // Transactions never announced to the network
 
 	chainHeadCh     chan ChainHeadEvent
 	chainHeadSub    event.Subscription
@@ -274,8 +324,16 @@ type txpoolResetRequest struct {
 	oldHead, newHead *types.Header
 }
 
+// privateTx is the deadline of a private transaction, along with the action to
+// take once it passes.
+type privateTx struct {
+	deadline uint64 // Last block number the transaction is kept private for
+	fallback bool   // Whether to broadcast the transaction after the deadline, or drop it
+}
+
 // NewTxPool creates a new transaction pool to gather, sort and filter inbound
-// transactions from the network.
+// transactions from the network. The admission policy of the config must be
+// valid, the pool refuses to run without enforcing it.
 func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain blockChain) *TxPool {
 	// Sanitize the input to ensure no vulnerable gas prices are set
 	config = (&config).sanitize()
@@ -290,6 +348,7 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		queue:           make(map[common.Address]*txList),
 		beats:           make(map[common.Address]time.Time),
 		all:             newTxLookup(),
+		private:         make(map[common.Hash]*privateTx),
 		chainHeadCh:     make(chan ChainHeadEvent, chainHeadChanSize),
 		reqResetCh:      make(chan *txpoolResetRequest),
 		reqPromoteCh:    make(chan *accountSet),
@@ -304,6 +363,19 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		log.Info("Setting new local account", "address", addr)
 		pool.locals.add(addr)
 	}
+	if config.Policy != nil {
+		filters, err := config.Policy.Filters()
+		if err != nil {
+			log.Crit("Invalid txpool policy", "err", err)
+		}
+		pool.policy = filters
+	}
+	if config.DropHistory > 0 {
+		pool.drops = newTxDropLog(int(config.DropHistory), config.DropJournal)
+		if err := pool.drops.load(); err != nil {
+			log.Warn("Failed to load dropped transaction log", "err", err)
+		}
+	}
 	pool.priced = newTxPricedList(pool.all)
 	pool.reset(nil, chain.CurrentBlock().Header())
 
@@ -322,6 +394,16 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 			log.Warn("Failed to rotate transaction journal", "err", err)
 		}
 	}
+	// If the remote transaction snapshot is enabled, restore it from disk
+	if config.Snapshot != "" {
+		pool.snapshot = newTxSnapshot(config.Snapshot, config.SnapshotMaxAge, config.SnapshotMaxTxs)
+
+		if err := pool.snapshot.load(func(txs []*types.Transaction) []error {
+			return pool.addTxs(txs, false, true)
+		}); err != nil {
+			log.Warn("Failed to load transaction snapshot", "err", err)
+		}
+	}
 
 	// Subscribe events from blockchain and start the main event loop.
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
@@ -390,12 +472,15 @@ func (pool *TxPool) loop() {
 				if time.Since(pool.beats[addr]) > pool.config.Lifetime {
 					list := pool.queue[addr].Flatten()
 					for _, tx := range list {
+						pool.recordDrop(tx, DropExpired, nil)
 						pool.removeTx(tx.Hash(), true)
 					}
 					queuedEvictionMeter.Mark(int64(len(list)))
 				}
 			}
+			drops := pool.flushDrops()
 			pool.mu.Unlock()
+			pool.sendDrops(drops)
 
 		// Handle local transaction journal rotation
 		case <-journal.C:
@@ -406,6 +491,13 @@ func (pool *TxPool) loop() {
 				}
 				pool.mu.Unlock()
 			}
+			if pool.snapshot != nil {
+				pool.mu.RLock()
+				if err := pool.snapshot.write(pool.remote()); err != nil {
+					log.Warn("Failed to write remote tx snapshot", "err", err)
+				}
+				pool.mu.RUnlock()
+			}
 		}
 	}
 }
@@ -422,6 +514,21 @@ func (pool *TxPool) Stop() {
 	if pool.journal != nil {
 		pool.journal.close()
 	}
+	if pool.drops != nil {
+		pool.mu.Lock()
+		drops := pool.flushDrops()
+		pool.mu.Unlock()
+
+		pool.drops.persist(drops)
+		pool.drops.close()
+	}
+	if pool.snapshot != nil {
+		pool.mu.RLock()
+		if err := pool.snapshot.write(pool.remote()); err != nil {
+			log.Warn("Failed to write remote tx snapshot", "err", err)
+		}
+		pool.mu.RUnlock()
+	}
 	log.Info("Transaction pool stopped")
 }
 
@@ -431,6 +538,19 @@ func (pool *TxPool) SubscribeNewTxsEvent(ch chan<- NewTxsEvent) event.Subscripti
 	return pool.scope.Track(pool.txFeed.Subscribe(ch))
 }
 
+// SubscribePrivateTxsEvent registers a subscription of NewTxsEvent for the
+// private transactions, which are left out of the public feed to keep them
+// hidden from everything but the local miner.
+func (pool *TxPool) SubscribePrivateTxsEvent(ch chan<- NewTxsEvent) event.Subscription {
+	return pool.scope.Track(pool.privTxFeed.Subscribe(ch))
+}
+
+// SubscribeDroppedTxsEvent registers a subscription of DroppedTxsEvent and
+// starts sending event to the given channel.
+func (pool *TxPool) SubscribeDroppedTxsEvent(ch chan<- DroppedTxsEvent) event.Subscription {
+	return pool.scope.Track(pool.dropFeed.Subscribe(ch))
+}
+
 // GasPrice returns the current gas price enforced by the transaction pool.
 func (pool *TxPool) GasPrice() *big.Int {
 	pool.mu.RLock()
@@ -443,7 +563,6 @@ func (pool *TxPool) GasPrice() *big.Int {
 // new transaction, and drops all transactions below this threshold.
 func (pool *TxPool) SetGasPrice(price *big.Int) {
 	pool.mu.Lock()
-	defer pool.mu.Unlock()
 
 	old := pool.gasPrice
 	pool.gasPrice = price
@@ -452,10 +571,14 @@ func (pool *TxPool) SetGasPrice(price *big.Int) {
 		// pool.priced is sorted by GasFeeCap, so we have to iterate through pool.all instead
 		drop := pool.all.RemotesBelowTip(price)
 		for _, tx := range drop {
+			pool.recordDrop(tx, DropUnderpriced, nil)
 			pool.removeTx(tx.Hash(), false)
 		}
 		pool.priced.Removed(len(drop))
 	}
+	drops := pool.flushDrops()
+	pool.mu.Unlock()
+	pool.sendDrops(drops)
 
 	log.Info("Transaction pool price threshold updated", "price", price)
 }
@@ -494,38 +617,59 @@ func (pool *TxPool) stats() (int, int) {
 
 // Content retrieves the data content of the transaction pool, returning all the
 // pending as well as queued transactions, grouped by account and sorted by nonce.
+// Private transactions are left out.
 func (pool *TxPool) Content() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
 	pool.mu.Lock()
 	defer pool.mu.Unlock()
 
 	pending := make(map[common.Address]types.Transactions)
 	for addr, list := range pool.pending {
-		pending[addr] = list.Flatten()
+		if txs := pool.public(list.Flatten()); len(txs) > 0 {
+			pending[addr] = txs
+		}
 	}
 	queued := make(map[common.Address]types.Transactions)
 	for addr, list := range pool.queue {
-		queued[addr] = list.Flatten()
+		if txs := pool.public(list.Flatten()); len(txs) > 0 {
+			queued[addr] = txs
+		}
 	}
 	return pending, queued
 }
 
 // ContentFrom retrieves the data content of the transaction pool, returning the
 // pending as well as queued transactions of this address, grouped by nonce.
+// Private transactions are left out.
 func (pool *TxPool) ContentFrom(addr common.Address) (types.Transactions, types.Transactions) {
 	pool.mu.RLock()
 	defer pool.mu.RUnlock()
 
 	var pending types.Transactions
 	if list, ok := pool.pending[addr]; ok {
-		pending = list.Flatten()
+		pending = pool.public(list.Flatten())
 	}
 	var queued types.Transactions
 	if list, ok := pool.queue[addr]; ok {
-		queued = list.Flatten()
+		queued = pool.public(list.Flatten())
 	}
 	return pending, queued
 }
 
+// public filters the private transactions out of the given list, which is
+// modified in place. The transaction pool lock must be held.
+func (pool *TxPool) public(txs types.Transactions) types.Transactions {
+	if len(pool.private) == 0 {
+		return txs
+	}
+	public := txs[:0]
+	for _, tx := range txs {
+		if _, ok := pool.private[tx.Hash()]; !ok {
+			public = append(public, tx)
+		}
+	}
+	return public
+}
+
 // Pending retrieves all currently processable transactions, grouped by origin
 // account and sorted by nonce. The returned transaction set is a copy and can be
 // freely modified by calling code.
@@ -581,6 +725,29 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 	return txs
 }
 
+// remote retrieves all currently known remote transactions, grouped by origin
+// account and sorted by nonce. Private transactions are left out, they must not
+// be reinjected as regular ones. The returned transaction set is a copy and can
+// be freely modified by calling code.
+func (pool *TxPool) remote() map[common.Address]types.Transactions {
+	txs := make(map[common.Address]types.Transactions)
+	collect := func(lists map[common.Address]*txList) {
+		for addr, list := range lists {
+			if pool.locals.contains(addr) {
+				continue
+			}
+			for _, tx := range list.Flatten() {
+				if _, ok := pool.private[tx.Hash()]; !ok {
+					txs[addr] = append(txs[addr], tx)
+				}
+			}
+		}
+	}
+	collect(pool.pending)
+	collect(pool.queue)
+	return txs
+}
+
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
@@ -645,6 +812,54 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 	return nil
 }
 
+// filterTx enforces the admission policy on a transaction which passed the basic
+// validation.
+func (pool *TxPool) filterTx(tx *types.Transaction, from common.Address, local bool) error {
+	for _, filters := range [][]TxFilter{pool.policy, pool.filters} {
+		for _, filter := range filters {
+			if err := filter.FilterTx(tx, from, local); err != nil {
+				filteredTxMeter.Mark(1)
+				return fmt.Errorf("%w: %v", ErrTxFiltered, err)
+			}
+		}
+	}
+	return nil
+}
+
+// admitTx notifies the admission filters tracking the accepted transactions.
+func (pool *TxPool) admitTx(tx *types.Transaction, from common.Address, local bool) {
+	for _, filters := range [][]TxFilter{pool.policy, pool.filters} {
+		for _, filter := range filters {
+			if admitter, ok := filter.(TxAdmitter); ok {
+				admitter.TxAdmitted(tx, from, local)
+			}
+		}
+	}
+}
+
+// SetPolicy replaces the admission policy of the pool. The new policy applies to
+// the transactions entering the pool from now on.
+func (pool *TxPool) SetPolicy(policy *TxPolicy) error {
+	filters, err := policy.Filters()
+	if err != nil {
+		return err
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.policy = filters
+	return nil
+}
+
+// AddFilter plugs a custom admission filter into the pool, evaluated after the
+// ones of the configured policy.
+func (pool *TxPool) AddFilter(filter TxFilter) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	pool.filters = append(pool.filters, filter)
+}
+
 // add validates a transaction and inserts it into the non-executable queue for later
 // pending promotion and execution. If the transaction is a replacement for an already
 // pending or queued one, it overwrites the previous transaction if its price is higher.
@@ -652,7 +867,10 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 // If a newly added transaction is marked as local, its sending account will be
 // be added to the allowlist, preventing any associated transaction from being dropped
 // out of the pool due to pricing constraints.
-func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err error) {
+//
+// Transactions reinjected after a reorg bypass the admission policy, they were
+// already admitted once.
+func (pool *TxPool) add(tx *types.Transaction, local bool, reinject bool) (replaced bool, err error) {
 	// If the transaction is already known, discard it
 	hash := tx.Hash()
 	if pool.all.Get(hash) != nil {
@@ -670,6 +888,13 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		invalidTxMeter.Mark(1)
 		return false, err
 	}
+	from, _ := types.Sender(pool.signer, tx) // already validated
+	if !reinject {
+		if err := pool.filterTx(tx, from, isLocal); err != nil {
+			log.Trace("Discarding filtered transaction", "hash", hash, "err", err)
+			return false, err
+		}
+	}
 	// If the transaction pool is full, discard underpriced transactions
 	if uint64(pool.all.Slots()+numSlots(tx)) > pool.config.GlobalSlots+pool.config.GlobalQueue {
 		// If the new transaction is underpriced, don't accept it
@@ -704,11 +929,11 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		for _, tx := range drop {
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "gasTipCap", tx.GasTipCap(), "gasFeeCap", tx.GasFeeCap())
 			underpricedTxMeter.Mark(1)
+			pool.recordDrop(tx, DropUnderpriced, nil)
 			pool.removeTx(tx.Hash(), false)
 		}
 	}
 	// Try to replace an existing transaction in the pending pool
-	from, _ := types.Sender(pool.signer, tx) // already validated
 	if list := pool.pending[from]; list != nil && list.Overlaps(tx) {
 		// Nonce already pending, check if required price bump is met
 		inserted, old := list.Add(tx, pool.config.PriceBump)
@@ -721,6 +946,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 			pool.all.Remove(old.Hash())
 			pool.priced.Removed(1)
 			pendingReplaceMeter.Mark(1)
+			pool.recordDrop(old, DropReplaced, tx)
 		}
 		pool.all.Add(tx, isLocal)
 		pool.priced.Put(tx, isLocal)
@@ -730,6 +956,9 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 
 		// Successful promotion, bump the heartbeat
 		pool.beats[from] = time.Now()
+		if !reinject {
+			pool.admitTx(tx, from, isLocal)
+		}
 		return old != nil, nil
 	}
 	// New transaction isn't replacing a pending one, push into queue
@@ -747,7 +976,9 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (replaced bool, err e
 		localGauge.Inc(1)
 	}
 	pool.journalTx(from, tx)
-
+	if !reinject {
+		pool.admitTx(tx, from, isLocal)
+	}
 	log.Trace("Pooled new future transaction", "hash", hash, "from", from, "to", tx.To())
 	return replaced, nil
 }
@@ -772,6 +1003,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction, local boo
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		queuedReplaceMeter.Mark(1)
+		pool.recordDrop(old, DropReplaced, tx)
 	} else {
 		// Nothing was replaced, bump the queued counter
 		queuedGauge.Inc(1)
@@ -821,6 +1053,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.all.Remove(hash)
 		pool.priced.Removed(1)
 		pendingDiscardMeter.Mark(1)
+		pool.recordDrop(tx, DropReplaced, list.txs.Get(tx.Nonce()))
 		return false
 	}
 	// Otherwise discard any previous transaction and mark this
@@ -828,6 +1061,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 		pool.all.Remove(old.Hash())
 		pool.priced.Removed(1)
 		pendingReplaceMeter.Mark(1)
+		pool.recordDrop(old, DropReplaced, tx)
 	} else {
 		// Nothing was replaced, bump the pending counter
 		pendingGauge.Inc(1)
@@ -885,6 +1119,84 @@ func (pool *TxPool) AddRemote(tx *types.Transaction) error {
 	return errs[0]
 }
 
+// AddPrivate enqueues a single transaction into the pool if it is valid, keeping
+// it private: it's available to the local miner up to and including the given
+// block number, but never announced to the network. Once the deadline passes,
+// the transaction is released for broadcasting if fallback is set, otherwise
+// it's dropped. Full pricing constraints apply, just like for remote ones.
+func (pool *TxPool) AddPrivate(tx *types.Transaction, deadline uint64, fallback bool) error {
+	hash := tx.Hash()
+
+	pool.mu.Lock()
+	if pool.all.Get(hash) != nil {
+		pool.mu.Unlock()
+		knownTxMeter.Mark(1)
+		return ErrAlreadyKnown
+	}
+	pool.private[hash] = &privateTx{deadline: deadline, fallback: fallback}
+	pool.mu.Unlock()
+
+	if err := pool.addTxs([]*types.Transaction{tx}, false, true)[0]; err != nil {
+		pool.mu.Lock()
+		delete(pool.private, hash)
+		pool.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// IsPrivate returns an indicator whether the transaction with the given hash is
+// kept private, so it must not be announced to the network.
+func (pool *TxPool) IsPrivate(hash common.Hash) bool {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	_, ok := pool.private[hash]
+	return ok
+}
+
+// PrivateCount returns the number of pending and queued transactions which are
+// kept private.
+func (pool *TxPool) PrivateCount() int {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	return len(pool.private)
+}
+
+// expirePrivate releases the private transactions whose deadline passed with the
+// given head, dropping them or returning the executable ones to be broadcast.
+// Records of transactions no longer in the pool are cleaned up.
+// The transaction pool lock must be held.
+func (pool *TxPool) expirePrivate(head uint64) types.Transactions {
+	var released types.Transactions
+	for hash, private := range pool.private {
+		tx := pool.all.Get(hash)
+		if tx == nil {
+			delete(pool.private, hash)
+			continue
+		}
+		if head < private.deadline {
+			continue
+		}
+		if !private.fallback {
+			log.Trace("Dropping expired private transaction", "hash", hash, "deadline", private.deadline)
+			pool.removeTx(hash, true)
+			delete(pool.private, hash)
+			privateExpiredMeter.Mark(1)
+			continue
+		}
+		// Queued transactions get announced once promoted
+		delete(pool.private, hash)
+		privateFallbackMeter.Mark(1)
+		from, _ := types.Sender(pool.signer, tx) // already validated
+		if list := pool.pending[from]; list != nil && list.Overlaps(tx) {
+			released = append(released, tx)
+		}
+	}
+	return released
+}
+
 // addTxs attempts to queue a batch of transactions if they are valid.
 func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 	// Filter out known ones without obtaining the pool lock or recovering signatures
@@ -917,7 +1229,7 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 
 	// Process all the new transaction and merge any errors into the original slice
 	pool.mu.Lock()
-	newErrs, dirtyAddrs := pool.addTxsLocked(news, local)
+	newErrs, dirtyAddrs := pool.addTxsLocked(news, local, false)
 	pool.mu.Unlock()
 
 	var nilSlot = 0
@@ -938,11 +1250,11 @@ func (pool *TxPool) addTxs(txs []*types.Transaction, local, sync bool) []error {
 
 // addTxsLocked attempts to queue a batch of transactions if they are valid.
 // The transaction pool lock must be held.
-func (pool *TxPool) addTxsLocked(txs []*types.Transaction, local bool) ([]error, *accountSet) {
+func (pool *TxPool) addTxsLocked(txs []*types.Transaction, local bool, reinject bool) ([]error, *accountSet) {
 	dirty := newAccountSet(pool.signer)
 	errs := make([]error, len(txs))
 	for i, tx := range txs {
-		replaced, err := pool.add(tx, local)
+		replaced, err := pool.add(tx, local, reinject)
 		errs[i] = err
 		if err == nil && !replaced {
 			dirty.addTx(tx)
@@ -976,7 +1288,16 @@ func (pool *TxPool) Status(hashes []common.Hash) []TxStatus {
 }
 
 // Get returns a transaction if it is contained in the pool and nil otherwise.
+// Private transactions are not returned, they are only available to the local
+// miner through Pending.
 func (pool *TxPool) Get(hash common.Hash) *types.Transaction {
+	pool.mu.RLock()
+	_, private := pool.private[hash]
+	pool.mu.RUnlock()
+
+	if private {
+		return nil
+	}
 	return pool.all.Get(hash)
 }
 
@@ -986,6 +1307,54 @@ func (pool *TxPool) Has(hash common.Hash) bool {
 	return pool.all.Get(hash) != nil
 }
 
+// Dropped returns the reason a transaction was dropped from the pool for, or
+// nil if the transaction is unknown or its record was already recycled.
+func (pool *TxPool) Dropped(hash common.Hash) *TxDrop {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	if pool.drops == nil {
+		return nil
+	}
+	return pool.drops.get(hash)
+}
+
+// recordDrop remembers the reason a transaction is dropped from the pool for.
+// Private transactions are not recorded, neither as dropped nor as replacement,
+// since the records are public. The transaction pool lock must be held.
+func (pool *TxPool) recordDrop(tx *types.Transaction, reason string, replacement *types.Transaction) {
+	if pool.drops == nil {
+		return
+	}
+	if _, ok := pool.private[tx.Hash()]; ok {
+		return
+	}
+	if replacement != nil {
+		if _, ok := pool.private[replacement.Hash()]; ok {
+			replacement = nil
+		}
+	}
+	pool.drops.add(tx, reason, replacement)
+}
+
+// flushDrops returns the drops recorded since the last flush, to be announced
+// once the pool lock is released. The transaction pool lock must be held.
+func (pool *TxPool) flushDrops() []*TxDrop {
+	if pool.drops == nil {
+		return nil
+	}
+	return pool.drops.flush()
+}
+
+// sendDrops persists the dropped transactions and notifies the subscribers. It
+// must be called without holding the pool lock.
+func (pool *TxPool) sendDrops(drops []*TxDrop) {
+	if len(drops) > 0 {
+		pool.drops.persist(drops)
+		pool.dropFeed.Send(DroppedTxsEvent{drops})
+	}
+}
+
 // removeTx removes a single transaction from the queue, moving all subsequent
 // transactions back to the future queue.
 func (pool *TxPool) removeTx(hash common.Hash, outofbound bool) {
@@ -1176,8 +1545,12 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 	// If a new block appeared, validate the pool of pending transactions. This will
 	// remove any transaction that has been included in the block or was invalidated
 	// because of another transaction (e.g. higher gas price).
+	var released types.Transactions
 	if reset != nil {
 		pool.demoteUnexecutables()
+		if reset.newHead != nil {
+			released = pool.expirePrivate(reset.newHead.Number.Uint64())
+		}
 		if reset.newHead != nil && pool.chainconfig.IsLondon(new(big.Int).Add(reset.newHead.Number, big.NewInt(1))) {
 			pendingBaseFee := misc.CalcBaseFee(pool.chainconfig, reset.newHead)
 			pool.priced.SetBaseFee(pendingBaseFee)
@@ -1196,9 +1569,13 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 
 	dropBetweenReorgHistogram.Update(int64(pool.changesSinceReorg))
 	pool.changesSinceReorg = 0 // Reset change counter
+	drops := pool.flushDrops()
 	pool.mu.Unlock()
 
-	// Notify subsystems for newly added transactions
+	pool.sendDrops(drops)
+
+	// Notify subsystems for newly added transactions and the released private ones
+	promoted = append(promoted, released...)
 	for _, tx := range promoted {
 		addr, _ := types.Sender(pool.signer, tx)
 		if _, ok := events[addr]; !ok {
@@ -1207,11 +1584,25 @@ func (pool *TxPool) runReorg(done chan struct{}, reset *txpoolResetRequest, dirt
 		events[addr].Put(tx)
 	}
 	if len(events) > 0 {
-		var txs []*types.Transaction
+		var txs, private []*types.Transaction
+		pool.mu.RLock()
 		for _, set := range events {
-			txs = append(txs, set.Flatten()...)
+			for _, tx := range set.Flatten() {
+				if _, ok := pool.private[tx.Hash()]; ok {
+					private = append(private, tx)
+				} else {
+					txs = append(txs, tx)
+				}
+			}
+		}
+		pool.mu.RUnlock()
+
+		if len(txs) > 0 {
+			pool.txFeed.Send(NewTxsEvent{txs})
+		}
+		if len(private) > 0 {
+			pool.privTxFeed.Send(NewTxsEvent{private})
 		}
-		pool.txFeed.Send(NewTxsEvent{txs})
 	}
 }
 
@@ -1297,7 +1688,7 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// Inject any transactions discarded due to reorgs
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
 	senderCacher.recover(pool.signer, reinject)
-	pool.addTxsLocked(reinject, false)
+	pool.addTxsLocked(reinject, false, true)
 
 	// Update all fork indicator by next pending block number.
 	next := new(big.Int).Add(newHead.Number, big.NewInt(1))
@@ -1331,6 +1722,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 		for _, tx := range drops {
 			hash := tx.Hash()
 			pool.all.Remove(hash)
+			pool.recordDrop(tx, DropUnpayable, nil)
 		}
 		log.Trace("Removed unpayable queued transactions", "count", len(drops))
 		queuedNofundsMeter.Mark(int64(len(drops)))
@@ -1353,6 +1745,7 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) []*types.Trans
 			for _, tx := range caps {
 				hash := tx.Hash()
 				pool.all.Remove(hash)
+				pool.recordDrop(tx, DropEvicted, nil)
 				log.Trace("Removed cap-exceeding queued transaction", "hash", hash)
 			}
 			queuedRateLimitMeter.Mark(int64(len(caps)))
@@ -1415,6 +1808,7 @@ func (pool *TxPool) truncatePending() {
 						// Drop the transaction from the global pools too
 						hash := tx.Hash()
 						pool.all.Remove(hash)
+						pool.recordDrop(tx, DropEvicted, nil)
 
 						// Update the account nonce to the dropped transaction
 						pool.pendingNonces.setIfLower(offenders[i], tx.Nonce())
@@ -1442,6 +1836,7 @@ func (pool *TxPool) truncatePending() {
 					// Drop the transaction from the global pools too
 					hash := tx.Hash()
 					pool.all.Remove(hash)
+					pool.recordDrop(tx, DropEvicted, nil)
 
 					// Update the account nonce to the dropped transaction
 					pool.pendingNonces.setIfLower(addr, tx.Nonce())
@@ -1488,6 +1883,7 @@ func (pool *TxPool) truncateQueue() {
 		// Drop all transactions if they are less than the overflow
 		if size := uint64(list.Len()); size <= drop {
 			for _, tx := range list.Flatten() {
+				pool.recordDrop(tx, DropEvicted, nil)
 				pool.removeTx(tx.Hash(), true)
 			}
 			drop -= size
@@ -1497,6 +1893,7 @@ func (pool *TxPool) truncateQueue() {
 		// Otherwise drop only last few transactions
 		txs := list.Flatten()
 		for i := len(txs) - 1; i >= 0 && drop > 0; i-- {
+			pool.recordDrop(txs[i], DropEvicted, nil)
 			pool.removeTx(txs[i].Hash(), true)
 			drop--
 			queuedRateLimitMeter.Mark(1)
@@ -1529,6 +1926,7 @@ func (pool *TxPool) demoteUnexecutables() {
 			hash := tx.Hash()
 			log.Trace("Removed unpayable pending transaction", "hash", hash)
 			pool.all.Remove(hash)
+			pool.recordDrop(tx, DropUnpayable, nil)
 		}
 		pendingNofundsMeter.Mark(int64(len(drops)))
 
@@ -24,6 +24,7 @@ import (
 	"math/big"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -431,14 +432,14 @@ func TestTransactionChainFork(t *testing.T) {
 	resetState()
 
 	tx := transaction(0, 100000, key)
-	if _, err := pool.add(tx, false); err != nil {
+	if _, err := pool.add(tx, false, false); err != nil {
 		t.Error("didn't expect error", err)
 	}
 	pool.removeTx(tx.Hash(), true)
 
 	// reset the pool's internal state
 	resetState()
-	if _, err := pool.add(tx, false); err != nil {
+	if _, err := pool.add(tx, false, false); err != nil {
 		t.Error("didn't expect error", err)
 	}
 }
@@ -465,10 +466,10 @@ func TestTransactionDoubleNonce(t *testing.T) {
 	tx3, _ := types.SignTx(types.NewTransaction(0, common.Address{}, big.NewInt(100), 1000000, big.NewInt(1), nil), signer, key)
 
 	// Add the first two transaction, ensure higher priced stays only
-	if replace, err := pool.add(tx1, false); err != nil || replace {
+	if replace, err := pool.add(tx1, false, false); err != nil || replace {
 		t.Errorf("first transaction insert failed (%v) or reported replacement (%v)", err, replace)
 	}
-	if replace, err := pool.add(tx2, false); err != nil || !replace {
+	if replace, err := pool.add(tx2, false, false); err != nil || !replace {
 		t.Errorf("second transaction insert failed (%v) or not reported replacement (%v)", err, replace)
 	}
 	<-pool.requestPromoteExecutables(newAccountSet(signer, addr))
@@ -480,7 +481,7 @@ func TestTransactionDoubleNonce(t *testing.T) {
 	}
 
 	// Add the third transaction and ensure it's not saved (smaller price)
-	pool.add(tx3, false)
+	pool.add(tx3, false, false)
 	<-pool.requestPromoteExecutables(newAccountSet(signer, addr))
 	if pool.pending[addr].Len() != 1 {
 		t.Error("expected 1 pending transactions, got", pool.pending[addr].Len())
@@ -503,7 +504,7 @@ func TestTransactionMissingNonce(t *testing.T) {
 	addr := crypto.PubkeyToAddress(key.PublicKey)
 	testAddBalance(pool, addr, big.NewInt(100000000000000))
 	tx := transaction(1, 100000, key)
-	if _, err := pool.add(tx, false); err != nil {
+	if _, err := pool.add(tx, false, false); err != nil {
 		t.Error("didn't expect error", err)
 	}
 	if len(pool.pending) != 0 {
@@ -2347,6 +2348,236 @@ func testTransactionJournaling(t *testing.T, nolocals bool) {
 	pool.Stop()
 }
 
+// Tests that the remote transactions of the pool are snapshotted on shutdown and
+// restored on startup, preserving their arrival time and honouring the limits.
+func TestTransactionSnapshot(t *testing.T) {
+	t.Parallel()
+
+	// Create a temporary path for the snapshot
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{1000000, statedb, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.Snapshot = filepath.Join(dir, "remotes.rlp")
+	config.SnapshotMaxAge = time.Hour
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+	var (
+		local, _   = crypto.GenerateKey()
+		remote, _  = crypto.GenerateKey()
+		stale, _   = crypto.GenerateKey()
+		private, _ = crypto.GenerateKey()
+	)
+	for _, key := range []*ecdsa.PrivateKey{local, remote, stale, private} {
+		testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+	}
+	// Add pending and queued remotes, plus transactions which must not be restored
+	arrival := time.Now().Add(-time.Minute)
+	for _, nonce := range []uint64{0, 1, 3} {
+		tx := transaction(nonce, 100000, remote)
+		tx.SetTime(arrival)
+		if err := pool.addRemoteSync(tx); err != nil {
+			t.Fatalf("failed to add remote transaction: %v", err)
+		}
+	}
+	old := transaction(0, 100000, stale)
+	old.SetTime(time.Now().Add(-2 * time.Hour))
+	if err := pool.addRemoteSync(old); err != nil {
+		t.Fatalf("failed to add stale transaction: %v", err)
+	}
+	if err := pool.AddLocal(transaction(0, 100000, local)); err != nil {
+		t.Fatalf("failed to add local transaction: %v", err)
+	}
+	if err := pool.AddPrivate(transaction(0, 100000, private), 100, false); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if pending, queued := pool.Stats(); pending != 5 || queued != 1 {
+		t.Fatalf("transactions mismatched: have %d/%d, want %d/%d", pending, queued, 5, 1)
+	}
+	pool.Stop()
+
+	// Restart the pool and ensure only the recent remotes are restored
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	if pending, queued := pool.Stats(); pending != 2 || queued != 1 {
+		t.Fatalf("transactions mismatched: have %d/%d, want %d/%d", pending, queued, 2, 1)
+	}
+	for _, nonce := range []uint64{0, 1, 3} {
+		tx := pool.Get(transaction(nonce, 100000, remote).Hash())
+		if tx == nil {
+			t.Fatalf("transaction %d missing", nonce)
+		}
+		if !tx.Time().Equal(arrival) {
+			t.Errorf("transaction %d arrival time mismatch: have %v, want %v", nonce, tx.Time(), arrival)
+		}
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Include the first remote, restart with a size limit and ensure the restored
+	// transactions are revalidated and capped
+	pool.Stop()
+	statedb.SetNonce(crypto.PubkeyToAddress(remote.PublicKey), 1)
+
+	config.SnapshotMaxTxs = 2
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	if pending, queued := pool.Stats(); pending != 1 || queued != 0 {
+		t.Fatalf("transactions mismatched: have %d/%d, want %d/%d", pending, queued, 1, 0)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that transactions leaving the pool without being included are recorded
+// with the reason, announced to subscribers and persisted across restarts.
+func TestTransactionDropTracking(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	blockchain := &testBlockChain{1000000, statedb, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.DropJournal = filepath.Join(dir, "dropped.rlp")
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+	events := make(chan DroppedTxsEvent, 16)
+	sub := pool.SubscribeDroppedTxsEvent(events)
+	defer sub.Unsubscribe()
+
+	key, _ := crypto.GenerateKey()
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000000))
+
+	// Replace a pending transaction and price out another one
+	var (
+		original    = pricedTransaction(0, 100000, big.NewInt(1), key)
+		replacement = pricedTransaction(0, 100000, big.NewInt(2), key)
+		cheap       = pricedTransaction(1, 100000, big.NewInt(2), key)
+	)
+	for _, tx := range []*types.Transaction{original, replacement, cheap} {
+		if err := pool.addRemoteSync(tx); err != nil {
+			t.Fatalf("failed to add transaction: %v", err)
+		}
+	}
+	pool.SetGasPrice(big.NewInt(3))
+
+	want := map[common.Hash]TxDrop{
+		original.Hash():    {Hash: original.Hash(), Reason: DropReplaced, Replacement: replacement.Hash()},
+		replacement.Hash(): {Hash: replacement.Hash(), Reason: DropUnderpriced},
+		cheap.Hash():       {Hash: cheap.Hash(), Reason: DropUnderpriced},
+	}
+	check := func(pool *TxPool) {
+		for hash, want := range want {
+			drop := pool.Dropped(hash)
+			if drop == nil {
+				t.Fatalf("drop of %x not recorded", hash)
+			}
+			if drop.Reason != want.Reason || drop.Replacement != want.Replacement {
+				t.Errorf("drop of %x mismatch: have %s/%x, want %s/%x", hash, drop.Reason, drop.Replacement, want.Reason, want.Replacement)
+			}
+		}
+	}
+	check(pool)
+
+	announced := make(map[common.Hash]bool)
+	for len(announced) < len(want) {
+		select {
+		case ev := <-events:
+			for _, drop := range ev.Drops {
+				announced[drop.Hash] = true
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("drop events missing: have %d, want %d", len(announced), len(want))
+		}
+	}
+	// Restart the pool and ensure the records survived
+	pool.Stop()
+	pool = NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	check(pool)
+	if drop := pool.Dropped(common.Hash{1}); drop != nil {
+		t.Fatalf("unexpected drop record for unknown transaction: %v", drop)
+	}
+}
+
+// Tests that the dropped transaction log retains only the latest drops.
+func TestTransactionDropLogLimit(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	dl := newTxDropLog(2, "")
+
+	txs := []*types.Transaction{transaction(0, 100000, key), transaction(1, 100000, key), transaction(2, 100000, key)}
+	for _, tx := range txs {
+		dl.add(tx, DropEvicted, nil)
+	}
+	if drop := dl.get(txs[0].Hash()); drop != nil {
+		t.Errorf("oldest drop retained: %v", drop)
+	}
+	for _, tx := range txs[1:] {
+		if drop := dl.get(tx.Hash()); drop == nil {
+			t.Errorf("drop of %x missing", tx.Hash())
+		}
+	}
+	// Dropping a transaction again must not be forgotten with its old record
+	dl.add(txs[1], DropExpired, nil)
+	if drop := dl.get(txs[1].Hash()); drop == nil || drop.Reason != DropExpired {
+		t.Errorf("redropped transaction record mismatch: %v", drop)
+	}
+	if drops := dl.flush(); len(drops) != 4 {
+		t.Errorf("flushed drops mismatch: have %d, want %d", len(drops), 4)
+	}
+}
+
+// Tests that the dropped transaction log only touches the disk when persisting
+// flushed drops, and that rotation retains the latest ones.
+func TestTransactionDropLogPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dropped.rlp")
+
+	dl := newTxDropLog(2, path)
+	if err := dl.load(); err != nil {
+		t.Fatalf("failed to load drop log: %v", err)
+	}
+	key, _ := crypto.GenerateKey()
+	txs := make([]*types.Transaction, 5)
+	for i := range txs {
+		txs[i] = transaction(uint64(i), 100000, key)
+		dl.add(txs[i], DropEvicted, nil)
+	}
+	if stat, err := os.Stat(path); err != nil || stat.Size() != 0 {
+		t.Fatalf("drops written before persisting: %v, %v", stat, err)
+	}
+	dl.persist(dl.flush())
+	if err := dl.close(); err != nil {
+		t.Fatalf("failed to close drop log: %v", err)
+	}
+	reloaded := newTxDropLog(2, path)
+	if err := reloaded.load(); err != nil {
+		t.Fatalf("failed to reload drop log: %v", err)
+	}
+	defer reloaded.close()
+
+	for i, tx := range txs {
+		if drop := reloaded.get(tx.Hash()); (drop != nil) != (i >= 3) {
+			t.Errorf("drop %d: retention mismatch: have %v, want %v", i, drop != nil, i >= 3)
+		}
+	}
+}
+
 // TestTransactionStatusCheck tests that the pool can correctly retrieve the
 // pending status of individual transactions.
 func TestTransactionStatusCheck(t *testing.T) {
@@ -2421,6 +2652,100 @@ func TestTransactionSlotCount(t *testing.T) {
 	}
 }
 
+// Tests that private transactions are kept private until their deadline, after
+// which they are either dropped or released for broadcasting.
+func TestTransactionPrivate(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	testAddBalance(pool, crypto.PubkeyToAddress(key.PublicKey), big.NewInt(1000000))
+
+	events := make(chan NewTxsEvent, 32)
+	sub := pool.txFeed.Subscribe(events)
+	defer sub.Unsubscribe()
+
+	privEvents := make(chan NewTxsEvent, 32)
+	privSub := pool.SubscribePrivateTxsEvent(privEvents)
+	defer privSub.Unsubscribe()
+
+	var (
+		dropped  = transaction(0, 100000, key)
+		released = transaction(1, 100000, key)
+	)
+	if err := pool.AddPrivate(dropped, 2, false); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddPrivate(released, 3, true); err != nil {
+		t.Fatalf("failed to add private transaction: %v", err)
+	}
+	if err := pool.AddPrivate(released, 3, true); err != ErrAlreadyKnown {
+		t.Fatalf("duplicate private transaction error mismatch: have %v, want %v", err, ErrAlreadyKnown)
+	}
+	if err := validateEvents(events, 0); err != nil {
+		t.Fatalf("private transactions leaked to the public feed: %v", err)
+	}
+	if err := validateEvents(privEvents, 2); err != nil {
+		t.Fatalf("private transactions event firing failed: %v", err)
+	}
+	if !pool.IsPrivate(dropped.Hash()) || !pool.IsPrivate(released.Hash()) || pool.PrivateCount() != 2 {
+		t.Fatalf("transactions not private")
+	}
+	// Private transactions must not be retrievable through the public getters
+	if pool.Get(dropped.Hash()) != nil || pool.Get(released.Hash()) != nil {
+		t.Fatalf("private transactions retrieved by hash")
+	}
+	if pending, queued := pool.Content(); len(pending) != 0 || len(queued) != 0 {
+		t.Fatalf("private transactions in pool content: %d pending, %d queued accounts", len(pending), len(queued))
+	}
+	if pending, queued := pool.ContentFrom(crypto.PubkeyToAddress(key.PublicKey)); len(pending) != 0 || len(queued) != 0 {
+		t.Fatalf("private transactions in account content: %d pending, %d queued", len(pending), len(queued))
+	}
+	if pending := pool.Pending(false); len(pending) != 1 {
+		t.Fatalf("private transactions not available to the miner")
+	}
+	// Reach the deadline of the first transaction, which is to be dropped along
+	// with the subsequent transaction of the account
+	<-pool.requestReset(nil, &types.Header{Number: big.NewInt(2), GasLimit: 10000000, BaseFee: common.Big1})
+	if pool.Has(dropped.Hash()) || pool.IsPrivate(dropped.Hash()) {
+		t.Fatalf("expired private transaction not dropped")
+	}
+	if drop := pool.Dropped(dropped.Hash()); drop != nil {
+		t.Fatalf("expired private transaction drop recorded: %v", drop.Reason)
+	}
+	if pending, queued := pool.Stats(); pending != 0 || queued != 1 {
+		t.Fatalf("pool stats mismatch: have %d pending, %d queued, want 0, 1", pending, queued)
+	}
+	if err := validateEvents(events, 0); err != nil {
+		t.Fatalf("expired private transaction event firing failed: %v", err)
+	}
+	// Reinject the gap, reach the deadline of the second transaction and ensure
+	// it gets released for broadcasting
+	if err := pool.addRemoteSync(transaction(0, 100000, key)); err != nil {
+		t.Fatalf("failed to add remote transaction: %v", err)
+	}
+	if err := validateEvents(events, 1); err != nil {
+		t.Fatalf("promoted transactions event firing failed: %v", err)
+	}
+	if err := validateEvents(privEvents, 1); err != nil {
+		t.Fatalf("promoted private transactions event firing failed: %v", err)
+	}
+	<-pool.requestReset(nil, &types.Header{Number: big.NewInt(3), GasLimit: 10000000, BaseFee: common.Big1})
+	if !pool.Has(released.Hash()) || pool.IsPrivate(released.Hash()) || pool.PrivateCount() != 0 {
+		t.Fatalf("expired private transaction not released")
+	}
+	if pool.Get(released.Hash()) == nil {
+		t.Fatalf("released private transaction not retrievable")
+	}
+	if err := validateEvents(events, 1); err != nil {
+		t.Fatalf("released private transaction event firing failed: %v", err)
+	}
+	if err := validateEvents(privEvents, 0); err != nil {
+		t.Fatalf("released private transaction still sent privately: %v", err)
+	}
+}
+
 // Benchmarks the speed of validating the contents of the pending queue of the
 // transaction pool.
 func BenchmarkPendingDemotion100(b *testing.B)   { benchmarkPendingDemotion(b, 100) }
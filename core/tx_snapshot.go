@@ -0,0 +1,146 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// snapshotEntry is a transaction persisted in the snapshot along with the time
+// it was first seen locally.
+type snapshotEntry struct {
+	Time uint64 // Arrival time of the transaction in unix nanoseconds
+	Tx   *types.Transaction
+}
+
+// txSnapshot is a point in time dump of the remote transactions of the pool, with
+// the aim of allowing the pending and queued set to survive node restarts. Unlike
+// the local journal, it is rewritten as a whole instead of appended to.
+type txSnapshot struct {
+	path   string        // Filesystem path to store the transactions at
+	maxAge time.Duration // Maximum age of the transactions to restore (0 = unlimited)
+	maxTxs uint64        // Maximum number of transactions to restore (0 = unlimited)
+}
+
+// newTxSnapshot creates a new remote transaction snapshot.
+func newTxSnapshot(path string, maxAge time.Duration, maxTxs uint64) *txSnapshot {
+	return &txSnapshot{
+		path:   path,
+		maxAge: maxAge,
+		maxTxs: maxTxs,
+	}
+}
+
+// load parses a transaction snapshot from disk, restoring the arrival time of
+// the transactions still recent enough and injecting them into the pool, where
+// they are revalidated against the current state.
+func (snap *txSnapshot) load(add func([]*types.Transaction) []error) error {
+	// Skip the parsing if the snapshot file doesn't exist at all
+	if _, err := os.Stat(snap.path); os.IsNotExist(err) {
+		return nil
+	}
+	input, err := os.Open(snap.path)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+
+	var (
+		stream = rlp.NewStream(bufio.NewReader(input), 0)
+		now    = time.Now()
+
+		total, stale, dropped int
+		failure               error
+		batch                 types.Transactions
+	)
+	loadBatch := func(txs types.Transactions) {
+		for _, err := range add(txs) {
+			if err != nil {
+				log.Debug("Failed to add snapshotted transaction", "err", err)
+				dropped++
+			}
+		}
+	}
+	for snap.maxTxs == 0 || uint64(total) < snap.maxTxs {
+		var entry snapshotEntry
+		if err = stream.Decode(&entry); err != nil {
+			if err != io.EOF {
+				failure = err
+			}
+			break
+		}
+		arrival := time.Unix(0, int64(entry.Time))
+		if snap.maxAge > 0 && now.Sub(arrival) > snap.maxAge {
+			stale++
+			continue
+		}
+		entry.Tx.SetTime(arrival)
+		total++
+
+		if batch = append(batch, entry.Tx); batch.Len() > 1024 {
+			loadBatch(batch)
+			batch = batch[:0]
+		}
+	}
+	if batch.Len() > 0 {
+		loadBatch(batch)
+	}
+	log.Info("Loaded remote transaction snapshot", "transactions", total, "stale", stale, "dropped", dropped)
+
+	return failure
+}
+
+// write replaces the snapshot on disk with the given transactions.
+func (snap *txSnapshot) write(all map[common.Address]types.Transactions) error {
+	output, err := os.OpenFile(snap.path+".new", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	var (
+		buffer = bufio.NewWriter(output)
+		count  int
+	)
+	for _, txs := range all {
+		for _, tx := range txs {
+			if err = rlp.Encode(buffer, &snapshotEntry{Time: uint64(tx.Time().UnixNano()), Tx: tx}); err != nil {
+				output.Close()
+				return err
+			}
+		}
+		count += len(txs)
+	}
+	if err = buffer.Flush(); err != nil {
+		output.Close()
+		return err
+	}
+	if err = output.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(snap.path+".new", snap.path); err != nil {
+		return err
+	}
+	log.Info("Persisted remote transaction snapshot", "transactions", count, "accounts", len(all))
+	return nil
+}
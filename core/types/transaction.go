@@ -374,6 +374,17 @@ func (tx *Transaction) Hash() common.Hash {
 	return h
 }
 
+// Time returns the time the transaction was first seen locally.
+func (tx *Transaction) Time() time.Time {
+	return tx.time
+}
+
+// SetTime overrides the time the transaction was first seen locally, used when
+// restoring transactions persisted across restarts.
+func (tx *Transaction) SetTime(t time.Time) {
+	tx.time = t
+}
+
 // Size returns the true RLP encoded storage size of the transaction, either by
 // encoding and returning it, or returning a previously cached value.
 func (tx *Transaction) Size() common.StorageSize {
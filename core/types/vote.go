@@ -0,0 +1,116 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"errors"
+	"math/bits"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// VoteSignatureLength is the length of a secp256k1 signature over a vote.
+	VoteSignatureLength = crypto.SignatureLength
+
+	// MaxAttestationValidators is the maximum number of validators which can be
+	// referenced by the bit set of a single vote attestation.
+	MaxAttestationValidators = 64
+)
+
+var errInvalidVoteSignature = errors.New("invalid vote signature length")
+
+// VoteData is the payload validators sign to attest that they consider the
+// target block a valid descendant of the source (justified) block.
+type VoteData struct {
+	SourceNumber uint64      // The number of the latest justified block
+	SourceHash   common.Hash // The hash of the latest justified block
+	TargetNumber uint64      // The number of the block being voted on
+	TargetHash   common.Hash // The hash of the block being voted on
+}
+
+// Hash returns the hash of the vote data, which is the digest signed by the
+// validators.
+func (d *VoteData) Hash() common.Hash {
+	return rlpHash(d)
+}
+
+// VoteEnvelope is a single signed vote as it travels over the network.
+type VoteEnvelope struct {
+	Signature []byte    // The secp256k1 signature of the voter over Data.Hash()
+	Data      *VoteData // The vote payload
+
+	// caches
+	hash atomic.Value
+}
+
+// Hash returns the unique hash of the vote envelope.
+func (v *VoteEnvelope) Hash() common.Hash {
+	if hash := v.hash.Load(); hash != nil {
+		return hash.(common.Hash)
+	}
+	h := rlpHash(v)
+	v.hash.Store(h)
+	return h
+}
+
+// Voter recovers the address of the validator which signed the vote.
+func (v *VoteEnvelope) Voter() (common.Address, error) {
+	return RecoverVoter(v.Data, v.Signature)
+}
+
+// RecoverVoter returns the address of the account which produced the given
+// signature over the vote data.
+func RecoverVoter(data *VoteData, sig []byte) (common.Address, error) {
+	if len(sig) != VoteSignatureLength {
+		return common.Address{}, errInvalidVoteSignature
+	}
+	pubkey, err := crypto.SigToPub(data.Hash().Bytes(), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
+
+// ValidatorBitSet is a bit set of validator indexes, referencing the validators
+// of a snapshot in ascending address order.
+type ValidatorBitSet uint64
+
+// Has returns whether the validator at the given index is in the set.
+func (s ValidatorBitSet) Has(index int) bool {
+	return index < MaxAttestationValidators && s&(1<<uint(index)) != 0
+}
+
+// Set returns a copy of the set with the validator at the given index added.
+func (s ValidatorBitSet) Set(index int) ValidatorBitSet {
+	return s | 1<<uint(index)
+}
+
+// Count returns the number of validators in the set.
+func (s ValidatorBitSet) Count() int {
+	return bits.OnesCount64(uint64(s))
+}
+
+// VoteAttestation is the aggregate of a quorum of votes for the same vote data,
+// embedded into the extra-data of the following block's header.
+type VoteAttestation struct {
+	VoteAddressSet ValidatorBitSet // The validators which voted, indexed in ascending address order
+	Signatures     [][]byte        // The votes' signatures, in the order of the bit set
+	Data           *VoteData       // The vote payload every signature attests to
+}
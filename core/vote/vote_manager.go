@@ -0,0 +1,176 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vote
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// maxVoteDelay is the maximum age of a new chain head for it to be voted on.
+// Older heads are the result of a chain sync and are not worth voting for.
+const maxVoteDelay = 30 * time.Second
+
+var signedVoteMeter = metrics.NewRegisteredMeter("vote/manager/signed", nil)
+
+// VoteManager casts the fast finality votes of the locally authorized validator
+// on every new chain head and feeds them into the vote pool.
+type VoteManager struct {
+	db     ethdb.KeyValueStore
+	chain  blockChain
+	pool   *VotePool
+	engine consensus.PoSA
+
+	// The highest source and target voted on so far, to never cast a double
+	// vote (two votes for the same target height) or a surround vote. They are
+	// persisted before every vote, so a restart can't make the node forget.
+	highestVotedSource uint64
+	highestVotedTarget uint64
+
+	chainHeadCh  chan core.ChainHeadEvent
+	chainHeadSub event.Subscription
+	wg           sync.WaitGroup
+}
+
+// voteHistory is the highest source and target voted on, as persisted in the
+// database.
+type voteHistory struct {
+	Source uint64
+	Target uint64
+}
+
+// NewVoteManager creates a vote manager casting votes into the given pool and
+// starts its event loop. The votes cast before are loaded from the database.
+func NewVoteManager(db ethdb.KeyValueStore, chain blockChain, pool *VotePool, engine consensus.PoSA) *VoteManager {
+	m := &VoteManager{
+		db:          db,
+		chain:       chain,
+		pool:        pool,
+		engine:      engine,
+		chainHeadCh: make(chan core.ChainHeadEvent, chainHeadChanSize),
+	}
+	if blob := rawdb.ReadParliaVoteHistory(db); len(blob) > 0 {
+		var history voteHistory
+		if err := rlp.DecodeBytes(blob, &history); err != nil {
+			// Nothing at or below the current head may be voted on safely, wait
+			// for the justified block to move past it
+			head := chain.CurrentHeader().Number.Uint64()
+			log.Error("Failed to decode vote history, voting from head", "head", head, "err", err)
+			history = voteHistory{Source: head, Target: head}
+		}
+		m.highestVotedSource, m.highestVotedTarget = history.Source, history.Target
+	}
+	m.chainHeadSub = chain.SubscribeChainHeadEvent(m.chainHeadCh)
+
+	m.wg.Add(1)
+	go m.loop()
+	return m
+}
+
+// Stop terminates the event loop of the vote manager.
+func (m *VoteManager) Stop() {
+	m.chainHeadSub.Unsubscribe()
+	m.wg.Wait()
+}
+
+func (m *VoteManager) loop() {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case ev := <-m.chainHeadCh:
+			if ev.Block != nil {
+				m.vote(ev.Block.Header())
+			}
+		case <-m.chainHeadSub.Err():
+			return
+		}
+	}
+}
+
+// vote casts a vote for the given header if the local node is an active
+// validator and the vote doesn't violate the voting rules.
+func (m *VoteManager) vote(header *types.Header) {
+	if !m.chain.Config().IsFastFinality(new(big.Int).Add(header.Number, common.Big1)) {
+		return
+	}
+	if time.Since(time.Unix(int64(header.Time), 0)) > maxVoteDelay {
+		return
+	}
+	if !m.engine.IsActiveValidatorAt(m.chain, header) {
+		return
+	}
+	source, sourceHash, err := m.engine.GetJustifiedNumberAndHash(m.chain, header)
+	if err != nil {
+		log.Debug("Failed to retrieve justified block", "number", header.Number, "err", err)
+		return
+	}
+	data := &types.VoteData{
+		SourceNumber: source,
+		SourceHash:   sourceHash,
+		TargetNumber: header.Number.Uint64(),
+		TargetHash:   header.Hash(),
+	}
+	if !m.safe(data) {
+		log.Debug("Skipped unsafe vote", "source", source, "target", data.TargetNumber)
+		return
+	}
+	// Persist the vote before signing, a crash right after must not allow a
+	// conflicting vote on restart
+	m.record(data)
+
+	vote, err := m.engine.SignVote(data)
+	if err != nil {
+		log.Warn("Failed to sign vote", "number", header.Number, "err", err)
+		return
+	}
+	signedVoteMeter.Mark(1)
+
+	log.Debug("Cast fast finality vote", "source", data.SourceNumber, "target", data.TargetNumber, "hash", data.TargetHash)
+	m.pool.PutVote(vote)
+}
+
+// safe reports whether voting on the given data can't be considered a double
+// vote or a surround vote with respect to all the votes cast before.
+func (m *VoteManager) safe(data *types.VoteData) bool {
+	if data.TargetNumber <= m.highestVotedTarget {
+		return false
+	}
+	return data.SourceNumber >= m.highestVotedSource
+}
+
+// record marks the given vote data as voted on, persisting it to the database.
+func (m *VoteManager) record(data *types.VoteData) {
+	blob, err := rlp.EncodeToBytes(&voteHistory{Source: data.SourceNumber, Target: data.TargetNumber})
+	if err != nil {
+		log.Crit("Failed to encode vote history", "err", err)
+	}
+	rawdb.WriteParliaVoteHistory(m.db, blob)
+	m.highestVotedSource, m.highestVotedTarget = data.SourceNumber, data.TargetNumber
+}
@@ -0,0 +1,84 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vote
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Tests that the votes cast are remembered across restarts, so the vote rules
+// can't be violated by restarting the node.
+func TestVoteManagerHistory(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		chain  = newTestChain()
+		engine = &testEngine{}
+		pool   = NewVotePool(chain, engine)
+	)
+	defer pool.Stop()
+
+	m := NewVoteManager(db, chain, pool, engine)
+	m.record(&types.VoteData{SourceNumber: 5, TargetNumber: 10})
+	m.Stop()
+
+	m = NewVoteManager(db, chain, pool, engine)
+	defer m.Stop()
+
+	tests := []struct {
+		source, target uint64
+		safe           bool
+	}{
+		{5, 10, false}, // Double vote
+		{4, 11, false}, // Surround vote
+		{5, 11, true},
+		{10, 11, true},
+	}
+	for i, tt := range tests {
+		if safe := m.safe(&types.VoteData{SourceNumber: tt.source, TargetNumber: tt.target}); safe != tt.safe {
+			t.Errorf("test %d: safety mismatch: have %v, want %v", i, safe, tt.safe)
+		}
+	}
+}
+
+// Tests that a corrupted vote history doesn't allow voting below the head.
+func TestVoteManagerCorruptHistory(t *testing.T) {
+	var (
+		db     = rawdb.NewMemoryDatabase()
+		chain  = newTestChain()
+		engine = &testEngine{}
+		pool   = NewVotePool(chain, engine)
+	)
+	defer pool.Stop()
+
+	for i := 0; i < 10; i++ {
+		chain.extend()
+	}
+	rawdb.WriteParliaVoteHistory(db, []byte{0xff})
+
+	m := NewVoteManager(db, chain, pool, engine)
+	defer m.Stop()
+
+	if m.safe(&types.VoteData{SourceNumber: 9, TargetNumber: 11}) {
+		t.Fatalf("vote with source below the head considered safe")
+	}
+	if !m.safe(&types.VoteData{SourceNumber: 10, TargetNumber: 11}) {
+		t.Fatalf("vote above the head considered unsafe")
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package vote implements the collection and production of the fast finality
+// votes of PoSA validators.
+package vote
+
+import (
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+const (
+	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
+	chainHeadChanSize = 10
+
+	// lowerLimitOfVoteBlockNumber is the distance behind the chain head after
+	// which votes are discarded.
+	lowerLimitOfVoteBlockNumber = 256
+
+	// upperLimitOfVoteBlockNumber is the distance ahead of the chain head up to
+	// which votes for still unknown blocks are accepted.
+	upperLimitOfVoteBlockNumber = 11
+
+	// maxFutureVotesPerBlock is the maximum number of unverified votes kept for
+	// a single, still unknown target block.
+	maxFutureVotesPerBlock = 64
+
+	// maxFutureVotes is the maximum number of unverified votes kept across all
+	// the unknown target blocks.
+	maxFutureVotes = 1024
+)
+
+var (
+	verifiedVoteGauge = metrics.NewRegisteredGauge("vote/pool/verified", nil)
+	futureVoteGauge   = metrics.NewRegisteredGauge("vote/pool/future", nil)
+	invalidVoteMeter  = metrics.NewRegisteredMeter("vote/pool/invalid", nil)
+)
+
+// blockChain provides the chain access needed by the vote pool and manager.
+type blockChain interface {
+	consensus.ChainHeaderReader
+
+	// SubscribeChainHeadEvent subscribes to new chain head notifications.
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
+}
+
+// voteBox is the collection of votes targeting the same block.
+type voteBox struct {
+	number uint64
+	votes  []*types.VoteEnvelope
+}
+
+// VotePool collects the fast finality votes of the validators, both produced
+// locally and received from the network. Votes for known blocks are verified
+// on arrival, votes for blocks not yet imported are kept aside until the block
+// arrives.
+type VotePool struct {
+	chain  blockChain
+	engine consensus.PoSA
+
+	curVotes    map[common.Hash]*voteBox // Verified votes, indexed by target hash
+	futureVotes map[common.Hash]*voteBox // Unverified votes for unknown targets, indexed by target hash
+	known       map[common.Hash]struct{} // Hashes of all the votes in the pool
+	futureCount int                      // Number of votes in the future set
+	mu          sync.RWMutex
+
+	voteFeed event.Feed
+	scope    event.SubscriptionScope
+
+	chainHeadCh  chan core.ChainHeadEvent
+	chainHeadSub event.Subscription
+	wg           sync.WaitGroup
+}
+
+// NewVotePool creates a vote pool tracking the given chain and starts its
+// maintenance loop.
+func NewVotePool(chain blockChain, engine consensus.PoSA) *VotePool {
+	pool := &VotePool{
+		chain:       chain,
+		engine:      engine,
+		curVotes:    make(map[common.Hash]*voteBox),
+		futureVotes: make(map[common.Hash]*voteBox),
+		known:       make(map[common.Hash]struct{}),
+		chainHeadCh: make(chan core.ChainHeadEvent, chainHeadChanSize),
+	}
+	pool.chainHeadSub = chain.SubscribeChainHeadEvent(pool.chainHeadCh)
+
+	pool.wg.Add(1)
+	go pool.loop()
+	return pool
+}
+
+// Stop terminates the maintenance loop of the vote pool.
+func (pool *VotePool) Stop() {
+	pool.scope.Close()
+	pool.chainHeadSub.Unsubscribe()
+	pool.wg.Wait()
+	log.Info("Vote pool stopped")
+}
+
+// loop moves votes from the future set once their target gets imported and
+// discards votes which became too old to matter.
+func (pool *VotePool) loop() {
+	defer pool.wg.Done()
+
+	for {
+		select {
+		case ev := <-pool.chainHeadCh:
+			if ev.Block != nil {
+				pool.transferFutureVotes()
+				pool.prune(ev.Block.NumberU64())
+			}
+		case <-pool.chainHeadSub.Err():
+			return
+		}
+	}
+}
+
+// PutVote adds a vote to the pool. Invalid, duplicate and out of range votes
+// are silently dropped.
+func (pool *VotePool) PutVote(vote *types.VoteEnvelope) {
+	if vote == nil || vote.Data == nil {
+		return
+	}
+	hash := vote.Hash()
+
+	pool.mu.RLock()
+	_, known := pool.known[hash]
+	pool.mu.RUnlock()
+	if known {
+		return
+	}
+	head := pool.chain.CurrentHeader().Number.Uint64()
+	target := vote.Data.TargetNumber
+	if target+lowerLimitOfVoteBlockNumber < head || target > head+upperLimitOfVoteBlockNumber {
+		log.Trace("Discarded out of range vote", "target", target, "head", head)
+		return
+	}
+	if pool.chain.GetHeader(vote.Data.TargetHash, target) == nil {
+		pool.mu.Lock()
+		pool.addFuture(vote)
+		pool.mu.Unlock()
+		return
+	}
+	if err := pool.engine.VerifyVote(pool.chain, vote); err != nil {
+		log.Debug("Discarded invalid vote", "target", target, "hash", vote.Data.TargetHash, "err", err)
+		invalidVoteMeter.Mark(1)
+		return
+	}
+	pool.mu.Lock()
+	added := pool.add(pool.curVotes, vote, 0)
+	pool.mu.Unlock()
+
+	if added {
+		pool.voteFeed.Send(core.NewVoteEvent{Vote: vote})
+	}
+}
+
+// add inserts a vote into the given vote set, unless already known or the box
+// of its target is full. The caller must hold the write lock.
+func (pool *VotePool) add(set map[common.Hash]*voteBox, vote *types.VoteEnvelope, limit int) bool {
+	hash := vote.Hash()
+	if _, ok := pool.known[hash]; ok {
+		return false
+	}
+	box := set[vote.Data.TargetHash]
+	if box == nil {
+		box = &voteBox{number: vote.Data.TargetNumber}
+		set[vote.Data.TargetHash] = box
+	}
+	if limit > 0 && len(box.votes) >= limit {
+		return false
+	}
+	box.votes = append(box.votes, vote)
+	pool.known[hash] = struct{}{}
+	pool.updateGauges()
+	return true
+}
+
+// addFuture inserts an unverified vote for a still unknown target block. Once
+// the future set is full, votes targeting the highest block numbers are evicted
+// first as they are the furthest from being verifiable. The caller must hold
+// the write lock.
+func (pool *VotePool) addFuture(vote *types.VoteEnvelope) bool {
+	if _, ok := pool.known[vote.Hash()]; ok {
+		return false
+	}
+	if box := pool.futureVotes[vote.Data.TargetHash]; box != nil && len(box.votes) >= maxFutureVotesPerBlock {
+		return false
+	}
+	if pool.futureCount >= maxFutureVotes {
+		var (
+			evictHash common.Hash
+			evictBox  *voteBox
+		)
+		for hash, box := range pool.futureVotes {
+			if evictBox == nil || box.number > evictBox.number {
+				evictHash, evictBox = hash, box
+			}
+		}
+		if evictBox == nil || evictBox.number <= vote.Data.TargetNumber {
+			return false
+		}
+		evicted := evictBox.votes[len(evictBox.votes)-1]
+		evictBox.votes = evictBox.votes[:len(evictBox.votes)-1]
+		if len(evictBox.votes) == 0 {
+			delete(pool.futureVotes, evictHash)
+		}
+		delete(pool.known, evicted.Hash())
+		pool.futureCount--
+	}
+	return pool.add(pool.futureVotes, vote, maxFutureVotesPerBlock)
+}
+
+// transferFutureVotes verifies the future votes whose target got imported and
+// moves them into the verified set.
+func (pool *VotePool) transferFutureVotes() {
+	var pending []*types.VoteEnvelope
+
+	pool.mu.Lock()
+	for hash, box := range pool.futureVotes {
+		if pool.chain.GetHeader(hash, box.number) == nil {
+			continue
+		}
+		for _, vote := range box.votes {
+			delete(pool.known, vote.Hash())
+		}
+		pending = append(pending, box.votes...)
+		delete(pool.futureVotes, hash)
+	}
+	pool.updateGauges()
+	pool.mu.Unlock()
+
+	for _, vote := range pending {
+		pool.PutVote(vote)
+	}
+}
+
+// prune discards all the votes targeting blocks too far behind the head.
+func (pool *VotePool) prune(head uint64) {
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+
+	for _, set := range []map[common.Hash]*voteBox{pool.curVotes, pool.futureVotes} {
+		for hash, box := range set {
+			if box.number+lowerLimitOfVoteBlockNumber >= head {
+				continue
+			}
+			for _, vote := range box.votes {
+				delete(pool.known, vote.Hash())
+			}
+			delete(set, hash)
+		}
+	}
+	pool.updateGauges()
+}
+
+// updateGauges refreshes the vote pool metrics and the future vote count. The
+// caller must hold the write lock.
+func (pool *VotePool) updateGauges() {
+	var verified, future int
+	for _, box := range pool.curVotes {
+		verified += len(box.votes)
+	}
+	for _, box := range pool.futureVotes {
+		future += len(box.votes)
+	}
+	pool.futureCount = future
+
+	verifiedVoteGauge.Update(int64(verified))
+	futureVoteGauge.Update(int64(future))
+}
+
+// FetchVoteByBlockHash implements consensus.VotePool, returning the verified
+// votes targeting the given block.
+func (pool *VotePool) FetchVoteByBlockHash(blockHash common.Hash) []*types.VoteEnvelope {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	box := pool.curVotes[blockHash]
+	if box == nil {
+		return nil
+	}
+	return append([]*types.VoteEnvelope(nil), box.votes...)
+}
+
+// GetVotes returns all the verified votes in the pool.
+func (pool *VotePool) GetVotes() []*types.VoteEnvelope {
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	var votes []*types.VoteEnvelope
+	for _, box := range pool.curVotes {
+		votes = append(votes, box.votes...)
+	}
+	return votes
+}
+
+// SubscribeNewVoteEvent registers a subscription of NewVoteEvent and starts
+// sending events to the given channel.
+func (pool *VotePool) SubscribeNewVoteEvent(ch chan<- core.NewVoteEvent) event.Subscription {
+	return pool.scope.Track(pool.voteFeed.Subscribe(ch))
+}
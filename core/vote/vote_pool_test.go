@@ -0,0 +1,227 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vote
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var errTestInvalidVote = errors.New("invalid vote")
+
+// testChain is a minimal header chain the vote pool can track.
+type testChain struct {
+	headers map[common.Hash]*types.Header
+	head    *types.Header
+	feed    event.Feed
+	lock    sync.RWMutex
+}
+
+func newTestChain() *testChain {
+	genesis := &types.Header{Number: big.NewInt(0)}
+	return &testChain{
+		headers: map[common.Hash]*types.Header{genesis.Hash(): genesis},
+		head:    genesis,
+	}
+}
+
+// extend appends a new header to the chain without notifying subscribers.
+func (c *testChain) extend() *types.Header {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	header := &types.Header{ParentHash: c.head.Hash(), Number: new(big.Int).Add(c.head.Number, common.Big1)}
+	c.headers[header.Hash()] = header
+	c.head = header
+	return header
+}
+
+func (c *testChain) Config() *params.ChainConfig { return params.TestChainConfig }
+
+func (c *testChain) CurrentHeader() *types.Header {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.head
+}
+
+func (c *testChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if header := c.headers[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+func (c *testChain) GetHeaderByNumber(number uint64) *types.Header { return nil }
+func (c *testChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.headers[hash]
+}
+func (c *testChain) GetTd(hash common.Hash, number uint64) *big.Int { return nil }
+
+func (c *testChain) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return c.feed.Subscribe(ch)
+}
+
+// testEngine is a PoSA engine accepting every vote with a non-empty signature.
+type testEngine struct {
+	consensus.PoSA
+}
+
+func (e *testEngine) VerifyVote(chain consensus.ChainHeaderReader, vote *types.VoteEnvelope) error {
+	if len(vote.Signature) == 0 {
+		return errTestInvalidVote
+	}
+	return nil
+}
+
+func newTestVote(target *types.Header, sig byte) *types.VoteEnvelope {
+	return &types.VoteEnvelope{
+		Signature: []byte{sig},
+		Data:      &types.VoteData{TargetNumber: target.Number.Uint64(), TargetHash: target.Hash()},
+	}
+}
+
+func TestVotePoolAdd(t *testing.T) {
+	chain := newTestChain()
+	pool := NewVotePool(chain, new(testEngine))
+	defer pool.Stop()
+
+	votes := make(chan core.NewVoteEvent, 10)
+	sub := pool.SubscribeNewVoteEvent(votes)
+	defer sub.Unsubscribe()
+
+	head := chain.extend()
+
+	// Valid votes are accepted and announced exactly once
+	pool.PutVote(newTestVote(head, 1))
+	pool.PutVote(newTestVote(head, 1))
+	pool.PutVote(newTestVote(head, 2))
+
+	// Invalid votes are dropped
+	pool.PutVote(&types.VoteEnvelope{Data: &types.VoteData{TargetNumber: 1, TargetHash: head.Hash()}})
+
+	if have := len(pool.FetchVoteByBlockHash(head.Hash())); have != 2 {
+		t.Fatalf("verified vote count mismatch: have %d, want %d", have, 2)
+	}
+	if have := len(votes); have != 2 {
+		t.Fatalf("announced vote count mismatch: have %d, want %d", have, 2)
+	}
+}
+
+func TestVotePoolFutureVotes(t *testing.T) {
+	chain := newTestChain()
+	pool := NewVotePool(chain, new(testEngine))
+	defer pool.Stop()
+
+	// Votes for an unknown block are kept aside
+	future := &types.Header{ParentHash: chain.CurrentHeader().Hash(), Number: big.NewInt(1)}
+	for i := 0; i < maxFutureVotesPerBlock+1; i++ {
+		pool.PutVote(newTestVote(future, byte(i+1)))
+	}
+	if have := len(pool.FetchVoteByBlockHash(future.Hash())); have != 0 {
+		t.Fatalf("future votes reported as verified: %d", have)
+	}
+	// Votes too far in the future are dropped altogether
+	pool.PutVote(newTestVote(&types.Header{Number: big.NewInt(upperLimitOfVoteBlockNumber + 1)}, 1))
+
+	pool.mu.RLock()
+	if have := len(pool.futureVotes[future.Hash()].votes); have != maxFutureVotesPerBlock {
+		t.Fatalf("future vote count mismatch: have %d, want %d", have, maxFutureVotesPerBlock)
+	}
+	if have := len(pool.futureVotes); have != 1 {
+		t.Fatalf("future vote box count mismatch: have %d, want %d", have, 1)
+	}
+	pool.mu.RUnlock()
+
+	// Import the target and ensure the votes get verified
+	head := chain.extend()
+	if head.Hash() != future.Hash() {
+		t.Fatalf("unexpected chain head")
+	}
+	chain.feed.Send(core.ChainHeadEvent{Block: types.NewBlockWithHeader(head)})
+
+	for i := 0; i < 100; i++ {
+		if len(pool.FetchVoteByBlockHash(head.Hash())) == maxFutureVotesPerBlock {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("future votes not transferred: have %d, want %d", len(pool.FetchVoteByBlockHash(head.Hash())), maxFutureVotesPerBlock)
+}
+
+func TestVotePoolPrune(t *testing.T) {
+	chain := newTestChain()
+	pool := NewVotePool(chain, new(testEngine))
+	defer pool.Stop()
+
+	target := chain.extend()
+	pool.PutVote(newTestVote(target, 1))
+
+	pool.prune(target.Number.Uint64() + lowerLimitOfVoteBlockNumber)
+	if have := len(pool.FetchVoteByBlockHash(target.Hash())); have != 1 {
+		t.Fatalf("recent votes pruned: have %d, want %d", have, 1)
+	}
+	pool.prune(target.Number.Uint64() + lowerLimitOfVoteBlockNumber + 1)
+	if have := len(pool.FetchVoteByBlockHash(target.Hash())); have != 0 {
+		t.Fatalf("stale votes not pruned: have %d", have)
+	}
+	if len(pool.known) != 0 {
+		t.Fatalf("stale vote hashes not pruned: have %d", len(pool.known))
+	}
+}
+
+func TestVotePoolFutureVoteLimit(t *testing.T) {
+	chain := newTestChain()
+	pool := NewVotePool(chain, new(testEngine))
+	defer pool.Stop()
+
+	// Fill the future set with votes for distinct unknown targets
+	far := uint64(upperLimitOfVoteBlockNumber)
+	for i := 0; i < maxFutureVotes; i++ {
+		pool.PutVote(newTestVote(&types.Header{Number: new(big.Int).SetUint64(far), Extra: []byte{byte(i), byte(i >> 8)}}, 1))
+	}
+	// Further votes at the same height are rejected, nearer ones evict
+	pool.PutVote(newTestVote(&types.Header{Number: new(big.Int).SetUint64(far), Extra: []byte("rejected")}, 1))
+	near := &types.Header{Number: big.NewInt(1), Extra: []byte("near")}
+	pool.PutVote(newTestVote(near, 1))
+
+	pool.mu.RLock()
+	defer pool.mu.RUnlock()
+
+	if pool.futureCount != maxFutureVotes {
+		t.Fatalf("future vote count mismatch: have %d, want %d", pool.futureCount, maxFutureVotes)
+	}
+	if len(pool.known) != maxFutureVotes {
+		t.Fatalf("known vote count mismatch: have %d, want %d", len(pool.known), maxFutureVotes)
+	}
+	if box := pool.futureVotes[near.Hash()]; box == nil || len(box.votes) != 1 {
+		t.Fatalf("near future vote not kept")
+	}
+}
@@ -33,6 +33,7 @@ import (
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
@@ -257,6 +258,18 @@ func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// SetTxPoolPolicy replaces the admission policy of the transaction pool. The
+// policy applies to the transactions entering the pool from now on; an empty
+// policy lifts all the restrictions.
+func (api *PrivateAdminAPI) SetTxPoolPolicy(policy core.TxPolicy) (bool, error) {
+	if err := api.eth.TxPool().SetPolicy(&policy); err != nil {
+		return false, err
+	}
+	log.Info("Updated txpool policy", "deny", len(policy.Deny), "allow", len(policy.Allow),
+		"selectors", len(policy.Selectors), "senderrate", policy.SenderRate)
+	return true, nil
+}
+
 // PublicDebugAPI is the collection of Ethereum full node APIs exposed
 // over the public debugging endpoint.
 type PublicDebugAPI struct {
@@ -318,6 +331,25 @@ func (api *PrivateDebugAPI) Preimage(ctx context.Context, hash common.Hash) (hex
 	return nil, errors.New("unknown preimage")
 }
 
+// PruneState starts deleting the stale state of the running node in the background,
+// retaining the state of the HEAD-64 block and everything above it. The optional
+// bloomSize is the megabytes of memory allocated to the state bloom (default 2048).
+func (api *PrivateDebugAPI) PruneState(bloomSize *uint64) error {
+	if api.eth.config.NoPruning {
+		return errors.New("state pruning is not available in archive mode")
+	}
+	size := uint64(2048)
+	if bloomSize != nil {
+		size = *bloomSize
+	}
+	return api.eth.statePruner.Start(api.eth.blockchain, size)
+}
+
+// PruneStatus returns the progress of the current or last online state pruning.
+func (api *PrivateDebugAPI) PruneStatus() pruner.PruneStatus {
+	return api.eth.statePruner.Status()
+}
+
 // BadBlockArgs represents the entries in the list returned when bad blocks are queried.
 type BadBlockArgs struct {
 	Hash  common.Hash            `json:"hash"`
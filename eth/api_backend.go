@@ -19,6 +19,7 @@ package eth
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math/big"
 	"time"
 
@@ -40,6 +41,10 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// errHistoryPruned is returned when the requested block data was expired from
+// the chain freezer by the history retention.
+var errHistoryPruned = errors.New("history pruned")
+
 // EthAPIBackend implements ethapi.Backend for full nodes
 type EthAPIBackend struct {
 	extRPCEnabled       bool
@@ -72,6 +77,14 @@ func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock().Header(), nil
 	}
+	// Finalized block is only known by fast finality capable engines
+	if number == rpc.FinalizedBlockNumber {
+		posa, ok := b.eth.engine.(consensus.PoSA)
+		if !ok {
+			return nil, errors.New("finalized block not supported by consensus engine")
+		}
+		return posa.GetFinalizedHeader(b.eth.blockchain, b.eth.blockchain.CurrentHeader()), nil
+	}
 	return b.eth.blockchain.GetHeaderByNumber(uint64(number)), nil
 }
 
@@ -106,11 +119,28 @@ func (b *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumbe
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock(), nil
 	}
-	return b.eth.blockchain.GetBlockByNumber(uint64(number)), nil
+	if number == rpc.FinalizedBlockNumber {
+		header, err := b.HeaderByNumber(ctx, number)
+		if header == nil || err != nil {
+			return nil, err
+		}
+		return b.eth.blockchain.GetBlock(header.Hash(), header.Number.Uint64()), nil
+	}
+	block := b.eth.blockchain.GetBlockByNumber(uint64(number))
+	if block == nil && b.eth.blockchain.GetHeaderByNumber(uint64(number)) != nil {
+		return nil, b.prunedHistory(uint64(number))
+	}
+	return block, nil
 }
 
 func (b *EthAPIBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
-	return b.eth.blockchain.GetBlockByHash(hash), nil
+	block := b.eth.blockchain.GetBlockByHash(hash)
+	if block == nil {
+		if header := b.eth.blockchain.GetHeaderByHash(hash); header != nil {
+			return nil, b.prunedHistory(header.Number.Uint64())
+		}
+	}
+	return block, nil
 }
 
 func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Block, error) {
@@ -127,6 +157,9 @@ func (b *EthAPIBackend) BlockByNumberOrHash(ctx context.Context, blockNrOrHash r
 		}
 		block := b.eth.blockchain.GetBlock(hash, header.Number.Uint64())
 		if block == nil {
+			if err := b.prunedHistory(header.Number.Uint64()); err != nil {
+				return nil, err
+			}
 			return nil, errors.New("header found, but block body is missing")
 		}
 		return block, nil
@@ -178,7 +211,13 @@ func (b *EthAPIBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockN
 }
 
 func (b *EthAPIBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
-	return b.eth.blockchain.GetReceiptsByHash(hash), nil
+	receipts := b.eth.blockchain.GetReceiptsByHash(hash)
+	if receipts == nil {
+		if number := rawdb.ReadHeaderNumber(b.eth.ChainDb(), hash); number != nil {
+			return nil, b.prunedHistory(*number)
+		}
+	}
+	return receipts, nil
 }
 
 func (b *EthAPIBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
@@ -189,6 +228,9 @@ func (b *EthAPIBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*typ
 	}
 	logs := rawdb.ReadLogs(db, hash, *number, b.eth.blockchain.Config())
 	if logs == nil {
+		if err := b.prunedHistory(*number); err != nil {
+			return nil, err
+		}
 		return nil, errors.New("failed to get logs for block")
 	}
 	return logs, nil
@@ -239,11 +281,19 @@ func (b *EthAPIBackend) SendTx(ctx context.Context, signedTx *types.Transaction)
 	return b.eth.txPool.AddLocal(signedTx)
 }
 
+func (b *EthAPIBackend) SendPrivateTx(ctx context.Context, signedTx *types.Transaction, deadline uint64, fallback bool) error {
+	return b.eth.txPool.AddPrivate(signedTx, deadline, fallback)
+}
+
 func (b *EthAPIBackend) GetPoolTransactions() (types.Transactions, error) {
 	pending := b.eth.txPool.Pending(false)
 	var txs types.Transactions
 	for _, batch := range pending {
-		txs = append(txs, batch...)
+		for _, tx := range batch {
+			if !b.eth.txPool.IsPrivate(tx.Hash()) {
+				txs = append(txs, tx)
+			}
+		}
 	}
 	return txs, nil
 }
@@ -252,11 +302,33 @@ func (b *EthAPIBackend) GetPoolTransaction(hash common.Hash) *types.Transaction
 	return b.eth.txPool.Get(hash)
 }
 
+func (b *EthAPIBackend) GetPoolTransactionStatus(hash common.Hash) core.TxStatus {
+	return b.eth.txPool.Status([]common.Hash{hash})[0]
+}
+
+func (b *EthAPIBackend) GetDroppedTransaction(hash common.Hash) *core.TxDrop {
+	return b.eth.txPool.Dropped(hash)
+}
+
 func (b *EthAPIBackend) GetTransaction(ctx context.Context, txHash common.Hash) (*types.Transaction, common.Hash, uint64, uint64, error) {
 	tx, blockHash, blockNumber, index := rawdb.ReadTransaction(b.eth.ChainDb(), txHash)
+	if tx == nil {
+		if number := rawdb.ReadTxLookupEntry(b.eth.ChainDb(), txHash); number != nil {
+			return nil, common.Hash{}, 0, 0, b.prunedHistory(*number)
+		}
+	}
 	return tx, blockHash, blockNumber, index, nil
 }
 
+// prunedHistory returns an error if the bodies and receipts of the given block
+// were expired from the chain freezer, or nil if they should be available.
+func (b *EthAPIBackend) prunedHistory(number uint64) error {
+	if tail := rawdb.ReadHistoryTail(b.eth.ChainDb()); number < tail {
+		return fmt.Errorf("%w: bodies and receipts before block #%d are not retained", errHistoryPruned, tail)
+	}
+	return nil
+}
+
 func (b *EthAPIBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error) {
 	return b.eth.txPool.Nonce(addr), nil
 }
@@ -265,6 +337,10 @@ func (b *EthAPIBackend) Stats() (pending int, queued int) {
 	return b.eth.txPool.Stats()
 }
 
+func (b *EthAPIBackend) PrivateStats() int {
+	return b.eth.txPool.PrivateCount()
+}
+
 func (b *EthAPIBackend) TxPoolContent() (map[common.Address]types.Transactions, map[common.Address]types.Transactions) {
 	return b.eth.TxPool().Content()
 }
@@ -281,6 +357,10 @@ func (b *EthAPIBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.S
 	return b.eth.TxPool().SubscribeNewTxsEvent(ch)
 }
 
+func (b *EthAPIBackend) SubscribeDroppedTxsEvent(ch chan<- core.DroppedTxsEvent) event.Subscription {
+	return b.eth.TxPool().SubscribeDroppedTxsEvent(ch)
+}
+
 func (b *EthAPIBackend) SyncProgress() ethereum.SyncProgress {
 	return b.eth.Downloader().Progress()
 }
@@ -0,0 +1,215 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// PublicBundleAPI provides an API to submit and simulate atomic transaction
+// bundles for inclusion in upcoming blocks.
+type PublicBundleAPI struct {
+	e *Ethereum
+}
+
+// NewPublicBundleAPI creates a new bundle API instance.
+func NewPublicBundleAPI(e *Ethereum) *PublicBundleAPI {
+	return &PublicBundleAPI{e}
+}
+
+// SendBundleArgs represents the arguments of a bundle submission.
+type SendBundleArgs struct {
+	Txs          []hexutil.Bytes `json:"txs"`
+	BlockNumber  rpc.BlockNumber `json:"blockNumber"`
+	MinTimestamp *uint64         `json:"minTimestamp"`
+	MaxTimestamp *uint64         `json:"maxTimestamp"`
+}
+
+// decodeBundleTxs decodes the binary encoded transactions of a bundle.
+func decodeBundleTxs(encoded []hexutil.Bytes) (types.Transactions, error) {
+	if len(encoded) == 0 {
+		return nil, core.ErrBundleEmpty
+	}
+	txs := make(types.Transactions, 0, len(encoded))
+	for i, blob := range encoded {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(blob); err != nil {
+			return nil, fmt.Errorf("invalid transaction %d: %v", i, err)
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// SendBundle adds a bundle of transactions to the bundle pool, to be included
+// atomically in the given block, and returns the bundle hash.
+func (api *PublicBundleAPI) SendBundle(ctx context.Context, args SendBundleArgs) (common.Hash, error) {
+	txs, err := decodeBundleTxs(args.Txs)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if args.BlockNumber <= 0 {
+		return common.Hash{}, errors.New("bundle block number required")
+	}
+	bundle := &core.Bundle{
+		Txs:         txs,
+		BlockNumber: uint64(args.BlockNumber),
+	}
+	if args.MinTimestamp != nil {
+		bundle.MinTimestamp = *args.MinTimestamp
+	}
+	if args.MaxTimestamp != nil {
+		bundle.MaxTimestamp = *args.MaxTimestamp
+	}
+	if err := api.e.BundlePool().Add(bundle); err != nil {
+		return common.Hash{}, err
+	}
+	return bundle.Hash(), nil
+}
+
+// CallBundleArgs represents the arguments of a bundle simulation.
+type CallBundleArgs struct {
+	Txs              []hexutil.Bytes       `json:"txs"`
+	BlockNumber      rpc.BlockNumber       `json:"blockNumber"`
+	StateBlockNumber rpc.BlockNumberOrHash `json:"stateBlockNumber"`
+	Coinbase         *common.Address       `json:"coinbase"`
+	Timestamp        *uint64               `json:"timestamp"`
+}
+
+// CallBundle simulates a bundle of transactions on top of the given state, as
+// if included in a new block, and reports the outcome of each transaction and
+// the effective payment of the bundle to the block producer. Unlike in a block
+// being built, reverting transactions are reported instead of failing the call.
+func (api *PublicBundleAPI) CallBundle(ctx context.Context, args CallBundleArgs) (map[string]interface{}, error) {
+	txs, err := decodeBundleTxs(args.Txs)
+	if err != nil {
+		return nil, err
+	}
+	statedb, parent, err := api.e.APIBackend.StateAndHeaderByNumberOrHash(ctx, args.StateBlockNumber)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	var (
+		config = api.e.blockchain.Config()
+		number = new(big.Int).Add(parent.Number, common.Big1)
+	)
+	if args.BlockNumber > 0 {
+		target := uint64(args.BlockNumber)
+		if target <= parent.Number.Uint64() || target > parent.Number.Uint64()+core.MaxBundleDistance {
+			return nil, fmt.Errorf("bundle block number %d out of range (%d, %d]", target, parent.Number.Uint64(), parent.Number.Uint64()+core.MaxBundleDistance)
+		}
+		number = new(big.Int).SetUint64(target)
+	}
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     number,
+		GasLimit:   parent.GasLimit,
+		Time:       parent.Time + 1,
+		Difficulty: parent.Difficulty,
+		Coinbase:   parent.Coinbase,
+	}
+	if args.Timestamp != nil {
+		header.Time = *args.Timestamp
+	}
+	if args.Coinbase != nil {
+		header.Coinbase = *args.Coinbase
+	}
+	if config.IsLondon(number) {
+		header.BaseFee = misc.CalcBaseFee(config, parent)
+	}
+	// Setup context so it may be cancelled when the call times out
+	var cancel context.CancelFunc
+	if timeout := api.e.APIBackend.RPCEVMTimeout(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	var (
+		signer   = types.MakeSigner(config, number)
+		gp       = new(core.GasPool).AddGas(header.GasLimit)
+		evm      = vm.NewEVM(core.NewEVMBlockContext(header, api.e.blockchain, nil), vm.TxContext{}, statedb, config, vm.Config{})
+		before   = core.ProducerBalance(config, statedb, header)
+		results  = make([]map[string]interface{}, 0, len(txs))
+		totalGas uint64
+	)
+	go func() {
+		<-ctx.Done()
+		evm.Cancel()
+	}()
+	for i, tx := range txs {
+		msg, err := tx.AsMessage(signer, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transaction %#x: %v", tx.Hash(), err)
+		}
+		statedb.Prepare(tx.Hash(), i)
+		evm.Reset(core.NewEVMTxContext(msg), statedb)
+
+		balance := core.ProducerBalance(config, statedb, header)
+		result, err := core.ApplyMessage(evm, msg, gp)
+		if err != nil {
+			return nil, fmt.Errorf("err: %w; txhash %s", err, tx.Hash())
+		}
+		if evm.Cancelled() {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", api.e.APIBackend.RPCEVMTimeout())
+		}
+		statedb.Finalise(config.IsEIP158(number))
+		totalGas += result.UsedGas
+
+		payment := new(big.Int).Sub(core.ProducerBalance(config, statedb, header), balance)
+		fields := map[string]interface{}{
+			"txHash":       tx.Hash(),
+			"fromAddress":  msg.From(),
+			"toAddress":    msg.To(),
+			"gasUsed":      hexutil.Uint64(result.UsedGas),
+			"coinbaseDiff": (*hexutil.Big)(payment),
+		}
+		if result.Err != nil {
+			fields["error"] = result.Err.Error()
+			if reason := result.Revert(); len(reason) > 0 {
+				fields["revert"] = hexutil.Bytes(reason)
+			}
+		} else {
+			fields["value"] = hexutil.Bytes(result.Return())
+		}
+		results = append(results, fields)
+	}
+	var (
+		payment  = new(big.Int).Sub(core.ProducerBalance(config, statedb, header), before)
+		gasPrice = (&core.BundleResult{GasUsed: totalGas, Payment: payment}).GasPrice()
+	)
+	return map[string]interface{}{
+		"bundleHash":       (&core.Bundle{Txs: txs}).Hash(),
+		"results":          results,
+		"coinbaseDiff":     (*hexutil.Big)(payment),
+		"bundleGasPrice":   (*hexutil.Big)(gasPrice),
+		"totalGasUsed":     hexutil.Uint64(totalGas),
+		"stateBlockNumber": hexutil.Uint64(parent.Number.Uint64()),
+	}, nil
+}
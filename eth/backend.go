@@ -27,6 +27,7 @@ import (
 	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/external"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/consensus"
@@ -39,11 +40,13 @@ import (
 	"github.com/ethereum/go-ethereum/core/state/pruner"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/core/vote"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/eth/ethconfig"
 	"github.com/ethereum/go-ethereum/eth/filters"
 	"github.com/ethereum/go-ethereum/eth/gasprice"
 	"github.com/ethereum/go-ethereum/eth/protocols/eth"
+	"github.com/ethereum/go-ethereum/eth/protocols/pulse"
 	"github.com/ethereum/go-ethereum/eth/protocols/snap"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
@@ -60,6 +63,10 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+// minRemoteSignTimeout is the minimum time an external signer is given to seal
+// a Parlia block or to sign a system transaction.
+const minRemoteSignTimeout = time.Second
+
 // Config contains the configuration options of the ETH protocol.
 // Deprecated: use ethconfig.Config instead.
 type Config = ethconfig.Config
@@ -70,6 +77,11 @@ type Ethereum struct {
 
 	// Handlers
 	txPool             *core.TxPool
+	bundlePool         *core.BundlePool
+	votePool           *vote.VotePool
+	voteManager        *vote.VoteManager
+	parliaHistory      *parlia.HistoryIndexer
+	statePruner        *pruner.OnlinePruner
 	blockchain         *core.BlockChain
 	handler            *handler
 	ethDialCandidates  enode.Iterator
@@ -113,6 +125,10 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if !config.SyncMode.IsValid() {
 		return nil, fmt.Errorf("invalid sync mode %d", config.SyncMode)
 	}
+	if config.HistoryRetain > 0 && (config.TxLookupLimit == 0 || config.TxLookupLimit > config.HistoryRetain) {
+		log.Warn("Limiting transaction index to the retained history", "provided", config.TxLookupLimit, "updated", config.HistoryRetain)
+		config.TxLookupLimit = config.HistoryRetain
+	}
 	if config.Miner.GasPrice == nil || config.Miner.GasPrice.Cmp(common.Big0) <= 0 {
 		log.Warn("Sanitizing invalid miner gas price", "provided", config.Miner.GasPrice, "updated", ethconfig.Defaults.Miner.GasPrice)
 		config.Miner.GasPrice = new(big.Int).Set(ethconfig.Defaults.Miner.GasPrice)
@@ -137,6 +153,13 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if err != nil {
 		return nil, err
 	}
+	scheme, err := rawdb.ParseStateScheme(config.StateScheme, chainDb)
+	if err != nil {
+		return nil, err
+	}
+	if scheme == rawdb.PathScheme && config.NoPruning {
+		return nil, errors.New("archive mode is not supported by the path-based state scheme")
+	}
 	chainConfig, genesisHash, genesisErr := core.SetupGenesisBlockWithOverride(chainDb, config.Genesis, config.OverrideArrowGlacier, config.OverrideTerminalTotalDifficulty)
 	if _, ok := genesisErr.(*params.ConfigCompatError); genesisErr != nil && !ok {
 		return nil, genesisErr
@@ -146,6 +169,12 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if err := pruner.RecoverPruning(stack.ResolvePath(""), chainDb, stack.ResolvePath(config.TrieCleanCacheJournal)); err != nil {
 		log.Error("Failed to recover state", "error", err)
 	}
+	// Every component persists its state through the online pruner (the chain,
+	// but also the state syncer and the APIs), so that state written while a
+	// pruning is running is never deleted.
+	statePruner := pruner.NewOnlinePruner(chainDb, stack.ResolvePath(""))
+	chainDb = statePruner.Database()
+
 	merger := consensus.NewMerger(chainDb)
 	eth := &Ethereum{
 		config:            config,
@@ -161,6 +190,7 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		bloomIndexer:      core.NewBloomIndexer(chainDb, params.BloomBitsBlocks, params.BloomConfirms),
 		p2pServer:         stack.Server(),
 		shutdownTracker:   shutdowncheck.NewShutdownTracker(chainDb),
+		statePruner:       statePruner,
 	}
 	eth.APIBackend = &EthAPIBackend{stack.Config().ExtRPCEnabled(), stack.Config().AllowUnprotectedTxs, eth, nil}
 	if eth.APIBackend.allowUnprotectedTxs {
@@ -200,6 +230,8 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 			TrieTimeLimit:       config.TrieTimeout,
 			SnapshotLimit:       config.SnapshotCache,
 			Preimages:           config.Preimages,
+			HistoryRetain:       config.HistoryRetain,
+			StateScheme:         scheme,
 		}
 	)
 	eth.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, chainConfig, eth.engine, vmConfig, eth.shouldPreserve, &config.TxLookupLimit)
@@ -217,15 +249,35 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
 	}
+	if config.TxPool.Snapshot != "" {
+		config.TxPool.Snapshot = stack.ResolvePath(config.TxPool.Snapshot)
+	}
+	if config.TxPool.DropJournal != "" {
+		config.TxPool.DropJournal = stack.ResolvePath(config.TxPool.DropJournal)
+	}
+	if _, err := config.TxPool.Policy.Filters(); err != nil {
+		return nil, fmt.Errorf("invalid txpool policy: %v", err)
+	}
 	eth.txPool = core.NewTxPool(config.TxPool, chainConfig, eth.blockchain)
+	eth.bundlePool = core.NewBundlePool(chainConfig, eth.blockchain)
 
+	// Collect and cast fast finality votes if the chain ever enables them
+	if p, ok := eth.engine.(*parlia.Parlia); ok && chainConfig.FastFinalityBlock != nil {
+		eth.votePool = vote.NewVotePool(eth.blockchain, p)
+		eth.voteManager = vote.NewVoteManager(chainDb, eth.blockchain, eth.votePool, p)
+		p.SetVotePool(eth.votePool)
+	}
+	// Index the validator history if requested
+	if _, ok := eth.engine.(*parlia.Parlia); ok && config.ParliaHistory {
+		eth.parliaHistory = parlia.NewHistoryIndexer(chainDb, eth.blockchain)
+	}
 	// Permit the downloader to use the trie cache allowance during fast sync
 	cacheLimit := cacheConfig.TrieCleanLimit + cacheConfig.TrieDirtyLimit + cacheConfig.SnapshotLimit
 	checkpoint := config.Checkpoint
 	if checkpoint == nil {
 		checkpoint = params.TrustedCheckpoints[genesisHash]
 	}
-	if eth.handler, err = newHandler(&handlerConfig{
+	handlerConfig := &handlerConfig{
 		Database:        chainDb,
 		Chain:           eth.blockchain,
 		TxPool:          eth.txPool,
@@ -237,10 +289,17 @@ func New(stack *node.Node, config *ethconfig.Config) (*Ethereum, error) {
 		Checkpoint:      checkpoint,
 		Whitelist:       config.Whitelist,
 		DirectBroadcast: config.DirectBroadcast,
-	}); err != nil {
+	}
+	if eth.votePool != nil {
+		handlerConfig.VotePool = eth.votePool
+	}
+	if eth.handler, err = newHandler(handlerConfig); err != nil {
 		return nil, err
 	}
 
+	if _, err := miner.NewOrderer(&config.Miner); err != nil {
+		return nil, fmt.Errorf("invalid miner ordering: %v", err)
+	}
 	eth.miner = miner.New(eth, &config.Miner, chainConfig, eth.EventMux(), eth.engine, eth.isLocalBlock, merger)
 	eth.miner.SetExtra(makeExtraData(config.Miner.ExtraData))
 
@@ -312,6 +371,11 @@ func (s *Ethereum) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   NewPublicMinerAPI(s),
 			Public:    true,
+		}, {
+			Namespace: "eth",
+			Version:   "1.0",
+			Service:   NewPublicBundleAPI(s),
+			Public:    true,
 		}, {
 			Namespace: "eth",
 			Version:   "1.0",
@@ -488,14 +552,51 @@ func (s *Ethereum) StartMining(threads int) error {
 			cli.Authorize(eb, wallet.SignData)
 		}
 		if parlia, ok := s.engine.(*parlia.Parlia); ok {
-			wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
-			if wallet == nil || err != nil {
-				log.Error("Etherbase account unavailable locally", "err", err)
-				return fmt.Errorf("signer missing: %v", err)
+			if endpoint := s.config.Miner.Signer; endpoint != "" {
+				signer, err := external.NewExternalSigner(endpoint)
+				if err != nil {
+					log.Error("External signer unavailable", "endpoint", endpoint, "err", err)
+					return fmt.Errorf("signer unavailable: %v", err)
+				}
+				// Signatures arriving after the block period are of no use
+				timeout := time.Duration(s.blockchain.Config().Parlia.Period) * time.Second
+				if timeout < minRemoteSignTimeout {
+					timeout = minRemoteSignTimeout
+				}
+				signer.SetTimeout(timeout)
+				if !signer.Contains(accounts.Account{Address: eb}) {
+					log.Error("Etherbase account unavailable in external signer", "endpoint", endpoint)
+					return fmt.Errorf("signer missing: %s not in %s", eb, endpoint)
+				}
+				parlia.Authorize(eb, signer.SignData, signer.SignTx)
+				log.Info("Parlia Etherbase account authorized", "account", eb, "signer", endpoint, "timeout", timeout)
+			} else if validators := s.config.ParliaDevValidators; len(validators) > 0 {
+				// Every local validator seals independently, signing with its own wallet
+				signFn := func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+					wallet, err := s.accountManager.Find(account)
+					if err != nil {
+						return nil, err
+					}
+					return wallet.SignData(account, mimeType, data)
+				}
+				signTxFn := func(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+					wallet, err := s.accountManager.Find(account)
+					if err != nil {
+						return nil, err
+					}
+					return wallet.SignTx(account, tx, chainID)
+				}
+				parlia.AuthorizeSealers(validators, signFn, signTxFn)
+				log.Info("Parlia developer validators authorized", "count", len(validators))
+			} else {
+				wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
+				if wallet == nil || err != nil {
+					log.Error("Etherbase account unavailable locally", "err", err)
+					return fmt.Errorf("signer missing: %v", err)
+				}
+				parlia.Authorize(eb, wallet.SignData, wallet.SignTx)
+				log.Info("Parlia Etherbase account authorized", "account", eb)
 			}
-
-			parlia.Authorize(eb, wallet.SignData, wallet.SignTx)
-			log.Info("Parlia Etherbase account authorized", "account", eb)
 		}
 		// If mining is started, we can disable the transaction rejection mechanism
 		// introduced to speed sync times.
@@ -526,6 +627,7 @@ func (s *Ethereum) Miner() *miner.Miner { return s.miner }
 func (s *Ethereum) AccountManager() *accounts.Manager  { return s.accountManager }
 func (s *Ethereum) BlockChain() *core.BlockChain       { return s.blockchain }
 func (s *Ethereum) TxPool() *core.TxPool               { return s.txPool }
+func (s *Ethereum) BundlePool() *core.BundlePool       { return s.bundlePool }
 func (s *Ethereum) EventMux() *event.TypeMux           { return s.eventMux }
 func (s *Ethereum) Engine() consensus.Engine           { return s.engine }
 func (s *Ethereum) ChainDb() ethdb.Database            { return s.chainDb }
@@ -548,6 +650,9 @@ func (s *Ethereum) Protocols() []p2p.Protocol {
 	if s.config.SnapshotCache > 0 {
 		protos = append(protos, snap.MakeProtocols((*snapHandler)(s.handler), s.snapDialCandidates)...)
 	}
+	if s.votePool != nil {
+		protos = append(protos, pulse.MakeProtocols((*pulseHandler)(s.handler))...)
+	}
 	return protos
 }
 
@@ -587,7 +692,16 @@ func (s *Ethereum) Stop() error {
 	s.bloomIndexer.Close()
 	close(s.closeBloomHandler)
 	s.txPool.Stop()
+	s.bundlePool.Stop()
+	if s.votePool != nil {
+		s.voteManager.Stop()
+		s.votePool.Stop()
+	}
+	if s.parliaHistory != nil {
+		s.parliaHistory.Stop()
+	}
 	s.miner.Close()
+	s.statePruner.Stop()
 	s.blockchain.Stop()
 	s.engine.Close()
 
@@ -91,6 +91,10 @@ var Defaults = Config{
 		GasCeil:  40000000,
 		GasPrice: big.NewInt(params.GWei),
 		Recommit: 10 * time.Second,
+
+		Ordering:     miner.OrderingPrice,
+		ReserveGas:   10,
+		AgeThreshold: time.Minute,
 	},
 	TxPool:        core.DefaultTxPoolConfig,
 	RPCGasCap:     50000000,
@@ -137,12 +141,18 @@ type Config struct {
 	EthDiscoveryURLs  []string
 	SnapDiscoveryURLs []string
 
-	NoPruning       bool // Whether to disable pruning and flush everything to disk
-	NoPrefetch      bool // Whether to disable prefetching and only load state on demand
+	NoPruning       bool   // Whether to disable pruning and flush everything to disk
+	StateScheme     string `toml:",omitempty"` // State scheme used to store ethereum state (hash or path)
+	NoPrefetch      bool   // Whether to disable prefetching and only load state on demand
 	DirectBroadcast bool
 	RangeLimit      bool
+	ParliaHistory   bool // Whether to index the Parlia validator set history and signing statistics
+
+	// Local validators taking turns sealing blocks on Parlia developer networks
+	ParliaDevValidators []common.Address `toml:",omitempty"`
 
 	TxLookupLimit uint64 `toml:",omitempty"` // The maximum number of blocks from head whose tx indices are reserved.
+	HistoryRetain uint64 `toml:",omitempty"` // The number of recent blocks whose bodies and receipts are retained (0 = all).
 
 	// Whitelist of required block number -> hash values to accept
 	Whitelist map[uint64]common.Hash `toml:"-"`
@@ -65,6 +65,10 @@ type txPool interface {
 	// AddRemotes should add the given transactions to the pool.
 	AddRemotes([]*types.Transaction) []error
 
+	// IsPrivate returns whether a transaction must not be announced to the
+	// network.
+	IsPrivate(hash common.Hash) bool
+
 	// Pending should return pending transactions.
 	// The slice should be modifiable by the caller.
 	Pending(enforceTips bool) map[common.Address]types.Transactions
@@ -80,6 +84,7 @@ type handlerConfig struct {
 	Database        ethdb.Database            // Database for direct sync insertions
 	Chain           *core.BlockChain          // Blockchain to serve data from
 	TxPool          txPool                    // Transaction pool to propagate from
+	VotePool        votePool                  // Fast finality vote pool to propagate from (nil = disabled)
 	Merger          *consensus.Merger         // The manager for eth1/2 transition
 	Network         uint64                    // Network identifier to adfvertise
 	Sync            downloader.SyncMode       // Whether to snap or full sync
@@ -103,6 +108,7 @@ type handler struct {
 
 	database ethdb.Database
 	txpool   txPool
+	votepool votePool
 	chain    *core.BlockChain
 	maxPeers int
 
@@ -110,12 +116,15 @@ type handler struct {
 	blockFetcher *fetcher.BlockFetcher
 	txFetcher    *fetcher.TxFetcher
 	peers        *peerSet
+	pulsePeers   *pulsePeerSet
 	merger       *consensus.Merger
 
 	eventMux      *event.TypeMux
 	txsCh         chan core.NewTxsEvent
 	txsSub        event.Subscription
 	minedBlockSub *event.TypeMuxSubscription
+	votesCh       chan core.NewVoteEvent
+	votesSub      event.Subscription
 
 	whitelist map[uint64]common.Hash
 
@@ -139,8 +148,10 @@ func newHandler(config *handlerConfig) (*handler, error) {
 		eventMux:        config.EventMux,
 		database:        config.Database,
 		txpool:          config.TxPool,
+		votepool:        config.VotePool,
 		chain:           config.Chain,
 		peers:           newPeerSet(),
+		pulsePeers:      newPulsePeerSet(),
 		merger:          config.Merger,
 		whitelist:       config.Whitelist,
 		quitSync:        make(chan struct{}),
@@ -517,6 +528,14 @@ func (h *handler) Start(maxPeers int) {
 	h.minedBlockSub = h.eventMux.Subscribe(core.NewMinedBlockEvent{})
 	go h.minedBroadcastLoop()
 
+	// broadcast fast finality votes
+	if h.votepool != nil {
+		h.wg.Add(1)
+		h.votesCh = make(chan core.NewVoteEvent, voteChanSize)
+		h.votesSub = h.votepool.SubscribeNewVoteEvent(h.votesCh)
+		go h.voteBroadcastLoop()
+	}
+
 	// start sync handlers
 	h.wg.Add(1)
 	go h.chainSync.loop()
@@ -525,6 +544,9 @@ func (h *handler) Start(maxPeers int) {
 func (h *handler) Stop() {
 	h.txsSub.Unsubscribe()        // quits txBroadcastLoop
 	h.minedBlockSub.Unsubscribe() // quits blockBroadcastLoop
+	if h.votesSub != nil {
+		h.votesSub.Unsubscribe() // quits voteBroadcastLoop
+	}
 
 	// Quit chainSync and txsync64.
 	// After this is done, no new peers will be accepted.
@@ -536,6 +558,7 @@ func (h *handler) Stop() {
 	// sessions which are already established but not added to h.peers yet
 	// will exit when they try to register.
 	h.peers.close()
+	h.pulsePeers.close()
 	h.peerWG.Wait()
 
 	log.Info("Ethereum protocol stopped")
@@ -607,6 +630,9 @@ func (h *handler) BroadcastTransactions(txs types.Transactions) {
 	)
 	// Broadcast transactions to a batch of peers not knowing about it
 	for _, tx := range txs {
+		if h.txpool.IsPrivate(tx.Hash()) {
+			continue
+		}
 		peers := h.peers.peersWithoutTransaction(tx.Hash())
 		// Send the tx unconditionally to a subset of our peers
 		numDirect := int(math.Sqrt(float64(len(peers))))
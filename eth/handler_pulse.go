@@ -0,0 +1,197 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth/protocols/pulse"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enode"
+)
+
+// voteChanSize is the size of channel listening to NewVoteEvent.
+const voteChanSize = 256
+
+// votePool defines the methods needed from a vote pool implementation to
+// support the fast finality vote propagation.
+type votePool interface {
+	// PutVote adds a vote to the pool.
+	PutVote(vote *types.VoteEnvelope)
+
+	// SubscribeNewVoteEvent should return an event subscription of
+	// NewVoteEvent and send events to the given channel.
+	SubscribeNewVoteEvent(chan<- core.NewVoteEvent) event.Subscription
+}
+
+// pulsePeerSet represents the collection of active peers participating in the
+// `pulse` protocol.
+type pulsePeerSet struct {
+	peers  map[string]*pulse.Peer
+	lock   sync.RWMutex
+	closed bool
+}
+
+// newPulsePeerSet creates a new peer set to track the active `pulse` peers.
+func newPulsePeerSet() *pulsePeerSet {
+	return &pulsePeerSet{
+		peers: make(map[string]*pulse.Peer),
+	}
+}
+
+// register injects a new `pulse` peer into the working set.
+func (ps *pulsePeerSet) register(peer *pulse.Peer) error {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	if ps.closed {
+		return errPeerSetClosed
+	}
+	if _, ok := ps.peers[peer.ID()]; ok {
+		return errPeerAlreadyRegistered
+	}
+	ps.peers[peer.ID()] = peer
+	return nil
+}
+
+// unregister removes a remote `pulse` peer from the active set.
+func (ps *pulsePeerSet) unregister(id string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	delete(ps.peers, id)
+}
+
+// peer retrieves the registered `pulse` peer with the given id.
+func (ps *pulsePeerSet) peer(id string) *pulse.Peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	return ps.peers[id]
+}
+
+// peersWithoutVote retrieves a list of peers that do not have a given vote in
+// their set of known hashes.
+func (ps *pulsePeerSet) peersWithoutVote(hash common.Hash) []*pulse.Peer {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	list := make([]*pulse.Peer, 0, len(ps.peers))
+	for _, p := range ps.peers {
+		if !p.KnownVote(hash) {
+			list = append(list, p)
+		}
+	}
+	return list
+}
+
+// close prevents new peers from registering. The connections themselves are
+// torn down together with their `eth` counterparts.
+func (ps *pulsePeerSet) close() {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	ps.closed = true
+}
+
+// pulseHandler implements the pulse.Backend interface to handle the various
+// network packets that are sent as broadcasts.
+type pulseHandler handler
+
+func (h *pulseHandler) Chain() *core.BlockChain { return h.chain }
+
+// RunPeer is invoked when a peer joins on the `pulse` protocol.
+func (h *pulseHandler) RunPeer(peer *pulse.Peer, hand pulse.Handler) error {
+	return (*handler)(h).runPulseExtension(peer, hand)
+}
+
+// PeerInfo retrieves all known `pulse` information about a peer.
+func (h *pulseHandler) PeerInfo(id enode.ID) interface{} {
+	if p := h.pulsePeers.peer(id.String()); p != nil {
+		return &struct {
+			Version uint `json:"version"`
+		}{p.Version()}
+	}
+	return nil
+}
+
+// Handle is invoked from a peer's message handler when it receives a new remote
+// message that the handler couldn't consume and serve itself.
+func (h *pulseHandler) Handle(peer *pulse.Peer, packet pulse.Packet) error {
+	switch packet := packet.(type) {
+	case *pulse.VotesPacket:
+		if h.votepool == nil {
+			return errors.New("unexpected votes, fast finality disabled")
+		}
+		for _, vote := range *packet {
+			h.votepool.PutVote(vote)
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unexpected pulse packet type: %T", packet)
+	}
+}
+
+// runPulseExtension registers a `pulse` peer into the set of vote gossiping
+// peers and starts handling inbound messages.
+func (h *handler) runPulseExtension(peer *pulse.Peer, handler pulse.Handler) error {
+	h.peerWG.Add(1)
+	defer h.peerWG.Done()
+
+	if err := h.pulsePeers.register(peer); err != nil {
+		peer.Log().Error("Pulse extension registration failed", "err", err)
+		return err
+	}
+	defer h.pulsePeers.unregister(peer.ID())
+
+	return handler(peer)
+}
+
+// BroadcastVotes propagates a batch of votes to all the `pulse` peers which
+// are not known to already have them.
+func (h *handler) BroadcastVotes(votes []*types.VoteEnvelope) {
+	voteset := make(map[*pulse.Peer][]*types.VoteEnvelope)
+	for _, vote := range votes {
+		for _, peer := range h.pulsePeers.peersWithoutVote(vote.Hash()) {
+			voteset[peer] = append(voteset[peer], vote)
+		}
+	}
+	for peer, votes := range voteset {
+		peer.AsyncSendVotes(votes)
+	}
+	log.Trace("Vote broadcast", "votes", len(votes), "peers", len(voteset))
+}
+
+// voteBroadcastLoop propagates new votes to connected peers.
+func (h *handler) voteBroadcastLoop() {
+	defer h.wg.Done()
+	for {
+		select {
+		case event := <-h.votesCh:
+			h.BroadcastVotes([]*types.VoteEnvelope{event.Vote})
+		case <-h.votesSub.Err():
+			return
+		}
+	}
+}
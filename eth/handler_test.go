@@ -91,6 +91,11 @@ func (p *testTxPool) AddRemotes(txs []*types.Transaction) []error {
 	return make([]error, len(txs))
 }
 
+// IsPrivate returns whether a transaction must not be announced to the network.
+func (p *testTxPool) IsPrivate(hash common.Hash) bool {
+	return false
+}
+
 // Pending returns all the transactions known to the pool
 func (p *testTxPool) Pending(enforceTips bool) map[common.Address]types.Transactions {
 	p.lock.RLock()
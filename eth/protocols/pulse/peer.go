@@ -0,0 +1,146 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package pulse
+
+import (
+	mapset "github.com/deckarep/golang-set"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p"
+)
+
+const (
+	// maxKnownVotes is the maximum vote hashes to keep in the known list
+	// before starting to randomly evict them.
+	maxKnownVotes = 8192
+
+	// maxQueuedVotes is the maximum number of vote lists to queue up before
+	// dropping broadcasts.
+	maxQueuedVotes = 256
+)
+
+// Peer is a collection of relevant information we have about a `pulse` peer.
+type Peer struct {
+	id string // Unique ID for the peer, cached
+
+	*p2p.Peer                   // The embedded P2P package peer
+	rw        p2p.MsgReadWriter // Input/output streams for pulse
+	version   uint              // Protocol version negotiated
+
+	knownVotes    mapset.Set                 // Set of vote hashes known to be known by this peer
+	voteBroadcast chan []*types.VoteEnvelope // Channel used to queue vote propagation requests
+
+	term   chan struct{} // Termination channel to stop the broadcaster
+	logger log.Logger    // Contextual logger with the peer id injected
+}
+
+// NewPeer create a wrapper for a network connection and negotiated  protocol
+// version.
+func NewPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter) *Peer {
+	id := p.ID().String()
+	peer := &Peer{
+		id:            id,
+		Peer:          p,
+		rw:            rw,
+		version:       version,
+		knownVotes:    mapset.NewSet(),
+		voteBroadcast: make(chan []*types.VoteEnvelope, maxQueuedVotes),
+		term:          make(chan struct{}),
+		logger:        log.New("peer", id[:8]),
+	}
+	go peer.broadcastVotes()
+	return peer
+}
+
+// Close signals the broadcast goroutine to terminate. Only ever call this if
+// you created the peer yourself via NewPeer. Otherwise let whoever created it
+// clean it up!
+func (p *Peer) Close() {
+	close(p.term)
+}
+
+// ID retrieves the peer's unique identifier.
+func (p *Peer) ID() string {
+	return p.id
+}
+
+// Version retrieves the peer's negoatiated `pulse` protocol version.
+func (p *Peer) Version() uint {
+	return p.version
+}
+
+// Log overrides the P2P logget with the higher level one containing only the id.
+func (p *Peer) Log() log.Logger {
+	return p.logger
+}
+
+// KnownVote returns whether peer is known to already have a vote.
+func (p *Peer) KnownVote(hash common.Hash) bool {
+	return p.knownVotes.Contains(hash)
+}
+
+// markVote marks a vote as known for the peer, ensuring that it will never be
+// propagated to this particular peer.
+func (p *Peer) markVote(hash common.Hash) {
+	// If we reached the memory allowance, drop a previously known vote hash
+	for p.knownVotes.Cardinality() >= maxKnownVotes {
+		p.knownVotes.Pop()
+	}
+	p.knownVotes.Add(hash)
+}
+
+// SendVotes propagates a batch of votes to the remote peer.
+func (p *Peer) SendVotes(votes []*types.VoteEnvelope) error {
+	for _, vote := range votes {
+		p.markVote(vote.Hash())
+	}
+	return p2p.Send(p.rw, VotesMsg, votes)
+}
+
+// AsyncSendVotes queues a batch of votes for propagation to the remote peer. If
+// the peer's broadcast queue is full, the votes are silently dropped.
+func (p *Peer) AsyncSendVotes(votes []*types.VoteEnvelope) {
+	select {
+	case p.voteBroadcast <- votes:
+		for _, vote := range votes {
+			p.markVote(vote.Hash())
+		}
+	case <-p.term:
+		p.Log().Debug("Dropping vote propagation", "count", len(votes))
+	default:
+		p.Log().Debug("Dropping vote propagation", "count", len(votes))
+	}
+}
+
+// broadcastVotes is a write loop that schedules vote broadcasts to the remote
+// peer. The goal is to have an async writer that does not lock up node internals.
+func (p *Peer) broadcastVotes() {
+	for {
+		select {
+		case votes := <-p.voteBroadcast:
+			if err := p2p.Send(p.rw, VotesMsg, votes); err != nil {
+				return
+			}
+			p.Log().Trace("Sent votes", "count", len(votes))
+
+		case <-p.term:
+			return
+		}
+	}
+}
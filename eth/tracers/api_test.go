@@ -59,9 +59,15 @@ type testBackend struct {
 }
 
 func newTestBackend(t *testing.T, n int, gspec *core.Genesis, generator func(i int, b *core.BlockGen)) *testBackend {
+	return newTestBackendWithEngine(t, n, gspec, params.TestChainConfig, ethash.NewFaker(), generator)
+}
+
+// newTestBackendWithEngine creates a new test backend running the given chain
+// config and consensus engine.
+func newTestBackendWithEngine(t *testing.T, n int, gspec *core.Genesis, config *params.ChainConfig, engine consensus.Engine, generator func(i int, b *core.BlockGen)) *testBackend {
 	backend := &testBackend{
-		chainConfig: params.TestChainConfig,
-		engine:      ethash.NewFaker(),
+		chainConfig: config,
+		engine:      engine,
 		chaindb:     rawdb.NewMemoryDatabase(),
 	}
 	// Generate blocks for testing
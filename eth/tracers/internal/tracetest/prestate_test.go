@@ -0,0 +1,213 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracetest
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth/tracers"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/tests"
+)
+
+type prestateAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Code    hexutil.Bytes               `json:"code"`
+	Nonce   uint64                      `json:"nonce"`
+	Storage map[common.Hash]common.Hash `json:"storage"`
+}
+
+// runPrestateTracer executes a value transfer to a contract which writes
+// 0x01 into storage slot 0x01, traced by the native prestate tracer.
+func runPrestateTracer(t *testing.T, config *params.ChainConfig, cfg json.RawMessage) (common.Address, common.Address, json.RawMessage) {
+	var to = common.HexToAddress("0x00000000000000000000000000000000deadbeef")
+	privkey, err := crypto.HexToECDSA("0000000000000000deadbeef00000000000000000000000000000000deadbeef")
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	signer := types.NewEIP155Signer(big.NewInt(1))
+	tx, err := types.SignNewTx(privkey, signer, &types.LegacyTx{
+		Nonce:    3,
+		GasPrice: big.NewInt(1),
+		Gas:      50000,
+		To:       &to,
+		Value:    big.NewInt(1000),
+	})
+	if err != nil {
+		t.Fatalf("err %v", err)
+	}
+	origin, _ := signer.Sender(tx)
+	txContext := vm.TxContext{
+		Origin:   origin,
+		GasPrice: big.NewInt(1),
+	}
+	context := vm.BlockContext{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		Coinbase:    common.HexToAddress("0x00000000000000000000000000000000000000c0"),
+		BlockNumber: new(big.Int).SetUint64(8000000),
+		Time:        new(big.Int).SetUint64(5),
+		Difficulty:  big.NewInt(0x30000),
+		GasLimit:    uint64(6000000),
+	}
+	var code = []byte{
+		byte(vm.PUSH1), 0x1, byte(vm.PUSH1), 0x1, byte(vm.SSTORE), // slot 1 = 1
+		byte(vm.PUSH1), 0x2, byte(vm.SLOAD), byte(vm.POP), // read untouched slot 2
+	}
+	var alloc = core.GenesisAlloc{
+		to: core.GenesisAccount{
+			Nonce: 1,
+			Code:  code,
+		},
+		origin: core.GenesisAccount{
+			Nonce:   3,
+			Balance: big.NewInt(500000000000000),
+		},
+		consensus.SystemAddress: core.GenesisAccount{
+			Balance: big.NewInt(7),
+		},
+	}
+	_, statedb := tests.MakePreState(rawdb.NewMemoryDatabase(), alloc, false)
+	tracer, err := tracers.New("prestateTracer", nil, cfg)
+	if err != nil {
+		t.Fatalf("failed to create prestate tracer: %v", err)
+	}
+	evm := vm.NewEVM(context, txContext, statedb, config, vm.Config{Debug: true, Tracer: tracer})
+	msg, err := tx.AsMessage(signer, nil)
+	if err != nil {
+		t.Fatalf("failed to prepare transaction for tracing: %v", err)
+	}
+	st := core.NewStateTransition(evm, msg, new(core.GasPool).AddGas(tx.Gas()))
+	if _, err = st.TransitionDb(); err != nil {
+		t.Fatalf("failed to execute transaction: %v", err)
+	}
+	res, err := tracer.GetResult()
+	if err != nil {
+		t.Fatalf("failed to retrieve trace result: %v", err)
+	}
+	return origin, to, res
+}
+
+// parliaConfig returns a chain config running Parlia without a PrimordialPulse
+// fork, collecting the transaction fees on the system address.
+func parliaConfig() *params.ChainConfig {
+	config := *params.MainnetChainConfig
+	config.Parlia = &params.ParliaConfig{Period: 3, Epoch: 200}
+	config.PrimordialPulseBlock = nil
+	return &config
+}
+
+func TestPrestateTracer(t *testing.T) {
+	origin, to, res := runPrestateTracer(t, params.MainnetChainConfig, nil)
+
+	var have map[common.Address]*prestateAccount
+	if err := json.Unmarshal(res, &have); err != nil {
+		t.Fatalf("failed to unmarshal trace result: %v", err)
+	}
+	if acc := have[origin]; acc == nil || acc.Balance.ToInt().Cmp(big.NewInt(500000000000000)) != 0 || acc.Nonce != 3 {
+		t.Errorf("sender pre-state mismatch: %s", res)
+	}
+	acc := have[to]
+	if acc == nil || acc.Balance.ToInt().Sign() != 0 || acc.Nonce != 1 || len(acc.Code) == 0 {
+		t.Fatalf("recipient pre-state mismatch: %s", res)
+	}
+	if len(acc.Storage) != 2 {
+		t.Errorf("storage slot count mismatch: have %d, want 2", len(acc.Storage))
+	}
+	if _, ok := have[consensus.SystemAddress]; ok {
+		t.Errorf("system address reported without Parlia: %s", res)
+	}
+}
+
+// Tests that under Parlia the system address collecting the fees is part of the
+// traced state, instead of only the coinbase.
+func TestPrestateTracerParlia(t *testing.T) {
+	_, _, res := runPrestateTracer(t, parliaConfig(), nil)
+
+	var have map[common.Address]*prestateAccount
+	if err := json.Unmarshal(res, &have); err != nil {
+		t.Fatalf("failed to unmarshal trace result: %v", err)
+	}
+	if acc := have[consensus.SystemAddress]; acc == nil || acc.Balance.ToInt().Cmp(big.NewInt(7)) != 0 {
+		t.Errorf("system address pre-state mismatch: %s", res)
+	}
+	_, _, res = runPrestateTracer(t, parliaConfig(), json.RawMessage(`{"diffMode": true}`))
+
+	var diff struct {
+		Pre  map[common.Address]*prestateAccount `json:"pre"`
+		Post map[common.Address]*prestateAccount `json:"post"`
+	}
+	if err := json.Unmarshal(res, &diff); err != nil {
+		t.Fatalf("failed to unmarshal trace result: %v", err)
+	}
+	if acc := diff.Post[consensus.SystemAddress]; acc == nil || acc.Balance.ToInt().Cmp(big.NewInt(7)) <= 0 {
+		t.Errorf("system address fee credit missing: %s", res)
+	}
+	if acc := diff.Post[common.HexToAddress("0xc0")]; acc != nil {
+		t.Errorf("coinbase credited under Parlia: %s", res)
+	}
+}
+
+func TestPrestateTracerDiffMode(t *testing.T) {
+	origin, to, res := runPrestateTracer(t, params.MainnetChainConfig, json.RawMessage(`{"diffMode": true}`))
+
+	var have struct {
+		Pre  map[common.Address]*prestateAccount `json:"pre"`
+		Post map[common.Address]*prestateAccount `json:"post"`
+	}
+	if err := json.Unmarshal(res, &have); err != nil {
+		t.Fatalf("failed to unmarshal trace result: %v", err)
+	}
+	if acc := have.Post[origin]; acc == nil || acc.Nonce != 4 || acc.Balance == nil {
+		t.Errorf("sender post-state mismatch: %s", res)
+	}
+	if acc := have.Post[to]; acc == nil || acc.Balance.ToInt().Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("recipient post balance mismatch: %s", res)
+	} else {
+		// Only the written slot is reported, the read-only one is omitted
+		slot := common.BigToHash(big.NewInt(1))
+		if len(acc.Storage) != 1 || acc.Storage[slot] != slot {
+			t.Errorf("recipient post storage mismatch: %s", res)
+		}
+		if len(acc.Code) != 0 || acc.Nonce != 0 {
+			t.Errorf("unmodified fields reported in post state: %s", res)
+		}
+	}
+	if acc := have.Pre[to]; acc == nil || len(acc.Storage) != 0 {
+		t.Errorf("recipient pre storage should omit empty slots: %s", res)
+	}
+}
+
+// Tests that configuration errors of a native tracer are reported, instead of
+// falling through to the other tracer lookups.
+func TestPrestateTracerInvalidConfig(t *testing.T) {
+	_, err := tracers.New("prestateTracer", nil, json.RawMessage(`{"diffMode": 1}`))
+	if err == nil || errors.Is(err, tracers.ErrTracerNotFound) {
+		t.Fatalf("invalid config error mismatch: have %v", err)
+	}
+}
@@ -56,7 +56,11 @@ func init() {
 		name := camel(strings.TrimSuffix(file, ".js"))
 		assetTracers[name] = string(tracers.MustAsset(file))
 	}
-	tracers2.RegisterLookup(true, newJsTracer)
+	// JavaScript tracers are configured through their own code, any tracer
+	// configuration is ignored.
+	tracers2.RegisterLookup(true, func(code string, ctx *tracers2.Context, _ json.RawMessage) (tracers2.Tracer, error) {
+		return newJsTracer(code, ctx)
+	})
 }
 
 // makeSlice convert an unsafe memory pointer with the given type into a Go byte
@@ -825,6 +829,10 @@ func (jst *jsTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
 	}
 }
 
+func (*jsTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (*jsTracer) CaptureTxEnd(restGas uint64) {}
+
 // GetResult calls the Javascript 'result' function and returns its value, or any accumulated error
 func (jst *jsTracer) GetResult() (json.RawMessage, error) {
 	// Transform the context into a JavaScript object and inject into the state
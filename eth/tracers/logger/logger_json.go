@@ -98,3 +98,7 @@ func (l *JSONLogger) CaptureEnter(typ vm.OpCode, from common.Address, to common.
 }
 
 func (l *JSONLogger) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (*JSONLogger) CaptureTxStart(gasLimit uint64) {}
+
+func (*JSONLogger) CaptureTxEnd(restGas uint64) {}
@@ -0,0 +1,197 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package tracers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/ethereum/go-ethereum/trie"
+)
+
+// testSystemContract is the only system contract known to systemTxEngine.
+var testSystemContract = common.HexToAddress("0x0000000000000000000000000000000000001000")
+
+// systemTxEngine is a minimal PoSA engine which, like Parlia, closes every block
+// with a system transaction of the coinbase, after moving the fees collected on
+// the system address to the coinbase.
+type systemTxEngine struct {
+	consensus.Engine
+	key    *ecdsa.PrivateKey
+	signer types.Signer
+}
+
+func (e *systemTxEngine) IsSystemContract(to *common.Address) bool {
+	return to != nil && *to == testSystemContract
+}
+
+func (e *systemTxEngine) IsSystemTransaction(tx *types.Transaction, header *types.Header) (bool, error) {
+	if !e.IsSystemContract(tx.To()) || tx.GasPrice().Sign() != 0 {
+		return false, nil
+	}
+	sender, err := types.Sender(e.signer, tx)
+	if err != nil {
+		return false, err
+	}
+	return sender == header.Coinbase, nil
+}
+
+func (e *systemTxEngine) EnoughDistance(chain consensus.ChainReader, header *types.Header) bool {
+	return true
+}
+
+func (e *systemTxEngine) IsActiveValidatorAt(chain consensus.ChainHeaderReader, header *types.Header) bool {
+	return false
+}
+
+func (e *systemTxEngine) VerifyVote(chain consensus.ChainHeaderReader, vote *types.VoteEnvelope) error {
+	return errors.New("votes not supported")
+}
+
+func (e *systemTxEngine) SignVote(data *types.VoteData) (*types.VoteEnvelope, error) {
+	return nil, errors.New("votes not supported")
+}
+
+func (e *systemTxEngine) GetJustifiedNumberAndHash(chain consensus.ChainHeaderReader, header *types.Header) (uint64, common.Hash, error) {
+	return 0, common.Hash{}, nil
+}
+
+func (e *systemTxEngine) GetFinalizedHeader(chain consensus.ChainHeaderReader, header *types.Header) *types.Header {
+	return nil
+}
+
+// systemChainContext adapts a header reader into the chain context needed to
+// apply the system transactions.
+type systemChainContext struct {
+	consensus.ChainHeaderReader
+	engine consensus.Engine
+}
+
+func (c *systemChainContext) Engine() consensus.Engine { return c.engine }
+
+func (e *systemTxEngine) Finalize(chain consensus.ChainHeaderReader, header *types.Header, statedb *state.StateDB, txs *[]*types.Transaction,
+	uncles []*types.Header, receipts *[]*types.Receipt, systemTxs *[]*types.Transaction, usedGas *uint64) error {
+	for _, tx := range *systemTxs {
+		balance := statedb.GetBalance(consensus.SystemAddress)
+		statedb.SetBalance(consensus.SystemAddress, new(big.Int))
+		statedb.AddBalance(header.Coinbase, balance)
+
+		statedb.Prepare(tx.Hash(), len(*txs))
+		receipt, err := core.ApplyTransaction(chain.Config(), &systemChainContext{chain, e}, &header.Coinbase, new(core.GasPool).AddGas(tx.Gas()), statedb, header, tx, usedGas, vm.Config{})
+		if err != nil {
+			return err
+		}
+		*txs = append(*txs, tx)
+		*receipts = append(*receipts, receipt)
+	}
+	return e.Engine.Finalize(chain, header, statedb, txs, uncles, receipts, systemTxs, usedGas)
+}
+
+func (e *systemTxEngine) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header *types.Header, statedb *state.StateDB,
+	txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, []*types.Receipt, error) {
+	tx, err := types.SignTx(types.NewTransaction(statedb.GetNonce(header.Coinbase), testSystemContract, common.Big0, 100000, common.Big0, nil), e.signer, e.key)
+	if err != nil {
+		return nil, nil, err
+	}
+	systemTxs := []*types.Transaction{tx}
+	if err := e.Finalize(chain, header, statedb, &txs, uncles, &receipts, &systemTxs, &header.GasUsed); err != nil {
+		return nil, nil, err
+	}
+	return types.NewBlock(header, txs, uncles, receipts, trie.NewStackTrie(nil)), receipts, nil
+}
+
+// Tests that tracing blocks with Parlia system transactions credits the fees
+// collected on the system address to the coinbase ahead of the system call,
+// the same way block processing does.
+func TestTraceBlockSystemTransactions(t *testing.T) {
+	t.Parallel()
+
+	// Run Parlia fee collection without London, as system transactions are free
+	config := *params.TestChainConfig
+	config.LondonBlock = nil
+	config.ArrowGlacierBlock = nil
+	config.Parlia = &params.ParliaConfig{Period: 3, Epoch: 200}
+	config.PrimordialPulseBlock = nil
+
+	accounts := newAccounts(2)
+	engine := &systemTxEngine{
+		Engine: ethash.NewFaker(),
+		key:    accounts[1].key,
+		signer: types.LatestSigner(&config),
+	}
+	// The system contract returns the balances of the system address and the coinbase
+	code := append(append([]byte{byte(vm.PUSH20)}, consensus.SystemAddress.Bytes()...), common.FromHex("0x31600052413160205260406000f3")...)
+	genesis := &core.Genesis{Alloc: core.GenesisAlloc{
+		accounts[0].addr:   {Balance: big.NewInt(params.Ether)},
+		testSystemContract: {Code: code, Balance: new(big.Int)},
+	}}
+	var (
+		genBlocks = 3
+		gasPrice  = big.NewInt(params.GWei)
+		fee       = new(big.Int).Mul(gasPrice, big.NewInt(int64(params.TxGas)))
+	)
+	backend := newTestBackendWithEngine(t, genBlocks, genesis, &config, engine, func(i int, b *core.BlockGen) {
+		b.SetCoinbase(accounts[1].addr)
+		tx, _ := types.SignTx(types.NewTransaction(uint64(i), common.Address{0xbb}, big.NewInt(1000), params.TxGas, gasPrice, nil), engine.signer, accounts[0].key)
+		b.AddTx(tx)
+	})
+	api := NewAPI(backend)
+
+	for number := 1; number <= genBlocks; number++ {
+		block := backend.chain.GetBlockByNumber(uint64(number))
+		if len(block.Transactions()) != 2 {
+			t.Fatalf("block %d: transaction count mismatch: have %d, want 2", number, len(block.Transactions()))
+		}
+		results, err := api.TraceBlockByNumber(context.Background(), rpc.BlockNumber(number), nil)
+		if err != nil {
+			t.Fatalf("block %d: failed to trace: %v", number, err)
+		}
+		result, ok := results[1].Result.(*ethapi.ExecutionResult)
+		if !ok || result.Failed {
+			t.Fatalf("block %d: system transaction trace mismatch: %+v", number, results[1])
+		}
+		ret := common.FromHex(result.ReturnValue)
+		if len(ret) != 64 {
+			t.Fatalf("block %d: return value length mismatch: have %d, want 64", number, len(ret))
+		}
+		// The system call must see the fees of the block moved to the coinbase
+		parent, err := backend.chain.StateAt(backend.chain.GetHeaderByNumber(uint64(number - 1)).Root)
+		if err != nil {
+			t.Fatalf("block %d: missing parent state: %v", number, err)
+		}
+		want := new(big.Int).Add(parent.GetBalance(accounts[1].addr), fee)
+		if have := new(big.Int).SetBytes(ret[:32]); have.Sign() != 0 {
+			t.Errorf("block %d: system address balance mismatch: have %v, want 0", number, have)
+		}
+		if have := new(big.Int).SetBytes(ret[32:]); have.Cmp(want) != 0 {
+			t.Errorf("block %d: coinbase balance mismatch: have %v, want %v", number, have, want)
+		}
+	}
+}
@@ -291,6 +291,9 @@ func TestEthClient(t *testing.T) {
 		"TransactionSender": {
 			func(t *testing.T) { testTransactionSender(t, client) },
 		},
+		"BlockReceipts": {
+			func(t *testing.T) { testBlockReceipts(t, chain, client) },
+		},
 	}
 
 	t.Parallel()
@@ -639,6 +642,56 @@ func testTransactionSender(t *testing.T, client *rpc.Client) {
 	}
 }
 
+func testBlockReceipts(t *testing.T, chain []*types.Block, client *rpc.Client) {
+	ec := NewClient(client)
+	ctx := context.Background()
+
+	// Block #2 carries both test transactions, look it up by number and hash.
+	for _, arg := range []rpc.BlockNumberOrHash{
+		rpc.BlockNumberOrHashWithNumber(2),
+		rpc.BlockNumberOrHashWithHash(chain[2].Hash(), false),
+	} {
+		receipts, err := ec.BlockReceipts(ctx, arg)
+		if err != nil {
+			t.Fatalf("can't get block receipts: %v", err)
+		}
+		if len(receipts) != 2 {
+			t.Fatalf("wrong number of receipts: have %d, want 2", len(receipts))
+		}
+		for i, tx := range []*types.Transaction{testTx1, testTx2} {
+			receipt := receipts[i]
+			if receipt.TxHash != tx.Hash() {
+				t.Errorf("receipt %d: wrong tx hash %v, want %v", i, receipt.TxHash, tx.Hash())
+			}
+			if receipt.BlockHash != chain[2].Hash() {
+				t.Errorf("receipt %d: wrong block hash %v, want %v", i, receipt.BlockHash, chain[2].Hash())
+			}
+			if receipt.Status != types.ReceiptStatusSuccessful {
+				t.Errorf("receipt %d: wrong status %d", i, receipt.Status)
+			}
+			single, err := ec.TransactionReceipt(ctx, tx.Hash())
+			if err != nil {
+				t.Fatalf("can't get receipt: %v", err)
+			}
+			if !reflect.DeepEqual(receipt, single) {
+				t.Errorf("receipt %d: mismatch with single receipt:\nhave %+v\nwant %+v", i, receipt, single)
+			}
+		}
+	}
+	// Blocks without transactions have no receipts.
+	receipts, err := ec.BlockReceipts(ctx, rpc.BlockNumberOrHashWithNumber(1))
+	if err != nil {
+		t.Fatalf("can't get block receipts: %v", err)
+	}
+	if len(receipts) != 0 {
+		t.Fatalf("wrong number of receipts: have %d, want 0", len(receipts))
+	}
+	// Unknown blocks are reported as not found.
+	if _, err := ec.BlockReceipts(ctx, rpc.BlockNumberOrHashWithNumber(1337)); err != ethereum.NotFound {
+		t.Fatalf("wrong error for unknown block: %v", err)
+	}
+}
+
 func sendTransaction(ec *Client) error {
 	chainID, err := ec.ChainID(context.Background())
 	if err != nil {
@@ -88,6 +88,10 @@ type AncientReader interface {
 
 	// AncientSize returns the ancient size of the specified category.
 	AncientSize(kind string) (uint64, error)
+
+	// AncientTail returns the number of the first item still available in the
+	// specified category, items below it were deleted to expire history.
+	AncientTail(kind string) (uint64, error)
 }
 
 // AncientBatchReader is the interface for 'batched' or 'atomic' reading.
@@ -109,6 +113,10 @@ type AncientWriter interface {
 	// TruncateAncients discards all but the first n ancient data from the ancient store.
 	TruncateAncients(n uint64) error
 
+	// TruncateTail discards the block bodies and receipts below the first n items
+	// from the ancient store. Headers and the other chain data are retained.
+	TruncateTail(n uint64) error
+
 	// Sync flushes all in-memory ancient store data to disk.
 	Sync() error
 }
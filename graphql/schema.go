@@ -132,6 +132,9 @@ const schema string = `
         # Logs is a list of log entries emitted by this transaction. If the
         # transaction has not yet been mined, this field will be null.
         logs: [Log!]
+        # LogsBloom is the bloom filter of the logs emitted by this transaction.
+        # If the transaction has not yet been mined, this field will be null.
+        logsBloom: Bytes
         r: BigInt!
         s: BigInt!
         v: BigInt!
@@ -0,0 +1,93 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// accumulatorDepth is the depth of the merkle tree over the header records of
+// a single archive, holding up to MaxSize leaves.
+const accumulatorDepth = 13
+
+// ComputeAccumulator calculates the accumulator root of an archive, which is
+// the SSZ hash tree root of the list of (block hash, total difficulty) header
+// records, limited to MaxSize entries.
+func ComputeAccumulator(hashes []common.Hash, tds []*big.Int) (common.Hash, error) {
+	if len(hashes) != len(tds) {
+		return common.Hash{}, fmt.Errorf("hash and total difficulty count mismatch: %d != %d", len(hashes), len(tds))
+	}
+	if len(hashes) > MaxSize {
+		return common.Hash{}, fmt.Errorf("too many header records: %d > %d", len(hashes), MaxSize)
+	}
+	layer := make([][32]byte, len(hashes))
+	for i := range hashes {
+		td, err := uint256LE(tds[i])
+		if err != nil {
+			return common.Hash{}, err
+		}
+		layer[i] = sha256.Sum256(append(hashes[i].Bytes(), td[:]...))
+	}
+	// Merkleize the records, padding each layer with the zero subtree root
+	var zero [32]byte
+	for d := 0; d < accumulatorDepth; d++ {
+		if len(layer)%2 == 1 {
+			layer = append(layer, zero)
+		}
+		next := make([][32]byte, len(layer)/2)
+		for i := range next {
+			next[i] = sha256.Sum256(append(layer[2*i][:], layer[2*i+1][:]...))
+		}
+		zero = sha256.Sum256(append(zero[:], zero[:]...))
+		layer = next
+	}
+	root := zero
+	if len(layer) > 0 {
+		root = layer[0]
+	}
+	// Mix in the length of the list
+	var length [32]byte
+	binary.LittleEndian.PutUint64(length[:], uint64(len(hashes)))
+	return sha256.Sum256(append(root[:], length[:]...)), nil
+}
+
+// uint256LE encodes a non-negative integer as a 32 byte little endian value.
+func uint256LE(v *big.Int) ([32]byte, error) {
+	var out [32]byte
+	if v == nil || v.Sign() < 0 || v.BitLen() > 256 {
+		return out, fmt.Errorf("invalid total difficulty: %v", v)
+	}
+	be := v.Bytes()
+	for i, b := range be {
+		out[len(be)-1-i] = b
+	}
+	return out, nil
+}
+
+// bigFromLE decodes a little endian encoded integer.
+func bigFromLE(b []byte) *big.Int {
+	be := make([]byte, len(b))
+	for i := range b {
+		be[len(b)-1-i] = b[i]
+	}
+	return new(big.Int).SetBytes(be)
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// headerSize is the size of an e2store entry header: a 2 byte type, a 4 byte
+// little endian value length and 2 reserved zero bytes.
+const headerSize = 8
+
+// maxEntrySize caps the length of a single entry value accepted by the reader.
+const maxEntrySize = 256 * 1024 * 1024
+
+var errReserved = errors.New("reserved bytes of entry header are not zero")
+
+// entry is a single type-length-value record of an e2store file.
+type entry struct {
+	typ   uint16
+	value []byte
+}
+
+// writer appends e2store entries to an output stream.
+type writer struct {
+	w io.Writer
+}
+
+// write encodes a single entry into the output stream, returning the number of
+// bytes written including the entry header.
+func (w *writer) write(typ uint16, value []byte) (int, error) {
+	var header [headerSize]byte
+	binary.LittleEndian.PutUint16(header[0:2], typ)
+	binary.LittleEndian.PutUint32(header[2:6], uint32(len(value)))
+	if n, err := w.w.Write(header[:]); err != nil {
+		return n, err
+	}
+	n, err := w.w.Write(value)
+	return headerSize + n, err
+}
+
+// readEntryHeader decodes the entry header at the given offset, returning the
+// entry type and the value length.
+func readEntryHeader(r io.ReaderAt, off int64) (uint16, uint32, error) {
+	var header [headerSize]byte
+	if _, err := r.ReadAt(header[:], off); err != nil {
+		return 0, 0, err
+	}
+	if header[6] != 0 || header[7] != 0 {
+		return 0, 0, errReserved
+	}
+	length := binary.LittleEndian.Uint32(header[2:6])
+	if length > maxEntrySize {
+		return 0, 0, fmt.Errorf("entry too large: %d bytes", length)
+	}
+	return binary.LittleEndian.Uint16(header[0:2]), length, nil
+}
+
+// readEntry decodes the entry at the given offset, returning it along with the
+// total number of bytes it occupies.
+func readEntry(r io.ReaderAt, off int64) (*entry, int64, error) {
+	typ, length, err := readEntryHeader(r, off)
+	if err != nil {
+		return nil, 0, err
+	}
+	value := make([]byte, length)
+	if _, err := r.ReadAt(value, off+headerSize); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	return &entry{typ: typ, value: value}, headerSize + int64(length), nil
+}
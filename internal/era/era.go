@@ -0,0 +1,416 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package era implements the era1 flat archive format for block history.
+//
+// An era1 file is an e2store file holding a fixed range of blocks:
+//
+//	Version | block-tuple* | Accumulator | BlockIndex
+//	block-tuple = CompressedHeader | CompressedBody | CompressedReceipts | TotalDifficulty
+//
+// Headers, bodies and receipts (in storage format) are RLP encoded and snappy
+// compressed using the framing format. The total difficulty is a 32 byte little
+// endian integer. The accumulator is the SSZ hash tree root of the (block hash,
+// total difficulty) records of the file, and the block index maps each block
+// number to the offset of its tuple:
+//
+//	BlockIndex = starting-number | offset* | count
+//
+// All index values are 8 byte little endian integers, the offsets are relative
+// to the beginning of the block index entry.
+package era
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"os"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/trie"
+	"github.com/golang/snappy"
+)
+
+const (
+	TypeVersion            uint16 = 0x3265
+	TypeCompressedHeader   uint16 = 0x03
+	TypeCompressedBody     uint16 = 0x04
+	TypeCompressedReceipts uint16 = 0x05
+	TypeTotalDifficulty    uint16 = 0x06
+	TypeAccumulator        uint16 = 0x07
+	TypeBlockIndex         uint16 = 0x3266
+
+	// MaxSize is the number of blocks held by a single era1 file.
+	MaxSize = 8192
+)
+
+// Filename returns the canonical name of an era1 file, composed of the network
+// name, the epoch number and the leading bytes of the accumulator root.
+func Filename(network string, epoch uint64, root common.Hash) string {
+	return fmt.Sprintf("%s-%05d-%x.era1", network, epoch, root[:4])
+}
+
+// Builder writes blocks into an era1 file. Blocks must be added in order and a
+// file holds at most MaxSize blocks.
+type Builder struct {
+	w       *writer
+	start   uint64
+	offsets []int64
+	hashes  []common.Hash
+	tds     []*big.Int
+	written int64
+}
+
+// NewBuilder creates an era1 builder writing into the given stream.
+func NewBuilder(w io.Writer) *Builder {
+	return &Builder{w: &writer{w: w}}
+}
+
+// AddRLP appends a block in its RLP encoded form to the archive. The receipts
+// are expected in storage format.
+func (b *Builder) AddRLP(header, body, receipts []byte, number uint64, hash common.Hash, td *big.Int) error {
+	if len(b.offsets) == 0 {
+		b.start = number
+		n, err := b.w.write(TypeVersion, nil)
+		if err != nil {
+			return err
+		}
+		b.written += int64(n)
+	}
+	if len(b.offsets) >= MaxSize {
+		return fmt.Errorf("exceeding maximum blocks per archive: %d", MaxSize)
+	}
+	if want := b.start + uint64(len(b.offsets)); number != want {
+		return fmt.Errorf("non-contiguous block: have %d, want %d", number, want)
+	}
+	tdLE, err := uint256LE(td)
+	if err != nil {
+		return err
+	}
+	b.offsets = append(b.offsets, b.written)
+	b.hashes = append(b.hashes, hash)
+	b.tds = append(b.tds, new(big.Int).Set(td))
+
+	for _, item := range []struct {
+		typ  uint16
+		data []byte
+	}{
+		{TypeCompressedHeader, header},
+		{TypeCompressedBody, body},
+		{TypeCompressedReceipts, receipts},
+	} {
+		compressed, err := compress(item.data)
+		if err != nil {
+			return err
+		}
+		if err := b.write(item.typ, compressed); err != nil {
+			return err
+		}
+	}
+	return b.write(TypeTotalDifficulty, tdLE[:])
+}
+
+// Finalize writes the accumulator and the block index, returning the
+// accumulator root of the archive.
+func (b *Builder) Finalize() (common.Hash, error) {
+	if len(b.offsets) == 0 {
+		return common.Hash{}, errors.New("no blocks added")
+	}
+	root, err := ComputeAccumulator(b.hashes, b.tds)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if err := b.write(TypeAccumulator, root.Bytes()); err != nil {
+		return common.Hash{}, err
+	}
+	index := make([]byte, 16+8*len(b.offsets))
+	binary.LittleEndian.PutUint64(index, b.start)
+	for i, offset := range b.offsets {
+		binary.LittleEndian.PutUint64(index[8+8*i:], uint64(offset-b.written))
+	}
+	binary.LittleEndian.PutUint64(index[8+8*len(b.offsets):], uint64(len(b.offsets)))
+	if err := b.write(TypeBlockIndex, index); err != nil {
+		return common.Hash{}, err
+	}
+	return root, nil
+}
+
+// write appends an entry to the archive, tracking the written size.
+func (b *Builder) write(typ uint16, value []byte) error {
+	n, err := b.w.write(typ, value)
+	b.written += int64(n)
+	return err
+}
+
+// Block is the content of a single block stored in an era1 file.
+type Block struct {
+	Number          uint64
+	Hash            common.Hash
+	Header          rlp.RawValue
+	Body            rlp.RawValue
+	Receipts        rlp.RawValue // Receipts in storage format
+	TotalDifficulty *big.Int
+}
+
+// ReadAtCloser is the storage backing an opened era1 file.
+type ReadAtCloser interface {
+	io.ReaderAt
+	io.Closer
+}
+
+// Era is an opened era1 file.
+type Era struct {
+	f      ReadAtCloser
+	start  uint64  // Number of the first block
+	count  uint64  // Number of blocks in the file
+	index  int64   // Offset of the block index entry
+	blocks []int64 // Absolute offsets of the block tuples
+}
+
+// Open opens the era1 file at the given path.
+func Open(path string) (*Era, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	e, err := From(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return e, nil
+}
+
+// From opens an era1 archive of the given size from the backing storage.
+func From(f ReadAtCloser, size int64) (*Era, error) {
+	typ, _, err := readEntryHeader(f, 0)
+	if err != nil {
+		return nil, err
+	}
+	if typ != TypeVersion {
+		return nil, fmt.Errorf("invalid version entry type: %#x", typ)
+	}
+	// The block count is the last value of the file, locate the index from it
+	if size < headerSize+24 {
+		return nil, errors.New("archive too short")
+	}
+	var buf [8]byte
+	if _, err := f.ReadAt(buf[:], size-8); err != nil {
+		return nil, err
+	}
+	count := binary.LittleEndian.Uint64(buf[:])
+	if count == 0 || count > MaxSize {
+		return nil, fmt.Errorf("invalid block count: %d", count)
+	}
+	e := &Era{f: f, count: count, index: size - headerSize - 16 - 8*int64(count)}
+	if e.index < 0 {
+		return nil, errors.New("archive too short for block index")
+	}
+	ent, length, err := readEntry(f, e.index)
+	if err != nil {
+		return nil, err
+	}
+	if ent.typ != TypeBlockIndex || e.index+length != size {
+		return nil, errors.New("invalid block index entry")
+	}
+	e.start = binary.LittleEndian.Uint64(ent.value)
+	for i := uint64(0); i < count; i++ {
+		offset := e.index + int64(binary.LittleEndian.Uint64(ent.value[8+8*i:]))
+		if offset < headerSize || offset >= e.index {
+			return nil, fmt.Errorf("invalid offset of block %d", e.start+i)
+		}
+		e.blocks = append(e.blocks, offset)
+	}
+	return e, nil
+}
+
+// Close closes the backing storage of the archive.
+func (e *Era) Close() error {
+	return e.f.Close()
+}
+
+// Start returns the number of the first block in the archive.
+func (e *Era) Start() uint64 {
+	return e.start
+}
+
+// Count returns the number of blocks in the archive.
+func (e *Era) Count() uint64 {
+	return e.count
+}
+
+// Accumulator returns the accumulator root stored in the archive.
+func (e *Era) Accumulator() (common.Hash, error) {
+	// The accumulator entry directly precedes the block index
+	ent, _, err := readEntry(e.f, e.index-headerSize-common.HashLength)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if ent.typ != TypeAccumulator || len(ent.value) != common.HashLength {
+		return common.Hash{}, errors.New("invalid accumulator entry")
+	}
+	return common.BytesToHash(ent.value), nil
+}
+
+// Block reads the block with the given number from the archive.
+func (e *Era) Block(number uint64) (*Block, error) {
+	if number < e.start || number >= e.start+e.count {
+		return nil, fmt.Errorf("block %d out of range [%d, %d)", number, e.start, e.start+e.count)
+	}
+	var (
+		off   = e.blocks[number-e.start]
+		block = &Block{Number: number}
+	)
+	for _, item := range []struct {
+		typ uint16
+		dst *rlp.RawValue
+	}{
+		{TypeCompressedHeader, &block.Header},
+		{TypeCompressedBody, &block.Body},
+		{TypeCompressedReceipts, &block.Receipts},
+	} {
+		ent, length, err := readEntry(e.f, off)
+		if err != nil {
+			return nil, err
+		}
+		if ent.typ != item.typ {
+			return nil, fmt.Errorf("block %d: unexpected entry type %#x, want %#x", number, ent.typ, item.typ)
+		}
+		if *item.dst, err = decompress(ent.value); err != nil {
+			return nil, fmt.Errorf("block %d: %v", number, err)
+		}
+		off += length
+	}
+	ent, _, err := readEntry(e.f, off)
+	if err != nil {
+		return nil, err
+	}
+	if ent.typ != TypeTotalDifficulty || len(ent.value) != 32 {
+		return nil, fmt.Errorf("block %d: invalid total difficulty entry", number)
+	}
+	block.TotalDifficulty = bigFromLE(ent.value)
+	block.Hash = crypto.Keccak256Hash(block.Header)
+	return block, nil
+}
+
+// Verify checks the integrity of the archive: the accumulator root has to
+// match the one recomputed from the stored headers and total difficulties,
+// the blocks have to be chained and the bodies and receipts have to match the
+// roots committed to by the headers. The accumulator root is returned.
+func (e *Era) Verify() (common.Hash, error) {
+	var (
+		hashes = make([]common.Hash, 0, e.count)
+		tds    = make([]*big.Int, 0, e.count)
+		parent common.Hash
+	)
+	for n := e.start; n < e.start+e.count; n++ {
+		block, err := e.Block(n)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		header, err := block.verify()
+		if err != nil {
+			return common.Hash{}, err
+		}
+		if n > e.start && header.ParentHash != parent {
+			return common.Hash{}, fmt.Errorf("block %d: parent hash mismatch", n)
+		}
+		parent = block.Hash
+		hashes, tds = append(hashes, block.Hash), append(tds, block.TotalDifficulty)
+	}
+	want, err := e.Accumulator()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	have, err := ComputeAccumulator(hashes, tds)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	if have != want {
+		return common.Hash{}, fmt.Errorf("accumulator mismatch: have %x, want %x", have, want)
+	}
+	return have, nil
+}
+
+// verify checks that the body and receipts of the block match the header,
+// returning the decoded header.
+func (b *Block) verify() (*types.Header, error) {
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(b.Header, header); err != nil {
+		return nil, fmt.Errorf("block %d: invalid header: %v", b.Number, err)
+	}
+	if header.Number.Uint64() != b.Number {
+		return nil, fmt.Errorf("block %d: header number mismatch: %d", b.Number, header.Number)
+	}
+	var body types.Body
+	if err := rlp.DecodeBytes(b.Body, &body); err != nil {
+		return nil, fmt.Errorf("block %d: invalid body: %v", b.Number, err)
+	}
+	if hash := types.DeriveSha(types.Transactions(body.Transactions), trie.NewStackTrie(nil)); hash != header.TxHash {
+		return nil, fmt.Errorf("block %d: transaction root mismatch: have %x, want %x", b.Number, hash, header.TxHash)
+	}
+	if hash := types.CalcUncleHash(body.Uncles); hash != header.UncleHash {
+		return nil, fmt.Errorf("block %d: uncle root mismatch: have %x, want %x", b.Number, hash, header.UncleHash)
+	}
+	var stored []*types.ReceiptForStorage
+	if err := rlp.DecodeBytes(b.Receipts, &stored); err != nil {
+		return nil, fmt.Errorf("block %d: invalid receipts: %v", b.Number, err)
+	}
+	if len(stored) != len(body.Transactions) {
+		return nil, fmt.Errorf("block %d: receipt count mismatch: have %d, want %d", b.Number, len(stored), len(body.Transactions))
+	}
+	// The storage format omits the receipt type and bloom, restore them
+	receipts := make(types.Receipts, len(stored))
+	for i, receipt := range stored {
+		receipts[i] = (*types.Receipt)(receipt)
+		receipts[i].Type = body.Transactions[i].Type()
+		receipts[i].Bloom = types.CreateBloom(types.Receipts{receipts[i]})
+	}
+	if hash := types.DeriveSha(receipts, trie.NewStackTrie(nil)); hash != header.ReceiptHash {
+		return nil, fmt.Errorf("block %d: receipt root mismatch: have %x, want %x", b.Number, hash, header.ReceiptHash)
+	}
+	return header, nil
+}
+
+// compress encodes the data with the snappy framing format.
+func compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := snappy.NewBufferedWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress decodes data encoded with the snappy framing format.
+func decompress(data []byte) ([]byte, error) {
+	return ioutil.ReadAll(snappy.NewReader(bytes.NewReader(data)))
+}
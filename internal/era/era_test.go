@@ -0,0 +1,240 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package era
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// testBlock is a block in the RLP encoded form stored in archives.
+type testBlock struct {
+	hash     common.Hash
+	header   []byte
+	body     []byte
+	receipts []byte
+	td       *big.Int
+}
+
+// makeTestBlocks generates a chain of blocks with transactions, starting with
+// the genesis block.
+func makeTestBlocks(t *testing.T, n int) []testBlock {
+	var (
+		key, _  = crypto.GenerateKey()
+		addr    = crypto.PubkeyToAddress(key.PublicKey)
+		db      = rawdb.NewMemoryDatabase()
+		gspec   = &core.Genesis{Config: params.TestChainConfig, Alloc: core.GenesisAlloc{addr: {Balance: big.NewInt(params.Ether)}}}
+		genesis = gspec.MustCommit(db)
+		signer  = types.LatestSigner(gspec.Config)
+	)
+	blocks, receipts := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, n-1, func(i int, b *core.BlockGen) {
+		for j := 0; j < i%3; j++ {
+			tx, _ := types.SignTx(types.NewTransaction(b.TxNonce(addr), common.Address{0x01}, big.NewInt(1), params.TxGas, b.BaseFee(), nil), signer, key)
+			b.AddTx(tx)
+		}
+	})
+	var (
+		out = make([]testBlock, 0, n)
+		td  = new(big.Int)
+	)
+	encode := func(block *types.Block, receipts types.Receipts) {
+		header, _ := rlp.EncodeToBytes(block.Header())
+		body, _ := rlp.EncodeToBytes(block.Body())
+		stored := make([]*types.ReceiptForStorage, len(receipts))
+		for i, receipt := range receipts {
+			stored[i] = (*types.ReceiptForStorage)(receipt)
+		}
+		encoded, _ := rlp.EncodeToBytes(stored)
+		td = new(big.Int).Add(td, block.Difficulty())
+		out = append(out, testBlock{hash: block.Hash(), header: header, body: body, receipts: encoded, td: td})
+	}
+	encode(genesis, nil)
+	for i, block := range blocks {
+		encode(block, receipts[i])
+	}
+	return out
+}
+
+// buildArchive writes the blocks into an archive starting at the given number.
+func buildArchive(t *testing.T, blocks []testBlock, start uint64) ([]byte, common.Hash) {
+	var (
+		buf     = new(bytes.Buffer)
+		builder = NewBuilder(buf)
+	)
+	for i, block := range blocks {
+		if err := builder.AddRLP(block.header, block.body, block.receipts, start+uint64(i), block.hash, block.td); err != nil {
+			t.Fatalf("failed to add block %d: %v", i, err)
+		}
+	}
+	root, err := builder.Finalize()
+	if err != nil {
+		t.Fatalf("failed to finalize archive: %v", err)
+	}
+	return buf.Bytes(), root
+}
+
+// openArchive opens an in-memory archive.
+func openArchive(t *testing.T, blob []byte) *Era {
+	path := filepath.Join(t.TempDir(), "test.era1")
+	if err := os.WriteFile(path, blob, 0644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := Open(path)
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	t.Cleanup(func() { e.Close() })
+	return e
+}
+
+// Tests that blocks written into an archive can be read back and verified.
+func TestArchiveRoundtrip(t *testing.T) {
+	blocks := makeTestBlocks(t, 32)
+	blob, root := buildArchive(t, blocks, 0)
+
+	e := openArchive(t, blob)
+	if e.Start() != 0 || e.Count() != uint64(len(blocks)) {
+		t.Fatalf("range mismatch: have [%d, +%d), want [0, +%d)", e.Start(), e.Count(), len(blocks))
+	}
+	if acc, err := e.Accumulator(); err != nil || acc != root {
+		t.Fatalf("accumulator mismatch: have %x (%v), want %x", acc, err, root)
+	}
+	for i, want := range blocks {
+		block, err := e.Block(uint64(i))
+		if err != nil {
+			t.Fatalf("failed to read block %d: %v", i, err)
+		}
+		if block.Number != uint64(i) || block.Hash != want.hash {
+			t.Errorf("block %d: id mismatch: have #%d %x, want %x", i, block.Number, block.Hash, want.hash)
+		}
+		if !bytes.Equal(block.Header, want.header) || !bytes.Equal(block.Body, want.body) || !bytes.Equal(block.Receipts, want.receipts) {
+			t.Errorf("block %d: content mismatch", i)
+		}
+		if block.TotalDifficulty.Cmp(want.td) != 0 {
+			t.Errorf("block %d: td mismatch: have %v, want %v", i, block.TotalDifficulty, want.td)
+		}
+	}
+	if _, err := e.Block(uint64(len(blocks))); err == nil {
+		t.Fatalf("read block beyond the archive")
+	}
+	if have, err := e.Verify(); err != nil || have != root {
+		t.Fatalf("verification failed: have %x (%v), want %x", have, err, root)
+	}
+}
+
+// Tests that the builder rejects non-contiguous blocks and empty archives.
+func TestArchiveBuilderErrors(t *testing.T) {
+	blocks := makeTestBlocks(t, 2)
+
+	builder := NewBuilder(new(bytes.Buffer))
+	if _, err := builder.Finalize(); err == nil {
+		t.Fatalf("finalized empty archive")
+	}
+	if err := builder.AddRLP(blocks[0].header, blocks[0].body, blocks[0].receipts, 5, blocks[0].hash, blocks[0].td); err != nil {
+		t.Fatalf("failed to add block: %v", err)
+	}
+	if err := builder.AddRLP(blocks[1].header, blocks[1].body, blocks[1].receipts, 7, blocks[1].hash, blocks[1].td); err == nil {
+		t.Fatalf("added non-contiguous block")
+	}
+}
+
+// Tests that tampering with the archive content is detected by verification.
+func TestArchiveVerifyCorruption(t *testing.T) {
+	blocks := makeTestBlocks(t, 16)
+
+	// Swap the receipts of two blocks with different transactions
+	tampered := append([]testBlock{}, blocks...)
+	tampered[2].receipts, tampered[3].receipts = blocks[3].receipts, blocks[2].receipts
+	blob, _ := buildArchive(t, tampered, 0)
+	if _, err := openArchive(t, blob).Verify(); err == nil {
+		t.Errorf("swapped receipts not detected")
+	}
+	// Replace a block with a sibling that doesn't chain to its parent
+	sibling := makeTestBlocks(t, 6)[5]
+	tampered = append([]testBlock{}, blocks...)
+	tampered[5] = sibling
+	blob, _ = buildArchive(t, tampered, 0)
+	if _, err := openArchive(t, blob).Verify(); err == nil {
+		t.Errorf("broken chain not detected")
+	}
+	// Alter a total difficulty, breaking the accumulator root
+	blob, _ = buildArchive(t, blocks, 0)
+	e := openArchive(t, blob)
+	off := e.blocks[3] // header entry of block 3
+	for i := 0; i < 3; i++ {
+		_, length, err := readEntryHeader(e.f, off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		off += headerSize + int64(length)
+	}
+	blob[off+headerSize]++
+	if _, err := openArchive(t, blob).Verify(); err == nil {
+		t.Errorf("altered total difficulty not detected")
+	}
+}
+
+// Tests the accumulator root against a precomputed single record tree.
+func TestComputeAccumulator(t *testing.T) {
+	if _, err := ComputeAccumulator([]common.Hash{{}}, nil); err == nil {
+		t.Fatalf("accepted mismatching record counts")
+	}
+	hashes := make([]common.Hash, MaxSize+1)
+	tds := make([]*big.Int, MaxSize+1)
+	if _, err := ComputeAccumulator(hashes, tds); err == nil {
+		t.Fatalf("accepted too many records")
+	}
+	// A single record is the leftmost leaf of an otherwise empty tree
+	var (
+		hash = common.Hash{0x01}
+		td   = big.NewInt(0x0102)
+	)
+	have, err := ComputeAccumulator([]common.Hash{hash}, []*big.Int{td})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tdLE [32]byte
+	tdLE[0], tdLE[1] = 0x02, 0x01
+	node := sha256Sum(hash[:], tdLE[:])
+	zero := [32]byte{}
+	for d := 0; d < accumulatorDepth; d++ {
+		node = sha256Sum(node[:], zero[:])
+		zero = sha256Sum(zero[:], zero[:])
+	}
+	var length [32]byte
+	length[0] = 1
+	if want := common.Hash(sha256Sum(node[:], length[:])); have != want {
+		t.Fatalf("accumulator mismatch: have %x, want %x", have, want)
+	}
+}
+
+func sha256Sum(a, b []byte) [32]byte {
+	return sha256.Sum256(append(append([]byte{}, a...), b...))
+}
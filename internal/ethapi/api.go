@@ -49,6 +49,10 @@ import (
 	"github.com/tyler-smith/go-bip39"
 )
 
+// defaultPrivateTxBlocks is the number of blocks a private transaction is kept
+// private for, unless a max block number is given.
+const defaultPrivateTxBlocks = 25
+
 // PublicEthereumAPI provides an API to access Ethereum related information.
 // It offers only methods that operate on public data that is freely available to anyone.
 type PublicEthereumAPI struct {
@@ -215,6 +219,7 @@ func (s *PublicTxPoolAPI) Status() map[string]hexutil.Uint {
 	return map[string]hexutil.Uint{
 		"pending": hexutil.Uint(pending),
 		"queued":  hexutil.Uint(queue),
+		"private": hexutil.Uint(s.b.PrivateStats()),
 	}
 }
 
@@ -253,6 +258,80 @@ func (s *PublicTxPoolAPI) Inspect() map[string]map[string]map[string]string {
 	return content
 }
 
+// rpcTxDrop converts a transaction drop record into its RPC representation.
+func rpcTxDrop(drop *core.TxDrop) map[string]interface{} {
+	fields := map[string]interface{}{
+		"hash":      drop.Hash,
+		"reason":    drop.Reason,
+		"droppedAt": hexutil.Uint64(drop.Time),
+	}
+	if drop.Replacement != (common.Hash{}) {
+		fields["replacedBy"] = drop.Replacement
+	}
+	return fields
+}
+
+// GetTransactionStatus reports the fate of a transaction: whether it is waiting
+// in the pool, was included in a block or was dropped from the pool, along with
+// the reason and the replacing transaction.
+func (s *PublicTxPoolAPI) GetTransactionStatus(ctx context.Context, hash common.Hash) (map[string]interface{}, error) {
+	switch s.b.GetPoolTransactionStatus(hash) {
+	case core.TxStatusPending:
+		return map[string]interface{}{"status": "pending"}, nil
+	case core.TxStatusQueued:
+		return map[string]interface{}{"status": "queued"}, nil
+	}
+	tx, blockHash, blockNumber, index, err := s.b.GetTransaction(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if tx != nil {
+		return map[string]interface{}{
+			"status":           "included",
+			"blockHash":        blockHash,
+			"blockNumber":      hexutil.Uint64(blockNumber),
+			"transactionIndex": hexutil.Uint64(index),
+		}, nil
+	}
+	if drop := s.b.GetDroppedTransaction(hash); drop != nil {
+		fields := rpcTxDrop(drop)
+		fields["status"] = "dropped"
+		return fields, nil
+	}
+	return map[string]interface{}{"status": "unknown"}, nil
+}
+
+// Dropped creates a subscription that is triggered each time a transaction leaves
+// the pool without being included, reporting the reason and the replacing
+// transaction, if any.
+func (s *PublicTxPoolAPI) Dropped(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		drops := make(chan core.DroppedTxsEvent, 128)
+		dropSub := s.b.SubscribeDroppedTxsEvent(drops)
+		defer dropSub.Unsubscribe()
+
+		for {
+			select {
+			case ev := <-drops:
+				for _, drop := range ev.Drops {
+					notifier.Notify(rpcSub.ID, rpcTxDrop(drop))
+				}
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
+
 // PublicAccountAPI provides an API to access accounts managed by this node.
 // It offers only methods that can retrieve accounts.
 type PublicAccountAPI struct {
@@ -817,6 +896,30 @@ func (s *PublicBlockChainAPI) GetUncleCountByBlockHash(ctx context.Context, bloc
 	return nil
 }
 
+// GetBlockReceipts returns the receipts of all transactions in the given block,
+// including the system transactions, in the same format as GetTransactionReceipt.
+func (s *PublicBlockChainAPI) GetBlockReceipts(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) ([]map[string]interface{}, error) {
+	block, err := s.b.BlockByNumberOrHash(ctx, blockNrOrHash)
+	if block == nil || err != nil {
+		return nil, err
+	}
+	receipts, err := s.b.GetReceipts(ctx, block.Hash())
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if len(txs) != len(receipts) {
+		return nil, fmt.Errorf("receipts length mismatch: %d vs %d", len(txs), len(receipts))
+	}
+	signer := types.MakeSigner(s.b.ChainConfig(), block.Number())
+
+	result := make([]map[string]interface{}, len(receipts))
+	for i, receipt := range receipts {
+		result[i] = marshalReceipt(receipt, block.Hash(), block.NumberU64(), signer, txs[i], i, block.BaseFee())
+	}
+	return result, nil
+}
+
 // GetCode returns the code stored at the given address in the state for the given block number.
 func (s *PublicBlockChainAPI) GetCode(ctx context.Context, address common.Address, blockNrOrHash rpc.BlockNumberOrHash) (hexutil.Bytes, error) {
 	state, _, err := s.b.StateAndHeaderByNumberOrHash(ctx, blockNrOrHash)
@@ -1634,13 +1737,28 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	// Derive the sender.
 	bigblock := new(big.Int).SetUint64(blockNumber)
 	signer := types.MakeSigner(s.b.ChainConfig(), bigblock)
+
+	var baseFee *big.Int
+	if s.b.ChainConfig().IsLondon(bigblock) {
+		header, err := s.b.HeaderByHash(ctx, blockHash)
+		if err != nil {
+			return nil, err
+		}
+		baseFee = header.BaseFee
+	}
+	return marshalReceipt(receipt, blockHash, blockNumber, signer, tx, int(index), baseFee), nil
+}
+
+// marshalReceipt converts a receipt into the RPC representation shared by
+// eth_getTransactionReceipt and eth_getBlockReceipts.
+func marshalReceipt(receipt *types.Receipt, blockHash common.Hash, blockNumber uint64, signer types.Signer, tx *types.Transaction, txIndex int, baseFee *big.Int) map[string]interface{} {
 	from, _ := types.Sender(signer, tx)
 
 	fields := map[string]interface{}{
 		"blockHash":         blockHash,
 		"blockNumber":       hexutil.Uint64(blockNumber),
-		"transactionHash":   hash,
-		"transactionIndex":  hexutil.Uint64(index),
+		"transactionHash":   tx.Hash(),
+		"transactionIndex":  hexutil.Uint64(txIndex),
 		"from":              from,
 		"to":                tx.To(),
 		"gasUsed":           hexutil.Uint64(receipt.GasUsed),
@@ -1651,14 +1769,10 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 		"type":              hexutil.Uint(tx.Type()),
 	}
 	// Assign the effective gas price paid
-	if !s.b.ChainConfig().IsLondon(bigblock) {
+	if baseFee == nil {
 		fields["effectiveGasPrice"] = hexutil.Uint64(tx.GasPrice().Uint64())
 	} else {
-		header, err := s.b.HeaderByHash(ctx, blockHash)
-		if err != nil {
-			return nil, err
-		}
-		gasPrice := new(big.Int).Add(header.BaseFee, tx.EffectiveGasTipValue(header.BaseFee))
+		gasPrice := new(big.Int).Add(baseFee, tx.EffectiveGasTipValue(baseFee))
 		fields["effectiveGasPrice"] = hexutil.Uint64(gasPrice.Uint64())
 	}
 	// Assign receipt status or post state.
@@ -1674,7 +1788,7 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	if receipt.ContractAddress != (common.Address{}) {
 		fields["contractAddress"] = receipt.ContractAddress
 	}
-	return fields, nil
+	return fields
 }
 
 // sign is a helper function that signs a transaction with the private key of the given address.
@@ -1779,6 +1893,48 @@ func (s *PublicTransactionPoolAPI) SendRawTransaction(ctx context.Context, input
 	return SubmitTransaction(ctx, s.b, tx)
 }
 
+// PrivateTxArgs represents the options of a private transaction submission.
+type PrivateTxArgs struct {
+	MaxBlockNumber *hexutil.Uint64 `json:"maxBlockNumber"`
+	Fallback       bool            `json:"fallback"`
+}
+
+// SendPrivateRawTransaction will add the signed transaction to the transaction pool
+// without announcing it to the network, so only the local miner can include it.
+// If not included up to the max block number (by default 25 blocks ahead of the
+// current head), the transaction is dropped, or broadcast if fallback is set.
+func (s *PublicTransactionPoolAPI) SendPrivateRawTransaction(ctx context.Context, input hexutil.Bytes, args *PrivateTxArgs) (common.Hash, error) {
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(input); err != nil {
+		return common.Hash{}, err
+	}
+	if err := checkTxFee(tx.GasPrice(), tx.Gas(), s.b.RPCTxFeeCap()); err != nil {
+		return common.Hash{}, err
+	}
+	if !s.b.UnprotectedAllowed() && !tx.Protected() {
+		return common.Hash{}, errors.New("only replay-protected (EIP-155) transactions allowed over RPC")
+	}
+	var (
+		head     = s.b.CurrentBlock().NumberU64()
+		deadline = head + defaultPrivateTxBlocks
+		fallback bool
+	)
+	if args != nil {
+		if args.MaxBlockNumber != nil {
+			deadline = uint64(*args.MaxBlockNumber)
+		}
+		fallback = args.Fallback
+	}
+	if deadline <= head {
+		return common.Hash{}, fmt.Errorf("max block number %d already reached (head %d)", deadline, head)
+	}
+	if err := s.b.SendPrivateTx(ctx, tx, deadline, fallback); err != nil {
+		return common.Hash{}, err
+	}
+	log.Info("Submitted private transaction", "hash", tx.Hash().Hex(), "nonce", tx.Nonce(), "maxblock", deadline, "fallback", fallback)
+	return tx.Hash(), nil
+}
+
 // Sign calculates an ECDSA signature for:
 // keccack256("\x19Ethereum Signed Message:\n" + len(message) + message).
 //
@@ -0,0 +1,421 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/misc"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// maxSimulateBlocks is the maximum number of blocks a single simulation
+	// request may span.
+	maxSimulateBlocks = 256
+
+	// simulateTimeIncrement is the default gap between simulated block
+	// timestamps if the chain has no configured block period.
+	simulateTimeIncrement = 12
+)
+
+var (
+	// transferAddress is the pseudo contract emitting the synthetic transfer
+	// logs for native value movements.
+	transferAddress = common.HexToAddress("0xEeeeeEeeeEeEeeEeEeEeeEEEeeeeEeeeeeeeEEeE")
+
+	// transferTopic is the ERC20 Transfer(address,address,uint256) event
+	// signature, reused for the synthetic transfer logs.
+	transferTopic = common.HexToHash("0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef")
+)
+
+// BlockOverrides is the set of header fields to override for a simulated block.
+type BlockOverrides struct {
+	Number        *hexutil.Big    `json:"number"`
+	Time          *hexutil.Uint64 `json:"time"`
+	GasLimit      *hexutil.Uint64 `json:"gasLimit"`
+	FeeRecipient  *common.Address `json:"feeRecipient"`
+	BaseFeePerGas *hexutil.Big    `json:"baseFeePerGas"`
+	Difficulty    *hexutil.Big    `json:"difficulty"`
+}
+
+// SimulateBlock is a single block of a simulation request: the header and state
+// overrides to apply before the block, and the calls to execute within it.
+type SimulateBlock struct {
+	BlockOverrides *BlockOverrides   `json:"blockOverrides"`
+	StateOverrides *StateOverride    `json:"stateOverrides"`
+	Calls          []TransactionArgs `json:"calls"`
+}
+
+// SimulateOpts is the argument of eth_simulateV1.
+type SimulateOpts struct {
+	BlockStateCalls []SimulateBlock `json:"blockStateCalls"`
+	TraceTransfers  bool            `json:"traceTransfers"`
+	Validation      bool            `json:"validation"`
+}
+
+// SimulateCallResult is the outcome of a single simulated call.
+type SimulateCallResult struct {
+	ReturnValue hexutil.Bytes      `json:"returnData"`
+	Logs        []*types.Log       `json:"logs"`
+	GasUsed     hexutil.Uint64     `json:"gasUsed"`
+	Status      hexutil.Uint64     `json:"status"`
+	Error       *SimulateCallError `json:"error,omitempty"`
+}
+
+// SimulateCallError describes why a simulated call failed in the EVM. The code
+// follows eth_call: 3 for reverts with the revert data attached, -32015 for any
+// other execution error.
+type SimulateCallError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+	Data    string `json:"data,omitempty"`
+}
+
+// SimulateV1 executes a sequence of calls across one or more simulated blocks
+// built on top of the given block. Each block may override header fields and
+// account state before its calls run, and all changes carry over to the
+// following blocks. Nothing is persisted.
+func (s *PublicBlockChainAPI) SimulateV1(ctx context.Context, opts SimulateOpts, blockNrOrHash *rpc.BlockNumberOrHash) ([]map[string]interface{}, error) {
+	if len(opts.BlockStateCalls) == 0 {
+		return nil, errors.New("empty input")
+	}
+	if len(opts.BlockStateCalls) > maxSimulateBlocks {
+		return nil, fmt.Errorf("too many blocks: %d > %d", len(opts.BlockStateCalls), maxSimulateBlocks)
+	}
+	bNrOrHash := rpc.BlockNumberOrHashWithNumber(rpc.LatestBlockNumber)
+	if blockNrOrHash != nil {
+		bNrOrHash = *blockNrOrHash
+	}
+	defer func(start time.Time) { log.Debug("Executing EVM simulation finished", "runtime", time.Since(start)) }(time.Now())
+
+	state, base, err := s.b.StateAndHeaderByNumberOrHash(ctx, bNrOrHash)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	// Bound the whole simulation by the eth_call timeout
+	var cancel context.CancelFunc
+	if timeout := s.b.RPCEVMTimeout(); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	sim := &simulator{
+		ctx:            ctx,
+		b:              s.b,
+		state:          state,
+		oldest:         base,
+		hashes:         map[uint64]common.Hash{base.Number.Uint64(): base.Hash()},
+		traceTransfers: opts.TraceTransfers,
+		validation:     opts.Validation,
+	}
+	var (
+		parent  = base
+		results = make([]map[string]interface{}, 0, len(opts.BlockStateCalls))
+	)
+	for i, block := range opts.BlockStateCalls {
+		header, err := sim.makeHeader(parent, block.BlockOverrides)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		result, err := sim.processBlock(header, block)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", i, err)
+		}
+		results = append(results, result)
+		parent = header
+	}
+	return results, nil
+}
+
+// simulator chains message executions over a single state across a series of
+// synthesized blocks.
+type simulator struct {
+	ctx   context.Context
+	b     Backend
+	state *state.StateDB
+
+	oldest *types.Header          // Oldest real ancestor resolved for BLOCKHASH
+	hashes map[uint64]common.Hash // Hashes of the simulated blocks and resolved ancestors
+
+	traceTransfers bool
+	validation     bool
+}
+
+// makeHeader synthesizes the header of the next simulated block on top of the
+// parent, applying any requested overrides.
+func (sim *simulator) makeHeader(parent *types.Header, overrides *BlockOverrides) (*types.Header, error) {
+	config := sim.b.ChainConfig()
+
+	header := &types.Header{
+		ParentHash:  parent.Hash(),
+		UncleHash:   types.EmptyUncleHash,
+		Coinbase:    parent.Coinbase,
+		Difficulty:  new(big.Int).Set(parent.Difficulty),
+		Number:      new(big.Int).Add(parent.Number, common.Big1),
+		GasLimit:    parent.GasLimit,
+		Time:        parent.Time + simulatePeriod(config.Parlia, config.Clique),
+		TxHash:      types.EmptyRootHash,
+		ReceiptHash: types.EmptyRootHash,
+	}
+	if overrides != nil {
+		if overrides.Number != nil {
+			if overrides.Number.ToInt().Cmp(parent.Number) <= 0 {
+				return nil, fmt.Errorf("block number %v not above parent %v", overrides.Number.ToInt(), parent.Number)
+			}
+			header.Number = new(big.Int).Set(overrides.Number.ToInt())
+		}
+		if overrides.Time != nil {
+			if uint64(*overrides.Time) <= parent.Time {
+				return nil, fmt.Errorf("block timestamp %d not above parent %d", uint64(*overrides.Time), parent.Time)
+			}
+			header.Time = uint64(*overrides.Time)
+		}
+		if overrides.GasLimit != nil {
+			header.GasLimit = uint64(*overrides.GasLimit)
+
+			// Bound the work of a simulated block by the eth_call gas allowance
+			if gasCap := sim.b.RPCGasCap(); gasCap != 0 && header.GasLimit > gasCap {
+				header.GasLimit = gasCap
+			}
+		}
+		if overrides.FeeRecipient != nil {
+			header.Coinbase = *overrides.FeeRecipient
+		}
+		if overrides.Difficulty != nil {
+			header.Difficulty = new(big.Int).Set(overrides.Difficulty.ToInt())
+		}
+	}
+	switch {
+	case overrides != nil && overrides.BaseFeePerGas != nil:
+		header.BaseFee = new(big.Int).Set(overrides.BaseFeePerGas.ToInt())
+	case config.IsLondon(header.Number) && !sim.validation:
+		// Without validation calls are usually unpriced, don't charge them
+		header.BaseFee = new(big.Int)
+	case config.IsLondon(header.Number):
+		header.BaseFee = misc.CalcBaseFee(config, parent)
+	}
+	return header, nil
+}
+
+// processBlock applies the state overrides and executes the calls of a single
+// simulated block, finalizing the header once all calls are done.
+func (sim *simulator) processBlock(header *types.Header, block SimulateBlock) (map[string]interface{}, error) {
+	if err := block.StateOverrides.Apply(sim.state); err != nil {
+		return nil, err
+	}
+	var (
+		config   = sim.b.ChainConfig()
+		gp       = new(core.GasPool).AddGas(header.GasLimit)
+		vmConfig = vm.Config{NoBaseFee: !sim.validation}
+		calls    = make([]SimulateCallResult, len(block.Calls))
+		logs     []*types.Log
+	)
+	if sim.traceTransfers {
+		vmConfig.Debug = true
+		vmConfig.Tracer = new(transferTracer)
+	}
+	var (
+		evm     *vm.EVM
+		vmError func() error
+	)
+	for i, args := range block.Calls {
+		// Calls without an explicit gas allowance get whatever is left in the block
+		if args.Gas == nil {
+			gas := hexutil.Uint64(gp.Gas())
+			args.Gas = &gas
+		}
+		msg, err := sim.toMessage(args, header.BaseFee)
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %w", i, err)
+		}
+		if evm == nil {
+			if evm, vmError, err = sim.b.GetEVM(sim.ctx, msg, sim.state, header, &vmConfig); err != nil {
+				return nil, err
+			}
+			evm.Context.Coinbase = header.Coinbase
+			evm.Context.GetHash = sim.getHash
+
+			done := make(chan struct{})
+			defer close(done)
+			go func(evm *vm.EVM) {
+				select {
+				case <-sim.ctx.Done():
+					evm.Cancel()
+				case <-done:
+				}
+			}(evm)
+		} else {
+			evm.Reset(core.NewEVMTxContext(msg), sim.state)
+		}
+		// Messages carry no signature, derive a stable identifier for the logs
+		hash := types.NewTx(&types.LegacyTx{
+			Nonce:    sim.state.GetNonce(msg.From()),
+			To:       msg.To(),
+			Value:    msg.Value(),
+			Gas:      msg.Gas(),
+			GasPrice: msg.GasPrice(),
+			Data:     msg.Data(),
+		}).Hash()
+		sim.state.Prepare(hash, i)
+
+		result, err := core.ApplyMessage(evm, msg, gp)
+		if err := vmError(); err != nil {
+			return nil, err
+		}
+		if evm.Cancelled() {
+			return nil, fmt.Errorf("execution aborted (timeout = %v)", sim.b.RPCEVMTimeout())
+		}
+		if err != nil {
+			return nil, fmt.Errorf("call %d: %w", i, err)
+		}
+		sim.state.Finalise(config.IsEIP158(header.Number))
+
+		call := SimulateCallResult{
+			ReturnValue: result.Return(),
+			Logs:        sim.state.GetLogs(hash, common.Hash{}),
+			GasUsed:     hexutil.Uint64(result.UsedGas),
+			Status:      hexutil.Uint64(types.ReceiptStatusSuccessful),
+		}
+		if call.Logs == nil {
+			call.Logs = []*types.Log{}
+		}
+		if result.Failed() {
+			call.Status = hexutil.Uint64(types.ReceiptStatusFailed)
+			if len(result.Revert()) > 0 {
+				revert := newRevertError(result)
+				call.Error = &SimulateCallError{Message: revert.Error(), Code: revert.ErrorCode(), Data: revert.reason}
+			} else {
+				call.Error = &SimulateCallError{Message: result.Err.Error(), Code: -32015}
+			}
+		}
+		calls[i] = call
+		logs = append(logs, call.Logs...)
+	}
+	// Seal the header with the post-state and patch the logs to reference it
+	header.GasUsed = header.GasLimit - gp.Gas()
+	header.Root = sim.state.IntermediateRoot(config.IsEIP158(header.Number))
+	header.Bloom = types.BytesToBloom(types.LogsBloom(logs))
+
+	hash := header.Hash()
+	for i, l := range logs {
+		l.BlockHash = hash
+		l.BlockNumber = header.Number.Uint64()
+		l.Index = uint(i)
+	}
+	sim.hashes[header.Number.Uint64()] = hash
+
+	fields := RPCMarshalHeader(header)
+	fields["calls"] = calls
+	return fields, nil
+}
+
+// toMessage converts the call arguments into an EVM message. In validation mode
+// the message is subject to the regular nonce checks.
+func (sim *simulator) toMessage(args TransactionArgs, baseFee *big.Int) (types.Message, error) {
+	msg, err := args.ToMessage(sim.b.RPCGasCap(), baseFee)
+	if err != nil || !sim.validation {
+		return msg, err
+	}
+	nonce := sim.state.GetNonce(msg.From())
+	if args.Nonce != nil {
+		nonce = uint64(*args.Nonce)
+	}
+	return types.NewMessage(msg.From(), msg.To(), nonce, msg.Value(), msg.Gas(), msg.GasPrice(), msg.GasFeeCap(), msg.GasTipCap(), msg.Data(), msg.AccessList(), false), nil
+}
+
+// getHash resolves BLOCKHASH lookups, serving the simulated blocks directly and
+// walking the real ancestors of the base block on demand.
+func (sim *simulator) getHash(number uint64) common.Hash {
+	for sim.oldest.Number.Uint64() > number {
+		parent, _ := sim.b.HeaderByHash(sim.ctx, sim.oldest.ParentHash)
+		if parent == nil {
+			return common.Hash{}
+		}
+		sim.oldest = parent
+		sim.hashes[parent.Number.Uint64()] = parent.Hash()
+	}
+	return sim.hashes[number]
+}
+
+// simulatePeriod returns the timestamp gap between simulated blocks.
+func simulatePeriod(parlia *params.ParliaConfig, clique *params.CliqueConfig) uint64 {
+	switch {
+	case parlia != nil && parlia.Period > 0:
+		return parlia.Period
+	case clique != nil && clique.Period > 0:
+		return clique.Period
+	}
+	return simulateTimeIncrement
+}
+
+// transferTracer emits a synthetic ERC20-style Transfer log for every native
+// value movement. The logs go through the StateDB journal so they disappear
+// together with the transfer if the enclosing call frame reverts.
+type transferTracer struct {
+	env *vm.EVM
+}
+
+func (t *transferTracer) CaptureStart(env *vm.EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.env = env
+	t.transfer(from, to, value)
+}
+
+func (t *transferTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+
+func (t *transferTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	if typ != vm.DELEGATECALL {
+		t.transfer(from, to, value)
+	}
+}
+
+func (t *transferTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (*transferTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (*transferTracer) CaptureTxEnd(restGas uint64) {}
+
+func (t *transferTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *transferTracer) CaptureEnd(output []byte, gasUsed uint64, d time.Duration, err error) {}
+
+func (t *transferTracer) transfer(from, to common.Address, value *big.Int) {
+	if value == nil || value.Sign() <= 0 || from == to {
+		return
+	}
+	t.env.StateDB.AddLog(&types.Log{
+		Address: transferAddress,
+		Topics:  []common.Hash{transferTopic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes())},
+		Data:    common.BigToHash(value).Bytes(),
+	})
+}
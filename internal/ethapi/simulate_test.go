@@ -0,0 +1,155 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package ethapi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// simulateBackend is a Backend over a local chain, implementing the methods the
+// simulation relies on. Calling any other method panics.
+type simulateBackend struct {
+	Backend
+	chain  *core.BlockChain
+	gasCap uint64
+}
+
+func newSimulateBackend(t *testing.T, alloc core.GenesisAlloc, gasCap uint64) *simulateBackend {
+	var (
+		db    = rawdb.NewMemoryDatabase()
+		gspec = &core.Genesis{Config: params.TestChainConfig, Alloc: alloc, GasLimit: 30000000}
+	)
+	gspec.MustCommit(db)
+	chain, err := core.NewBlockChain(db, nil, gspec.Config, ethash.NewFaker(), vm.Config{}, nil, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	t.Cleanup(chain.Stop)
+	return &simulateBackend{chain: chain, gasCap: gasCap}
+}
+
+func (b *simulateBackend) ChainConfig() *params.ChainConfig { return b.chain.Config() }
+func (b *simulateBackend) RPCGasCap() uint64                { return b.gasCap }
+func (b *simulateBackend) RPCEVMTimeout() time.Duration     { return 5 * time.Second }
+
+func (b *simulateBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return b.chain.GetHeaderByHash(hash), nil
+}
+
+func (b *simulateBackend) StateAndHeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*state.StateDB, *types.Header, error) {
+	header := b.chain.CurrentHeader()
+	if number, ok := blockNrOrHash.Number(); ok && number >= 0 {
+		header = b.chain.GetHeaderByNumber(uint64(number))
+	}
+	if header == nil {
+		return nil, nil, errors.New("header not found")
+	}
+	statedb, err := b.chain.StateAt(header.Root)
+	return statedb, header, err
+}
+
+func (b *simulateBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmConfig *vm.Config) (*vm.EVM, func() error, error) {
+	context := core.NewEVMBlockContext(header, b.chain, nil)
+	return vm.NewEVM(context, core.NewEVMTxContext(msg), state, b.chain.Config(), *vmConfig), func() error { return nil }, nil
+}
+
+// probeCode returns storage slot 0, the block number and the balance of 0xbb.
+var probeCode = append(append(common.FromHex("0x6000546000524360205273"), common.Address{0xbb}.Bytes()...), common.FromHex("0x3160405260606000f3")...)
+
+// Tests that state and block overrides apply to the simulated blocks and that
+// the changes of a block carry over to the next one.
+func TestSimulateV1(t *testing.T) {
+	var (
+		from      = common.Address{0xaa}
+		recipient = common.Address{0xbb}
+		probe     = common.Address{0xcc}
+		unfunded  = common.Address{0xdd}
+	)
+	api := NewPublicBlockChainAPI(newSimulateBackend(t, core.GenesisAlloc{from: {Balance: big.NewInt(params.Ether)}}, 25000000))
+
+	var (
+		code     = hexutil.Bytes(probeCode)
+		storage  = map[common.Hash]common.Hash{{}: common.BigToHash(big.NewInt(42))}
+		number   = (*hexutil.Big)(big.NewInt(10))
+		gasLimit = hexutil.Uint64(1 << 40)
+		value    = (*hexutil.Big)(big.NewInt(1000))
+	)
+	results, err := api.SimulateV1(context.Background(), SimulateOpts{
+		BlockStateCalls: []SimulateBlock{
+			{
+				BlockOverrides: &BlockOverrides{Number: number, GasLimit: &gasLimit},
+				StateOverrides: &StateOverride{probe: {Code: &code, StateDiff: &storage}},
+				Calls: []TransactionArgs{
+					{From: &from, To: &recipient, Value: value},
+					{From: &from, To: &probe},
+				},
+			},
+			{
+				// Unpriced calls of empty accounts are fine without validation
+				Calls: []TransactionArgs{{From: &unfunded, To: &probe}},
+			},
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("simulation failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("block count mismatch: have %d, want 2", len(results))
+	}
+	if have := uint64(results[0]["gasLimit"].(hexutil.Uint64)); have != 25000000 {
+		t.Errorf("gas limit override not capped: have %d, want %d", have, 25000000)
+	}
+	if results[1]["parentHash"] != results[0]["hash"] {
+		t.Errorf("simulated blocks not chained")
+	}
+	check := func(block int, call SimulateCallResult, number int64) {
+		if call.Status != hexutil.Uint64(types.ReceiptStatusSuccessful) {
+			t.Fatalf("block %d: call failed: %v", block, call.Error)
+		}
+		want := append(append(common.BigToHash(big.NewInt(42)).Bytes(), common.BigToHash(big.NewInt(number)).Bytes()...), common.BigToHash(value.ToInt()).Bytes()...)
+		if !bytes.Equal(call.ReturnValue, want) {
+			t.Errorf("block %d: return data mismatch: have %x, want %x", block, []byte(call.ReturnValue), want)
+		}
+	}
+	check(0, results[0]["calls"].([]SimulateCallResult)[1], 10)
+	check(1, results[1]["calls"].([]SimulateCallResult)[0], 11)
+
+	// Priced calls must still be paid for
+	price := (*hexutil.Big)(big.NewInt(1))
+	_, err = api.SimulateV1(context.Background(), SimulateOpts{
+		BlockStateCalls: []SimulateBlock{{Calls: []TransactionArgs{{From: &unfunded, To: &recipient, GasPrice: price}}}},
+	}, nil)
+	if !errors.Is(err, core.ErrInsufficientFunds) {
+		t.Fatalf("priced call of empty account: have %v, want %v", err, core.ErrInsufficientFunds)
+	}
+}
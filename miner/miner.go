@@ -39,6 +39,7 @@ import (
 type Backend interface {
 	BlockChain() *core.BlockChain
 	TxPool() *core.TxPool
+	BundlePool() *core.BundlePool
 }
 
 // Config is the configuration parameters of mining.
@@ -53,6 +54,12 @@ type Config struct {
 	GasPrice      *big.Int       // Minimum gas price for mining a transaction
 	Recommit      time.Duration  // The time interval for miner to re-create mining work.
 	Noverify      bool           // Disable remote mining solution verification(only useful in ethash).
+	Signer        string         `toml:",omitempty"` // External signer endpoint sealing the blocks (only useful in parlia).
+
+	Ordering        string           // Transaction ordering strategy of the built blocks (price, reserve, age or roundrobin)
+	ReserveGas      uint64           // Percentage of the block gas reserved for locals and priority senders (reserve ordering)
+	PrioritySenders []common.Address `toml:",omitempty"` // Senders entitled to the reserved block gas besides the locals (reserve ordering)
+	AgeThreshold    time.Duration    // Time in the pool after which transactions are preferred (age ordering)
 }
 
 // Miner creates blocks and searches for proof-of-work values.
@@ -0,0 +1,322 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+// Names of the transaction ordering strategies.
+const (
+	OrderingPrice      = "price"      // Locals first, then by price and nonce
+	OrderingReserve    = "reserve"    // By price and nonce, with a share of the block gas reserved for priority senders
+	OrderingAge        = "age"        // Locals first, then the senders waiting for long, each by price and nonce
+	OrderingRoundRobin = "roundrobin" // Locals first, then one transaction per sender at a time
+)
+
+// TxIterator yields the transactions to commit into a block being built.
+type TxIterator interface {
+	// Peek returns the next transaction to commit along with the bucket its gas
+	// is accounted to, or nil if no transaction is left.
+	Peek() (*types.Transaction, string)
+
+	// Shift moves past the current transaction to the next one from the same
+	// sender, after it was included using the given gas or skipped (zero gas).
+	Shift(gasUsed uint64)
+
+	// Pop drops the current transaction along with all the subsequent ones from
+	// the same sender.
+	Pop()
+}
+
+// Orderer is a strategy deciding the order the pending transactions are committed
+// in when building a block.
+type Orderer interface {
+	// Name returns the name of the strategy.
+	Name() string
+
+	// Order creates an iterator over the pending transactions, grouped by sender
+	// and sorted by nonce, for the block with the given header. The pending map
+	// is reowned by the orderer.
+	Order(signer types.Signer, header *types.Header, pending map[common.Address]types.Transactions, locals []common.Address) TxIterator
+}
+
+// NewOrderer creates the transaction ordering strategy selected by the config.
+func NewOrderer(config *Config) (Orderer, error) {
+	switch config.Ordering {
+	case "", OrderingPrice:
+		return new(priceOrderer), nil
+	case OrderingReserve:
+		if config.ReserveGas == 0 || config.ReserveGas > 100 {
+			return nil, fmt.Errorf("invalid reserved gas percentage %d", config.ReserveGas)
+		}
+		priority := make(map[common.Address]struct{})
+		for _, addr := range config.PrioritySenders {
+			priority[addr] = struct{}{}
+		}
+		return &reserveOrderer{percent: config.ReserveGas, priority: priority}, nil
+	case OrderingAge:
+		if config.AgeThreshold <= 0 {
+			return nil, fmt.Errorf("invalid age threshold %v", config.AgeThreshold)
+		}
+		return &ageOrderer{threshold: config.AgeThreshold}, nil
+	case OrderingRoundRobin:
+		return new(roundRobinOrderer), nil
+	default:
+		return nil, fmt.Errorf("unknown transaction ordering %q", config.Ordering)
+	}
+}
+
+// orderGasMeter returns the meter of the gas used by the transactions of a bucket
+// of an ordering strategy.
+func orderGasMeter(orderer, bucket string) metrics.Meter {
+	return metrics.GetOrRegisterMeter(fmt.Sprintf("miner/ordering/%s/%s/gas", orderer, bucket), nil)
+}
+
+// splitLocals moves the transactions of the local accounts out of the pending set.
+func splitLocals(pending map[common.Address]types.Transactions, locals []common.Address) map[common.Address]types.Transactions {
+	split := make(map[common.Address]types.Transactions)
+	for _, addr := range locals {
+		if txs := pending[addr]; len(txs) > 0 {
+			delete(pending, addr)
+			split[addr] = txs
+		}
+	}
+	return split
+}
+
+// priceIterator yields transactions by price and nonce, all accounted to the
+// same bucket.
+type priceIterator struct {
+	txs    *types.TransactionsByPriceAndNonce
+	bucket string
+}
+
+func newPriceIterator(signer types.Signer, header *types.Header, txs map[common.Address]types.Transactions, bucket string) *priceIterator {
+	return &priceIterator{
+		txs:    types.NewTransactionsByPriceAndNonce(signer, txs, header.BaseFee),
+		bucket: bucket,
+	}
+}
+
+func (it *priceIterator) Peek() (*types.Transaction, string) {
+	if tx := it.txs.Peek(); tx != nil {
+		return tx, it.bucket
+	}
+	return nil, ""
+}
+
+func (it *priceIterator) Shift(gasUsed uint64) { it.txs.Shift() }
+func (it *priceIterator) Pop()                 { it.txs.Pop() }
+
+// chainIterator yields the transactions of several iterators, one after another.
+type chainIterator []TxIterator
+
+func (it *chainIterator) Peek() (*types.Transaction, string) {
+	for len(*it) > 0 {
+		if tx, bucket := (*it)[0].Peek(); tx != nil {
+			return tx, bucket
+		}
+		*it = (*it)[1:]
+	}
+	return nil, ""
+}
+
+func (it *chainIterator) Shift(gasUsed uint64) { (*it)[0].Shift(gasUsed) }
+func (it *chainIterator) Pop()                 { (*it)[0].Pop() }
+
+// priceOrderer commits the transactions of the local accounts first, then the
+// remote ones, each by price and nonce.
+type priceOrderer struct{}
+
+func (o *priceOrderer) Name() string { return OrderingPrice }
+
+func (o *priceOrderer) Order(signer types.Signer, header *types.Header, pending map[common.Address]types.Transactions, locals []common.Address) TxIterator {
+	local := splitLocals(pending, locals)
+	return &chainIterator{
+		newPriceIterator(signer, header, local, "local"),
+		newPriceIterator(signer, header, pending, "remote"),
+	}
+}
+
+// reserveOrderer commits all the transactions by price and nonce, but caps the
+// gas of the ones from regular senders, reserving a percentage of the block gas
+// to the local accounts and the configured priority senders.
+type reserveOrderer struct {
+	percent  uint64
+	priority map[common.Address]struct{}
+}
+
+func (o *reserveOrderer) Name() string { return OrderingReserve }
+
+func (o *reserveOrderer) Order(signer types.Signer, header *types.Header, pending map[common.Address]types.Transactions, locals []common.Address) TxIterator {
+	priority := make(map[common.Address]struct{}, len(o.priority)+len(locals))
+	for addr := range o.priority {
+		priority[addr] = struct{}{}
+	}
+	for _, addr := range locals {
+		priority[addr] = struct{}{}
+	}
+	return &reserveIterator{
+		txs:      types.NewTransactionsByPriceAndNonce(signer, pending, header.BaseFee),
+		signer:   signer,
+		priority: priority,
+		budget:   header.GasLimit / 100 * (100 - o.percent),
+	}
+}
+
+// reserveIterator yields transactions by price and nonce, skipping the regular
+// senders once they would exceed their share of the block gas.
+type reserveIterator struct {
+	txs      *types.TransactionsByPriceAndNonce
+	signer   types.Signer
+	priority map[common.Address]struct{}
+
+	budget  uint64 // Block gas available to regular senders
+	used    uint64 // Block gas used by regular senders
+	regular bool   // Whether the current transaction is from a regular sender
+}
+
+func (it *reserveIterator) Peek() (*types.Transaction, string) {
+	for {
+		tx := it.txs.Peek()
+		if tx == nil {
+			return nil, ""
+		}
+		from, _ := types.Sender(it.signer, tx)
+		if _, ok := it.priority[from]; ok {
+			it.regular = false
+			return tx, "priority"
+		}
+		if it.used+tx.Gas() > it.budget {
+			it.txs.Pop()
+			continue
+		}
+		it.regular = true
+		return tx, "regular"
+	}
+}
+
+func (it *reserveIterator) Shift(gasUsed uint64) {
+	if it.regular {
+		it.used += gasUsed
+	}
+	it.txs.Shift()
+}
+
+func (it *reserveIterator) Pop() { it.txs.Pop() }
+
+// ageOrderer commits the transactions of the local accounts first, then the ones
+// of the senders whose next transaction has been waiting in the pool for longer
+// than the threshold, then the rest, each by price and nonce.
+type ageOrderer struct {
+	threshold time.Duration
+}
+
+func (o *ageOrderer) Name() string { return OrderingAge }
+
+func (o *ageOrderer) Order(signer types.Signer, header *types.Header, pending map[common.Address]types.Transactions, locals []common.Address) TxIterator {
+	var (
+		local = splitLocals(pending, locals)
+		aged  = make(map[common.Address]types.Transactions)
+	)
+	for addr, txs := range pending {
+		if time.Since(txs[0].Time()) > o.threshold {
+			delete(pending, addr)
+			aged[addr] = txs
+		}
+	}
+	return &chainIterator{
+		newPriceIterator(signer, header, local, "local"),
+		newPriceIterator(signer, header, aged, "aged"),
+		newPriceIterator(signer, header, pending, "fresh"),
+	}
+}
+
+// roundRobinOrderer commits the transactions of the local accounts first, then
+// the remote ones, each taking one transaction per sender at a time, so that no
+// sender can fill the block on its own.
+type roundRobinOrderer struct{}
+
+func (o *roundRobinOrderer) Name() string { return OrderingRoundRobin }
+
+func (o *roundRobinOrderer) Order(signer types.Signer, header *types.Header, pending map[common.Address]types.Transactions, locals []common.Address) TxIterator {
+	local := splitLocals(pending, locals)
+	return &chainIterator{
+		newRoundRobinIterator(header, local, "local"),
+		newRoundRobinIterator(header, pending, "remote"),
+	}
+}
+
+// roundRobinIterator yields one transaction per sender in each round, visiting
+// the senders of a round by the price of their next transaction.
+type roundRobinIterator struct {
+	txs     map[common.Address]types.Transactions
+	baseFee *big.Int
+	bucket  string
+
+	round []common.Address // Senders left in the current round
+	next  []common.Address // Senders of the next round
+}
+
+func newRoundRobinIterator(header *types.Header, txs map[common.Address]types.Transactions, bucket string) *roundRobinIterator {
+	it := &roundRobinIterator{
+		txs:     txs,
+		baseFee: header.BaseFee,
+		bucket:  bucket,
+	}
+	for addr := range txs {
+		it.next = append(it.next, addr)
+	}
+	return it
+}
+
+func (it *roundRobinIterator) Peek() (*types.Transaction, string) {
+	if len(it.round) == 0 {
+		if len(it.next) == 0 {
+			return nil, ""
+		}
+		it.round, it.next = it.next, nil
+		sort.SliceStable(it.round, func(i, j int) bool {
+			return it.txs[it.round[i]][0].EffectiveGasTipCmp(it.txs[it.round[j]][0], it.baseFee) > 0
+		})
+	}
+	return it.txs[it.round[0]][0], it.bucket
+}
+
+func (it *roundRobinIterator) Shift(gasUsed uint64) {
+	addr := it.round[0]
+	it.round = it.round[1:]
+	if txs := it.txs[addr][1:]; len(txs) > 0 {
+		it.txs[addr] = txs
+		it.next = append(it.next, addr)
+	} else {
+		delete(it.txs, addr)
+	}
+}
+
+func (it *roundRobinIterator) Pop() {
+	delete(it.txs, it.round[0])
+	it.round = it.round[1:]
+}
@@ -0,0 +1,208 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package miner
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// orderingAccount is a test sender along with its pending transactions.
+type orderingAccount struct {
+	key  *ecdsa.PrivateKey
+	addr common.Address
+	txs  types.Transactions
+}
+
+// newOrderingAccounts creates senders each with the given number of transactions
+// priced from the given price, with the given gas limit.
+func newOrderingAccounts(t *testing.T, signer types.Signer, prices []int64, count int, gas uint64) []*orderingAccount {
+	accounts := make([]*orderingAccount, len(prices))
+	for i, price := range prices {
+		key, _ := crypto.GenerateKey()
+		acc := &orderingAccount{key: key, addr: crypto.PubkeyToAddress(key.PublicKey)}
+		for nonce := 0; nonce < count; nonce++ {
+			tx, err := types.SignTx(types.NewTransaction(uint64(nonce), common.Address{}, big.NewInt(0), gas, big.NewInt(price), nil), signer, key)
+			if err != nil {
+				t.Fatalf("failed to sign transaction: %v", err)
+			}
+			acc.txs = append(acc.txs, tx)
+		}
+		accounts[i] = acc
+	}
+	return accounts
+}
+
+func pendingOf(accounts []*orderingAccount) map[common.Address]types.Transactions {
+	pending := make(map[common.Address]types.Transactions)
+	for _, acc := range accounts {
+		pending[acc.addr] = append(types.Transactions{}, acc.txs...)
+	}
+	return pending
+}
+
+// drain includes all the transactions yielded by the iterator, each using its
+// whole gas limit, and returns them along with their buckets.
+func drain(it TxIterator) (types.Transactions, []string) {
+	var (
+		txs     types.Transactions
+		buckets []string
+	)
+	for {
+		tx, bucket := it.Peek()
+		if tx == nil {
+			return txs, buckets
+		}
+		txs = append(txs, tx)
+		buckets = append(buckets, bucket)
+		it.Shift(tx.Gas())
+	}
+}
+
+func TestNewOrderer(t *testing.T) {
+	tests := []struct {
+		config Config
+		name   string
+		fail   bool
+	}{
+		{config: Config{}, name: OrderingPrice},
+		{config: Config{Ordering: OrderingReserve, ReserveGas: 10}, name: OrderingReserve},
+		{config: Config{Ordering: OrderingReserve}, fail: true},
+		{config: Config{Ordering: OrderingReserve, ReserveGas: 101}, fail: true},
+		{config: Config{Ordering: OrderingAge, AgeThreshold: time.Minute}, name: OrderingAge},
+		{config: Config{Ordering: OrderingAge}, fail: true},
+		{config: Config{Ordering: OrderingRoundRobin}, name: OrderingRoundRobin},
+		{config: Config{Ordering: "random"}, fail: true},
+	}
+	for i, tt := range tests {
+		orderer, err := NewOrderer(&tt.config)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if orderer.Name() != tt.name {
+			t.Errorf("test %d: orderer mismatch: have %s, want %s", i, orderer.Name(), tt.name)
+		}
+	}
+}
+
+// Tests that the price ordering commits the locals first, then the remotes by price.
+func TestPriceOrdering(t *testing.T) {
+	var (
+		signer   = types.HomesteadSigner{}
+		header   = &types.Header{GasLimit: 10000000}
+		accounts = newOrderingAccounts(t, signer, []int64{1, 2, 3}, 2, 21000)
+	)
+	txs, buckets := drain(new(priceOrderer).Order(signer, header, pendingOf(accounts), []common.Address{accounts[0].addr}))
+
+	want := types.Transactions{accounts[0].txs[0], accounts[0].txs[1], accounts[2].txs[0], accounts[2].txs[1], accounts[1].txs[0], accounts[1].txs[1]}
+	wantBuckets := []string{"local", "local", "remote", "remote", "remote", "remote"}
+	checkOrdering(t, txs, buckets, want, wantBuckets)
+}
+
+// Tests that the reserve ordering caps the gas of the regular senders, leaving
+// the reserved gas to the priority ones even if they pay less.
+func TestReserveOrdering(t *testing.T) {
+	var (
+		signer   = types.HomesteadSigner{}
+		header   = &types.Header{GasLimit: 100000}
+		accounts = newOrderingAccounts(t, signer, []int64{1, 3, 2}, 3, 20000)
+		orderer  = &reserveOrderer{percent: 50, priority: map[common.Address]struct{}{accounts[0].addr: {}}}
+	)
+	txs, buckets := drain(orderer.Order(signer, header, pendingOf(accounts), nil))
+
+	// Regular senders get 50000 gas, enough for two transactions
+	want := types.Transactions{accounts[1].txs[0], accounts[1].txs[1], accounts[0].txs[0], accounts[0].txs[1], accounts[0].txs[2]}
+	wantBuckets := []string{"regular", "regular", "priority", "priority", "priority"}
+	checkOrdering(t, txs, buckets, want, wantBuckets)
+}
+
+// Tests that the age ordering prefers the senders waiting for long.
+func TestAgeOrdering(t *testing.T) {
+	var (
+		signer   = types.HomesteadSigner{}
+		header   = &types.Header{GasLimit: 10000000}
+		accounts = newOrderingAccounts(t, signer, []int64{1, 2, 3}, 1, 21000)
+	)
+	accounts[0].txs[0].SetTime(time.Now().Add(-time.Hour))
+
+	txs, buckets := drain((&ageOrderer{threshold: time.Minute}).Order(signer, header, pendingOf(accounts), []common.Address{accounts[1].addr}))
+
+	want := types.Transactions{accounts[1].txs[0], accounts[0].txs[0], accounts[2].txs[0]}
+	wantBuckets := []string{"local", "aged", "fresh"}
+	checkOrdering(t, txs, buckets, want, wantBuckets)
+}
+
+// Tests that the round-robin ordering takes a transaction per sender at a time,
+// skipping the senders dropped.
+func TestRoundRobinOrdering(t *testing.T) {
+	var (
+		signer   = types.HomesteadSigner{}
+		header   = &types.Header{GasLimit: 10000000}
+		accounts = newOrderingAccounts(t, signer, []int64{1, 2, 3}, 3, 21000)
+	)
+	it := new(roundRobinOrderer).Order(signer, header, pendingOf(accounts), nil)
+
+	// Skip the rest of the cheapest sender after its first transaction
+	var txs types.Transactions
+	for {
+		tx, _ := it.Peek()
+		if tx == nil {
+			break
+		}
+		if tx == accounts[0].txs[1] {
+			it.Pop()
+			continue
+		}
+		txs = append(txs, tx)
+		it.Shift(tx.Gas())
+	}
+	want := types.Transactions{
+		accounts[2].txs[0], accounts[1].txs[0], accounts[0].txs[0],
+		accounts[2].txs[1], accounts[1].txs[1],
+		accounts[2].txs[2], accounts[1].txs[2],
+	}
+	checkOrdering(t, txs, nil, want, nil)
+}
+
+func checkOrdering(t *testing.T, txs types.Transactions, buckets []string, want types.Transactions, wantBuckets []string) {
+	t.Helper()
+
+	if len(txs) != len(want) {
+		t.Fatalf("transaction count mismatch: have %d, want %d", len(txs), len(want))
+	}
+	for i := range txs {
+		if txs[i].Hash() != want[i].Hash() {
+			t.Errorf("transaction %d mismatch: have %x, want %x", i, txs[i].Hash(), want[i].Hash())
+		}
+		if wantBuckets != nil && buckets[i] != wantBuckets[i] {
+			t.Errorf("transaction %d bucket mismatch: have %s, want %s", i, buckets[i], wantBuckets[i])
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"errors"
 	"math/big"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -35,6 +36,7 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/trie"
 )
@@ -77,8 +79,31 @@ const (
 
 	// staleThreshold is the maximum depth of the acceptable stale block.
 	staleThreshold = 11
+
+	// lateSealTolerance is the time past its timestamp a block can be sealed at
+	// before it is considered late, competing with the out-of-turn blocks.
+	lateSealTolerance = time.Second
+)
+
+var (
+	// deadlineInterruptMeter counts the blocks whose filling was cut short by the
+	// production slot deadline.
+	deadlineInterruptMeter = metrics.NewRegisteredMeter("miner/slot/interrupted", nil)
+	// lateSealMeter counts the blocks sealed late for their production slot.
+	lateSealMeter = metrics.NewRegisteredMeter("miner/slot/late", nil)
+	// missedSlotMeter counts the production slots taken by another block.
+	missedSlotMeter = metrics.NewRegisteredMeter("miner/slot/missed", nil)
 )
 
+// slot is the block production slot the worker is building a block for, with
+// engines bounding the time available to do so (e.g. parlia).
+type slot struct {
+	number   uint64
+	coinbase common.Address
+	inturn   bool      // Whether the slot is the one of the local validator
+	deadline time.Time // Time the block must be handed over for sealing by
+}
+
 // environment is the worker's current environment and holds all of the current state information.
 type environment struct {
 	signer types.Signer
@@ -89,6 +114,7 @@ type environment struct {
 	uncles    mapset.Set     // uncle set
 	tcount    int            // tx count in cycle
 	gasPool   *core.GasPool  // available gas used to pack transactions
+	deadline  time.Time      // time to stop packing transactions at (zero = unbounded)
 
 	header   *types.Header
 	txs      []*types.Transaction
@@ -131,6 +157,8 @@ type worker struct {
 	eth         Backend
 	chain       *core.BlockChain
 	merger      *consensus.Merger
+	orderer     Orderer      // Transaction ordering strategy of the built blocks
+	slot        atomic.Value // Production slot of the block being built (*slot)
 
 	// Feeds
 	pendingLogsFeed event.Feed
@@ -139,6 +167,7 @@ type worker struct {
 	mux          *event.TypeMux
 	txsCh        chan core.NewTxsEvent
 	txsSub       event.Subscription
+	privTxsSub   event.Subscription
 	chainHeadCh  chan core.ChainHeadEvent
 	chainHeadSub event.Subscription
 	chainSideCh  chan core.ChainSideEvent
@@ -218,8 +247,17 @@ func newWorker(config *Config, chainConfig *params.ChainConfig, engine consensus
 		resubmitIntervalCh: make(chan time.Duration),
 		resubmitAdjustCh:   make(chan *intervalAdjust, resubmitAdjustChanSize),
 	}
+	// Set up the transaction ordering strategy of the built blocks
+	orderer, err := NewOrderer(config)
+	if err != nil {
+		log.Error("Invalid transaction ordering, using price ordering", "err", err)
+		orderer = new(priceOrderer)
+	}
+	worker.orderer = orderer
+
 	// Subscribe NewTxsEvent for tx pool
 	worker.txsSub = eth.TxPool().SubscribeNewTxsEvent(worker.txsCh)
+	worker.privTxsSub = eth.TxPool().SubscribePrivateTxsEvent(worker.txsCh)
 	// Subscribe events for blockchain
 	worker.chainHeadSub = eth.BlockChain().SubscribeChainHeadEvent(worker.chainHeadCh)
 	worker.chainSideSub = eth.BlockChain().SubscribeChainSideEvent(worker.chainSideCh)
@@ -398,6 +436,11 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 			commit(false, commitInterruptNewHead)
 
 		case head := <-w.chainHeadCh:
+			// Check whether the slot we were building a block for was taken
+			if s, ok := w.slot.Load().(*slot); ok && s.inturn && s.number == head.Block.NumberU64() && s.coinbase != head.Block.Coinbase() {
+				log.Debug("Missed block production slot", "number", s.number, "coinbase", head.Block.Coinbase())
+				missedSlotMeter.Mark(1)
+			}
 			clearPending(head.Block.NumberU64())
 			timestamp = time.Now().Unix()
 			commit(false, commitInterruptNewHead)
@@ -412,6 +455,12 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 					timer.Reset(recommit)
 					continue
 				}
+				// Short circuit if the production slot deadline passed, a new
+				// block would be sealed late.
+				if s, ok := w.slot.Load().(*slot); ok && s.number == w.chain.CurrentBlock().NumberU64()+1 && time.Now().After(s.deadline) {
+					timer.Reset(recommit)
+					continue
+				}
 				commit(true, commitInterruptResubmit)
 			}
 
@@ -455,6 +504,7 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 func (w *worker) mainLoop() {
 	defer w.wg.Done()
 	defer w.txsSub.Unsubscribe()
+	defer w.privTxsSub.Unsubscribe()
 	defer w.chainHeadSub.Unsubscribe()
 	defer w.chainSideSub.Unsubscribe()
 	defer func() {
@@ -530,7 +580,7 @@ func (w *worker) mainLoop() {
 					acc, _ := types.Sender(w.current.signer, tx)
 					txs[acc] = append(txs[acc], tx)
 				}
-				txset := types.NewTransactionsByPriceAndNonce(w.current.signer, txs, w.current.header.BaseFee)
+				txset := newPriceIterator(w.current.signer, w.current.header, txs, "remote")
 				tcount := w.current.tcount
 				w.commitTransactions(txset, coinbase, nil)
 				// Only update the snapshot if any new transactons were added
@@ -554,6 +604,8 @@ func (w *worker) mainLoop() {
 			return
 		case <-w.txsSub.Err():
 			return
+		case <-w.privTxsSub.Err():
+			return
 		case <-w.chainHeadSub.Err():
 			return
 		case <-w.chainSideSub.Err():
@@ -632,6 +684,12 @@ func (w *worker) resultLoop() {
 				sealhash = w.engine.SealHash(block.Header())
 				hash     = block.Hash()
 			)
+			if s, ok := w.slot.Load().(*slot); ok && s.number == block.NumberU64() {
+				if late := time.Since(time.Unix(int64(block.Time()), 0)); late > lateSealTolerance {
+					log.Warn("Block sealed late for its slot", "number", block.Number(), "hash", hash, "late", common.PrettyDuration(late))
+					lateSealMeter.Mark(1)
+				}
+			}
 			w.pendingMu.RLock()
 			task, exist := w.pendingTasks[sealhash]
 			w.pendingMu.RUnlock()
@@ -791,7 +849,70 @@ func (w *worker) commitTransaction(tx *types.Transaction, coinbase common.Addres
 	return receipt.Logs, nil
 }
 
-func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coinbase common.Address, interrupt *int32) bool {
+// commitBundles simulates the bundles on top of the pending state, ranks them by
+// the effective gas price paid to the block producer and commits them in that
+// order. Bundles which fail or revert, on their own or after the higher paying
+// ones, are discarded as a whole.
+func (w *worker) commitBundles(bundles []*core.Bundle) {
+	// Short circuit if current is nil
+	if w.current == nil || len(bundles) == 0 {
+		return
+	}
+	if w.current.gasPool == nil {
+		w.current.gasPool = new(core.GasPool).AddGas(w.current.header.GasLimit)
+	}
+	type simulatedBundle struct {
+		bundle *core.Bundle
+		price  *big.Int
+	}
+	var (
+		vmConfig  = *w.chain.GetVMConfig()
+		simulated = make([]simulatedBundle, 0, len(bundles))
+	)
+	for _, bundle := range bundles {
+		var (
+			statedb = w.current.state.Copy()
+			gasPool = new(core.GasPool).AddGas(w.current.gasPool.Gas())
+			gasUsed = w.current.header.GasUsed
+		)
+		result, err := core.ApplyBundle(w.chainConfig, w.chain, gasPool, statedb, w.current.header, bundle, w.current.tcount, &gasUsed, vmConfig)
+		if err != nil {
+			log.Trace("Discarding failed bundle", "hash", bundle.Hash(), "err", err)
+			continue
+		}
+		simulated = append(simulated, simulatedBundle{bundle: bundle, price: result.GasPrice()})
+	}
+	sort.SliceStable(simulated, func(i, j int) bool {
+		return simulated[i].price.Cmp(simulated[j].price) > 0
+	})
+	for _, sim := range simulated {
+		if !w.current.deadline.IsZero() && time.Now().After(w.current.deadline) {
+			log.Debug("Slot deadline reached, bundle filling stopped", "number", w.current.header.Number, "txs", w.current.tcount)
+			deadlineInterruptMeter.Mark(1)
+			return
+		}
+		var (
+			snap    = w.current.state.Snapshot()
+			gas     = w.current.gasPool.Gas()
+			gasUsed = w.current.header.GasUsed
+		)
+		result, err := core.ApplyBundle(w.chainConfig, w.chain, w.current.gasPool, w.current.state, w.current.header, sim.bundle, w.current.tcount, &w.current.header.GasUsed, vmConfig)
+		if err != nil {
+			log.Trace("Discarding conflicting bundle", "hash", sim.bundle.Hash(), "err", err)
+			w.current.state.RevertToSnapshot(snap)
+			*w.current.gasPool = core.GasPool(gas)
+			w.current.header.GasUsed = gasUsed
+			continue
+		}
+		w.current.txs = append(w.current.txs, sim.bundle.Txs...)
+		w.current.receipts = append(w.current.receipts, result.Receipts...)
+		w.current.tcount += len(sim.bundle.Txs)
+
+		log.Debug("Committed bundle", "hash", sim.bundle.Hash(), "txs", len(sim.bundle.Txs), "gas", result.GasUsed, "payment", result.Payment)
+	}
+}
+
+func (w *worker) commitTransactions(txs TxIterator, coinbase common.Address, interrupt *int32) bool {
 	// Short circuit if current is nil
 	if w.current == nil {
 		return true
@@ -825,13 +946,20 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 			}
 			return atomic.LoadInt32(interrupt) == commitInterruptNewHead
 		}
+		// Stop once the production slot deadline nears, leaving time to seal and
+		// broadcast the block
+		if !w.current.deadline.IsZero() && time.Now().After(w.current.deadline) {
+			log.Debug("Slot deadline reached, block filling stopped", "number", w.current.header.Number, "txs", w.current.tcount)
+			deadlineInterruptMeter.Mark(1)
+			break
+		}
 		// If we don't have enough gas for any further transactions then we're done
 		if w.current.gasPool.Gas() < params.TxGas {
 			log.Trace("Not enough gas for further transactions", "have", w.current.gasPool, "want", params.TxGas)
 			break
 		}
 		// Retrieve the next transaction and abort if all done
-		tx := txs.Peek()
+		tx, bucket := txs.Peek()
 		if tx == nil {
 			break
 		}
@@ -861,7 +989,7 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 		case errors.Is(err, core.ErrNonceTooLow):
 			// New head notification data race between the transaction pool and miner, shift
 			log.Trace("Skipping transaction with low nonce", "sender", from, "nonce", tx.Nonce())
-			txs.Shift()
+			txs.Shift(0)
 
 		case errors.Is(err, core.ErrNonceTooHigh):
 			// Reorg notification data race between the transaction pool and miner, skip account =
@@ -872,7 +1000,10 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 			// Everything ok, collect the logs and shift in the next transaction from the same account
 			coalescedLogs = append(coalescedLogs, logs...)
 			w.current.tcount++
-			txs.Shift()
+
+			gasUsed := w.current.receipts[len(w.current.receipts)-1].GasUsed
+			orderGasMeter(w.orderer.Name(), bucket).Mark(int64(gasUsed))
+			txs.Shift(gasUsed)
 
 		case errors.Is(err, core.ErrTxTypeNotSupported):
 			// Pop the unsupported transaction without shifting in the next from the account
@@ -883,7 +1014,7 @@ func (w *worker) commitTransactions(txs *types.TransactionsByPriceAndNonce, coin
 			// Strange error, discard the transaction and get the next in line (note, the
 			// nonce-too-high clause will prevent us from executing in vain).
 			log.Debug("Transaction failed, account skipped", "hash", tx.Hash(), "err", err)
-			txs.Shift()
+			txs.Shift(0)
 		}
 	}
 
@@ -971,6 +1102,21 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		log.Error("Failed to create mining context", "err", err)
 		return
 	}
+	// Bound the time available to fill the block if the engine has production
+	// slots. Out-of-turn validators have their backoff included in the block time.
+	if w.isRunning() {
+		if delay := w.engine.Delay(w.chain, header); delay != nil {
+			w.current.deadline = time.Now().Add(*delay - w.config.DelayLeftOver)
+			w.slot.Store(&slot{
+				number:   header.Number.Uint64(),
+				coinbase: header.Coinbase,
+				inturn:   parlia.InTurn(header),
+				deadline: w.current.deadline,
+			})
+			log.Debug("Building block for production slot", "number", header.Number, "inturn", parlia.InTurn(header),
+				"delay", common.PrettyDuration(*delay), "leftover", w.config.DelayLeftOver)
+		}
+	}
 	// Create the current work task and check any fork transitions needed
 	env := w.current
 	if w.chainConfig.DAOForkSupport && w.chainConfig.DAOForkBlock != nil && w.chainConfig.DAOForkBlock.Cmp(header.Number) == 0 {
@@ -1011,32 +1157,32 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		w.commit(uncles, nil, false, tstart)
 	}
 
-	// Fill the block with all available pending transactions.
+	// Fill the block with all available bundles and pending transactions.
+	var bundles []*core.Bundle
+	if pool := w.eth.BundlePool(); pool != nil {
+		bundles = pool.Pending(header.Number.Uint64(), header.Time)
+	}
 	pending := w.eth.TxPool().Pending(true)
 	// Short circuit if there is no available pending transactions.
 	// But if we disable empty precommit already, ignore it. Since
 	// empty block is necessary to keep the liveness of the network.
-	if len(pending) == 0 && atomic.LoadUint32(&w.noempty) == 0 {
+	if len(bundles) == 0 && len(pending) == 0 && atomic.LoadUint32(&w.noempty) == 0 {
 		w.updateSnapshot()
 		return
 	}
-	// Split the pending transactions into locals and remotes
-	localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
-	for _, account := range w.eth.TxPool().Locals() {
-		if txs := remoteTxs[account]; len(txs) > 0 {
-			delete(remoteTxs, account)
-			localTxs[account] = txs
-		}
-	}
-	if len(localTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, localTxs, header.BaseFee)
-		if w.commitTransactions(txs, w.coinbase, interrupt) {
-			return
-		}
+	// Bundles go ahead of the regular transactions
+	w.commitBundles(bundles)
+
+	// Parlia might hand the block to another local validator, which becomes the
+	// author seen by the transactions
+	coinbase := w.coinbase
+	if _, ok := w.engine.(*parlia.Parlia); ok {
+		coinbase = header.Coinbase
 	}
-	if len(remoteTxs) > 0 {
-		txs := types.NewTransactionsByPriceAndNonce(w.current.signer, remoteTxs, header.BaseFee)
-		if w.commitTransactions(txs, w.coinbase, interrupt) {
+	// Split the pending transactions into locals and remotes
+	if len(pending) > 0 {
+		txs := w.orderer.Order(w.current.signer, header, pending, w.eth.TxPool().Locals())
+		if w.commitTransactions(txs, coinbase, interrupt) {
 			return
 		}
 	}
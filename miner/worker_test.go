@@ -17,6 +17,7 @@
 package miner
 
 import (
+	"crypto/ecdsa"
 	"math/big"
 	"math/rand"
 	"sync/atomic"
@@ -110,6 +111,7 @@ func init() {
 type testWorkerBackend struct {
 	db         ethdb.Database
 	txPool     *core.TxPool
+	bundlePool *core.BundlePool
 	chain      *core.BlockChain
 	testTxFeed event.Feed
 	genesis    *core.Genesis
@@ -129,7 +131,7 @@ func newTestWorkerBackend(t *testing.T, chainConfig *params.ChainConfig, engine
 		e.Authorize(testBankAddress, func(account accounts.Account, s string, data []byte) ([]byte, error) {
 			return crypto.Sign(crypto.Keccak256(data), testBankKey)
 		})
-	case *ethash.Ethash:
+	case *ethash.Ethash, *slotEngine:
 	default:
 		t.Fatalf("unexpected consensus engine type: %T", engine)
 	}
@@ -159,6 +161,7 @@ func newTestWorkerBackend(t *testing.T, chainConfig *params.ChainConfig, engine
 		db:         db,
 		chain:      chain,
 		txPool:     txpool,
+		bundlePool: core.NewBundlePool(chainConfig, chain),
 		genesis:    &gspec,
 		uncleBlock: blocks[0],
 	}
@@ -166,6 +169,7 @@ func newTestWorkerBackend(t *testing.T, chainConfig *params.ChainConfig, engine
 
 func (b *testWorkerBackend) BlockChain() *core.BlockChain { return b.chain }
 func (b *testWorkerBackend) TxPool() *core.TxPool         { return b.txPool }
+func (b *testWorkerBackend) BundlePool() *core.BundlePool { return b.bundlePool }
 
 func (b *testWorkerBackend) newRandomUncle() *types.Block {
 	var parent *types.Block
@@ -521,3 +525,105 @@ func testAdjustInterval(t *testing.T, chainConfig *params.ChainConfig, engine co
 		t.Error("interval reset timeout")
 	}
 }
+
+func TestCommitBundles(t *testing.T) {
+	engine := ethash.NewFaker()
+	defer engine.Close()
+
+	w, b := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+	w.setEtherbase(common.Address{0xc0}) // Bundle payments are measured at the coinbase
+
+	signer := types.LatestSigner(ethashChainConfig)
+	transfer := func(key *ecdsa.PrivateKey, nonce uint64, value int64, price int64) *types.Transaction {
+		return types.MustSignNewTx(key, signer, &types.LegacyTx{
+			Nonce:    nonce,
+			To:       &testUserAddress,
+			Value:    big.NewInt(value),
+			Gas:      params.TxGas,
+			GasPrice: big.NewInt(price * params.InitialBaseFee),
+		})
+	}
+	var (
+		low  = &core.Bundle{Txs: types.Transactions{transfer(testBankKey, 0, 1, 2)}, BlockNumber: 1}
+		high = &core.Bundle{Txs: types.Transactions{transfer(testBankKey, 0, 2, 3)}, BlockNumber: 1}
+		bad  = &core.Bundle{Txs: types.Transactions{transfer(testBankKey, 0, 3, 10), transfer(testBankKey, 2, 1, 10)}, BlockNumber: 1}
+	)
+	for _, bundle := range []*core.Bundle{low, high, bad} {
+		if err := b.bundlePool.Add(bundle); err != nil {
+			t.Fatalf("failed to add bundle: %v", err)
+		}
+	}
+	taskCh := make(chan *task, 4)
+	w.newTaskHook = func(task *task) {
+		if task.block.NumberU64() == 1 && len(task.block.Transactions()) > 0 {
+			taskCh <- task
+		}
+	}
+	w.skipSealHook = func(task *task) bool { return true }
+	w.start()
+
+	select {
+	case task := <-taskCh:
+		// The highest paying bundle goes first, the conflicting and failing ones
+		// are discarded, just like the pool transaction reusing the nonce
+		txs := task.block.Transactions()
+		if len(txs) != 1 || txs[0].Hash() != high.Txs[0].Hash() {
+			t.Fatalf("block transactions mismatch: have %d txs", len(txs))
+		}
+		if balance := task.state.GetBalance(testUserAddress); balance.Cmp(big.NewInt(2)) != 0 {
+			t.Fatalf("account balance mismatch: have %d, want %d", balance, 2)
+		}
+	case <-time.NewTimer(3 * time.Second).C:
+		t.Fatal("new task timeout")
+	}
+}
+
+// slotEngine is a consensus engine with block production slots ending after a
+// fixed delay.
+type slotEngine struct {
+	consensus.Engine
+	delay time.Duration
+}
+
+func (e *slotEngine) Delay(chain consensus.ChainReader, header *types.Header) *time.Duration {
+	return &e.delay
+}
+
+func TestCommitSlotDeadline(t *testing.T) {
+	t.Run("open", func(t *testing.T) { testCommitSlotDeadline(t, time.Minute, 1) })
+	t.Run("passed", func(t *testing.T) { testCommitSlotDeadline(t, -time.Second, 0) })
+}
+
+func testCommitSlotDeadline(t *testing.T, delay time.Duration, txs int) {
+	engine := &slotEngine{Engine: ethash.NewFaker(), delay: delay}
+	defer engine.Close()
+
+	w, _ := newTestWorker(t, ethashChainConfig, engine, rawdb.NewMemoryDatabase(), 0)
+	defer w.close()
+
+	// Skip the empty block precommit, only the filled block is of interest
+	atomic.StoreUint32(&w.noempty, 1)
+
+	taskCh := make(chan *task, 4)
+	w.newTaskHook = func(task *task) {
+		if task.block.NumberU64() == 1 {
+			taskCh <- task
+		}
+	}
+	w.skipSealHook = func(task *task) bool { return true }
+	w.start()
+
+	select {
+	case task := <-taskCh:
+		if have := len(task.block.Transactions()); have != txs {
+			t.Fatalf("block transactions mismatch: have %d, want %d", have, txs)
+		}
+	case <-time.NewTimer(3 * time.Second).C:
+		t.Fatal("new task timeout")
+	}
+	s, ok := w.slot.Load().(*slot)
+	if !ok || s.number != 1 {
+		t.Fatalf("production slot not tracked: %v", s)
+	}
+}
@@ -69,6 +69,11 @@ type Config struct {
 	// in memory.
 	DataDir string
 
+	// DBEngine is the key-value backend used for the node databases, either
+	// "leveldb" or "pebble". If empty, an existing database is opened with the
+	// engine it was created by and new ones default to leveldb.
+	DBEngine string `toml:",omitempty"`
+
 	// Configuration of peer-to-peer networking.
 	P2P p2p.Config
 
@@ -18,8 +18,10 @@ package params
 
 import (
 	"encoding/binary"
+	"encoding/hex"
 	"fmt"
 	"math/big"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/math"
@@ -335,6 +337,8 @@ var (
 		nil,
 		nil,
 		nil,
+		nil,
+		nil,
 		new(EthashConfig),
 		nil,
 		nil,
@@ -367,6 +371,8 @@ var (
 		nil,
 		nil,
 		nil,
+		nil,
+		nil,
 		&CliqueConfig{
 			Period: 0,
 			Epoch:  30000,
@@ -395,6 +401,8 @@ var (
 		nil,
 		nil,
 		nil,
+		nil,
+		nil,
 		new(EthashConfig),
 		nil,
 		nil,
@@ -488,6 +496,8 @@ type ChainConfig struct {
 	// PulseChain Fork Flags
 	PrimordialPulseBlock *big.Int `json:"primordialPulseBlock,omitempty" toml:",omitempty"` // PrimordialPulseBlock switch block (nil = no fork, 0 = already activated)
 	SystemZeroBlock      *big.Int `json:"systemZeroBlock,omitempty" toml:",omitempty"`      // SystemZeroBlock switch block (nil = no fork, 0 = already activated)
+	FastFinalityBlock    *big.Int `json:"fastFinalityBlock,omitempty" toml:",omitempty"`    // FastFinalityBlock switch block (nil = no fork, 0 = already activated)
+	DoubleSignSlashBlock *big.Int `json:"doubleSignSlashBlock,omitempty" toml:",omitempty"` // DoubleSignSlashBlock switch block (nil = no fork, 0 = already activated)
 
 	// Various consensus engines
 	Ethash *EthashConfig `json:"ethash,omitempty" toml:",omitempty"`
@@ -523,6 +533,8 @@ type ParliaConfig struct {
 	InitValidators  *[]string         `json:"initValidators,omitempty" toml:",omitempty"`  // The list of consensus addresses for the initial validatorSet, used for the PrimordialPulseBlock only
 	SystemContracts *[]SystemContract `json:"systemContracts,omitempty" toml:",omitempty"` // The list of system contracts to deploy during, used for the PrimordialPulseBlock only
 	Treasury        *Treasury         `json:"treasury,omitempty" toml:",omitempty"`        // An optional treasury which will receive allocations durign the PrimordialPulseBlock only
+	Upgrades        []ContractUpgrade `json:"upgrades,omitempty" toml:",omitempty"`        // The list of hard-fork scheduled system contract upgrades
+	FeeSchedules    []FeeSchedule     `json:"feeSchedules,omitempty" toml:",omitempty"`    // The list of hard-fork scheduled transaction fee distributions, superseding BurnRate
 }
 
 type SystemContract struct {
@@ -530,6 +542,152 @@ type SystemContract struct {
 	Code string `json:"code"`
 }
 
+// ContractUpgrade is a named system contract upgrade, replacing the code and
+// optionally writing storage slots of a contract at the activation block.
+type ContractUpgrade struct {
+	Name    string                      `json:"name"`                                // Unique name of the upgrade
+	Block   *big.Int                    `json:"block"`                               // Activation block of the upgrade
+	Addr    string                      `json:"addr"`                                // Address of the upgraded contract
+	Code    string                      `json:"code,omitempty" toml:",omitempty"`    // New code of the contract (empty = keep the current code)
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty" toml:",omitempty"` // Storage slots to write after the code replacement
+}
+
+// upgradeBlock returns the activation block of the named upgrade, or nil if no
+// such upgrade is scheduled.
+func (b *ParliaConfig) upgradeBlock(name string) *big.Int {
+	if b == nil {
+		return nil
+	}
+	for _, upgrade := range b.Upgrades {
+		if upgrade.Name == name {
+			return upgrade.Block
+		}
+	}
+	return nil
+}
+
+// checkUpgrades ensures all the scheduled contract upgrades are well formed.
+func (b *ParliaConfig) checkUpgrades() error {
+	names := make(map[string]struct{})
+	for i, upgrade := range b.Upgrades {
+		if upgrade.Name == "" {
+			return fmt.Errorf("parlia upgrade %d: missing name", i)
+		}
+		if _, ok := names[upgrade.Name]; ok {
+			return fmt.Errorf("parlia upgrade %s: duplicate name", upgrade.Name)
+		}
+		names[upgrade.Name] = struct{}{}
+
+		if upgrade.Block == nil {
+			return fmt.Errorf("parlia upgrade %s: missing activation block", upgrade.Name)
+		}
+		if !common.IsHexAddress(upgrade.Addr) || common.HexToAddress(upgrade.Addr) == (common.Address{}) {
+			return fmt.Errorf("parlia upgrade %s: invalid contract address %q", upgrade.Name, upgrade.Addr)
+		}
+		if upgrade.Code == "" && len(upgrade.Storage) == 0 {
+			return fmt.Errorf("parlia upgrade %s: neither code nor storage to upgrade", upgrade.Name)
+		}
+		if _, err := hex.DecodeString(strings.TrimPrefix(upgrade.Code, "0x")); err != nil {
+			return fmt.Errorf("parlia upgrade %s: invalid contract code: %v", upgrade.Name, err)
+		}
+	}
+	return nil
+}
+
+// parliaSystemContracts are the Parlia system contracts fee shares may be paid
+// to through a method call, mirroring core/systemcontracts which can't be
+// imported here.
+var parliaSystemContracts = map[common.Address]bool{
+	common.HexToAddress("0x0000000000000000000000000000000000001000"): true, // Validator contract
+	common.HexToAddress("0x0000000000000000000000000000000000001001"): true, // Slashing contract
+	common.HexToAddress("0x0000000000000000000000000000000000001002"): true, // Staking contract
+}
+
+// FeeShareDenominator is the denominator of the fee shares, expressing them in
+// basis points.
+const FeeShareDenominator = 10000
+
+// FeeSchedule is a distribution policy of the transaction fees collected in
+// every block, in effect from its activation block until the next schedule.
+type FeeSchedule struct {
+	Block  *big.Int   `json:"block"`  // Activation block of the schedule
+	Shares []FeeShare `json:"shares"` // Beneficiaries paid in order, the remainder goes to the validator
+}
+
+// FeeShare is the portion of the transaction fees paid to a beneficiary.
+type FeeShare struct {
+	Name   string `json:"name"`                               // Name of the beneficiary, used for logging
+	Addr   string `json:"addr"`                               // Address of the beneficiary
+	Method string `json:"method,omitempty" toml:",omitempty"` // Payable method without arguments of a system contract receiving the share (empty = plain transfer)
+	Bps    uint64 `json:"bps"`                                // Share of the fees in basis points
+}
+
+// FeeSchedule returns the fee distribution policy in effect at the given block,
+// or nil if the BurnRate policy applies.
+func (b *ParliaConfig) FeeSchedule(num *big.Int) *FeeSchedule {
+	if b == nil {
+		return nil
+	}
+	for i := len(b.FeeSchedules) - 1; i >= 0; i-- {
+		if isForked(b.FeeSchedules[i].Block, num) {
+			return &b.FeeSchedules[i]
+		}
+	}
+	return nil
+}
+
+// checkFeeSchedules ensures all the fee distribution policies are well formed.
+func (b *ParliaConfig) checkFeeSchedules() error {
+	var last *big.Int
+	for i, schedule := range b.FeeSchedules {
+		if schedule.Block == nil {
+			return fmt.Errorf("parlia fee schedule %d: missing activation block", i)
+		}
+		if last != nil && schedule.Block.Cmp(last) <= 0 {
+			return fmt.Errorf("parlia fee schedule %d: activation block %v not after %v", i, schedule.Block, last)
+		}
+		last = schedule.Block
+
+		var (
+			names = make(map[string]struct{})
+			total uint64
+		)
+		for _, share := range schedule.Shares {
+			if share.Name == "" {
+				return fmt.Errorf("parlia fee schedule %d: missing share name", i)
+			}
+			if _, ok := names[share.Name]; ok {
+				return fmt.Errorf("parlia fee schedule %d: duplicate share %s", i, share.Name)
+			}
+			names[share.Name] = struct{}{}
+
+			if !common.IsHexAddress(share.Addr) {
+				return fmt.Errorf("parlia fee schedule %d: share %s: invalid address %q", i, share.Name, share.Addr)
+			}
+			if share.Method != "" && !parliaSystemContracts[common.HexToAddress(share.Addr)] {
+				return fmt.Errorf("parlia fee schedule %d: share %s: method target %s is not a system contract", i, share.Name, share.Addr)
+			}
+			if total += share.Bps; total > FeeShareDenominator {
+				return fmt.Errorf("parlia fee schedule %d: shares exceed %d basis points", i, FeeShareDenominator)
+			}
+		}
+	}
+	return nil
+}
+
+// sameShares reports whether two fee schedules distribute the fees identically.
+func sameShares(a, b []FeeShare) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
 type Treasury struct {
 	Addr    string                `json:"addr"`
 	Balance *math.HexOrDecimal256 `json:"balance"`
@@ -553,7 +711,7 @@ func (c *ChainConfig) String() string {
 	default:
 		engine = "unknown"
 	}
-	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Petersburg: %v Istanbul: %v, Muir Glacier: %v, Berlin: %v, London: %v, Arrow Glacier: %v, MergeFork: %v, PrimordialPulse: %v, SystemZero: %v, Engine: %v}",
+	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Petersburg: %v Istanbul: %v, Muir Glacier: %v, Berlin: %v, London: %v, Arrow Glacier: %v, MergeFork: %v, PrimordialPulse: %v, SystemZero: %v, FastFinality: %v, DoubleSignSlash: %v, Engine: %v}",
 		c.ChainID,
 		c.HomesteadBlock,
 		c.DAOForkBlock,
@@ -572,6 +730,8 @@ func (c *ChainConfig) String() string {
 		c.MergeForkBlock,
 		c.PrimordialPulseBlock,
 		c.SystemZeroBlock,
+		c.FastFinalityBlock,
+		c.DoubleSignSlashBlock,
 		engine,
 	)
 }
@@ -661,6 +821,16 @@ func (c *ChainConfig) IsSystemZero(num *big.Int) bool {
 	return isForked(c.SystemZeroBlock, num)
 }
 
+// IsFastFinality returns whether num is either equal to the FastFinality fork block or greater.
+func (c *ChainConfig) IsFastFinality(num *big.Int) bool {
+	return isForked(c.FastFinalityBlock, num)
+}
+
+// IsDoubleSignSlash returns whether num is either equal to the DoubleSignSlash fork block or greater.
+func (c *ChainConfig) IsDoubleSignSlash(num *big.Int) bool {
+	return isForked(c.DoubleSignSlashBlock, num)
+}
+
 // IsPrimordialPulseBlock returns whether or not the given block is the primordial pulse block.
 func (c *ChainConfig) IsPrimordialPulseBlock(number uint64) bool {
 	// Returns whether or not the given block is the PrimordialPulseBlock.
@@ -717,6 +887,9 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 		{name: "mergeStartBlock", block: c.MergeForkBlock, optional: true},
 		{name: "primordialPulseBlock", block: c.PrimordialPulseBlock},
 		{name: "systemZeroBlock", block: c.SystemZeroBlock},
+		{name: "fastFinalityBlock", block: c.FastFinalityBlock, optional: true},
+		// The DoubleSignSlash fork is independent of the others, it only
+		// processes double sign evidences, so it's not ordered.
 	} {
 		if lastFork.name != "" {
 			// Next one must be higher number
@@ -736,6 +909,12 @@ func (c *ChainConfig) CheckConfigForkOrder() error {
 			lastFork = cur
 		}
 	}
+	if c.Parlia != nil {
+		if err := c.Parlia.checkUpgrades(); err != nil {
+			return err
+		}
+		return c.Parlia.checkFeeSchedules()
+	}
 	return nil
 }
 
@@ -799,6 +978,75 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.SystemZeroBlock, newcfg.SystemZeroBlock, head) {
 		return newCompatError("SystemZero fork block", c.SystemZeroBlock, newcfg.SystemZeroBlock)
 	}
+	if isForkIncompatible(c.FastFinalityBlock, newcfg.FastFinalityBlock, head) {
+		return newCompatError("FastFinality fork block", c.FastFinalityBlock, newcfg.FastFinalityBlock)
+	}
+	if isForkIncompatible(c.DoubleSignSlashBlock, newcfg.DoubleSignSlashBlock, head) {
+		return newCompatError("DoubleSignSlash fork block", c.DoubleSignSlashBlock, newcfg.DoubleSignSlashBlock)
+	}
+	if err := c.checkParliaUpgradesCompatible(newcfg, head); err != nil {
+		return err
+	}
+	if err := c.checkParliaFeeSchedulesCompatible(newcfg, head); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkParliaUpgradesCompatible checks the system contract upgrades scheduled
+// in both configs, treating upgrades missing from either side as unscheduled.
+func (c *ChainConfig) checkParliaUpgradesCompatible(newcfg *ChainConfig, head *big.Int) *ConfigCompatError {
+	var names []string
+	seen := make(map[string]struct{})
+	for _, config := range []*ParliaConfig{c.Parlia, newcfg.Parlia} {
+		if config == nil {
+			continue
+		}
+		for _, upgrade := range config.Upgrades {
+			if _, ok := seen[upgrade.Name]; !ok {
+				seen[upgrade.Name] = struct{}{}
+				names = append(names, upgrade.Name)
+			}
+		}
+	}
+	for _, name := range names {
+		stored, next := c.Parlia.upgradeBlock(name), newcfg.Parlia.upgradeBlock(name)
+		if isForkIncompatible(stored, next, head) {
+			return newCompatError(fmt.Sprintf("Parlia %s upgrade block", name), stored, next)
+		}
+	}
+	return nil
+}
+
+// checkParliaFeeSchedulesCompatible checks the fee distribution policies scheduled
+// in both configs position by position, as neither the activation block nor the
+// shares of a policy can change once it's in effect.
+func (c *ChainConfig) checkParliaFeeSchedulesCompatible(newcfg *ChainConfig, head *big.Int) *ConfigCompatError {
+	var stored, next []FeeSchedule
+	if c.Parlia != nil {
+		stored = c.Parlia.FeeSchedules
+	}
+	if newcfg.Parlia != nil {
+		next = newcfg.Parlia.FeeSchedules
+	}
+	for i := 0; i < len(stored) || i < len(next); i++ {
+		var (
+			s1, s2           *big.Int
+			shares1, shares2 []FeeShare
+		)
+		if i < len(stored) {
+			s1, shares1 = stored[i].Block, stored[i].Shares
+		}
+		if i < len(next) {
+			s2, shares2 = next[i].Block, next[i].Shares
+		}
+		if isForkIncompatible(s1, s2, head) {
+			return newCompatError(fmt.Sprintf("Parlia fee schedule %d block", i), s1, s2)
+		}
+		if isForked(s1, head) && !sameShares(shares1, shares2) {
+			return newCompatError(fmt.Sprintf("Parlia fee schedule %d shares", i), s1, s2)
+		}
+	}
 	return nil
 }
 
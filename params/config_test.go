@@ -20,6 +20,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 func TestCheckCompatible(t *testing.T) {
@@ -87,6 +89,62 @@ func TestCheckCompatible(t *testing.T) {
 				RewindTo:     30,
 			},
 		},
+		{
+			stored:  &ChainConfig{Parlia: &ParliaConfig{Upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(30)}}}},
+			new:     &ChainConfig{Parlia: &ParliaConfig{Upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(30)}, {Name: "B", Block: big.NewInt(50)}}}},
+			head:    40,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Parlia: &ParliaConfig{Upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(30)}}}},
+			new:    &ChainConfig{Parlia: &ParliaConfig{Upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(35)}}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "Parlia A upgrade block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(35),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored: &ChainConfig{Parlia: &ParliaConfig{Upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(30)}}}},
+			new:    &ChainConfig{Parlia: &ParliaConfig{}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "Parlia A upgrade block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    nil,
+				RewindTo:     29,
+			},
+		},
+		{
+			stored:  &ChainConfig{Parlia: &ParliaConfig{FeeSchedules: []FeeSchedule{{Block: big.NewInt(30), Shares: []FeeShare{{Name: "burn", Bps: 2500}}}}}},
+			new:     &ChainConfig{Parlia: &ParliaConfig{FeeSchedules: []FeeSchedule{{Block: big.NewInt(30), Shares: []FeeShare{{Name: "burn", Bps: 2500}}}, {Block: big.NewInt(50)}}}},
+			head:    40,
+			wantErr: nil,
+		},
+		{
+			stored: &ChainConfig{Parlia: &ParliaConfig{FeeSchedules: []FeeSchedule{{Block: big.NewInt(30), Shares: []FeeShare{{Name: "burn", Bps: 2500}}}}}},
+			new:    &ChainConfig{Parlia: &ParliaConfig{FeeSchedules: []FeeSchedule{{Block: big.NewInt(30), Shares: []FeeShare{{Name: "burn", Bps: 2000}}}}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "Parlia fee schedule 0 shares",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(30),
+				RewindTo:     29,
+			},
+		},
+		{
+			stored: &ChainConfig{Parlia: &ParliaConfig{FeeSchedules: []FeeSchedule{{Block: big.NewInt(30)}}}},
+			new:    &ChainConfig{Parlia: &ParliaConfig{FeeSchedules: []FeeSchedule{{Block: big.NewInt(35)}}}},
+			head:   40,
+			wantErr: &ConfigCompatError{
+				What:         "Parlia fee schedule 0 block",
+				StoredConfig: big.NewInt(30),
+				NewConfig:    big.NewInt(35),
+				RewindTo:     29,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -96,3 +154,86 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckParliaUpgrades(t *testing.T) {
+	var (
+		addr    = "0x0000000000000000000000000000000000001001"
+		code    = "0x6000"
+		storage = map[common.Hash]common.Hash{{0x01}: {0x02}}
+	)
+	tests := []struct {
+		upgrades []ContractUpgrade
+		fail     bool
+	}{
+		{upgrades: nil},
+		{upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(1), Addr: addr, Code: code}, {Name: "B", Block: big.NewInt(1), Addr: addr, Storage: storage}}},
+		{upgrades: []ContractUpgrade{{Block: big.NewInt(1), Addr: addr, Code: code}}, fail: true},
+		{upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(1), Addr: addr, Code: code}, {Name: "A", Block: big.NewInt(2), Addr: addr, Code: code}}, fail: true},
+		{upgrades: []ContractUpgrade{{Name: "A", Addr: addr, Code: code}}, fail: true},
+		{upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(1), Addr: "0x1001", Code: code}}, fail: true},
+		{upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(1), Addr: "0x0000000000000000000000000000000000000000", Code: code}}, fail: true},
+		{upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(1), Addr: addr}}, fail: true},
+		{upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(1), Addr: addr, Code: "0x60zz"}}, fail: true},
+		{upgrades: []ContractUpgrade{{Name: "A", Block: big.NewInt(1), Addr: addr, Code: "0x600"}}, fail: true},
+	}
+	for i, tt := range tests {
+		config := &ChainConfig{Parlia: &ParliaConfig{Upgrades: tt.upgrades}}
+		if err := config.CheckConfigForkOrder(); (err != nil) != tt.fail {
+			t.Errorf("test %d: failure mismatch: have %v, want failure %v", i, err, tt.fail)
+		}
+	}
+}
+
+func TestCheckParliaFeeSchedules(t *testing.T) {
+	addr := "0x0000000000000000000000000000000000001001"
+	tests := []struct {
+		schedules []FeeSchedule
+		fail      bool
+	}{
+		{schedules: nil},
+		{schedules: []FeeSchedule{{Block: big.NewInt(1), Shares: []FeeShare{{Name: "A", Addr: addr, Bps: 6000}, {Name: "B", Addr: addr, Bps: 4000}}}, {Block: big.NewInt(2)}}},
+		{schedules: []FeeSchedule{{Shares: []FeeShare{{Name: "A", Addr: addr}}}}, fail: true},
+		{schedules: []FeeSchedule{{Block: big.NewInt(2)}, {Block: big.NewInt(2)}}, fail: true},
+		{schedules: []FeeSchedule{{Block: big.NewInt(1), Shares: []FeeShare{{Addr: addr}}}}, fail: true},
+		{schedules: []FeeSchedule{{Block: big.NewInt(1), Shares: []FeeShare{{Name: "A", Addr: addr}, {Name: "A", Addr: addr}}}}, fail: true},
+		{schedules: []FeeSchedule{{Block: big.NewInt(1), Shares: []FeeShare{{Name: "A", Addr: "0x1001"}}}}, fail: true},
+		{schedules: []FeeSchedule{{Block: big.NewInt(1), Shares: []FeeShare{{Name: "A", Addr: addr, Bps: 6000}, {Name: "B", Addr: addr, Bps: 4001}}}}, fail: true},
+		{schedules: []FeeSchedule{{Block: big.NewInt(1), Shares: []FeeShare{{Name: "A", Addr: addr, Method: "receiveFees", Bps: 100}}}}},
+		{schedules: []FeeSchedule{{Block: big.NewInt(1), Shares: []FeeShare{{Name: "A", Addr: "0x0000000000000000000000000000000000000666", Method: "receiveFees", Bps: 100}}}}, fail: true},
+	}
+	for i, tt := range tests {
+		config := &ChainConfig{Parlia: &ParliaConfig{FeeSchedules: tt.schedules}}
+		if err := config.CheckConfigForkOrder(); (err != nil) != tt.fail {
+			t.Errorf("test %d: failure mismatch: have %v, want failure %v", i, err, tt.fail)
+		}
+	}
+	// The latest activated schedule must be in effect
+	config := &ParliaConfig{FeeSchedules: []FeeSchedule{{Block: big.NewInt(10)}, {Block: big.NewInt(20)}}}
+	for number, want := range map[int64]*FeeSchedule{9: nil, 10: &config.FeeSchedules[0], 19: &config.FeeSchedules[0], 20: &config.FeeSchedules[1]} {
+		if have := config.FeeSchedule(big.NewInt(number)); have != want {
+			t.Errorf("block %d: fee schedule mismatch: have %v, want %v", number, have, want)
+		}
+	}
+}
+
+// Tests that the DoubleSignSlash fork can be enabled independently of the fast
+// finality one.
+func TestCheckDoubleSignSlashOrder(t *testing.T) {
+	tests := []struct {
+		fastFinality    *big.Int
+		doubleSignSlash *big.Int
+	}{
+		{fastFinality: nil, doubleSignSlash: big.NewInt(5)},
+		{fastFinality: big.NewInt(10), doubleSignSlash: big.NewInt(5)},
+		{fastFinality: big.NewInt(5), doubleSignSlash: big.NewInt(10)},
+		{fastFinality: big.NewInt(5), doubleSignSlash: nil},
+	}
+	for i, tt := range tests {
+		config := *TestChainConfig
+		config.PrimordialPulseBlock, config.SystemZeroBlock = big.NewInt(0), big.NewInt(0)
+		config.FastFinalityBlock, config.DoubleSignSlashBlock = tt.fastFinality, tt.doubleSignSlash
+		if err := config.CheckConfigForkOrder(); err != nil {
+			t.Errorf("test %d: unexpected failure: %v", i, err)
+		}
+	}
+}
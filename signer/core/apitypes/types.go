@@ -190,6 +190,10 @@ var (
 		accounts.MimetypeParlia,
 		0x03,
 	}
+	ApplicationParliaVote = SigFormat{
+		accounts.MimetypeParliaVote,
+		0x04,
+	}
 	TextPlain = SigFormat{
 		accounts.MimetypeTextPlain,
 		0x45,
@@ -180,16 +180,12 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 		if err != nil {
 			return nil, useEthereumV, err
 		}
-		header := &types.Header{}
-		if err := rlp.DecodeBytes(parliaData, header); err != nil {
+		header, chainID, err := DecodeParliaHeader(parliaData)
+		if err != nil {
 			return nil, useEthereumV, err
 		}
-		// The incoming parlia header is already truncated, sent to us with a extradata already shortened
-		if len(header.Extra) < 65 {
-			// Need to add it back, to get a suitable length for hashing
-			newExtra := make([]byte, len(header.Extra)+65)
-			copy(newExtra, header.Extra)
-			header.Extra = newExtra
+		if chainID != nil && chainID.Cmp(api.chainID) != 0 {
+			return nil, useEthereumV, fmt.Errorf("parlia header for chain %v, configured %v", chainID, api.chainID)
 		}
 		// Get back the rlp data, encoded by us
 		sighash, parliaRlp, err := parliaHeaderHashAndRlp(header, api.chainID)
@@ -206,6 +202,29 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 		// Parlia uses V on the form 0 or 1
 		useEthereumV = false
 		req = &SignDataRequest{ContentType: mediaType, Rawdata: parliaRlp, Messages: messages, Hash: sighash}
+	case apitypes.ApplicationParliaVote.Mime:
+		stringData, ok := data.(string)
+		if !ok {
+			return nil, useEthereumV, fmt.Errorf("input for %v must be an hex-encoded string", apitypes.ApplicationParliaVote.Mime)
+		}
+		voteData, err := hexutil.Decode(stringData)
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		vote := new(types.VoteData)
+		if err := rlp.DecodeBytes(voteData, vote); err != nil {
+			return nil, useEthereumV, err
+		}
+		messages := []*apitypes.NameValueType{
+			{
+				Name:  "Parlia vote",
+				Typ:   "parlia",
+				Value: fmt.Sprintf("parlia vote for %d [0x%x] from %d [0x%x]", vote.TargetNumber, vote.TargetHash, vote.SourceNumber, vote.SourceHash),
+			},
+		}
+		// Parlia uses V on the form 0 or 1
+		useEthereumV = false
+		req = &SignDataRequest{ContentType: mediaType, Rawdata: voteData, Messages: messages, Hash: vote.Hash().Bytes()}
 	default: // also case TextPlain.Mime:
 		// Calculates an Ethereum ECDSA signature for:
 		// hash = keccak256("\x19${byteVersion}Ethereum Signed Message:\n${message length}${message}")
@@ -268,6 +287,67 @@ func parliaHeaderHashAndRlp(header *types.Header, chainId *big.Int) (hash, rlp [
 	return hash, rlp, err
 }
 
+// parliaSigHeader is the header data signed by Parlia validators, the chain id
+// followed by the header fields with the seal stripped from the extra data.
+type parliaSigHeader struct {
+	ChainID     *big.Int
+	ParentHash  common.Hash
+	UncleHash   common.Hash
+	Coinbase    common.Address
+	Root        common.Hash
+	TxHash      common.Hash
+	ReceiptHash common.Hash
+	Bloom       types.Bloom
+	Difficulty  *big.Int
+	Number      *big.Int
+	GasLimit    uint64
+	GasUsed     uint64
+	Time        uint64
+	Extra       []byte
+	MixDigest   common.Hash
+	Nonce       types.BlockNonce
+}
+
+// DecodeParliaHeader decodes a Parlia header sent for signing, either in the
+// sealing form produced by parlia.ParliaRLP or as a plain header. The chain id
+// is only returned for the former. In both cases the extra data is expected
+// without the seal and gets padded back to its full length.
+func DecodeParliaHeader(data []byte) (*types.Header, *big.Int, error) {
+	var (
+		header  = new(types.Header)
+		chainID *big.Int
+	)
+	sig := new(parliaSigHeader)
+	if err := rlp.DecodeBytes(data, sig); err == nil {
+		chainID = sig.ChainID
+		header = &types.Header{
+			ParentHash:  sig.ParentHash,
+			UncleHash:   sig.UncleHash,
+			Coinbase:    sig.Coinbase,
+			Root:        sig.Root,
+			TxHash:      sig.TxHash,
+			ReceiptHash: sig.ReceiptHash,
+			Bloom:       sig.Bloom,
+			Difficulty:  sig.Difficulty,
+			Number:      sig.Number,
+			GasLimit:    sig.GasLimit,
+			GasUsed:     sig.GasUsed,
+			Time:        sig.Time,
+			Extra:       sig.Extra,
+			MixDigest:   sig.MixDigest,
+			Nonce:       sig.Nonce,
+		}
+	} else if err := rlp.DecodeBytes(data, header); err != nil {
+		return nil, nil, err
+	}
+	// The incoming parlia header is already truncated, sent to us with a extradata already shortened
+	newExtra := make([]byte, len(header.Extra)+65)
+	copy(newExtra, header.Extra)
+	header.Extra = newExtra
+
+	return header, chainID, nil
+}
+
 // SignTypedData signs EIP-712 conformant typed data
 // hash = keccak256("\x19${byteVersion}${domainSeparator}${hashStruct(message)}")
 // It returns
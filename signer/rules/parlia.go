@@ -0,0 +1,120 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/signer/core"
+	"github.com/ethereum/go-ethereum/signer/storage"
+)
+
+const (
+	// parliaSealedPrefix is the storage key prefix of the Parlia headers recently
+	// sealed by a validator, suffixed by the validator address.
+	parliaSealedPrefix = "parlia-sealed-"
+
+	// parliaSealedWindow is the number of most recent heights remembered for each
+	// validator. Headers below the window are refused, as they can't be checked.
+	parliaSealedWindow = 1024
+)
+
+// parliaSealed is the seal hash of every header recently approved for sealing
+// by a validator, keyed by block number.
+type parliaSealed map[uint64]hexutil.Bytes
+
+// parliaSealRequest extracts the validator, block number and seal hash of a
+// Parlia header signing request.
+func parliaSealRequest(request *core.SignDataRequest) (string, uint64, hexutil.Bytes, error) {
+	header, _, err := core.DecodeParliaHeader(request.Rawdata)
+	if err != nil {
+		return "", 0, nil, err
+	}
+	if header.Number == nil || !header.Number.IsUint64() {
+		return "", 0, nil, fmt.Errorf("invalid parlia header number %v", header.Number)
+	}
+	return parliaSealedPrefix + request.Address.Address().Hex(), header.Number.Uint64(), request.Hash, nil
+}
+
+// loadParliaSealed retrieves the headers recently sealed by a validator.
+func (r *rulesetUI) loadParliaSealed(key string) (parliaSealed, error) {
+	sealed := make(parliaSealed)
+	blob, err := r.storage.Get(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return sealed, nil // Nothing sealed yet
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load parlia seal history: %v", err)
+	}
+	if err := json.Unmarshal([]byte(blob), &sealed); err != nil {
+		return nil, fmt.Errorf("corrupted parlia seal history: %v", err)
+	}
+	return sealed, nil
+}
+
+// checkParliaSeal ensures that a Parlia header signing request doesn't conflict
+// with a different header sealed by the same validator at the same height. The
+// request is recorded as sealed if the record flag is set and it's consistent.
+func (r *rulesetUI) checkParliaSeal(request *core.SignDataRequest, record bool) error {
+	r.parliaLock.Lock()
+	defer r.parliaLock.Unlock()
+
+	key, number, hash, err := parliaSealRequest(request)
+	if err != nil {
+		return err
+	}
+	sealed, err := r.loadParliaSealed(key)
+	if err != nil {
+		return err
+	}
+	var highest uint64
+	for n := range sealed {
+		if n > highest {
+			highest = n
+		}
+	}
+	if highest >= parliaSealedWindow && number <= highest-parliaSealedWindow {
+		return fmt.Errorf("parlia header %d below the seal history window (highest sealed %d)", number, highest)
+	}
+	if prev, ok := sealed[number]; ok {
+		if prev.String() != hash.String() {
+			return fmt.Errorf("parlia header %d already sealed with hash %s, refusing %s", number, prev, hash)
+		}
+		return nil // Signing the same header again is harmless
+	}
+	if !record {
+		return nil
+	}
+	sealed[number] = hash
+	if number > highest {
+		highest = number
+	}
+	for n := range sealed {
+		if highest >= parliaSealedWindow && n <= highest-parliaSealedWindow {
+			delete(sealed, n)
+		}
+	}
+	blob, err := json.Marshal(sealed)
+	if err != nil {
+		return err
+	}
+	r.storage.Put(key, string(blob))
+	return nil
+}
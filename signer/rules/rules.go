@@ -21,8 +21,10 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/dop251/goja"
+	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/internal/jsre/deps"
 	"github.com/ethereum/go-ethereum/log"
@@ -51,6 +53,8 @@ type rulesetUI struct {
 	next    core.UIClientAPI // The next handler, for manual processing
 	storage storage.Storage
 	jsRules string // The rules to use
+
+	parliaLock sync.Mutex // Protects the Parlia seal history in the storage
 }
 
 func NewRuleEvaluator(next core.UIClientAPI, jsbackend storage.Storage) (*rulesetUI, error) {
@@ -171,11 +175,27 @@ func (r *rulesetUI) ApproveTx(request *core.SignTxRequest) (core.SignTxResponse,
 }
 
 func (r *rulesetUI) ApproveSignData(request *core.SignDataRequest) (core.SignDataResponse, error) {
+	// Never seal two different Parlia headers at the same height, whatever the
+	// rules or the manual approval say
+	parlia := request != nil && request.ContentType == accounts.MimetypeParlia
+	if parlia {
+		if err := r.checkParliaSeal(request, false); err != nil {
+			log.Warn("Refusing to seal parlia header", "error", err)
+			return core.SignDataResponse{Approved: false}, nil
+		}
+	}
 	jsonreq, err := json.Marshal(request)
 	approved, err := r.checkApproval("ApproveSignData", jsonreq, err)
 	if err != nil {
 		log.Info("Rule-based approval error, going to manual", "error", err)
-		return r.next.ApproveSignData(request)
+		res, err := r.next.ApproveSignData(request)
+		if err == nil && res.Approved && parlia {
+			res.Approved = r.recordParliaSeal(request)
+		}
+		return res, err
+	}
+	if approved && parlia {
+		approved = r.recordParliaSeal(request)
 	}
 	if approved {
 		return core.SignDataResponse{Approved: true}, nil
@@ -183,6 +203,16 @@ func (r *rulesetUI) ApproveSignData(request *core.SignDataRequest) (core.SignDat
 	return core.SignDataResponse{Approved: false}, err
 }
 
+// recordParliaSeal records an approved Parlia header signing request, reporting
+// whether it's still consistent with the headers sealed in the meantime.
+func (r *rulesetUI) recordParliaSeal(request *core.SignDataRequest) bool {
+	if err := r.checkParliaSeal(request, true); err != nil {
+		log.Warn("Refusing to seal parlia header", "error", err)
+		return false
+	}
+	return true
+}
+
 // OnInputRequired not handled by rules
 func (r *rulesetUI) OnInputRequired(info core.UserInputRequest) (core.UserInputResponse, error) {
 	return r.next.OnInputRequired(info)
@@ -17,6 +17,7 @@
 package rules
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
@@ -25,6 +26,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/parlia"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/signer/core"
@@ -626,3 +628,77 @@ function ApproveSignData(r){
 		t.Fatalf("Expected approved")
 	}
 }
+
+// newParliaSealRequest creates a request to seal a Parlia header at the given
+// height, varied by the extra data.
+func newParliaSealRequest(addr *common.MixedcaseAddress, number int64, vanity byte) *core.SignDataRequest {
+	chainID := big.NewInt(943)
+	header := &types.Header{Number: big.NewInt(number), Difficulty: big.NewInt(2), Extra: make([]byte, 32+65)}
+	header.Extra[0] = vanity
+
+	return &core.SignDataRequest{
+		ContentType: accounts.MimetypeParlia,
+		Address:     *addr,
+		Rawdata:     parlia.ParliaRLP(header, chainID),
+		Hash:        parlia.SealHash(header, chainID).Bytes(),
+	}
+}
+
+func TestParliaDoubleSign(t *testing.T) {
+	js := `function ApproveSignData(r){ return "Approve" }`
+	r, err := initRuleEngine(js)
+	if err != nil {
+		t.Fatalf("Couldn't create evaluator %v", err)
+	}
+	addr, _ := mixAddr("0x694267f14675d7e1b9494fd8d72fefe1755710fa")
+
+	tests := []struct {
+		number   int64
+		vanity   byte
+		approved bool
+	}{
+		{1, 1, true},
+		{1, 1, true},  // same header again
+		{1, 2, false}, // conflicting header at the same height
+		{2, 2, true},
+		{parliaSealedWindow + 3, 1, true},
+		{2, 3, false}, // below the window, can't be checked
+		{parliaSealedWindow + 3, 2, false},
+	}
+	for i, tt := range tests {
+		resp, err := r.ApproveSignData(newParliaSealRequest(addr, tt.number, tt.vanity))
+		if err != nil {
+			t.Fatalf("test %d: unexpected error %v", i, err)
+		}
+		if resp.Approved != tt.approved {
+			t.Errorf("test %d: approval mismatch: have %v, want %v", i, resp.Approved, tt.approved)
+		}
+	}
+	// Other validators must not be affected
+	other, _ := mixAddr("0x0000000000000000000000000000000000000001")
+	if resp, _ := r.ApproveSignData(newParliaSealRequest(other, 1, 2)); !resp.Approved {
+		t.Errorf("header of other validator refused")
+	}
+}
+
+// failingStorage is a storage whose reads fail, like an undecryptable one.
+type failingStorage struct {
+	storage.Storage
+}
+
+func (failingStorage) Get(key string) (string, error) {
+	return "", errors.New("decryption failed")
+}
+
+// Tests that Parlia headers are refused if the seal history can't be loaded,
+// instead of treating the failure as an empty history.
+func TestParliaSealHistoryFailure(t *testing.T) {
+	r, err := NewRuleEvaluator(&alwaysDenyUI{}, failingStorage{storage.NewEphemeralStorage()})
+	if err != nil {
+		t.Fatalf("Failed to create js engine: %v", err)
+	}
+	addr, _ := mixAddr("0x694267f14675d7e1b9494fd8d72fefe1755710fa")
+	if err := r.checkParliaSeal(newParliaSealRequest(addr, 1, 1), true); err == nil {
+		t.Fatalf("header approved without seal history")
+	}
+}
@@ -76,6 +76,9 @@ type Database struct {
 
 	preimages map[common.Hash][]byte // Preimages of nodes from the secure trie
 
+	scheme string      // Node storage scheme, either hash-based or path-based
+	layers *pathLayers // Diff layers on top of the persisted state in path-based scheme
+
 	gctime  time.Duration      // Time spent on garbage collection since last commit
 	gcnodes uint64             // Nodes garbage collected since last commit
 	gcsize  common.StorageSize // Data storage garbage collected since last commit
@@ -277,6 +280,7 @@ type Config struct {
 	Cache     int    // Memory allowance (MB) to use for caching trie nodes in memory
 	Journal   string // Journal of clean cache to survive node restarts
 	Preimages bool   // Flag whether the preimage of trie key is recorded
+	Scheme    string // Node storage scheme, the hash-based one if empty
 }
 
 // NewDatabase creates a new trie database to store ephemeral trie content before
@@ -308,9 +312,18 @@ func NewDatabaseWithConfig(diskdb ethdb.KeyValueStore, config *Config) *Database
 	if config == nil || config.Preimages { // TODO(karalabe): Flip to default off in the future
 		db.preimages = make(map[common.Hash][]byte)
 	}
+	db.scheme = rawdb.HashScheme
+	if config != nil && config.Scheme == rawdb.PathScheme {
+		db.scheme, db.layers = rawdb.PathScheme, newPathLayers(diskdb, cleans)
+	}
 	return db
 }
 
+// Scheme returns the node storage scheme used by the database.
+func (db *Database) Scheme() string {
+	return db.scheme
+}
+
 // DiskDB retrieves the persistent storage backing the trie database.
 func (db *Database) DiskDB() ethdb.KeyValueStore {
 	return db.diskdb
@@ -367,6 +380,20 @@ func (db *Database) insertPreimage(hash common.Hash, preimage []byte) {
 	db.preimagesSize += common.StorageSize(common.HashLength + len(preimage))
 }
 
+// nodeWithPath retrieves a trie node of the given owner, path and hash, or
+// returns nil if none can be found. The owner and path are only used in the
+// path-based scheme.
+func (db *Database) nodeWithPath(owner common.Hash, path []byte, hash common.Hash) node {
+	if db.layers == nil {
+		return db.node(hash)
+	}
+	blob := db.layers.node(owner, path, hash)
+	if len(blob) == 0 {
+		return nil
+	}
+	return mustDecodeNode(hash[:], blob)
+}
+
 // node retrieves a cached trie node from memory, or returns nil if none can be
 // found in the memory cache.
 func (db *Database) node(hash common.Hash) node {
@@ -410,6 +437,14 @@ func (db *Database) Node(hash common.Hash) ([]byte, error) {
 	if hash == (common.Hash{}) {
 		return nil, errors.New("not found")
 	}
+	// Persisted nodes are keyed by path in the path-based scheme, only the
+	// ones in memory can be retrieved by hash.
+	if db.layers != nil {
+		if blob := db.layers.nodeByHash(hash); len(blob) != 0 {
+			return blob, nil
+		}
+		return nil, errors.New("not found")
+	}
 	// Retrieve the node from the clean cache if available
 	if db.cleans != nil {
 		if enc := db.cleans.Get(nil, hash[:]); enc != nil {
@@ -481,7 +516,16 @@ func (db *Database) Nodes() []common.Hash {
 // This function is used to add reference between internal trie node
 // and external node(e.g. storage trie root), all internal trie nodes
 // are referenced together by database itself.
+//
+// In the path-based scheme only the state roots referenced from the meta root
+// are tracked, keeping their diff layers alive.
 func (db *Database) Reference(child common.Hash, parent common.Hash) {
+	if db.layers != nil {
+		if parent == (common.Hash{}) {
+			db.layers.reference(child)
+		}
+		return
+	}
 	db.lock.Lock()
 	defer db.lock.Unlock()
 
@@ -510,7 +554,14 @@ func (db *Database) reference(child common.Hash, parent common.Hash) {
 }
 
 // Dereference removes an existing reference from a root node.
+//
+// In the path-based scheme the diff layer of an unreferenced state is merged
+// into its children, the persisted state is left untouched.
 func (db *Database) Dereference(root common.Hash) {
+	if db.layers != nil {
+		db.layers.release(root)
+		return
+	}
 	// Sanity check to ensure that the meta-root is not removed
 	if root == (common.Hash{}) {
 		log.Error("Attempted to dereference the trie cache meta root")
@@ -590,6 +641,10 @@ func (db *Database) dereference(child common.Hash, parent common.Hash) {
 // Note, this method is a non-synchronized mutator. It is unsafe to call this
 // concurrently with other mutators.
 func (db *Database) Cap(limit common.StorageSize) error {
+	// Diff layers are capped by count instead of size in the path-based scheme
+	if db.layers != nil {
+		return nil
+	}
 	// Create a database batch to flush persistent data out. It is important that
 	// outside code doesn't see an inconsistent state (referenced data removed from
 	// memory cache during commit but not yet in persistent storage). This is ensured
@@ -693,6 +748,9 @@ func (db *Database) Cap(limit common.StorageSize) error {
 // Note, this method is a non-synchronized mutator. It is unsafe to call this
 // concurrently with other mutators.
 func (db *Database) Commit(node common.Hash, report bool, callback func(common.Hash)) error {
+	if db.layers != nil {
+		return db.commitLayers(node, report)
+	}
 	// Create a database batch to flush persistent data out. It is important that
 	// outside code doesn't see an inconsistent state (referenced data removed from
 	// memory cache during commit but not yet in persistent storage). This is ensured
@@ -837,6 +895,12 @@ func (c *cleaner) Delete(key []byte) error {
 // Size returns the current storage size of the memory cache in front of the
 // persistent database layer.
 func (db *Database) Size() (common.StorageSize, common.StorageSize) {
+	if db.layers != nil {
+		db.lock.RLock()
+		defer db.lock.RUnlock()
+
+		return db.layers.size(), db.preimagesSize
+	}
 	db.lock.RLock()
 	defer db.lock.RUnlock()
 
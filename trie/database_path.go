@@ -0,0 +1,589 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// reverseDiffLimit is the maximum number of reverse diffs retained in the disk,
+// which bounds how far the persisted state can be rolled back.
+const reverseDiffLimit = 1024
+
+var (
+	// errLayerMissing is returned if a state transition is requested on top of
+	// a state which is neither tracked in memory nor persisted in the disk.
+	errLayerMissing = errors.New("parent state layer missing")
+
+	// errStateUnrecoverable is returned if the persisted state cannot be rolled
+	// back to the requested root with the available reverse diffs.
+	errStateUnrecoverable = errors.New("state is unrecoverable")
+
+	pathLayerDiffMeter    = metrics.NewRegisteredMeter("trie/path/diff/nodes", nil)
+	pathLayerFlattenTimer = metrics.NewRegisteredResettingTimer("trie/path/flatten/time", nil)
+	pathLayerFlattenMeter = metrics.NewRegisteredMeter("trie/path/flatten/nodes", nil)
+)
+
+// pathNode is a trie node tracked in memory along with its position. An empty
+// blob marks a node removed from the trie.
+type pathNode struct {
+	owner common.Hash // Owner of the trie, zero for the account trie
+	path  []byte      // Hex path of the node inside its trie
+	hash  common.Hash // Hash of the node blob
+	blob  []byte      // RLP encoded node
+}
+
+// indexedNode is a trie node referenced by one or more in-memory diff layers.
+type indexedNode struct {
+	blob []byte
+	refs int
+}
+
+// pathNodeKey composes the in-memory lookup key of a trie node.
+func pathNodeKey(owner common.Hash, path []byte) string {
+	return string(owner.Bytes()) + string(path)
+}
+
+// pathDiffLayer is a set of trie nodes changed by a single state transition,
+// kept in memory on top of the persisted state.
+type pathDiffLayer struct {
+	root   common.Hash          // State root reached by applying this layer
+	parent *pathDiffLayer       // Parent layer, nil if the parent is persisted
+	nodes  map[string]*pathNode // Trie nodes changed by this layer
+	size   common.StorageSize   // Approximate memory used by the nodes
+	refs   int                  // External references held on the state
+}
+
+// reverseDiff is the set of trie nodes overwritten when a diff layer was
+// flattened into the disk, allowing the persisted state to be rolled back.
+type reverseDiff struct {
+	Parent common.Hash       // State root before the diff layer was applied
+	Root   common.Hash       // State root after the diff layer was applied
+	Nodes  []reverseDiffNode // Previous values of the overwritten trie nodes
+}
+
+// reverseDiffNode is a single overwritten trie node, an empty blob means the
+// node didn't exist before.
+type reverseDiffNode struct {
+	Owner common.Hash
+	Path  []byte
+	Blob  []byte
+}
+
+// pathLayers is the backend of the trie database in the path-based scheme.
+// The latest version of every trie node is persisted keyed by owner and path,
+// a bounded number of recent state transitions are kept as in-memory diff
+// layers on top, and reverse diffs of flattened layers are stored in the disk
+// for rolling back the persisted state.
+type pathLayers struct {
+	diskdb ethdb.KeyValueStore
+	cleans *fastcache.Cache // Clean cache of the persisted nodes keyed by owner and path
+
+	layers  map[common.Hash]*pathDiffLayer // In-memory diff layers keyed by state root
+	index   map[common.Hash]*indexedNode   // Nodes of all diff layers keyed by node hash
+	pending map[string]*pathNode           // Nodes committed but not yet bound to a layer
+	lock    sync.RWMutex
+}
+
+// newPathLayers creates the path-based backend on top of the given disk.
+func newPathLayers(diskdb ethdb.KeyValueStore, cleans *fastcache.Cache) *pathLayers {
+	return &pathLayers{
+		diskdb:  diskdb,
+		cleans:  cleans,
+		layers:  make(map[common.Hash]*pathDiffLayer),
+		index:   make(map[common.Hash]*indexedNode),
+		pending: make(map[string]*pathNode),
+	}
+}
+
+// diskRoot returns the root of the state persisted in the disk, which is the
+// hash of the account trie root node.
+func (pl *pathLayers) diskRoot() common.Hash {
+	blob, hash := rawdb.ReadAccountTrieNode(pl.diskdb, nil)
+	if len(blob) == 0 {
+		return emptyRoot
+	}
+	return hash
+}
+
+// insert tracks a committed trie node until the state transition it belongs
+// to is bound into a diff layer with update.
+func (pl *pathLayers) insert(owner common.Hash, path []byte, hash common.Hash, blob []byte) {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	pl.pending[pathNodeKey(owner, path)] = &pathNode{owner: owner, path: path, hash: hash, blob: blob}
+}
+
+// delete tracks the removal of a trie node until the state transition it
+// belongs to is bound into a diff layer with update.
+func (pl *pathLayers) delete(owner common.Hash, path []byte) {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	pl.pending[pathNodeKey(owner, path)] = &pathNode{owner: owner, path: path}
+}
+
+// node retrieves the blob of the trie node with the given owner, path and
+// hash. Nil is returned if the node is unavailable.
+func (pl *pathLayers) node(owner common.Hash, path []byte, hash common.Hash) []byte {
+	pl.lock.RLock()
+	if n, ok := pl.pending[pathNodeKey(owner, path)]; ok && n.hash == hash {
+		pl.lock.RUnlock()
+		return n.blob
+	}
+	if n, ok := pl.index[hash]; ok {
+		pl.lock.RUnlock()
+		memcacheDirtyHitMeter.Mark(1)
+		memcacheDirtyReadMeter.Mark(int64(len(n.blob)))
+		return n.blob
+	}
+	pl.lock.RUnlock()
+	memcacheDirtyMissMeter.Mark(1)
+
+	// The clean cache mirrors the persisted nodes. The node persisted in the
+	// disk might be a different version, in which case the requested one is
+	// regarded as missing.
+	key := pathNodeKey(owner, path)
+	if pl.cleans != nil {
+		if entry := pl.cleans.Get(nil, []byte(key)); len(entry) > common.HashLength {
+			if common.BytesToHash(entry[:common.HashLength]) != hash {
+				return nil
+			}
+			memcacheCleanHitMeter.Mark(1)
+			memcacheCleanReadMeter.Mark(int64(len(entry) - common.HashLength))
+			return entry[common.HashLength:]
+		}
+	}
+	blob, nHash := rawdb.ReadTrieNodeByPath(pl.diskdb, owner, path)
+	if len(blob) == 0 {
+		return nil
+	}
+	if pl.cleans != nil {
+		pl.cleans.Set([]byte(key), append(nHash.Bytes(), blob...))
+		memcacheCleanMissMeter.Mark(1)
+		memcacheCleanWriteMeter.Mark(int64(len(blob)))
+	}
+	if nHash != hash {
+		return nil
+	}
+	return blob
+}
+
+// cleanNode updates the clean cache entry of a persisted trie node, an empty
+// blob means the node was deleted.
+func (pl *pathLayers) cleanNode(owner common.Hash, path []byte, hash common.Hash, blob []byte) {
+	if pl.cleans == nil {
+		return
+	}
+	key := []byte(pathNodeKey(owner, path))
+	if len(blob) == 0 {
+		pl.cleans.Del(key)
+		return
+	}
+	pl.cleans.Set(key, append(hash.Bytes(), blob...))
+}
+
+// nodeByHash retrieves the trie node blob of the given hash from the diff
+// layers. The persisted nodes can't be looked up without knowing their paths.
+func (pl *pathLayers) nodeByHash(hash common.Hash) []byte {
+	pl.lock.RLock()
+	defer pl.lock.RUnlock()
+
+	if n, ok := pl.index[hash]; ok {
+		return n.blob
+	}
+	return nil
+}
+
+// update binds all pending trie nodes into a new diff layer, transitioning
+// the state from parentRoot to root.
+func (pl *pathLayers) update(root common.Hash, parentRoot common.Hash) error {
+	if parentRoot == (common.Hash{}) {
+		parentRoot = emptyRoot
+	}
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	nodes := pl.pending
+	pl.pending = make(map[string]*pathNode)
+
+	// Nothing to do if the state is already known
+	if _, ok := pl.layers[root]; ok || root == parentRoot {
+		return nil
+	}
+	diskRoot := pl.diskRoot()
+	if root == diskRoot {
+		return nil
+	}
+	var parent *pathDiffLayer
+	if parentRoot != diskRoot {
+		if parent = pl.layers[parentRoot]; parent == nil {
+			return fmt.Errorf("%w: %x", errLayerMissing, parentRoot)
+		}
+	}
+	layer := &pathDiffLayer{root: root, parent: parent, nodes: nodes}
+	for _, n := range nodes {
+		layer.size += common.StorageSize(len(n.path) + len(n.blob) + common.HashLength)
+		if len(n.blob) == 0 {
+			continue // removed node, nothing to look up by hash
+		}
+		if entry, ok := pl.index[n.hash]; ok {
+			entry.refs++
+		} else {
+			pl.index[n.hash] = &indexedNode{blob: n.blob, refs: 1}
+		}
+	}
+	pl.layers[root] = layer
+	pathLayerDiffMeter.Mark(int64(len(nodes)))
+	return nil
+}
+
+// cap flattens the diff layers below the given root into the disk, keeping at
+// most the given number of layers in memory. All the layers not descending
+// from the new persisted state are discarded.
+func (pl *pathLayers) cap(root common.Hash, layers int) error {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	layer := pl.layers[root]
+	if layer == nil {
+		if root == pl.diskRoot() {
+			return nil
+		}
+		return fmt.Errorf("%w: %x", errLayerMissing, root)
+	}
+	// Collect the layers from the root downwards, bail out if there are
+	// not enough to flatten anything.
+	var chain []*pathDiffLayer
+	for l := layer; l != nil; l = l.parent {
+		chain = append(chain, l)
+	}
+	if len(chain) <= layers {
+		return nil
+	}
+	start := time.Now()
+	flatten := chain[layers:]
+	for i := len(flatten) - 1; i >= 0; i-- {
+		if err := pl.flatten(flatten[i]); err != nil {
+			return err
+		}
+	}
+	flattened := make(map[*pathDiffLayer]bool)
+	for _, l := range flatten {
+		flattened[l] = true
+	}
+	// Discard every layer which isn't built on top of the new persisted state
+	top := flatten[0]
+	for hash, l := range pl.layers {
+		if flattened[l] {
+			delete(pl.layers, hash)
+			continue
+		}
+		bottom := l
+		for bottom.parent != nil && !flattened[bottom.parent] {
+			bottom = bottom.parent
+		}
+		if bottom.parent != top {
+			pl.dereference(l)
+			delete(pl.layers, hash)
+		}
+	}
+	for _, l := range pl.layers {
+		if l.parent == top {
+			l.parent = nil
+		}
+	}
+	pathLayerFlattenTimer.Update(time.Since(start))
+	return nil
+}
+
+// flatten writes the nodes of the given layer into the disk, deleting the
+// removed ones, along with the reverse diff of the transition holding the
+// previous version of every touched node. The layer's parent must be persisted.
+func (pl *pathLayers) flatten(layer *pathDiffLayer) error {
+	var (
+		batch = pl.diskdb.NewBatch()
+		diff  = reverseDiff{Parent: pl.diskRoot(), Root: layer.root}
+	)
+	for _, n := range layer.nodes {
+		prev, _ := rawdb.ReadTrieNodeByPath(pl.diskdb, n.owner, n.path)
+		diff.Nodes = append(diff.Nodes, reverseDiffNode{Owner: n.owner, Path: n.path, Blob: prev})
+		rawdb.WriteTrieNodeByPath(batch, n.owner, n.path, n.blob)
+	}
+	blob, err := rlp.EncodeToBytes(&diff)
+	if err != nil {
+		return err
+	}
+	id := rawdb.ReadReverseDiffHead(pl.diskdb) + 1
+	rawdb.WriteReverseDiff(batch, id, blob)
+	rawdb.WriteReverseDiffHead(batch, id)
+	if id > reverseDiffLimit {
+		rawdb.DeleteReverseDiff(batch, id-reverseDiffLimit)
+	}
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	// The nodes are persisted now, move them into the clean cache
+	for _, n := range layer.nodes {
+		pl.cleanNode(n.owner, n.path, n.hash, n.blob)
+	}
+	pl.dereference(layer)
+	pathLayerFlattenMeter.Mark(int64(len(layer.nodes)))
+	return nil
+}
+
+// dereference drops the references of the layer's nodes from the index.
+func (pl *pathLayers) dereference(layer *pathDiffLayer) {
+	for _, n := range layer.nodes {
+		if entry, ok := pl.index[n.hash]; ok {
+			if entry.refs--; entry.refs <= 0 {
+				delete(pl.index, n.hash)
+			}
+		}
+	}
+}
+
+// reference adds an external reference to the diff layer of the given state
+// root, keeping the state alive until it's released.
+func (pl *pathLayers) reference(root common.Hash) {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	if layer := pl.layers[root]; layer != nil {
+		layer.refs++
+	}
+}
+
+// release drops an external reference from the diff layer of the given state
+// root. Once no references are left the layer is discarded: its nodes still
+// visible from the child layers are merged into them, keeping the states built
+// on top intact, while the overwritten ones are freed. The persisted state is
+// never touched, so ephemeral databases can drop their ancestor states without
+// flattening them into a shared disk.
+func (pl *pathLayers) release(root common.Hash) {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	layer := pl.layers[root]
+	if layer == nil {
+		return
+	}
+	if layer.refs--; layer.refs > 0 {
+		return
+	}
+	for _, child := range pl.layers {
+		if child.parent != layer {
+			continue
+		}
+		for key, n := range layer.nodes {
+			if _, ok := child.nodes[key]; ok {
+				continue
+			}
+			child.nodes[key] = n
+			child.size += common.StorageSize(len(n.path) + len(n.blob) + common.HashLength)
+			if len(n.blob) != 0 {
+				pl.index[n.hash].refs++
+			}
+		}
+		child.parent = layer.parent
+	}
+	pl.dereference(layer)
+	delete(pl.layers, root)
+}
+
+// size returns the memory used by the diff layers and the pending nodes.
+func (pl *pathLayers) size() common.StorageSize {
+	pl.lock.RLock()
+	defer pl.lock.RUnlock()
+
+	var size common.StorageSize
+	for _, l := range pl.layers {
+		size += l.size
+	}
+	for _, n := range pl.pending {
+		size += common.StorageSize(len(n.path) + len(n.blob) + common.HashLength)
+	}
+	return size
+}
+
+// recoverable reports whether the persisted state can be rolled back to the
+// given root with the available reverse diffs.
+func (pl *pathLayers) recoverable(root common.Hash) bool {
+	_, err := pl.reverseDiffs(root)
+	return err == nil
+}
+
+// reverseDiffs collects the reverse diffs needed to roll the persisted state
+// back to the given root, newest first.
+func (pl *pathLayers) reverseDiffs(root common.Hash) ([]*reverseDiff, error) {
+	var (
+		diffs   []*reverseDiff
+		current = pl.diskRoot()
+	)
+	for id := rawdb.ReadReverseDiffHead(pl.diskdb); current != root; id-- {
+		blob := rawdb.ReadReverseDiff(pl.diskdb, id)
+		if id == 0 || len(blob) == 0 {
+			return nil, errStateUnrecoverable
+		}
+		diff := new(reverseDiff)
+		if err := rlp.DecodeBytes(blob, diff); err != nil {
+			return nil, err
+		}
+		if diff.Root != current {
+			return nil, errStateUnrecoverable
+		}
+		diffs = append(diffs, diff)
+		current = diff.Parent
+	}
+	return diffs, nil
+}
+
+// recover rolls the persisted state back to the given root by applying the
+// reverse diffs. All in-memory diff layers are discarded, since they are not
+// built on top of the recovered state.
+func (pl *pathLayers) recover(root common.Hash) error {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+
+	diffs, err := pl.reverseDiffs(root)
+	if err != nil {
+		return err
+	}
+	head := rawdb.ReadReverseDiffHead(pl.diskdb)
+	for _, diff := range diffs {
+		batch := pl.diskdb.NewBatch()
+		for _, n := range diff.Nodes {
+			rawdb.WriteTrieNodeByPath(batch, n.Owner, n.Path, n.Blob)
+		}
+		rawdb.DeleteReverseDiff(batch, head)
+		head--
+		rawdb.WriteReverseDiffHead(batch, head)
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		for _, n := range diff.Nodes {
+			pl.cleanNode(n.Owner, n.Path, crypto.Keccak256Hash(n.Blob), n.Blob)
+		}
+	}
+	pl.layers = make(map[common.Hash]*pathDiffLayer)
+	pl.index = make(map[common.Hash]*indexedNode)
+	pl.pending = make(map[string]*pathNode)
+
+	log.Info("Rolled back persisted state", "root", root, "diffs", len(diffs))
+	return nil
+}
+
+// Update binds the trie nodes committed since the last update into a diff
+// layer, transitioning the state from parent to root. It's a noop in the
+// hash-based scheme, where the committed nodes are reference counted instead.
+func (db *Database) Update(root common.Hash, parent common.Hash) error {
+	if db.layers == nil {
+		return nil
+	}
+	return db.layers.update(root, parent)
+}
+
+// CapLayers flattens the diff layers below the given root into the disk,
+// keeping at most the given number of layers in memory. It's a noop in the
+// hash-based scheme.
+func (db *Database) CapLayers(root common.Hash, layers int) error {
+	if db.layers == nil {
+		return nil
+	}
+	db.lock.RLock()
+	flushPreimages := db.preimagesSize > 4*1024*1024
+	db.lock.RUnlock()
+
+	if flushPreimages {
+		if err := db.flushPreimages(); err != nil {
+			return err
+		}
+	}
+	return db.layers.cap(root, layers)
+}
+
+// Recoverable reports whether the persisted state can be rolled back to the
+// given root. It's always false in the hash-based scheme.
+func (db *Database) Recoverable(root common.Hash) bool {
+	if db.layers == nil {
+		return false
+	}
+	return db.layers.recoverable(root)
+}
+
+// Recover rolls the persisted state back to the given root, discarding all
+// the in-memory diff layers.
+func (db *Database) Recover(root common.Hash) error {
+	if db.layers == nil {
+		return errors.New("state recovery is not supported by hash scheme")
+	}
+	return db.layers.recover(root)
+}
+
+// commitLayers flattens all the diff layers up to the given root into the
+// disk along with the accumulated preimages.
+func (db *Database) commitLayers(root common.Hash, report bool) error {
+	start := time.Now()
+	if err := db.flushPreimages(); err != nil {
+		return err
+	}
+	if err := db.layers.cap(root, 0); err != nil {
+		log.Error("Failed to commit trie from trie database", "err", err)
+		return err
+	}
+	logger := log.Info
+	if !report {
+		logger = log.Debug
+	}
+	logger("Persisted trie from memory database", "root", root, "time", common.PrettyDuration(time.Since(start)))
+	return nil
+}
+
+// flushPreimages writes all the accumulated preimages into the disk.
+func (db *Database) flushPreimages() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if db.preimages == nil || len(db.preimages) == 0 {
+		return nil
+	}
+	batch := db.diskdb.NewBatch()
+	rawdb.WritePreimages(batch, db.preimages)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	db.preimages, db.preimagesSize = make(map[common.Hash][]byte), 0
+	return nil
+}
+
+// nodeBlob returns the RLP encoding of a collapsed trie node.
+func nodeBlob(n node) []byte {
+	return (&cachedNode{node: simplifyNode(n)}).rlp()
+}
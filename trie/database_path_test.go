@@ -0,0 +1,355 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/ethdb/memorydb"
+)
+
+// makePathStates creates a sequence of states on top of each other in a path
+// based trie database, returning the state roots and the content of each.
+func makePathStates(t *testing.T, db *Database, count int) ([]common.Hash, []map[string]string) {
+	var (
+		roots    []common.Hash
+		contents []map[string]string
+		parent   = emptyRoot
+		content  = make(map[string]string)
+	)
+	for i := 0; i < count; i++ {
+		tr, err := New(parent, db)
+		if err != nil {
+			t.Fatalf("state %d: failed to open parent: %v", i, err)
+		}
+		next := make(map[string]string)
+		for k, v := range content {
+			next[k] = v
+		}
+		for j := 0; j < 20; j++ {
+			key, val := fmt.Sprintf("key-%d", (i*7+j)%50), fmt.Sprintf("val-%d-%d", i, j)
+			if (i+j)%3 == 0 {
+				val = strings.Repeat(val, 8) // mix stored and embedded leaves
+			}
+			tr.Update([]byte(key), []byte(val))
+			next[key] = val
+		}
+		if i > 0 {
+			key := fmt.Sprintf("key-%d", (i*13)%50)
+			tr.Delete([]byte(key))
+			delete(next, key)
+		}
+		root, _, err := tr.Commit(nil)
+		if err != nil {
+			t.Fatalf("state %d: failed to commit: %v", i, err)
+		}
+		if err := db.Update(root, parent); err != nil {
+			t.Fatalf("state %d: failed to update: %v", i, err)
+		}
+		roots, contents = append(roots, root), append(contents, next)
+		parent, content = root, next
+	}
+	return roots, contents
+}
+
+// checkPathState checks that the state of the given root is accessible and
+// holds the expected content.
+func checkPathState(t *testing.T, db *Database, root common.Hash, content map[string]string) {
+	t.Helper()
+
+	tr, err := New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", root, err)
+	}
+	for k, v := range content {
+		have, err := tr.TryGet([]byte(k))
+		if err != nil {
+			t.Fatalf("state %x: failed to read %s: %v", root, k, err)
+		}
+		if !bytes.Equal(have, []byte(v)) {
+			t.Fatalf("state %x: value mismatch for %s: have %s, want %s", root, k, have, v)
+		}
+	}
+	it := NewIterator(tr.NodeIterator(nil))
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if it.Err != nil {
+		t.Fatalf("state %x: failed to iterate: %v", root, it.Err)
+	}
+	if count != len(content) {
+		t.Fatalf("state %x: item count mismatch: have %d, want %d", root, count, len(content))
+	}
+}
+
+// Tests that diff layers are flattened into the disk when capped and that only
+// the most recent states are retained.
+func TestPathDatabaseCap(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+
+	roots, contents := makePathStates(t, db, 10)
+	for i, root := range roots {
+		checkPathState(t, db, root, contents[i])
+	}
+	if err := db.CapLayers(roots[9], 3); err != nil {
+		t.Fatalf("failed to cap layers: %v", err)
+	}
+	if disk := db.layers.diskRoot(); disk != roots[6] {
+		t.Fatalf("disk root mismatch: have %x, want %x", disk, roots[6])
+	}
+	for i := 6; i < 10; i++ {
+		checkPathState(t, db, roots[i], contents[i])
+	}
+	if _, err := New(roots[5], db); err == nil {
+		t.Fatalf("flattened state is still accessible")
+	}
+	// Reopen the database, only the persisted state should be available
+	db = NewDatabase(diskdb)
+	if db.Scheme() != rawdb.HashScheme {
+		t.Fatalf("unmarked database opened with %s scheme", db.Scheme())
+	}
+	db = NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+	checkPathState(t, db, roots[6], contents[6])
+	if _, err := New(roots[7], db); err == nil {
+		t.Fatalf("in-memory state survived restart")
+	}
+}
+
+// Tests that the layers not built on top of the persisted state are dropped
+// when capping.
+func TestPathDatabaseCapSidechain(t *testing.T) {
+	db := NewDatabaseWithConfig(memorydb.New(), &Config{Scheme: rawdb.PathScheme})
+
+	roots, contents := makePathStates(t, db, 4)
+
+	// Fork off the second state
+	tr, _ := New(roots[1], db)
+	tr.Update([]byte("fork"), []byte("value"))
+	fork, _, _ := tr.Commit(nil)
+	if err := db.Update(fork, roots[1]); err != nil {
+		t.Fatalf("failed to update fork: %v", err)
+	}
+	if err := db.CapLayers(roots[3], 1); err != nil {
+		t.Fatalf("failed to cap layers: %v", err)
+	}
+	if _, err := New(fork, db); err == nil {
+		t.Fatalf("sidechain state is still accessible")
+	}
+	checkPathState(t, db, roots[2], contents[2])
+	checkPathState(t, db, roots[3], contents[3])
+
+	// Building on top of a missing state must fail
+	if err := db.Update(common.Hash{0x01}, fork); err == nil {
+		t.Fatalf("update on top of missing state succeeded")
+	}
+}
+
+// Tests that the persisted state can be rolled back with the reverse diffs.
+func TestPathDatabaseRecover(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+
+	roots, contents := makePathStates(t, db, 10)
+	if err := db.Commit(roots[9], false, nil); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if size, _ := db.Size(); size != 0 {
+		t.Fatalf("dangling diff layers after commit: %v", size)
+	}
+	if db.Recoverable(common.Hash{0x01}) {
+		t.Fatalf("unknown state reported recoverable")
+	}
+	for _, i := range []int{7, 3, 0} {
+		if !db.Recoverable(roots[i]) {
+			t.Fatalf("state %d not recoverable", i)
+		}
+		if err := db.Recover(roots[i]); err != nil {
+			t.Fatalf("failed to recover state %d: %v", i, err)
+		}
+		checkPathState(t, db, roots[i], contents[i])
+		if db.Recoverable(roots[i+1]) {
+			t.Fatalf("state %d recoverable after rollback", i+1)
+		}
+	}
+	if err := db.Recover(emptyRoot); err != nil {
+		t.Fatalf("failed to recover empty state: %v", err)
+	}
+	if disk := db.layers.diskRoot(); disk != emptyRoot {
+		t.Fatalf("disk root mismatch: have %x, want %x", disk, emptyRoot)
+	}
+	if head := rawdb.ReadReverseDiffHead(diskdb); head != 0 {
+		t.Fatalf("reverse diff head mismatch: have %d, want 0", head)
+	}
+	// The rolled back state can be moved forward again
+	redo, redoContents := makePathStates(t, db, 3)
+	if err := db.Commit(redo[2], false, nil); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	checkPathState(t, db, redo[2], redoContents[2])
+}
+
+// checkPathNodes checks that the account trie nodes persisted in the disk are
+// exactly the ones referenced by the trie of the given root.
+func checkPathNodes(t *testing.T, db *Database, diskdb *memorydb.Database, root common.Hash) {
+	t.Helper()
+
+	want := make(map[string]bool)
+	if root != emptyRoot {
+		tr, err := New(root, db)
+		if err != nil {
+			t.Fatalf("failed to open state %x: %v", root, err)
+		}
+		it := tr.NodeIterator(nil)
+		for it.Next(true) {
+			if it.Hash() != (common.Hash{}) {
+				want[string(it.Path())] = true
+			}
+		}
+		if it.Error() != nil {
+			t.Fatalf("state %x: failed to iterate: %v", root, it.Error())
+		}
+	}
+	it := diskdb.NewIterator(rawdb.TrieNodeAccountPrefix, nil)
+	defer it.Release()
+
+	have := 0
+	for it.Next() {
+		path := string(it.Key()[len(rawdb.TrieNodeAccountPrefix):])
+		if !want[path] {
+			t.Fatalf("state %x: dangling node at path %x", root, path)
+		}
+		have++
+	}
+	if have != len(want) {
+		t.Fatalf("state %x: node count mismatch: have %d, want %d", root, have, len(want))
+	}
+}
+
+// Tests that the nodes dropping out of the trie are deleted from the disk when
+// the layers are flattened, and restored again by rolling the state back.
+func TestPathDatabaseDeletion(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+
+	roots, contents := makePathStates(t, db, 10)
+	for i := 0; i < len(roots); i++ {
+		if err := db.CapLayers(roots[len(roots)-1], len(roots)-1-i); err != nil {
+			t.Fatalf("failed to cap layers: %v", err)
+		}
+		checkPathNodes(t, db, diskdb, roots[i])
+	}
+	for _, i := range []int{6, 2} {
+		if err := db.Recover(roots[i]); err != nil {
+			t.Fatalf("failed to recover state %d: %v", i, err)
+		}
+		checkPathState(t, db, roots[i], contents[i])
+		checkPathNodes(t, db, diskdb, roots[i])
+	}
+	// Delete everything, no node may be left in the disk
+	tr, _ := New(roots[2], db)
+	for k := range contents[2] {
+		tr.Delete([]byte(k))
+	}
+	root, _, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	if root != emptyRoot {
+		t.Fatalf("root mismatch: have %x, want %x", root, emptyRoot)
+	}
+	if err := db.Update(root, roots[2]); err != nil {
+		t.Fatalf("failed to update: %v", err)
+	}
+	if err := db.Commit(root, false, nil); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	checkPathNodes(t, db, diskdb, emptyRoot)
+
+	if err := db.Recover(roots[2]); err != nil {
+		t.Fatalf("failed to recover state: %v", err)
+	}
+	checkPathState(t, db, roots[2], contents[2])
+	checkPathNodes(t, db, diskdb, roots[2])
+}
+
+// Tests that dereferenced states are merged into their children, freeing the
+// overwritten nodes without flattening anything into the disk.
+func TestPathDatabaseDereference(t *testing.T) {
+	diskdb := memorydb.New()
+	db := NewDatabaseWithConfig(diskdb, &Config{Scheme: rawdb.PathScheme})
+
+	roots, contents := makePathStates(t, db, 10)
+	for _, root := range roots {
+		db.Reference(root, common.Hash{})
+	}
+	// Fork off a state in the middle, its parent must stay readable for it
+	tr, _ := New(roots[4], db)
+	tr.Update([]byte("fork"), []byte("value"))
+	fork, _, _ := tr.Commit(nil)
+	if err := db.Update(fork, roots[4]); err != nil {
+		t.Fatalf("failed to update fork: %v", err)
+	}
+	forkContent := map[string]string{"fork": "value"}
+	for k, v := range contents[4] {
+		forkContent[k] = v
+	}
+	// Release the states one by one, like a reexecution advancing
+	var (
+		entries = diskdb.Len()
+		size, _ = db.Size()
+	)
+	db.Reference(roots[3], common.Hash{}) // held twice, survives one release
+	for i := 0; i < len(roots)-1; i++ {
+		db.Dereference(roots[i])
+		for j := i + 1; j < len(roots); j++ {
+			checkPathState(t, db, roots[j], contents[j])
+		}
+		checkPathState(t, db, fork, forkContent)
+	}
+	checkPathState(t, db, roots[3], contents[3])
+	db.Dereference(roots[3])
+
+	for i := 0; i < len(roots)-1; i++ {
+		if _, err := New(roots[i], db); err == nil {
+			t.Fatalf("dereferenced state %d is still accessible", i)
+		}
+	}
+	if have := len(db.layers.layers); have != 2 {
+		t.Fatalf("layer count mismatch: have %d, want %d", have, 2)
+	}
+	if shrunk, _ := db.Size(); shrunk >= size {
+		t.Fatalf("memory not freed: have %v, had %v", shrunk, size)
+	}
+	if diskdb.Len() != entries {
+		t.Fatalf("disk modified: have %d entries, want %d", diskdb.Len(), entries)
+	}
+	checkPathState(t, db, roots[9], contents[9])
+	checkPathState(t, db, fork, forkContent)
+
+	// The merged layers must still flatten into the correct state
+	if err := db.Commit(roots[9], false, nil); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	checkPathNodes(t, db, diskdb, roots[9])
+}
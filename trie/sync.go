@@ -17,6 +17,7 @@
 package trie
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 
@@ -48,6 +49,7 @@ type request struct {
 
 	parents []*request // Parent state nodes referencing this entry (notify all upon completion)
 	deps    int        // Number of dependencies before allowed to commit this node
+	fetched bool       // Whether the request was handed out for retrieval
 
 	callback LeafCallback // Callback to invoke if a leaf node it reached on this branch
 }
@@ -94,22 +96,24 @@ type SyncResult struct {
 // syncMemBatch is an in-memory buffer of successfully downloaded but not yet
 // persisted data items.
 type syncMemBatch struct {
-	nodes map[common.Hash][]byte // In-memory membatch of recently completed nodes
-	codes map[common.Hash][]byte // In-memory membatch of recently completed codes
+	nodes  map[string][]byte      // In-memory membatch of recently completed nodes
+	hashes map[string]common.Hash // Hashes of recently completed nodes
+	codes  map[common.Hash][]byte // In-memory membatch of recently completed codes
 }
 
 // newSyncMemBatch allocates a new memory-buffer for not-yet persisted trie nodes.
 func newSyncMemBatch() *syncMemBatch {
 	return &syncMemBatch{
-		nodes: make(map[common.Hash][]byte),
-		codes: make(map[common.Hash][]byte),
+		nodes:  make(map[string][]byte),
+		hashes: make(map[string]common.Hash),
+		codes:  make(map[common.Hash][]byte),
 	}
 }
 
-// hasNode reports the trie node with specific hash is already cached.
-func (batch *syncMemBatch) hasNode(hash common.Hash) bool {
-	_, ok := batch.nodes[hash]
-	return ok
+// hasNode reports the trie node with specific key and hash is already cached.
+func (batch *syncMemBatch) hasNode(key string, hash common.Hash) bool {
+	h, ok := batch.hashes[key]
+	return ok && h == hash
 }
 
 // hasCode reports the contract code with specific hash is already cached.
@@ -121,24 +125,35 @@ func (batch *syncMemBatch) hasCode(hash common.Hash) bool {
 // Sync is the main state trie synchronisation scheduler, which provides yet
 // unknown trie hashes to retrieve, accepts node data associated with said hashes
 // and reconstructs the trie step by step until all is done.
+//
+// The trie nodes are either stored keyed by hash or by path, depending on the
+// state scheme recorded in the database.
 type Sync struct {
-	database ethdb.KeyValueReader     // Persistent database to check for existing entries
-	membatch *syncMemBatch            // Memory buffer to avoid frequent database writes
-	nodeReqs map[common.Hash]*request // Pending requests pertaining to a trie node hash
-	codeReqs map[common.Hash]*request // Pending requests pertaining to a code hash
-	queue    *prque.Prque             // Priority queue with the pending requests
-	fetches  map[int]int              // Number of active fetches per trie node depth
+	scheme     string                     // Node storage scheme used by the database
+	database   ethdb.KeyValueReader       // Persistent database to check for existing entries
+	membatch   *syncMemBatch              // Memory buffer to avoid frequent database writes
+	nodeReqs   map[string]*request        // Pending requests pertaining to a trie node, keyed by hash or path
+	nodeHashes map[common.Hash][]*request // Pending requests pertaining to a trie node hash
+	codeReqs   map[common.Hash]*request   // Pending requests pertaining to a code hash
+	queue      *prque.Prque               // Priority queue with the pending requests
+	fetches    map[int]int                // Number of active fetches per trie node depth
 }
 
 // NewSync creates a new trie data download scheduler.
 func NewSync(root common.Hash, database ethdb.KeyValueReader, callback LeafCallback) *Sync {
+	scheme := rawdb.ReadStateScheme(database)
+	if scheme != rawdb.PathScheme {
+		scheme = rawdb.HashScheme
+	}
 	ts := &Sync{
-		database: database,
-		membatch: newSyncMemBatch(),
-		nodeReqs: make(map[common.Hash]*request),
-		codeReqs: make(map[common.Hash]*request),
-		queue:    prque.New(nil),
-		fetches:  make(map[int]int),
+		scheme:     scheme,
+		database:   database,
+		membatch:   newSyncMemBatch(),
+		nodeReqs:   make(map[string]*request),
+		nodeHashes: make(map[common.Hash][]*request),
+		codeReqs:   make(map[common.Hash]*request),
+		queue:      prque.New(nil),
+		fetches:    make(map[int]int),
 	}
 	ts.AddSubTrie(root, nil, common.Hash{}, callback)
 	return ts
@@ -150,13 +165,12 @@ func (s *Sync) AddSubTrie(root common.Hash, path []byte, parent common.Hash, cal
 	if root == emptyRoot {
 		return
 	}
-	if s.membatch.hasNode(root) {
+	if s.membatch.hasNode(s.nodeKey(path, root), root) {
 		return
 	}
 	// If database says this is a duplicate, then at least the trie node is
 	// present, and we hold the assumption that it's NOT legacy contract code.
-	blob := rawdb.ReadTrieNode(s.database, root)
-	if len(blob) > 0 {
+	if s.hasNode(path, root) {
 		return
 	}
 	// Assemble the new sub-trie sync request
@@ -167,7 +181,7 @@ func (s *Sync) AddSubTrie(root common.Hash, path []byte, parent common.Hash, cal
 	}
 	// If this sub-trie has a designated parent, link them together
 	if parent != (common.Hash{}) {
-		ancestor := s.nodeReqs[parent]
+		ancestor := s.ancestor(parent, path)
 		if ancestor == nil {
 			panic(fmt.Sprintf("sub-trie ancestor not found: %x", parent))
 		}
@@ -204,7 +218,7 @@ func (s *Sync) AddCodeEntry(hash common.Hash, path []byte, parent common.Hash) {
 	}
 	// If this sub-trie has a designated parent, link them together
 	if parent != (common.Hash{}) {
-		ancestor := s.nodeReqs[parent] // the parent of codereq can ONLY be nodereq
+		ancestor := s.ancestor(parent, path) // the parent of codereq can ONLY be nodereq
 		if ancestor == nil {
 			panic(fmt.Sprintf("raw-entry ancestor not found: %x", parent))
 		}
@@ -232,16 +246,21 @@ func (s *Sync) Missing(max int) (nodes []common.Hash, paths []SyncPath, codes []
 		if s.fetches[depth] > maxFetchesPerDepth {
 			break
 		}
-		// Item is allowed to be scheduled, add it to the task list
+		// Item is allowed to be scheduled, add it to the task list. Skip
+		// the nodes already delivered along with a same-hash request.
 		s.queue.Pop()
+		req := item.(*request)
+		if req.data != nil {
+			continue
+		}
 		s.fetches[depth]++
+		req.fetched = true
 
-		hash := item.(common.Hash)
-		if req, ok := s.nodeReqs[hash]; ok {
-			nodeHashes = append(nodeHashes, hash)
-			nodePaths = append(nodePaths, newSyncPath(req.path))
+		if req.code {
+			codeHashes = append(codeHashes, req.hash)
 		} else {
-			codeHashes = append(codeHashes, hash)
+			nodeHashes = append(nodeHashes, req.hash)
+			nodePaths = append(nodePaths, newSyncPath(req.path))
 		}
 	}
 	return nodeHashes, nodePaths, codeHashes
@@ -255,7 +274,7 @@ func (s *Sync) Missing(max int) (nodes []common.Hash, paths []SyncPath, codes []
 // there is no downside.
 func (s *Sync) Process(result SyncResult) error {
 	// If the item was not requested either for code or node, bail out
-	if s.nodeReqs[result.Hash] == nil && s.codeReqs[result.Hash] == nil {
+	if len(s.nodeHashes[result.Hash]) == 0 && s.codeReqs[result.Hash] == nil {
 		return ErrNotRequested
 	}
 	// There is an pending code request for this data, commit directly
@@ -265,8 +284,12 @@ func (s *Sync) Process(result SyncResult) error {
 		req.data = result.Data
 		s.commit(req)
 	}
-	// There is an pending node request for this data, fill it.
-	if req := s.nodeReqs[result.Hash]; req != nil && req.data == nil {
+	// There are pending node requests for this data, fill them. In the
+	// path-based scheme the same node might be requested at multiple paths.
+	for _, req := range append([]*request(nil), s.nodeHashes[result.Hash]...) {
+		if req.data != nil {
+			continue
+		}
 		filled = true
 		// Decode the node data content and update the request
 		node, err := decodeNode(result.Hash[:], result.Data)
@@ -300,7 +323,12 @@ func (s *Sync) Process(result SyncResult) error {
 func (s *Sync) Commit(dbw ethdb.Batch) error {
 	// Dump the membatch into a database dbw
 	for key, value := range s.membatch.nodes {
-		rawdb.WriteTrieNode(dbw, key, value)
+		if s.scheme == rawdb.PathScheme {
+			owner, path := splitSyncPath([]byte(key))
+			rawdb.WriteTrieNodeByPath(dbw, owner, path, value)
+		} else {
+			rawdb.WriteTrieNode(dbw, common.BytesToHash([]byte(key)), value)
+		}
 	}
 	for key, value := range s.membatch.codes {
 		rawdb.WriteCode(dbw, key, value)
@@ -319,16 +347,22 @@ func (s *Sync) Pending() int {
 // is already a pending request for this node, the new request will be discarded
 // and only a parent reference added to the old one.
 func (s *Sync) schedule(req *request) {
-	var reqset = s.nodeReqs
-	if req.code {
-		reqset = s.codeReqs
-	}
 	// If we're already requesting this node, add a new reference and stop
-	if old, ok := reqset[req.hash]; ok {
-		old.parents = append(old.parents, req.parents...)
-		return
+	if req.code {
+		if old, ok := s.codeReqs[req.hash]; ok {
+			old.parents = append(old.parents, req.parents...)
+			return
+		}
+		s.codeReqs[req.hash] = req
+	} else {
+		key := s.nodeKey(req.path, req.hash)
+		if old, ok := s.nodeReqs[key]; ok {
+			old.parents = append(old.parents, req.parents...)
+			return
+		}
+		s.nodeReqs[key] = req
+		s.nodeHashes[req.hash] = append(s.nodeHashes[req.hash], req)
 	}
-	reqset[req.hash] = req
 
 	// Schedule the request for future retrieval. This queue is shared
 	// by both node requests and code requests. It can happen that there
@@ -339,7 +373,7 @@ func (s *Sync) schedule(req *request) {
 	for i := 0; i < 14 && i < len(req.path); i++ {
 		prio |= int64(15-req.path[i]) << (52 - i*4) // 15-nibble => lexicographic order
 	}
-	s.queue.Push(req.hash, prio)
+	s.queue.Push(req, prio)
 }
 
 // children retrieves all the missing children of a state trie entry for future
@@ -396,12 +430,12 @@ func (s *Sync) children(req *request, object node) ([]*request, error) {
 		if node, ok := (child.node).(hashNode); ok {
 			// Try to resolve the node from the local database
 			hash := common.BytesToHash(node)
-			if s.membatch.hasNode(hash) {
+			if s.membatch.hasNode(s.nodeKey(child.path, hash), hash) {
 				continue
 			}
 			// If database says duplicate, then at least the trie node is present
 			// and we hold the assumption that it's NOT legacy contract code.
-			if blob := rawdb.ReadTrieNode(s.database, hash); len(blob) > 0 {
+			if s.hasNode(child.path, hash) {
 				continue
 			}
 			// Locally unknown node, schedule for retrieval
@@ -424,10 +458,14 @@ func (s *Sync) commit(req *request) (err error) {
 	if req.code {
 		s.membatch.codes[req.hash] = req.data
 		delete(s.codeReqs, req.hash)
-		s.fetches[len(req.path)]--
 	} else {
-		s.membatch.nodes[req.hash] = req.data
-		delete(s.nodeReqs, req.hash)
+		key := s.nodeKey(req.path, req.hash)
+		s.membatch.nodes[key] = req.data
+		s.membatch.hashes[key] = req.hash
+		delete(s.nodeReqs, key)
+		s.dropNodeHash(req)
+	}
+	if req.fetched {
 		s.fetches[len(req.path)]--
 	}
 	// Check all parents for completion
@@ -441,3 +479,62 @@ func (s *Sync) commit(req *request) (err error) {
 	}
 	return nil
 }
+
+// nodeKey returns the key of a trie node request, which is the node hash in
+// the hash-based scheme or the node path in the path-based scheme.
+func (s *Sync) nodeKey(path []byte, hash common.Hash) string {
+	if s.scheme == rawdb.PathScheme {
+		return string(path)
+	}
+	return string(hash.Bytes())
+}
+
+// hasNode reports whether the trie node with the given path and hash is
+// already present in the database.
+func (s *Sync) hasNode(path []byte, hash common.Hash) bool {
+	if s.scheme == rawdb.PathScheme {
+		owner, inner := splitSyncPath(path)
+		if owner == (common.Hash{}) {
+			return rawdb.HasAccountTrieNode(s.database, inner, hash)
+		}
+		return rawdb.HasStorageTrieNode(s.database, owner, inner, hash)
+	}
+	return len(rawdb.ReadTrieNode(s.database, hash)) > 0
+}
+
+// ancestor returns the pending node request with the given hash which is the
+// parent of the given path.
+func (s *Sync) ancestor(hash common.Hash, path []byte) *request {
+	for _, req := range s.nodeHashes[hash] {
+		if bytes.HasPrefix(path, req.path) {
+			return req
+		}
+	}
+	return nil
+}
+
+// dropNodeHash removes a completed request from the hash grouped requests.
+func (s *Sync) dropNodeHash(req *request) {
+	reqs := s.nodeHashes[req.hash]
+	for i, r := range reqs {
+		if r == req {
+			reqs = append(reqs[:i], reqs[i+1:]...)
+			break
+		}
+	}
+	if len(reqs) == 0 {
+		delete(s.nodeHashes, req.hash)
+	} else {
+		s.nodeHashes[req.hash] = reqs
+	}
+}
+
+// splitSyncPath splits a composite hex path into the owner of the trie and the
+// node path inside it. Paths shorter than an account key belong to the account
+// trie, which is owned by the zero hash.
+func splitSyncPath(path []byte) (common.Hash, []byte) {
+	if len(path) < 2*common.HashLength {
+		return common.Hash{}, path
+	}
+	return common.BytesToHash(hexToKeybytes(path[:2*common.HashLength])), path[2*common.HashLength:]
+}
@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethdb/memorydb"
 )
@@ -104,18 +105,28 @@ func TestEmptySync(t *testing.T) {
 
 // Tests that given a root hash, a trie can sync iteratively on a single thread,
 // requesting retrieval tasks and returning all of them in one go.
-func TestIterativeSyncIndividual(t *testing.T)       { testIterativeSync(t, 1, false) }
-func TestIterativeSyncBatched(t *testing.T)          { testIterativeSync(t, 100, false) }
-func TestIterativeSyncIndividualByPath(t *testing.T) { testIterativeSync(t, 1, true) }
-func TestIterativeSyncBatchedByPath(t *testing.T)    { testIterativeSync(t, 100, true) }
+func TestIterativeSyncIndividual(t *testing.T)       { testIterativeSync(t, 1, false, rawdb.HashScheme) }
+func TestIterativeSyncBatched(t *testing.T)          { testIterativeSync(t, 100, false, rawdb.HashScheme) }
+func TestIterativeSyncIndividualByPath(t *testing.T) { testIterativeSync(t, 1, true, rawdb.HashScheme) }
+func TestIterativeSyncBatchedByPath(t *testing.T)    { testIterativeSync(t, 100, true, rawdb.HashScheme) }
+
+// Tests that a trie can be synced into a database using the path-based scheme.
+func TestIterativeSyncPathScheme(t *testing.T) {
+	testIterativeSync(t, 1, false, rawdb.PathScheme)
+}
+
+func TestIterativeSyncBatchedPathScheme(t *testing.T) {
+	testIterativeSync(t, 100, true, rawdb.PathScheme)
+}
 
-func testIterativeSync(t *testing.T, count int, bypath bool) {
+func testIterativeSync(t *testing.T, count int, bypath bool, scheme string) {
 	// Create a random trie to copy
 	srcDb, srcTrie, srcData := makeTestTrie()
 
 	// Create a destination trie and sync with the scheduler
 	diskdb := memorydb.New()
-	triedb := NewDatabase(diskdb)
+	rawdb.WriteStateScheme(diskdb, scheme)
+	triedb := NewDatabaseWithConfig(diskdb, &Config{Scheme: scheme})
 	sched := NewSync(srcTrie.Hash(), diskdb, nil)
 
 	nodes, paths, codes := sched.Missing(count)
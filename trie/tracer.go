@@ -0,0 +1,102 @@
+// Copyright 2022 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package trie
+
+// tracer tracks the paths of the trie nodes loaded from the database and of
+// the nodes removed from the trie since the last commit. In the path-based
+// scheme nodes are keyed by their paths, so the removed ones are not replaced
+// by anything and have to be deleted explicitly.
+//
+// A nil tracer is valid and tracks nothing, which is used in the hash-based
+// scheme.
+type tracer struct {
+	loaded  map[string]struct{} // Paths of the nodes resolved from the database
+	deletes map[string]struct{} // Paths of the nodes removed from the trie
+}
+
+// newTracer creates an empty tracer.
+func newTracer() *tracer {
+	return &tracer{
+		loaded:  make(map[string]struct{}),
+		deletes: make(map[string]struct{}),
+	}
+}
+
+// onLoad records a node resolved from the database at the given path.
+func (t *tracer) onLoad(path []byte) {
+	if t == nil {
+		return
+	}
+	t.loaded[string(path)] = struct{}{}
+}
+
+// onDelete records a node removed from the trie at the given path.
+func (t *tracer) onDelete(path []byte) {
+	if t == nil {
+		return
+	}
+	t.deletes[string(path)] = struct{}{}
+}
+
+// exists reports whether a node was loaded from the database at the given
+// path, in other words whether the database holds a node there.
+func (t *tracer) exists(path []byte) bool {
+	if t == nil {
+		return false
+	}
+	_, ok := t.loaded[string(path)]
+	return ok
+}
+
+// deleted returns the paths of the removed nodes which are present in the
+// database. Nodes created and removed since the last commit are skipped.
+func (t *tracer) deleted() [][]byte {
+	if t == nil {
+		return nil
+	}
+	var paths [][]byte
+	for path := range t.deletes {
+		if _, ok := t.loaded[path]; ok {
+			paths = append(paths, []byte(path))
+		}
+	}
+	return paths
+}
+
+// reset clears all the tracked paths.
+func (t *tracer) reset() {
+	if t == nil {
+		return
+	}
+	t.loaded = make(map[string]struct{})
+	t.deletes = make(map[string]struct{})
+}
+
+// copy returns a deep copy of the tracer.
+func (t *tracer) copy() *tracer {
+	if t == nil {
+		return nil
+	}
+	cpy := newTracer()
+	for path := range t.loaded {
+		cpy.loaded[path] = struct{}{}
+	}
+	for path := range t.deletes {
+		cpy.deletes[path] = struct{}{}
+	}
+	return cpy
+}